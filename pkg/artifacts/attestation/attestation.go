@@ -0,0 +1,216 @@
+package attestation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+var (
+	_ artifacts.OCI      = (*Attestation)(nil)
+	_ artifacts.Referrer = (*Attestation)(nil)
+)
+
+const (
+	// StatementType is the _type of in-toto v0.1 statements
+	StatementType = "https://in-toto.io/Statement/v0.1"
+
+	// SLSAProvenancePredicateType is the predicateType of SLSA v0.2 provenance
+	SLSAProvenancePredicateType = "https://slsa.dev/provenance/v0.2"
+
+	// BuilderID and FileBuildType are the builder and build type of provenance generated by NewProvenance
+	BuilderID     = "https://github.com/rancherfederal/ocil"
+	FileBuildType = "https://github.com/rancherfederal/ocil/file@v1"
+)
+
+// ErrInvalidStatement is returned for documents that aren't in-toto statements
+var ErrInvalidStatement = errors.New("invalid in-toto statement")
+
+// Statement is an in-toto statement, making a typed claim (the predicate) about its subjects
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []Subject       `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate,omitempty"`
+}
+
+// Subject is an artifact a Statement is about, identified by its digests (ie: {"sha256": "..."})
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance is a SLSA v0.2 provenance predicate, with just what ocil knows of the builds it does itself
+type Provenance struct {
+	Builder   Builder    `json:"builder"`
+	BuildType string     `json:"buildType"`
+	Metadata  *Metadata  `json:"metadata,omitempty"`
+	Materials []Material `json:"materials,omitempty"`
+}
+
+type Builder struct {
+	ID string `json:"id"`
+}
+
+type Metadata struct {
+	BuildStartedOn  *time.Time `json:"buildStartedOn,omitempty"`
+	BuildFinishedOn *time.Time `json:"buildFinishedOn,omitempty"`
+}
+
+// Material is an input of a build, ie: the url a file was fetched from
+type Material struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// Attestation implements the OCI interface for an in-toto statement, optionally referring to the image it is about
+type Attestation struct {
+	data          []byte
+	predicateType string
+	subject       *v1.Descriptor
+	annotations   map[string]string
+}
+
+type attestationConfig struct {
+	PredicateType string `json:"predicateType,omitempty"`
+}
+
+func NewAttestation(data []byte, opts ...Option) (*Attestation, error) {
+	var s Statement
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidStatement, err)
+	}
+	if !strings.HasPrefix(s.Type, "https://in-toto.io/Statement/") || s.PredicateType == "" || len(s.Subject) == 0 {
+		return nil, ErrInvalidStatement
+	}
+
+	a := &Attestation{data: data, predicateType: s.PredicateType}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a, nil
+}
+
+// NewProvenance returns a SLSA provenance statement about every layer of oci, named by their title annotation (as
+// file artifacts are)
+// 	When oci knows its source, that is recorded as the build's only material.
+func NewProvenance(oci artifacts.OCI, opts ...ProvenanceOption) (*Statement, error) {
+	o := &provenanceOptions{
+		builderID: BuilderID,
+		buildType: FileBuildType,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	m, err := oci.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var subjects []Subject
+	for _, l := range m.Layers {
+		name := l.Annotations[ocispec.AnnotationTitle]
+		if name == "" {
+			name = l.Digest.String()
+		}
+		subjects = append(subjects, Subject{
+			Name:   name,
+			Digest: map[string]string{l.Digest.Algorithm: l.Digest.Hex},
+		})
+	}
+
+	p := Provenance{
+		Builder:   Builder{ID: o.builderID},
+		BuildType: o.buildType,
+	}
+	if !o.started.IsZero() || !o.finished.IsZero() {
+		p.Metadata = &Metadata{}
+		if !o.started.IsZero() {
+			started := o.started.UTC()
+			p.Metadata.BuildStartedOn = &started
+		}
+		if !o.finished.IsZero() {
+			finished := o.finished.UTC()
+			p.Metadata.BuildFinishedOn = &finished
+		}
+	}
+	if s, ok := oci.(artifacts.Sourced); ok && s.Source() != "" {
+		p.Materials = []Material{{URI: s.Source()}}
+	}
+
+	predicate, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{
+		Type:          StatementType,
+		Subject:       subjects,
+		PredicateType: SLSAProvenancePredicateType,
+		Predicate:     predicate,
+	}, nil
+}
+
+// PredicateType is the predicateType of the statement
+func (a *Attestation) PredicateType() string {
+	return a.predicateType
+}
+
+func (a *Attestation) MediaType() string {
+	return consts.OCIManifestSchema1
+}
+
+func (a *Attestation) Manifest() (*v1.Manifest, error) {
+	layer, err := partial.Descriptor(a.layer())
+	if err != nil {
+		return nil, err
+	}
+
+	cfgDesc, err := partial.Descriptor(a.config())
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.MediaType(a.MediaType()),
+		Config:        *cfgDesc,
+		Layers:        []v1.Descriptor{*layer},
+		Annotations:   a.annotations,
+	}, nil
+}
+
+func (a *Attestation) RawManifest() ([]byte, error) {
+	return artifacts.MarshalManifest(a)
+}
+
+func (a *Attestation) RawConfig() ([]byte, error) {
+	return a.config().Raw()
+}
+
+func (a *Attestation) Layers() ([]v1.Layer, error) {
+	return []v1.Layer{a.layer()}, nil
+}
+
+func (a *Attestation) Subject() *v1.Descriptor {
+	return a.subject
+}
+
+func (a *Attestation) layer() v1.Layer {
+	return static.NewLayer(a.data, types.MediaType(consts.InTotoMediaType))
+}
+
+func (a *Attestation) config() artifacts.Config {
+	return artifacts.ToConfig(attestationConfig{PredicateType: a.predicateType}, artifacts.WithConfigMediaType(consts.AttestationConfigMediaType))
+}
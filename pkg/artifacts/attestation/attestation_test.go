@@ -0,0 +1,114 @@
+package attestation_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/attestation"
+	"github.com/rancherfederal/ocil/pkg/artifacts/file"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+func TestNewAttestation(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "should accept a statement",
+			data: `{"_type": "https://in-toto.io/Statement/v0.1", "subject": [{"name": "a", "digest": {"sha256": "00"}}], "predicateType": "https://slsa.dev/provenance/v0.2"}`,
+			want: attestation.SLSAProvenancePredicateType,
+		},
+		{
+			name:    "should reject statements without subjects",
+			data:    `{"_type": "https://in-toto.io/Statement/v0.1", "predicateType": "https://slsa.dev/provenance/v0.2"}`,
+			wantErr: attestation.ErrInvalidStatement,
+		},
+		{
+			name:    "should reject other documents",
+			data:    `{"spdxVersion": "SPDX-2.3"}`,
+			wantErr: attestation.ErrInvalidStatement,
+		},
+		{
+			name:    "should reject non json",
+			data:    `not json`,
+			wantErr: attestation.ErrInvalidStatement,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := attestation.NewAttestation([]byte(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewAttestation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if a.PredicateType() != tt.want {
+				t.Errorf("PredicateType() = %s, want %s", a.PredicateType(), tt.want)
+			}
+			m, err := a.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Layers) != 1 || string(m.Layers[0].MediaType) != consts.InTotoMediaType {
+				t.Errorf("Manifest() layers = %+v, want a single %s layer", m.Layers, consts.InTotoMediaType)
+			}
+			if string(m.Config.MediaType) != consts.AttestationConfigMediaType {
+				t.Errorf("Manifest() config media type = %s, want %s", m.Config.MediaType, consts.AttestationConfigMediaType)
+			}
+		})
+	}
+}
+
+func TestNewProvenance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := file.NewFile(path)
+
+	started := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, err := attestation.NewProvenance(f, attestation.WithBuildTimes(started, started.Add(time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := f.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Subject) != 1 || s.Subject[0].Name != "notes.txt" || s.Subject[0].Digest["sha256"] != m.Layers[0].Digest.Hex {
+		t.Errorf("NewProvenance() subject = %+v, want notes.txt at %s", s.Subject, m.Layers[0].Digest)
+	}
+
+	var p attestation.Provenance
+	if err := json.Unmarshal(s.Predicate, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Builder.ID != attestation.BuilderID || p.BuildType != attestation.FileBuildType {
+		t.Errorf("NewProvenance() predicate = %+v, want ocil's builder and build type", p)
+	}
+	if len(p.Materials) != 1 || p.Materials[0].URI != path {
+		t.Errorf("NewProvenance() materials = %+v, want %s", p.Materials, path)
+	}
+	if p.Metadata == nil || p.Metadata.BuildStartedOn == nil || !p.Metadata.BuildStartedOn.Equal(started) {
+		t.Errorf("NewProvenance() metadata = %+v, want started on %s", p.Metadata, started)
+	}
+
+	// a generated statement is an attestation of its own
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := attestation.NewAttestation(data); err != nil {
+		t.Errorf("NewAttestation() of a generated provenance: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package attestation
+
+import (
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+type Option func(*Attestation)
+
+// WithSubject records the manifest the statement is about
+func WithSubject(subject v1.Descriptor) Option {
+	return func(a *Attestation) {
+		a.subject = &subject
+	}
+}
+
+func WithAnnotations(annotations map[string]string) Option {
+	return func(a *Attestation) {
+		a.annotations = annotations
+	}
+}
+
+type ProvenanceOption func(*provenanceOptions)
+
+type provenanceOptions struct {
+	builderID string
+	buildType string
+	started   time.Time
+	finished  time.Time
+}
+
+// WithBuilderID sets the id of the builder the provenance names, instead of ocil's own
+func WithBuilderID(id string) ProvenanceOption {
+	return func(o *provenanceOptions) {
+		o.builderID = id
+	}
+}
+
+// WithBuildType sets the build type the provenance names, instead of ocil's file build type
+func WithBuildType(buildType string) ProvenanceOption {
+	return func(o *provenanceOptions) {
+		o.buildType = buildType
+	}
+}
+
+// WithBuildTimes records when the build started and finished
+func WithBuildTimes(started, finished time.Time) ProvenanceOption {
+	return func(o *provenanceOptions) {
+		o.started = started
+		o.finished = finished
+	}
+}
@@ -0,0 +1,116 @@
+package chart
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// interface guard
+var _ artifacts.OCI = (*Chart)(nil)
+
+// ErrInvalidChart is returned for content that isn't a packaged helm chart, ie: missing a Chart.yaml
+var ErrInvalidChart = errors.New("invalid chart")
+
+// Metadata is the part of a charts Chart.yaml stored as the config of the chart, as helm does
+type Metadata struct {
+	APIVersion  string `json:"apiVersion" yaml:"apiVersion"`
+	Name        string `json:"name" yaml:"name"`
+	Version     string `json:"version" yaml:"version"`
+	AppVersion  string `json:"appVersion,omitempty" yaml:"appVersion,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Type        string `json:"type,omitempty" yaml:"type,omitempty"`
+}
+
+// Chart implements the OCI interface for a packaged helm chart (a .tgz), laid out as helm push would
+type Chart struct {
+	*memory.Memory
+
+	meta Metadata
+}
+
+type Option func(*options)
+
+type options struct {
+	annotations map[string]string
+}
+
+func WithAnnotations(m map[string]string) Option {
+	return func(o *options) {
+		o.annotations = m
+	}
+}
+
+// NewChart is the packaged chart data, whose Chart.yaml is read for its config
+func NewChart(data []byte, opts ...Option) (*Chart, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	meta, err := readMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Chart{
+		Memory: memory.NewMemory(data, consts.ChartLayerMediaType,
+			memory.WithConfig(meta, consts.ChartConfigMediaType),
+			memory.WithAnnotations(o.annotations)),
+		meta: *meta,
+	}, nil
+}
+
+// Metadata is what the charts Chart.yaml says of it
+func (c *Chart) Metadata() Metadata {
+	return c.meta
+}
+
+// Reference is the name and version of the chart, the reference helm pushes it under (ie: nginx:1.0.0)
+func (c *Chart) Reference() string {
+	return c.meta.Name + ":" + c.meta.Version
+}
+
+// readMetadata reads the Chart.yaml at the root of the packaged chart data
+func readMetadata(data []byte) (*Metadata, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChart, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: no Chart.yaml", ErrInvalidChart)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidChart, err)
+		}
+
+		// charts are packaged in a directory of their name, beneath which subcharts have Chart.yamls of their own
+		if dir, name := path.Split(path.Clean(hdr.Name)); name != "Chart.yaml" || path.Dir(path.Clean(dir)) != "." {
+			continue
+		}
+
+		var meta Metadata
+		if err := yaml.NewDecoder(tr).Decode(&meta); err != nil {
+			return nil, fmt.Errorf("%w: Chart.yaml: %v", ErrInvalidChart, err)
+		}
+		if meta.Name == "" || meta.Version == "" {
+			return nil, fmt.Errorf("%w: Chart.yaml has no name or version", ErrInvalidChart)
+		}
+		return &meta, nil
+	}
+}
@@ -0,0 +1,87 @@
+package chart_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/chart"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+func TestNewChart(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "should read the charts own Chart.yaml",
+			files: map[string]string{
+				"nginx/charts/common/Chart.yaml": "apiVersion: v2\nname: common\nversion: 2.0.0\n",
+				"nginx/Chart.yaml":               "apiVersion: v2\nname: nginx\nversion: 1.0.0\nappVersion: 1.21.0\n",
+			},
+			want: "nginx:1.0.0",
+		},
+		{
+			name:    "should reject charts without a Chart.yaml",
+			files:   map[string]string{"nginx/values.yaml": "image: nginx\n"},
+			wantErr: chart.ErrInvalidChart,
+		},
+		{
+			name:    "should reject charts without a version",
+			files:   map[string]string{"nginx/Chart.yaml": "apiVersion: v2\nname: nginx\n"},
+			wantErr: chart.ErrInvalidChart,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := chart.NewChart(packageChart(t, tt.files))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewChart() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := c.Reference(); got != tt.want {
+				t.Errorf("Reference() = %s, want %s", got, tt.want)
+			}
+
+			m, err := c.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mt := string(m.Config.MediaType); mt != consts.ChartConfigMediaType {
+				t.Errorf("config media type = %s, want %s", mt, consts.ChartConfigMediaType)
+			}
+			if mt := string(m.Layers[0].MediaType); mt != consts.ChartLayerMediaType {
+				t.Errorf("layer media type = %s, want %s", mt, consts.ChartLayerMediaType)
+			}
+		})
+	}
+}
+
+func packageChart(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,369 @@
+package file
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	gtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	orasfile "oras.land/oras-go/v2/content/file"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/layer"
+)
+
+// interface guard
+var _ artifacts.OCI = (*Directory)(nil)
+
+// Directory implements the OCI interface for an entire directory tree, packaged as a single reproducible tar+gzip layer
+// 	Entries are written in lexical order with normalized ownership, permissions and mtimes, so the same tree always
+// 	produces the same digest regardless of where, when or by whom it was checked out.  The layer is marked for
+// 	unpacking, and unpacks to a directory of the same name.  Ownership and permissions can be preserved or forced
+// 	instead, for trees extracted onto hosts expecting them.
+type Directory struct {
+	Path string
+
+	computed    bool
+	modTime     time.Time
+	ownership   ownership
+	modes       modes
+	config      artifacts.Config
+	blob        gv1.Layer
+	manifest    *gv1.Manifest
+	annotations map[string]string
+}
+
+type DirectoryOption func(*Directory)
+
+// ownership is how a Directory records the owner of its entries, root by default
+type ownership struct {
+	preserve bool
+	uid, gid int
+}
+
+// modes is how a Directory records the permissions of its entries, 0644 for files (0755 if executable) and 0755 for
+// directories by default
+type modes struct {
+	preserve  bool
+	file, dir os.FileMode
+}
+
+// WithModTime sets the mtime recorded for every entry, instead of the unix epoch
+func WithModTime(t time.Time) DirectoryOption {
+	return func(d *Directory) {
+		d.modTime = t
+	}
+}
+
+// WithPreservedOwnership records the uid and gid owning each entry, rather than root
+// 	Ownership is only known on unix, entries are owned by root on windows.
+func WithPreservedOwnership() DirectoryOption {
+	return func(d *Directory) {
+		d.ownership = ownership{preserve: true}
+	}
+}
+
+// WithOwnership records every entry as owned by uid and gid, rather than root
+func WithOwnership(uid, gid int) DirectoryOption {
+	return func(d *Directory) {
+		d.ownership = ownership{uid: uid, gid: gid}
+	}
+}
+
+// WithPreservedModes records the permissions of each entry, setuid, setgid and sticky bits included, rather than
+// normalizing them
+func WithPreservedModes() DirectoryOption {
+	return func(d *Directory) {
+		d.modes = modes{preserve: true}
+	}
+}
+
+// WithModes records the permissions of every file as file and of every directory as dir, rather than normalizing them
+// 	Either left at 0 is normalized as usual.
+func WithModes(file, dir os.FileMode) DirectoryOption {
+	return func(d *Directory) {
+		d.modes = modes{file: file, dir: dir}
+	}
+}
+
+func WithDirectoryAnnotations(m map[string]string) DirectoryOption {
+	return func(d *Directory) {
+		d.annotations = m
+	}
+}
+
+func NewDirectory(path string, opts ...DirectoryOption) *Directory {
+	d := &Directory{
+		Path:    path,
+		modTime: time.Unix(0, 0),
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Name is the name the directory unpacks to
+func (d *Directory) Name() string {
+	return filepath.Base(filepath.Clean(d.Path))
+}
+
+func (d *Directory) MediaType() string {
+	return consts.OCIManifestSchema1
+}
+
+func (d *Directory) RawConfig() ([]byte, error) {
+	if err := d.compute(); err != nil {
+		return nil, err
+	}
+	return d.config.Raw()
+}
+
+func (d *Directory) Layers() ([]gv1.Layer, error) {
+	if err := d.compute(); err != nil {
+		return nil, err
+	}
+	return []gv1.Layer{d.blob}, nil
+}
+
+func (d *Directory) Manifest() (*gv1.Manifest, error) {
+	if err := d.compute(); err != nil {
+		return nil, err
+	}
+	return d.manifest, nil
+}
+
+func (d *Directory) RawManifest() ([]byte, error) {
+	return artifacts.MarshalManifest(d)
+}
+
+func (d *Directory) compute() error {
+	if d.computed {
+		return nil
+	}
+
+	fi, err := os.Stat(d.Path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", d.Path)
+	}
+
+	// the archive is rebuilt every time it's opened rather than staged on disk, it's identical every time anyways
+	opener := func(archive func(io.Writer) error) layer.Opener {
+		return func() (io.ReadCloser, error) {
+			pr, pw := io.Pipe()
+			go func() {
+				pw.CloseWithError(archive(pw))
+			}()
+			return pr, nil
+		}
+	}
+
+	compressed, err := layer.FromOpener(opener(d.archive),
+		layer.WithMediaType(consts.OCILayer),
+		layer.WithAnnotations(map[string]string{
+			ocispec.AnnotationTitle:   d.Name(),
+			orasfile.AnnotationUnpack: "true",
+		}))
+	if err != nil {
+		return err
+	}
+
+	// the diffID is that of the tar the layer unpacks from, not of the blob
+	uncompressed := opener(d.tar)
+	rc, err := uncompressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	diffID, _, err := gv1.SHA256(rc)
+	if err != nil {
+		return err
+	}
+	blob := &directoryLayer{Layer: compressed, diffID: diffID, uncompressed: uncompressed}
+
+	ldesc, err := partial.Descriptor(blob)
+	if err != nil {
+		return err
+	}
+
+	cfg := artifacts.ToConfig(struct {
+		Reference string `json:"reference"`
+	}{d.Name()}, artifacts.WithConfigMediaType(consts.FileDirectoryConfigMediaType))
+
+	cdesc, err := partial.Descriptor(cfg)
+	if err != nil {
+		return err
+	}
+
+	d.manifest = &gv1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     gtypes.MediaType(d.MediaType()),
+		Config:        *cdesc,
+		Layers:        []gv1.Descriptor{*ldesc},
+		Annotations:   d.annotations,
+	}
+	d.config = cfg
+	d.blob = blob
+	d.computed = true
+	return nil
+}
+
+// directoryLayer is the tar+gzip layer of a Directory, whose diffID and uncompressed content are those of its tar
+type directoryLayer struct {
+	gv1.Layer
+
+	diffID       gv1.Hash
+	uncompressed layer.Opener
+}
+
+func (l *directoryLayer) DiffID() (gv1.Hash, error) {
+	return l.diffID, nil
+}
+
+func (l *directoryLayer) Uncompressed() (io.ReadCloser, error) {
+	return l.uncompressed()
+}
+
+// Descriptor is that of the compressed layer, its annotations included
+func (l *directoryLayer) Descriptor() (*gv1.Descriptor, error) {
+	return partial.Descriptor(l.Layer)
+}
+
+// archive writes the directory to w as a deterministic tar+gzip stream
+func (d *Directory) archive(w io.Writer) error {
+	// the zero gzip header has no name or mtime, so only the content determines the output
+	zw := gzip.NewWriter(w)
+	if err := d.tar(zw); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// tar writes the directory to w as a deterministic tar stream
+func (d *Directory) tar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	root := filepath.Clean(d.Path)
+	prefix := d.Name()
+
+	// filepath.Walk visits entries in lexical order
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		header := &tar.Header{
+			Name:    filepath.ToSlash(filepath.Join(prefix, rel)),
+			ModTime: d.modTime,
+			Format:  tar.FormatPAX,
+		}
+
+		mode := info.Mode()
+		switch {
+		case mode.IsDir():
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+			header.Mode = 0755
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = filepath.ToSlash(link)
+			header.Mode = 0777
+		case mode.IsRegular():
+			header.Typeflag = tar.TypeReg
+			header.Size = info.Size()
+			header.Mode = 0644
+			if mode&0111 != 0 {
+				header.Mode = 0755
+			}
+		default:
+			return fmt.Errorf("unsupported file type %s: %s", mode.Type(), path)
+		}
+		d.ownership.apply(header, info)
+		d.modes.apply(header, info)
+
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("tar %s: %w", path, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		// a file changing size mid archive would otherwise corrupt it
+		if _, err := io.CopyN(tw, f, header.Size); err != nil {
+			return fmt.Errorf("tar %s: %w", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+func (o ownership) apply(h *tar.Header, info os.FileInfo) {
+	h.Uid, h.Gid = o.uid, o.gid
+	if !o.preserve {
+		return
+	}
+	if uid, gid, ok := owner(info); ok {
+		h.Uid, h.Gid = uid, gid
+	}
+}
+
+// apply sets the mode of h, symlinks always being 0777 as their own permissions are never used
+func (m modes) apply(h *tar.Header, info os.FileInfo) {
+	if h.Typeflag == tar.TypeSymlink {
+		return
+	}
+	switch {
+	case m.preserve:
+		h.Mode = tarMode(info.Mode())
+	case m.file != 0 && h.Typeflag == tar.TypeReg:
+		h.Mode = tarMode(m.file)
+	case m.dir != 0 && h.Typeflag == tar.TypeDir:
+		h.Mode = tarMode(m.dir)
+	}
+}
+
+// tarMode converts the permissions of mode, along with its setuid, setgid and sticky bits, to those of a tar header
+func tarMode(mode os.FileMode) int64 {
+	m := int64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
@@ -2,10 +2,15 @@ package file
 
 import (
 	"context"
+	_ "crypto/sha512" // register sha512 for checksums
+	"errors"
+	"fmt"
+	"io"
 
 	gv1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	gtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
 
 	"github.com/rancherfederal/ocil/pkg/artifacts"
 	"github.com/rancherfederal/ocil/pkg/artifacts/file/getter"
@@ -13,7 +18,13 @@ import (
 )
 
 // interface guard
-var _ artifacts.OCI = (*File)(nil)
+var (
+	_ artifacts.OCI     = (*File)(nil)
+	_ artifacts.Sourced = (*File)(nil)
+)
+
+// ErrChecksumMismatch is returned when fetched content doesn't match the checksum given with WithChecksum
+var ErrChecksumMismatch = errors.New("checksum mismatch")
 
 // File implements the OCI interface for File API objects. API spec information is
 // stored into the Path field.
@@ -26,6 +37,7 @@ type File struct {
 	blob        gv1.Layer
 	manifest    *gv1.Manifest
 	annotations map[string]string
+	checksum    digest.Digest
 }
 
 func NewFile(path string, opts ...Option) *File {
@@ -47,6 +59,11 @@ func (f *File) Name(path string) string {
 	return f.client.Name(path)
 }
 
+// Source is the path or url the file is fetched from
+func (f *File) Source() string {
+	return f.Path
+}
+
 func (f *File) MediaType() string {
 	return consts.OCIManifestSchema1
 }
@@ -74,6 +91,10 @@ func (f *File) Manifest() (*gv1.Manifest, error) {
 	return f.manifest, nil
 }
 
+func (f *File) RawManifest() ([]byte, error) {
+	return artifacts.MarshalManifest(f)
+}
+
 func (f *File) compute() error {
 	if f.computed {
 		return nil
@@ -85,6 +106,10 @@ func (f *File) compute() error {
 		return err
 	}
 
+	if err := f.verify(blob); err != nil {
+		return err
+	}
+
 	layer, err := partial.Descriptor(blob)
 	if err != nil {
 		return err
@@ -114,3 +139,40 @@ func (f *File) compute() error {
 	f.computed = true
 	return nil
 }
+
+// verify checks the content of blob against the expected checksum, if there is one
+func (f *File) verify(blob gv1.Layer) error {
+	if f.checksum == "" {
+		return nil
+	}
+	if err := f.checksum.Validate(); err != nil {
+		return fmt.Errorf("checksum %s: %w", f.checksum, err)
+	}
+
+	// the layer's digest is a sha256 of the content already, no need to fetch it again
+	if f.checksum.Algorithm() == digest.SHA256 {
+		d, err := blob.Digest()
+		if err != nil {
+			return err
+		}
+		if d.String() != f.checksum.String() {
+			return fmt.Errorf("%s is %s, expected %s: %w", f.Path, d, f.checksum, ErrChecksumMismatch)
+		}
+		return nil
+	}
+
+	rc, err := blob.Compressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	verifier := f.checksum.Verifier()
+	if _, err := io.Copy(verifier, rc); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("%s does not match %s: %w", f.Path, f.checksum, ErrChecksumMismatch)
+	}
+	return nil
+}
@@ -1,16 +1,24 @@
 package file_test
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/opencontainers/go-digest"
 	"github.com/spf13/afero"
 
 	"github.com/rancherfederal/ocil/pkg/artifacts/file"
@@ -121,6 +129,235 @@ func Test_file_Layers(t *testing.T) {
 	}
 }
 
+func Test_file_Checksum(t *testing.T) {
+	tests := []struct {
+		name     string
+		ref      string
+		checksum digest.Digest
+		wantErr  error
+	}{
+		{
+			name:     "should accept a matching sha256",
+			ref:      filename,
+			checksum: digest.SHA256.FromBytes(data),
+		},
+		{
+			name:     "should accept a matching sha512",
+			ref:      ts.URL + "/" + filename,
+			checksum: digest.SHA512.FromBytes(data),
+		},
+		{
+			name:     "should reject a mismatched sha256",
+			ref:      filename,
+			checksum: digest.SHA256.FromString("other"),
+			wantErr:  file.ErrChecksumMismatch,
+		},
+		{
+			name:     "should reject a mismatched sha512",
+			ref:      ts.URL + "/" + filename,
+			checksum: digest.SHA512.FromString("other"),
+			wantErr:  file.ErrChecksumMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := file.NewFile(tt.ref, file.WithClient(mc), file.WithChecksum(tt.checksum))
+
+			_, err := f.Layers()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Layers() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	tree := map[string]string{
+		"b.txt":        "b",
+		"a/nested.txt": "nested",
+		"a/run.sh":     "#!/bin/sh",
+	}
+	mkTree := func(t *testing.T, modTime time.Time, contents map[string]string) string {
+		root := filepath.Join(t.TempDir(), "tree")
+		for name, data := range contents {
+			path := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return root
+	}
+	digestOf := func(t *testing.T, path string) gv1.Hash {
+		layers, err := file.NewDirectory(path).Layers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := layers[0].Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	want := digestOf(t, mkTree(t, time.Now(), tree))
+
+	t.Run("should produce identical digests for identical trees", func(t *testing.T) {
+		if got := digestOf(t, mkTree(t, time.Now().Add(-time.Hour), tree)); got != want {
+			t.Errorf("digest = %s, want %s", got, want)
+		}
+	})
+
+	t.Run("should produce different digests for different trees", func(t *testing.T) {
+		changed := map[string]string{"b.txt": "changed"}
+		for k, v := range tree {
+			if k != "b.txt" {
+				changed[k] = v
+			}
+		}
+		if got := digestOf(t, mkTree(t, time.Now(), changed)); got == want {
+			t.Errorf("digest = %s, want anything else", got)
+		}
+	})
+
+	t.Run("should archive entries in order with normalized headers", func(t *testing.T) {
+		layers, err := file.NewDirectory(mkTree(t, time.Now(), tree)).Layers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := layers[0].Compressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		zr, err := gzip.NewReader(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		tr := tar.NewReader(zr)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Uid != 0 || h.Gid != 0 || !h.ModTime.Equal(time.Unix(0, 0)) {
+				t.Errorf("header %s = uid %d, gid %d, mtime %s, want root owned at the epoch", h.Name, h.Uid, h.Gid, h.ModTime)
+			}
+			names = append(names, h.Name)
+		}
+
+		want := []string{"tree/", "tree/a/", "tree/a/nested.txt", "tree/a/run.sh", "tree/b.txt"}
+		if strings.Join(names, ",") != strings.Join(want, ",") {
+			t.Errorf("entries = %v, want %v", names, want)
+		}
+	})
+
+	t.Run("should record the diffID of the uncompressed tar", func(t *testing.T) {
+		layers, err := file.NewDirectory(mkTree(t, time.Now(), tree)).Layers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := layers[0].Compressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		zr, err := gzip.NewReader(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _, err := gv1.SHA256(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		diffID, err := layers[0].DiffID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diffID != want {
+			t.Errorf("DiffID() = %s, want %s", diffID, want)
+		}
+
+		urc, err := layers[0].Uncompressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer urc.Close()
+		if got, _, err := gv1.SHA256(urc); err != nil || got != want {
+			t.Errorf("Uncompressed() hashes to %s (%v), want %s", got, err, want)
+		}
+	})
+
+	headersOf := func(t *testing.T, d *file.Directory) []*tar.Header {
+		layers, err := d.Layers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := layers[0].Compressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		zr, err := gzip.NewReader(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var headers []*tar.Header
+		tr := tar.NewReader(zr)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				return headers
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			headers = append(headers, h)
+		}
+	}
+
+	t.Run("should record forced ownership and modes", func(t *testing.T) {
+		d := file.NewDirectory(mkTree(t, time.Now(), tree), file.WithOwnership(1000, 2000), file.WithModes(0640, 0750))
+		for _, h := range headersOf(t, d) {
+			want := int64(0640)
+			if h.Typeflag == tar.TypeDir {
+				want = 0750
+			}
+			if h.Uid != 1000 || h.Gid != 2000 || h.Mode != want {
+				t.Errorf("header %s = uid %d, gid %d, mode %o, want 1000, 2000 and %o", h.Name, h.Uid, h.Gid, h.Mode, want)
+			}
+		}
+	})
+
+	t.Run("should preserve ownership and modes", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("windows has no uid, gid or permission bits")
+		}
+		d := file.NewDirectory(mkTree(t, time.Now(), tree), file.WithPreservedOwnership(), file.WithPreservedModes())
+		for _, h := range headersOf(t, d) {
+			want := int64(0600)
+			if h.Typeflag == tar.TypeDir {
+				want = 0700
+			}
+			if h.Uid != os.Getuid() || h.Gid != os.Getgid() || h.Mode != want {
+				t.Errorf("header %s = uid %d, gid %d, mode %o, want %d, %d and %o", h.Name, h.Uid, h.Gid, h.Mode, os.Getuid(), os.Getgid(), want)
+			}
+		}
+	})
+}
+
 func setup() func() {
 	tfs = afero.NewMemMapFs()
 	afero.WriteFile(tfs, filename, data, 0644)
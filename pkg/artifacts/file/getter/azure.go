@@ -0,0 +1,270 @@
+package getter
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+const (
+	azureStorageVersion = "2020-10-02"
+
+	// azureStorageResource is the resource managed identity tokens are requested for
+	azureStorageResource = "https://storage.azure.com/"
+
+	// azureInstanceMetadataEndpoint is the instance metadata service of azure vms, which nothing answers off of azure
+	azureInstanceMetadataEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// Azure fetches azblob://<container>/<blob> blobs
+// 	Credentials are, in order: AZURE_STORAGE_CONNECTION_STRING, AZURE_STORAGE_ACCOUNT with AZURE_STORAGE_KEY,
+// 	AZURE_STORAGE_ACCOUNT with AZURE_STORAGE_SAS_TOKEN, then AZURE_STORAGE_ACCOUNT with the managed identity of the
+// 	vm or app service (AZURE_CLIENT_ID selecting a user assigned one).  Requests are sent anonymously with only an
+// 	account and no identity, which is enough for public containers.  A connection string's BlobEndpoint points
+// 	requests elsewhere, ie: at azurite.
+type Azure struct {
+	// Endpoint overrides the blob endpoint of the account
+	Endpoint string
+	Client   *http.Client
+}
+
+func NewAzure() *Azure {
+	return &Azure{Client: http.DefaultClient}
+}
+
+func (a Azure) Name(u *url.URL) string {
+	return path.Base(u.Path)
+}
+
+func (a Azure) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	creds, err := azureCredentialChain()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = creds.endpoint
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", creds.account)
+	}
+
+	target := strings.TrimSuffix(endpoint, "/") + "/" + url.PathEscape(u.Host) + "/" + escapePath(strings.TrimPrefix(u.Path, "/"))
+	if creds.sas != "" {
+		target += "?" + strings.TrimPrefix(creds.sas, "?")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", azureStorageVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+
+	switch {
+	case creds.key != nil:
+		creds.sign(req)
+	case creds.token != "":
+		req.Header.Set("Authorization", "Bearer "+creds.token)
+	}
+	rc, err := fetch(a.Client, req)
+	if err != nil && creds.key == nil && creds.sas == "" && creds.token == "" {
+		return nil, fmt.Errorf("%w: no azure credentials were found, the request was sent anonymously", err)
+	}
+	return rc, err
+}
+
+func (a Azure) Detect(u *url.URL) bool {
+	return u.Scheme == "azblob"
+}
+
+func (a *Azure) Config(u *url.URL) artifacts.Config {
+	c := &objectConfig{
+		config{Reference: u.String()},
+	}
+	return artifacts.ToConfig(c, artifacts.WithConfigMediaType(consts.FileAzureConfigMediaType))
+}
+
+type azureCredentials struct {
+	account  string
+	key      []byte
+	sas      string
+	token    string
+	endpoint string
+}
+
+func azureCredentialChain() (*azureCredentials, error) {
+	if cs := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); cs != "" {
+		return parseConnectionString(cs)
+	}
+
+	creds := &azureCredentials{
+		account: os.Getenv("AZURE_STORAGE_ACCOUNT"),
+		sas:     os.Getenv("AZURE_STORAGE_SAS_TOKEN"),
+	}
+	if creds.account == "" {
+		return nil, errors.New("no azure storage account found, set AZURE_STORAGE_ACCOUNT or AZURE_STORAGE_CONNECTION_STRING")
+	}
+	if key := os.Getenv("AZURE_STORAGE_KEY"); key != "" {
+		k, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("decode AZURE_STORAGE_KEY: %w", err)
+		}
+		creds.key = k
+		creds.sas = ""
+	}
+	if creds.key == nil && creds.sas == "" {
+		token, err := managedIdentityToken()
+		if err != nil {
+			return nil, err
+		}
+		creds.token = token
+	}
+	return creds, nil
+}
+
+// managedIdentityToken requests a token for the blob service from the managed identity endpoint of the app service
+// (IDENTITY_ENDPOINT and IDENTITY_HEADER), or else of the vm, returning none off of azure
+func managedIdentityToken() (string, error) {
+	query := url.Values{"resource": {azureStorageResource}}
+	if id := os.Getenv("AZURE_CLIENT_ID"); id != "" {
+		query.Set("client_id", id)
+	}
+
+	// the app service endpoint must answer, the vm's doesn't off of azure
+	endpoint := os.Getenv("IDENTITY_ENDPOINT")
+	appService := endpoint != ""
+	client := &http.Client{Timeout: 10 * time.Second}
+	if appService {
+		query.Set("api-version", "2019-08-01")
+	} else {
+		endpoint = azureInstanceMetadataEndpoint
+		query.Set("api-version", "2018-02-01")
+		client.Timeout = time.Second
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if appService {
+		req.Header.Set("X-IDENTITY-HEADER", os.Getenv("IDENTITY_HEADER"))
+	} else {
+		req.Header.Set("Metadata", "true")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if appService {
+			return "", fmt.Errorf("managed identity: %w", err)
+		}
+		return "", nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// a vm without an identity is as good as no vm
+		if !appService {
+			return "", nil
+		}
+		return "", fmt.Errorf("managed identity: %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("managed identity: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// parseConnectionString parses the "Key=Value;..." connection strings the azure portal hands out
+func parseConnectionString(cs string) (*azureCredentials, error) {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(cs, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) == 2 {
+			fields[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	creds := &azureCredentials{
+		account:  fields["AccountName"],
+		sas:      fields["SharedAccessSignature"],
+		endpoint: fields["BlobEndpoint"],
+	}
+	if key := fields["AccountKey"]; key != "" {
+		k, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("decode connection string account key: %w", err)
+		}
+		creds.key = k
+	}
+
+	if creds.endpoint == "" {
+		if creds.account == "" {
+			return nil, errors.New("connection string has neither an AccountName nor a BlobEndpoint")
+		}
+		protocol, suffix := fields["DefaultEndpointsProtocol"], fields["EndpointSuffix"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		if suffix == "" {
+			suffix = "core.windows.net"
+		}
+		creds.endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, creds.account, suffix)
+	}
+	return creds, nil
+}
+
+// sign authorizes req with the shared key scheme of the blob service
+func (c *azureCredentials) sign(req *http.Request) {
+	var msHeaders []string
+	for k := range req.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-ms-") {
+			msHeaders = append(msHeaders, k)
+		}
+	}
+	sort.Strings(msHeaders)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range msHeaders {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(req.Header.Get(k)) + "\n")
+	}
+
+	resource := "/" + c.account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	var params []string
+	for k := range query {
+		params = append(params, k)
+	}
+	sort.Strings(params)
+	for _, k := range params {
+		vs := query[k]
+		sort.Strings(vs)
+		resource += "\n" + strings.ToLower(k) + ":" + strings.Join(vs, ",")
+	}
+
+	// verb, then the standard headers (encoding, language, length, md5, type, date, the conditionals and range) which
+	// a bare GET never sets
+	toSign := req.Method + strings.Repeat("\n", 12) + canonicalHeaders.String() + resource
+
+	h := hmac.New(sha256.New, c.key)
+	h.Write([]byte(toSign))
+	req.Header.Set("Authorization", "SharedKey "+c.account+":"+base64.StdEncoding.EncodeToString(h.Sum(nil)))
+}
@@ -10,7 +10,6 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 
 	"github.com/rancherfederal/ocil/pkg/artifacts"
@@ -25,38 +24,18 @@ func NewDirectory() *directory {
 	return &directory{File: NewFile()}
 }
 
+// Open streams the directory as a tar+gzip archive
 func (d directory) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
-	tmpfile, err := os.CreateTemp("", "hauler")
-	if err != nil {
-		return nil, err
-	}
-
-	digester := digest.Canonical.Digester()
-	zw := gzip.NewWriter(io.MultiWriter(tmpfile, digester.Hash()))
-	defer zw.Close()
-
-	tarDigester := digest.Canonical.Digester()
-	if err := tarDir(d.path(u), d.Name(u), io.MultiWriter(zw, tarDigester.Hash()), false); err != nil {
-		return nil, err
-	}
-
-	if err := zw.Close(); err != nil {
-		return nil, err
-	}
-	if err := tmpfile.Sync(); err != nil {
-		return nil, err
-	}
-
-	fi, err := os.Open(tmpfile.Name())
-	if err != nil {
-		return nil, err
-	}
-
-	// rc := &closer{
-	// 	t: io.TeeReader(tmpfile, fi),
-	// 	closes: []func() error{fi.Close, tmpfile.Close, zw.Close},
-	// }
-	return fi, nil
+	pr, pw := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(pw)
+		if err := tarDir(d.path(u), d.Name(u), zw, false); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(zw.Close())
+	}()
+	return pr, nil
 }
 
 func (d directory) Detect(u *url.URL) bool {
@@ -0,0 +1,83 @@
+package getter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+const gcsReadOnlyScope = "https://www.googleapis.com/auth/devstorage.read_only"
+
+// GCS fetches gs://<bucket>/<object> objects
+// 	Credentials are the application default credentials: GOOGLE_APPLICATION_CREDENTIALS, then those of gcloud, then
+// 	the metadata server when running on google cloud.  Requests are sent anonymously when there are none, which is
+// 	enough for public buckets.  STORAGE_EMULATOR_HOST points requests at an emulator, anonymously.
+type GCS struct {
+	// Endpoint overrides STORAGE_EMULATOR_HOST
+	Endpoint string
+	Client   *http.Client
+}
+
+func NewGCS() *GCS {
+	return &GCS{}
+}
+
+func (g GCS) Name(u *url.URL) string {
+	return path.Base(u.Path)
+}
+
+func (g GCS) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("STORAGE_EMULATOR_HOST")
+	}
+	if endpoint != "" && !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+
+	client := g.Client
+	if endpoint == "" {
+		endpoint = "https://storage.googleapis.com"
+		if client == nil {
+			if c, err := google.DefaultClient(ctx, gcsReadOnlyScope); err == nil {
+				client = c
+			}
+		}
+	}
+
+	target := strings.TrimSuffix(endpoint, "/") + "/" + url.PathEscape(u.Host) + "/" + escapePath(strings.TrimPrefix(u.Path, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	return fetch(client, req)
+}
+
+func (g GCS) Detect(u *url.URL) bool {
+	return u.Scheme == "gs"
+}
+
+func (g *GCS) Config(u *url.URL) artifacts.Config {
+	c := &objectConfig{
+		config{Reference: u.String()},
+	}
+	return artifacts.ToConfig(c, artifacts.WithConfigMediaType(consts.FileGCSConfigMediaType))
+}
+
+// escapePath escapes each segment of p, preserving the slashes between them
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
@@ -9,7 +9,8 @@ import (
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
-	"oras.land/oras-go/pkg/content"
+	"go.opentelemetry.io/otel/trace"
+	"oras.land/oras-go/v2/content/file"
 
 	content2 "github.com/rancherfederal/ocil/pkg/artifacts"
 	"github.com/rancherfederal/ocil/pkg/consts"
@@ -24,6 +25,9 @@ type Client struct {
 // ClientOptions provides options for the client
 type ClientOptions struct {
 	NameOverride string
+
+	// TracerProvider starts the spans of fetches, the global otel TracerProvider when nil
+	TracerProvider trace.TracerProvider
 }
 
 var (
@@ -40,11 +44,15 @@ type Getter interface {
 	Config(*url.URL) content2.Config
 }
 
-func NewClient(opts ClientOptions) *Client {
+// NewClient returns a client using every known getter, the http getter configured with httpOpts
+func NewClient(opts ClientOptions, httpOpts ...HttpOption) *Client {
 	defaults := map[string]Getter{
 		"file":      NewFile(),
 		"directory": NewDirectory(),
-		"http":      NewHttp(),
+		"http":      NewHttp(httpOpts...),
+		"s3":        NewS3(),
+		"gcs":       NewGCS(),
+		"azure":     NewAzure(),
 	}
 
 	c := &Client{
@@ -68,25 +76,31 @@ func (c *Client) LayerFrom(ctx context.Context, source string) (v1.Layer, error)
 		return nil, fmt.Errorf("create getter: %w", err)
 	}
 
-	opener := func() (io.ReadCloser, error) {
-		return g.Open(ctx, u)
-	}
-
 	annotations := make(map[string]string)
 	annotations[ocispec.AnnotationTitle] = c.Name(source)
 
 	switch g.(type) {
 	case *directory:
-		annotations[content.AnnotationUnpack] = "true"
+		annotations[file.AnnotationUnpack] = "true"
 	}
 
-	l, err := layer.FromOpener(opener,
+	opts := []layer.Option{
 		layer.WithMediaType(consts.FileLayerMediaType),
-		layer.WithAnnotations(annotations))
+		layer.WithAnnotations(annotations),
+	}
+
+	// local files are cheap to open again for every read, anything else is streamed in once and spooled
+	if _, ok := g.(*File); ok {
+		return layer.FromOpener(func() (io.ReadCloser, error) {
+			return c.open(ctx, g, u)
+		}, opts...)
+	}
+
+	rc, err := c.open(ctx, g, u)
 	if err != nil {
 		return nil, err
 	}
-	return l, nil
+	return layer.FromReader(rc, opts...)
 }
 
 func (c *Client) ContentFrom(ctx context.Context, source string) (io.ReadCloser, error) {
@@ -101,7 +115,7 @@ func (c *Client) ContentFrom(ctx context.Context, source string) (io.ReadCloser,
 		}
 		return nil, fmt.Errorf("create getter: %w", err)
 	}
-	return g.Open(ctx, u)
+	return c.open(ctx, g, u)
 }
 
 func (c *Client) getterFrom(srcUrl *url.URL) (Getter, error) {
@@ -1,10 +1,24 @@
 package getter_test
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/rancherfederal/ocil/pkg/artifacts/file/getter"
 )
@@ -51,6 +65,27 @@ func TestClient_Detect(t *testing.T) {
 			},
 			want: "http",
 		},
+		{
+			name: "should identify a s3 object",
+			args: args{
+				source: "s3://bucket/path/to/file.yaml",
+			},
+			want: "s3",
+		},
+		{
+			name: "should identify a gcs object",
+			args: args{
+				source: "gs://bucket/path/to/file.yaml",
+			},
+			want: "gcs",
+		},
+		{
+			name: "should identify an azure blob",
+			args: args{
+				source: "azblob://container/path/to/file.yaml",
+			},
+			want: "azure",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -100,6 +135,14 @@ func TestClient_Name(t *testing.T) {
 			},
 			want: rootDir,
 		},
+		{
+			name: "should correctly name an object",
+			args: args{
+				source: "s3://bucket/path/to/file.yaml",
+				opts:   getter.ClientOptions{},
+			},
+			want: "file.yaml",
+		},
 		{
 			name: "should correctly override a files name",
 			args: args{
@@ -119,6 +162,464 @@ func TestClient_Name(t *testing.T) {
 	}
 }
 
+func TestClient_LayerFrom(t *testing.T) {
+	data := bytes.Repeat([]byte("large file "), 1<<20)
+
+	var fetches int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fetches++
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	c := getter.NewClient(getter.ClientOptions{})
+	l, err := c.LayerFrom(context.Background(), srv.URL+"/large.iso")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := digest.FromBytes(data)
+	d, err := l.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.String() != want.String() {
+		t.Errorf("Digest() = %s, want %s", d, want)
+	}
+
+	// every read is served from the single fetch
+	for i := 0; i < 2; i++ {
+		rc, err := l.Compressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("Compressed() read %d bytes, want the %d fetched", len(got), len(data))
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("content fetched %d times, want once", fetches)
+	}
+}
+
+func TestClient_ContentFromTraced(t *testing.T) {
+	data := []byte("traced")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	sr := tracetest.NewSpanRecorder()
+	c := getter.NewClient(getter.ClientOptions{TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))})
+	rc, err := c.ContentFrom(context.Background(), srv.URL+"/file.txt?X-Amz-Signature=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	}
+	if len(sr.Ended()) != 0 {
+		t.Fatal("span ended before the content was closed")
+	}
+	rc.Close()
+
+	spans := sr.Ended()
+	if len(spans) != 1 || spans[0].Name() != "getter.open" {
+		t.Fatalf("recorded %d spans, want a single getter.open", len(spans))
+	}
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range spans[0].Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if got := attrs["ocil.read_bytes"].AsInt64(); got != int64(len(data)) {
+		t.Errorf("ocil.read_bytes = %d, want %d", got, len(data))
+	}
+	if got := attrs["ocil.source"].AsString(); strings.Contains(got, "secret") {
+		t.Errorf("ocil.source = %s, want the query left out", got)
+	}
+}
+
+func TestHttp_Options(t *testing.T) {
+	data := []byte("contents")
+
+	// the target both serves content directly and acts as a proxy, recording how each request reached it
+	var proxied atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(r.URL.IsAbs())
+		switch {
+		case r.URL.Path == "/slow":
+			time.Sleep(500 * time.Millisecond)
+		case r.URL.Path == "/custom" && r.Header.Get("X-Custom") != "value":
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		case strings.HasPrefix(r.URL.Path, "/basic"):
+			if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		case strings.HasPrefix(r.URL.Path, "/bearer"):
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+	proxy, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		source      string
+		opts        []getter.HttpOption
+		wantProxied bool
+		wantErr     bool
+	}{
+		{
+			name:   "should send custom headers",
+			source: srv.URL + "/custom",
+			opts:   []getter.HttpOption{getter.WithHeader("X-Custom", "value")},
+		},
+		{
+			name:   "should authenticate with basic auth",
+			source: srv.URL + "/basic/file.yaml",
+			opts:   []getter.HttpOption{getter.WithBasicAuth("user", "pass")},
+		},
+		{
+			name:    "should fail without credentials",
+			source:  srv.URL + "/basic/file.yaml",
+			wantErr: true,
+		},
+		{
+			name:   "should authenticate with a bearer token",
+			source: srv.URL + "/bearer/file.yaml",
+			opts:   []getter.HttpOption{getter.WithBearerToken("token")},
+		},
+		{
+			name:    "should time out slow requests",
+			source:  srv.URL + "/slow",
+			opts:    []getter.HttpOption{getter.WithTimeout(50 * time.Millisecond)},
+			wantErr: true,
+		},
+		{
+			name:        "should send requests through the proxy",
+			source:      "http://unreachable.invalid/file.yaml",
+			opts:        []getter.HttpOption{getter.WithProxy(proxy)},
+			wantProxied: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rc, err := getter.NewHttp(tt.opts...).Open(context.Background(), u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer rc.Close()
+
+			got, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Open() = %q, want %q", got, data)
+			}
+			if got := proxied.Load(); got != tt.wantProxied {
+				t.Errorf("proxied = %v, want %v", got, tt.wantProxied)
+			}
+		})
+	}
+}
+
+func TestObjectGetters(t *testing.T) {
+	data := []byte("object contents")
+
+	// every request must be for the object, and authorized as expected
+	serve := func(t *testing.T, path, auth string, forbidden bool) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if forbidden {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if r.URL.Path != path {
+				http.NotFound(w, r)
+				return
+			}
+			if got := r.Header.Get("Authorization"); !strings.HasPrefix(got, auth) || (auth == "" && got != "") {
+				t.Errorf("Authorization = %q, want prefix %q", got, auth)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write(data)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+
+	// credentials serves answer to any request for credentials, returning the environment pointing at it
+	credentials := func(answer func(w http.ResponseWriter, r *http.Request), env func(endpoint string) map[string]string) func(t *testing.T) map[string]string {
+		return func(t *testing.T) map[string]string {
+			srv := httptest.NewServer(http.HandlerFunc(answer))
+			t.Cleanup(srv.Close)
+			return env(srv.URL)
+		}
+	}
+	webIdentityToken := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(webIdentityToken, []byte("jwt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		source      string
+		env         map[string]string
+		credentials func(t *testing.T) map[string]string
+		getter      func(endpoint string) getter.Getter
+		path        string
+		auth        string
+		forbidden   bool
+		wantErr     string
+	}{
+		{
+			name:   "should fetch a signed s3 object",
+			source: "s3://bucket/path/to/file.yaml",
+			env:    map[string]string{"AWS_ACCESS_KEY_ID": "id", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_REGION": "us-west-2"},
+			getter: func(endpoint string) getter.Getter { return &getter.S3{Endpoint: endpoint} },
+			path:   "/bucket/path/to/file.yaml",
+			auth:   "AWS4-HMAC-SHA256 Credential=id/",
+		},
+		{
+			name:   "should fetch a public s3 object without credentials",
+			source: "s3://bucket/file.yaml",
+			getter: func(endpoint string) getter.Getter { return &getter.S3{Endpoint: endpoint} },
+			path:   "/bucket/file.yaml",
+		},
+		{
+			name:   "should fetch a gcs object from an emulator",
+			source: "gs://bucket/path/to/file.yaml",
+			getter: func(endpoint string) getter.Getter { return &getter.GCS{Endpoint: endpoint} },
+			path:   "/bucket/path/to/file.yaml",
+		},
+		{
+			name:   "should fetch a shared key signed azure blob",
+			source: "azblob://container/path/to/file.yaml",
+			env:    map[string]string{"AZURE_STORAGE_ACCOUNT": "account", "AZURE_STORAGE_KEY": "c2VjcmV0"},
+			getter: func(endpoint string) getter.Getter { return &getter.Azure{Endpoint: endpoint} },
+			path:   "/container/path/to/file.yaml",
+			auth:   "SharedKey account:",
+		},
+		{
+			name:    "should fail on missing objects",
+			source:  "s3://bucket/missing.yaml",
+			getter:  func(endpoint string) getter.Getter { return &getter.S3{Endpoint: endpoint} },
+			path:    "/bucket/file.yaml",
+			wantErr: "not found",
+		},
+		{
+			name:   "should sign with the credentials of a web identity",
+			source: "s3://bucket/file.yaml",
+			credentials: credentials(func(w http.ResponseWriter, r *http.Request) {
+				if r.FormValue("Action") != "AssumeRoleWithWebIdentity" || r.FormValue("WebIdentityToken") != "jwt" || r.FormValue("RoleArn") != "arn:aws:iam::1:role/r" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>`+
+					`<AccessKeyId>webidentity</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>`+
+					`</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`)
+			}, func(endpoint string) map[string]string {
+				return map[string]string{"AWS_WEB_IDENTITY_TOKEN_FILE": webIdentityToken, "AWS_ROLE_ARN": "arn:aws:iam::1:role/r", "AWS_ENDPOINT_URL_STS": endpoint}
+			}),
+			getter: func(endpoint string) getter.Getter { return &getter.S3{Endpoint: endpoint} },
+			path:   "/bucket/file.yaml",
+			auth:   "AWS4-HMAC-SHA256 Credential=webidentity/",
+		},
+		{
+			name:   "should sign with the credentials of the container",
+			source: "s3://bucket/file.yaml",
+			credentials: credentials(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "container-token" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(w, `{"AccessKeyId":"container","SecretAccessKey":"secret","Token":"token"}`)
+			}, func(endpoint string) map[string]string {
+				return map[string]string{"AWS_CONTAINER_CREDENTIALS_FULL_URI": endpoint + "/creds", "AWS_CONTAINER_AUTHORIZATION_TOKEN": "container-token"}
+			}),
+			getter: func(endpoint string) getter.Getter { return &getter.S3{Endpoint: endpoint} },
+			path:   "/bucket/file.yaml",
+			auth:   "AWS4-HMAC-SHA256 Credential=container/",
+		},
+		{
+			name:   "should sign with the credentials of the instance role",
+			source: "s3://bucket/file.yaml",
+			credentials: credentials(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+					fmt.Fprint(w, "imds-token")
+				case r.Header.Get("X-aws-ec2-metadata-token") != "imds-token":
+					w.WriteHeader(http.StatusUnauthorized)
+				case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+					fmt.Fprint(w, "node-role")
+				case r.URL.Path == "/latest/meta-data/iam/security-credentials/node-role":
+					fmt.Fprint(w, `{"AccessKeyId":"instance","SecretAccessKey":"secret","Token":"token"}`)
+				default:
+					http.NotFound(w, r)
+				}
+			}, func(endpoint string) map[string]string {
+				return map[string]string{"AWS_EC2_METADATA_DISABLED": "", "AWS_EC2_METADATA_SERVICE_ENDPOINT": endpoint}
+			}),
+			getter: func(endpoint string) getter.Getter { return &getter.S3{Endpoint: endpoint} },
+			path:   "/bucket/file.yaml",
+			auth:   "AWS4-HMAC-SHA256 Credential=instance/",
+		},
+		{
+			name:      "should say no credentials were found when an unsigned request is forbidden",
+			source:    "s3://bucket/file.yaml",
+			getter:    func(endpoint string) getter.Getter { return &getter.S3{Endpoint: endpoint} },
+			forbidden: true,
+			wantErr:   "no aws credentials were found",
+		},
+		{
+			name:   "should authorize with a managed identity",
+			source: "azblob://container/file.yaml",
+			env:    map[string]string{"AZURE_STORAGE_ACCOUNT": "account"},
+			credentials: credentials(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-IDENTITY-HEADER") != "identity" || r.URL.Query().Get("resource") != "https://storage.azure.com/" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				fmt.Fprint(w, `{"access_token":"managed"}`)
+			}, func(endpoint string) map[string]string {
+				return map[string]string{"IDENTITY_ENDPOINT": endpoint, "IDENTITY_HEADER": "identity"}
+			}),
+			getter: func(endpoint string) getter.Getter { return &getter.Azure{Endpoint: endpoint} },
+			path:   "/container/file.yaml",
+			auth:   "Bearer managed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// isolate from any credentials of whoever runs the tests
+			t.Setenv("HOME", t.TempDir())
+			for _, k := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_SHARED_CREDENTIALS_FILE",
+				"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+				"AZURE_STORAGE_CONNECTION_STRING", "AZURE_STORAGE_SAS_TOKEN", "IDENTITY_ENDPOINT"} {
+				t.Setenv(k, "")
+			}
+			t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if tt.credentials != nil {
+				for k, v := range tt.credentials(t) {
+					t.Setenv(k, v)
+				}
+			}
+
+			srv := serve(t, tt.path, tt.auth, tt.forbidden)
+			u, err := url.Parse(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rc, err := tt.getter(srv.URL).Open(context.Background(), u)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Open() error = %v, want an error saying %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+
+			got, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Open() = %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestS3_Open(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, k := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_PROFILE", "AWS_SHARED_CREDENTIALS_FILE",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_AUTHORIZATION_TOKEN"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	objects := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "object contents")
+	}))
+	defer objects.Close()
+	u, err := url.Parse("s3://bucket/file.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should look up credentials once", func(t *testing.T) {
+		var lookups int32
+		creds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&lookups, 1)
+			fmt.Fprint(w, `{"AccessKeyId":"container","SecretAccessKey":"secret","Token":"token"}`)
+		}))
+		defer creds.Close()
+		t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", creds.URL)
+
+		g := &getter.S3{Endpoint: objects.URL}
+		for i := 0; i < 3; i++ {
+			rc, err := g.Open(context.Background(), u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rc.Close()
+		}
+		if n := atomic.LoadInt32(&lookups); n != 1 {
+			t.Errorf("credentials were looked up %d times, want once", n)
+		}
+	})
+
+	t.Run("should give up looking up credentials with its context", func(t *testing.T) {
+		creds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer creds.Close()
+		t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", creds.URL)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, err := (&getter.S3{Endpoint: objects.URL}).Open(ctx, u); err == nil {
+			t.Fatal("Open() succeeded without credentials")
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("Open() took %s to give up, its context was done after 100ms", elapsed)
+		}
+	})
+}
+
 var (
 	rootDir     = "gettertests"
 	fileWithExt = filepath.Join(rootDir, "file.yaml")
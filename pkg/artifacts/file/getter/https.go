@@ -8,22 +8,89 @@ import (
 	"net/url"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/rancherfederal/ocil/pkg/artifacts"
 	"github.com/rancherfederal/ocil/pkg/consts"
 )
 
-type Http struct{}
+type Http struct {
+	client   *http.Client
+	header   http.Header
+	username string
+	password string
+	token    string
+}
+
+type HttpOption func(*httpOptions)
+
+type httpOptions struct {
+	http    Http
+	timeout time.Duration
+	proxy   *url.URL
+}
+
+// WithHeader sends the header key: value with every request, in addition to any others with the same key
+func WithHeader(key, value string) HttpOption {
+	return func(o *httpOptions) {
+		o.http.header.Add(key, value)
+	}
+}
+
+// WithBasicAuth authenticates every request with username and password
+func WithBasicAuth(username, password string) HttpOption {
+	return func(o *httpOptions) {
+		o.http.username, o.http.password = username, password
+	}
+}
 
-func NewHttp() *Http {
-	return &Http{}
+// WithBearerToken authenticates every request with token
+func WithBearerToken(token string) HttpOption {
+	return func(o *httpOptions) {
+		o.http.token = token
+	}
+}
+
+// WithTimeout bounds every request, including reading its body, to d
+func WithTimeout(d time.Duration) HttpOption {
+	return func(o *httpOptions) {
+		o.timeout = d
+	}
+}
+
+// WithProxy sends every request through proxy, instead of the one configured by HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+func WithProxy(proxy *url.URL) HttpOption {
+	return func(o *httpOptions) {
+		o.proxy = proxy
+	}
+}
+
+func NewHttp(opts ...HttpOption) *Http {
+	o := &httpOptions{http: Http{header: make(http.Header)}}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if o.proxy != nil {
+		t.Proxy = http.ProxyURL(o.proxy)
+	}
+
+	h := o.http
+	h.client = &http.Client{Transport: t, Timeout: o.timeout}
+	return &h
 }
 
 func (h Http) Name(u *url.URL) string {
-	resp, err := http.Head(u.String())
+	req, err := h.request(context.TODO(), http.MethodHead, u)
 	if err != nil {
 		return ""
 	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return ""
+	}
+	resp.Body.Close()
 
 	contentType := resp.Header.Get("Content-Type")
 	for _, v := range strings.Split(contentType, ",") {
@@ -40,11 +107,32 @@ func (h Http) Name(u *url.URL) string {
 }
 
 func (h Http) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
-	resp, err := http.Get(u.String())
+	req, err := h.request(ctx, http.MethodGet, u)
 	if err != nil {
 		return nil, err
 	}
-	return resp.Body, nil
+	return fetch(h.client, req)
+}
+
+// request builds a request for u with the configured headers and credentials
+func (h Http) request(ctx context.Context, method string, u *url.URL) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range h.header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+
+	switch {
+	case h.token != "":
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	case h.username != "" || h.password != "":
+		req.SetBasicAuth(h.username, h.password)
+	}
+	return req, nil
 }
 
 func (h Http) Detect(u *url.URL) bool {
@@ -0,0 +1,29 @@
+package getter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// objectConfig is the config of files fetched from cloud object storage
+type objectConfig struct {
+	config `json:",inline,omitempty"`
+}
+
+// fetch sends req with client, returning the body of successful responses only
+func fetch(client *http.Client, req *http.Request) (io.ReadCloser, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch %s: %s", req.URL.Redacted(), resp.Status)
+	}
+	return resp.Body, nil
+}
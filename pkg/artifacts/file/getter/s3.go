@@ -0,0 +1,76 @@
+package getter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/s3"
+)
+
+// S3 fetches s3://<bucket>/<key> objects
+// 	Credentials are found by s3.DefaultCredentials: the aws environment variables, the shared credentials file, then
+// 	the web identity, ECS container and EC2 instance providers.  Requests are sent unsigned when there are none,
+// 	which is enough for public buckets.  AWS_ENDPOINT_URL points requests at any other s3 compatible store (ie: minio),
+// 	using path style addressing.  The client is configured by the first Open, and reused by those that follow.
+type S3 struct {
+	// Endpoint overrides AWS_ENDPOINT_URL
+	Endpoint string
+	Client   *http.Client
+
+	mu     sync.Mutex
+	client *s3.Client
+}
+
+func NewS3() *S3 {
+	return &S3{Client: http.DefaultClient}
+}
+
+func (s *S3) Name(u *url.URL) string {
+	return path.Base(u.Path)
+}
+
+func (s *S3) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	c, err := s.s3Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, u.Host, strings.TrimPrefix(u.Path, "/"))
+}
+
+// s3Client is the client of s, configured from the environment the first time it's asked for
+func (s *S3) s3Client(ctx context.Context) (*s3.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	c, err := s3.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.Endpoint != "" {
+		c.Endpoint = s.Endpoint
+	}
+	c.HTTP = s.Client
+	s.client = c
+	return c, nil
+}
+
+func (s *S3) Detect(u *url.URL) bool {
+	return u.Scheme == "s3"
+}
+
+func (s *S3) Config(u *url.URL) artifacts.Config {
+	c := &objectConfig{
+		config{Reference: u.String()},
+	}
+	return artifacts.ToConfig(c, artifacts.WithConfigMediaType(consts.FileS3ConfigMediaType))
+}
@@ -0,0 +1,63 @@
+package getter
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/rancherfederal/ocil/pkg/artifacts/file/getter"
+
+// open opens u with g inside a span, that lasts until the content is closed so it covers the whole fetch
+func (c *Client) open(ctx context.Context, g Getter, u *url.URL) (io.ReadCloser, error) {
+	tp := c.Options.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	// query strings can carry credentials, ie: presigned urls
+	source := *u
+	source.RawQuery = ""
+
+	ctx, span := tp.Tracer(tracerName).Start(ctx, "getter.open", trace.WithAttributes(
+		attribute.String("ocil.source", source.Redacted()),
+		attribute.String("ocil.getter", g.Name(u)),
+	))
+	rc, err := g.Open(ctx, u)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+	return &tracedReader{ReadCloser: rc, span: span}, nil
+}
+
+// tracedReader ends its span once closed, recording how much was read
+type tracedReader struct {
+	io.ReadCloser
+	span trace.Span
+	n    int64
+}
+
+func (r *tracedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF {
+		r.span.RecordError(err)
+		r.span.SetStatus(codes.Error, err.Error())
+	}
+	return n, err
+}
+
+func (r *tracedReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.span.SetAttributes(attribute.Int64("ocil.read_bytes", r.n))
+	r.span.End()
+	return err
+}
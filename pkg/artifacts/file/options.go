@@ -1,6 +1,8 @@
 package file
 
 import (
+	"github.com/opencontainers/go-digest"
+
 	"github.com/rancherfederal/ocil/pkg/artifacts"
 	"github.com/rancherfederal/ocil/pkg/artifacts/file/getter"
 )
@@ -24,3 +26,11 @@ func WithAnnotations(m map[string]string) Option {
 		f.annotations = m
 	}
 }
+
+// WithChecksum verifies the fetched content matches the expected digest (ie: sha256:..., sha512:...), failing to
+// compute the file's layer otherwise
+func WithChecksum(d digest.Digest) Option {
+	return func(f *File) {
+		f.checksum = d
+	}
+}
@@ -0,0 +1,189 @@
+package artifacts
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+var (
+	_ OCI      = (*Generic)(nil)
+	_ Referrer = (*Generic)(nil)
+	_ Typed    = (*Generic)(nil)
+)
+
+// Generic is an artifact of whatever config and layers it is built up with, ie:
+//
+// 	a := artifacts.NewGeneric().
+// 		WithConfig("application/vnd.example.config.v1+json", cfg).
+// 		AddLayer("application/vnd.example.layer.v1", r, map[string]string{ocispec.AnnotationTitle: "data.bin"})
+//
+// 	The first error building it (ie: reading a layer) is returned by Manifest and Layers.
+type Generic struct {
+	config          []byte
+	configMediaType string
+	artifactType    string
+	layers          []genericLayer
+	annotations     map[string]string
+	subject         *v1.Descriptor
+	err             error
+}
+
+type genericLayer struct {
+	v1.Layer
+	annotations map[string]string
+}
+
+// NewGeneric returns an artifact without layers, whose config is an empty json object until WithConfig is given one
+func NewGeneric() *Generic {
+	return &Generic{
+		config:          []byte("{}"),
+		configMediaType: consts.UnknownManifest,
+	}
+}
+
+// WithConfig sets the config of the artifact to data, of mediaType
+func (g *Generic) WithConfig(mediaType string, data []byte) *Generic {
+	g.config = data
+	g.configMediaType = mediaType
+	return g
+}
+
+// AddLayer appends the content read from r as a layer of mediaType (consts.UnknownLayer when empty), its descriptor
+// annotated with annotations
+func (g *Generic) AddLayer(mediaType string, r io.Reader, annotations ...map[string]string) *Generic {
+	if g.err != nil {
+		return g
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		g.err = fmt.Errorf("read layer %d: %w", len(g.layers), err)
+		return g
+	}
+	if mediaType == "" {
+		mediaType = consts.UnknownLayer
+	}
+
+	g.layers = append(g.layers, genericLayer{Layer: static.NewLayer(data, types.MediaType(mediaType)), annotations: merge(annotations)})
+	return g
+}
+
+// AddStream appends the content read from rc as a layer, as AddLayer does but without reading it until the artifact is
+// added to a store, whose manifest is only known once it has been (see NewStreamLayer)
+func (g *Generic) AddStream(mediaType string, rc io.ReadCloser, annotations ...map[string]string) *Generic {
+	g.layers = append(g.layers, genericLayer{Layer: NewStreamLayer(rc, mediaType), annotations: merge(annotations)})
+	return g
+}
+
+func merge(annotations []map[string]string) map[string]string {
+	var merged map[string]string
+	for _, a := range annotations {
+		for k, v := range a {
+			if merged == nil {
+				merged = make(map[string]string)
+			}
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// WithArtifactType declares the artifact to be of artifactType, as image-spec v1.1 artifacts do
+// 	Unless it's given one WithConfig, the config of the artifact is then the empty descriptor rather than a config of
+// 	its own, and an artifact without layers gets the empty descriptor as its only layer, as the spec requires.
+func (g *Generic) WithArtifactType(artifactType string) *Generic {
+	g.artifactType = artifactType
+	return g
+}
+
+// WithAnnotations sets the annotations of the artifacts manifest
+func (g *Generic) WithAnnotations(annotations map[string]string) *Generic {
+	g.annotations = annotations
+	return g
+}
+
+// WithSubject records the manifest the artifact refers to
+func (g *Generic) WithSubject(subject v1.Descriptor) *Generic {
+	g.subject = &subject
+	return g
+}
+
+func (g *Generic) MediaType() string {
+	return consts.OCIManifestSchema1
+}
+
+func (g *Generic) Manifest() (*v1.Manifest, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	configMediaType := g.configMediaType
+	if g.artifactType != "" && configMediaType == consts.UnknownManifest {
+		configMediaType = consts.OCIEmptyMediaType
+	}
+	cfg := static.NewLayer(g.config, types.MediaType(configMediaType))
+	cfgDesc, err := partial.Descriptor(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	layers := make([]v1.Descriptor, 0, len(g.layers))
+	for _, l := range g.allLayers() {
+		desc, err := partial.Descriptor(l.Layer)
+		if err != nil {
+			return nil, err
+		}
+		desc.Annotations = l.annotations
+		layers = append(layers, *desc)
+	}
+
+	return &v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.MediaType(g.MediaType()),
+		Config:        *cfgDesc,
+		Layers:        layers,
+		Annotations:   g.annotations,
+	}, nil
+}
+
+func (g *Generic) RawManifest() ([]byte, error) {
+	return MarshalManifest(g)
+}
+
+func (g *Generic) RawConfig() ([]byte, error) {
+	return g.config, nil
+}
+
+func (g *Generic) Layers() ([]v1.Layer, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	layers := make([]v1.Layer, 0, len(g.layers))
+	for _, l := range g.allLayers() {
+		layers = append(layers, l.Layer)
+	}
+	return layers, nil
+}
+
+// allLayers returns the layers of the artifact, or the empty descriptor for typed artifacts without any
+func (g *Generic) allLayers() []genericLayer {
+	if g.artifactType == "" || len(g.layers) > 0 {
+		return g.layers
+	}
+	return []genericLayer{{Layer: static.NewLayer([]byte("{}"), consts.OCIEmptyMediaType)}}
+}
+
+func (g *Generic) Subject() *v1.Descriptor {
+	return g.subject
+}
+
+func (g *Generic) ArtifactType() string {
+	return g.artifactType
+}
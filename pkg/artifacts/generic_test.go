@@ -0,0 +1,114 @@
+package artifacts_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+func TestGeneric(t *testing.T) {
+	g := artifacts.NewGeneric().
+		WithConfig("application/vnd.example.config.v1+json", []byte(`{"hello":"world"}`)).
+		AddLayer("application/vnd.example.layer.v1", strings.NewReader("first"), map[string]string{"title": "first.txt"}).
+		AddLayer("", strings.NewReader("second")).
+		WithAnnotations(map[string]string{"team": "a"})
+
+	m, err := g.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mt := m.Config.MediaType; mt != "application/vnd.example.config.v1+json" {
+		t.Errorf("config media type = %s, want the one given", mt)
+	}
+	if len(m.Layers) != 2 {
+		t.Fatalf("manifest has %d layers, want 2", len(m.Layers))
+	}
+	if got := m.Layers[0].Annotations["title"]; got != "first.txt" {
+		t.Errorf("first layer title = %q, want first.txt", got)
+	}
+	if mt := m.Layers[1].MediaType; mt != types.MediaType(consts.UnknownLayer) {
+		t.Errorf("second layer media type = %s, want %s", mt, consts.UnknownLayer)
+	}
+	if m.Annotations["team"] != "a" {
+		t.Errorf("manifest annotations = %v, want those given", m.Annotations)
+	}
+
+	layers, err := g.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, l := range layers {
+		d, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != m.Layers[i].Digest {
+			t.Errorf("layer %d digest = %s, manifest says %s", i, d, m.Layers[i].Digest)
+		}
+	}
+}
+
+func TestGeneric_WithArtifactType(t *testing.T) {
+	// the digest of the empty descriptor of image-spec v1.1
+	const empty = "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+
+	g := artifacts.NewGeneric().WithArtifactType("application/vnd.example.data.v1")
+	m, err := g.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Config.MediaType != consts.OCIEmptyMediaType || m.Config.Digest.String() != empty || m.Config.Size != 2 {
+		t.Errorf("config = %+v, want the empty descriptor", m.Config)
+	}
+	if len(m.Layers) != 1 || m.Layers[0].MediaType != consts.OCIEmptyMediaType || m.Layers[0].Digest.String() != empty {
+		t.Errorf("layers = %+v, want only the empty descriptor", m.Layers)
+	}
+	layers, err := g.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 {
+		t.Errorf("Layers() = %d layers, want the empty descriptor", len(layers))
+	}
+
+	raw, err := g.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `"artifactType":"application/vnd.example.data.v1"`) {
+		t.Errorf("RawManifest() = %s, want its artifactType", raw)
+	}
+
+	// a config or layers given are kept
+	g = artifacts.NewGeneric().
+		WithArtifactType("application/vnd.example.data.v1").
+		WithConfig("application/vnd.example.config.v1+json", []byte(`{}`)).
+		AddLayer("application/vnd.example.layer.v1", strings.NewReader("data"))
+	if m, err = g.Manifest(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Config.MediaType != "application/vnd.example.config.v1+json" || len(m.Layers) != 1 || m.Layers[0].MediaType != "application/vnd.example.layer.v1" {
+		t.Errorf("manifest = %+v, want the config and layer given", m)
+	}
+}
+
+func TestGeneric_ReadError(t *testing.T) {
+	fail := errors.New("read failed")
+	g := artifacts.NewGeneric().AddLayer("", io.MultiReader(strings.NewReader("partial"), errReader{fail}))
+	if _, err := g.Manifest(); !errors.Is(err, fail) {
+		t.Errorf("Manifest() error = %v, want %v", err, fail)
+	}
+	if _, err := g.Layers(); !errors.Is(err, fail) {
+		t.Errorf("Layers() error = %v, want %v", err, fail)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
@@ -1,15 +1,28 @@
 package image
 
 import (
-	"github.com/google/go-containerregistry/pkg/authn"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
 	gname "github.com/google/go-containerregistry/pkg/name"
 	gv1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 
 	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
 )
 
-var _ artifacts.OCI = (*Image)(nil)
+var (
+	_ artifacts.OCI       = (*Image)(nil)
+	_ artifacts.Signed    = (*Image)(nil)
+	_ artifacts.Sourced   = (*Image)(nil)
+	_ artifacts.Converted = (*Image)(nil)
+	_ artifacts.Signed    = (*Index)(nil)
+)
 
 func (i *Image) MediaType() string {
 	mt, err := i.Image.MediaType()
@@ -19,6 +32,11 @@ func (i *Image) MediaType() string {
 	return string(mt)
 }
 
+// Source is the reference the image is pulled from
+func (i *Image) Source() string {
+	return i.Name
+}
+
 func (i *Image) RawConfig() ([]byte, error) {
 	return i.RawConfigFile()
 }
@@ -28,26 +46,159 @@ func (i *Image) RawConfig() ([]byte, error) {
 type Image struct {
 	Name string
 	gv1.Image
+
+	opts     []remote.Option
+	original bool
 }
 
+// NewImage is the image name in a remote registry, pulled with the go-containerregistry options opts
+// 	It's NewImageWith(name, WithRemoteOptions(opts...)), see NewImageWith for the options of this package.
 func NewImage(name string, opts ...remote.Option) (*Image, error) {
+	return NewImageWith(name, WithRemoteOptions(opts...))
+}
+
+// NewImageWith is the image name in a remote registry (ie: nginx:1.25), pulled through lazily
+// 	Nothing is fetched until the image is first used, and even then layers are only fetched as they're read.  Docker
+// 	schema1 images are converted to docker schema2, see WithSchema1Original to keep the manifest they're pulled as.
+func NewImageWith(name string, opts ...Option) (*Image, error) {
 	r, err := gname.ParseReference(name)
 	if err != nil {
 		return nil, err
 	}
 
-	defaultOpts := []remote.Option{
-		remote.WithAuthFromKeychain(authn.DefaultKeychain),
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	ropts, err := o.remoteOptions(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		Name:     name,
+		Image:    &remoteImage{ref: r, opts: ropts},
+		opts:     ropts,
+		original: o.original,
+	}, nil
+}
+
+// schema1Config is the config of preserved schema1 manifests, recording where they were pulled from
+type schema1Config struct {
+	Source string `json:"source"`
+	Digest string `json:"digest"`
+}
+
+// Original is the docker schema1 manifest the image was converted from, if it was and WithSchema1Original keeps it
+func (i *Image) Original() (artifacts.OCI, error) {
+	ri, ok := i.Image.(*remoteImage)
+	if !i.original || !ok {
+		return nil, nil
+	}
+	raw, mt, err := ri.schema1()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	h, _, err := gv1.SHA256(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := json.Marshal(schema1Config{Source: i.Name, Digest: h.String()})
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.NewGeneric().
+		WithConfig(consts.Schema1ConfigMediaType, cfg).
+		AddLayer(string(mt), bytes.NewReader(raw)), nil
+}
+
+// Signatures fetches the cosign signatures of the image from the repository it was pulled from
+func (i *Image) Signatures() (artifacts.OCI, error) {
+	d, err := i.Image.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return signatures(i.Name, d, i.opts)
+}
+
+// signatures fetches the cosign signatures of the manifest d from the repository of name, nil if it has none
+func signatures(name string, d gv1.Hash, opts []remote.Option) (artifacts.OCI, error) {
+	r, err := gname.ParseReference(name)
+	if err != nil {
+		return nil, err
 	}
-	opts = append(opts, defaultOpts...)
 
-	img, err := remote.Image(r, opts...)
+	tag := r.Context().Tag(fmt.Sprintf("%s-%s.%s", d.Algorithm, d.Hex, consts.CosignSignatureSuffix))
+	sig, err := remote.Image(tag, opts...)
+
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return &Image{
-		Name:  name,
-		Image: img,
+		Name:  tag.String(),
+		Image: sig,
+		opts:  opts,
+	}, nil
+}
+
+// Index is a multi-platform image, an image index or docker manifest list, identified by the Name field
+type Index struct {
+	Name string
+	gv1.ImageIndex
+
+	opts []remote.Option
+}
+
+// Signatures fetches the cosign signatures of the index from the repository it was pulled from
+func (i *Index) Signatures() (artifacts.OCI, error) {
+	d, err := i.ImageIndex.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return signatures(i.Name, d, i.opts)
+}
+
+// Source is the reference the index is pulled from
+func (i *Index) Source() string {
+	return i.Name
+}
+
+// NewIndex is the index name in a remote registry, pulled with the go-containerregistry options opts
+// 	It's NewIndexWith(name, WithRemoteOptions(opts...)), see NewIndexWith for the options of this package.
+func NewIndex(name string, opts ...remote.Option) (*Index, error) {
+	return NewIndexWith(name, WithRemoteOptions(opts...))
+}
+
+// NewIndexWith is the index name in a remote registry, pulled with opts
+func NewIndexWith(name string, opts ...Option) (*Index, error) {
+	r, err := gname.ParseReference(name)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	ropts, err := o.remoteOptions(r)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := remote.Index(r, ropts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Index{
+		Name:       name,
+		ImageIndex: idx,
+		opts:       ropts,
 	}, nil
 }
@@ -1 +1,374 @@
 package image_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/image"
+)
+
+func TestImage_Signatures(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	tests := []struct {
+		name   string
+		signed bool
+	}{
+		{
+			name:   "should fetch the signatures of a signed image",
+			signed: true,
+		},
+		{
+			name:   "should return nil for an unsigned image",
+			signed: false,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := fmt.Sprintf("%s/hello/world%d:v1", host, i)
+			img, err := random.Image(1024, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := write(ref, img); err != nil {
+				t.Fatal(err)
+			}
+
+			sig, err := random.Image(128, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.signed {
+				d, err := img.Digest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				sigRef := fmt.Sprintf("%s/hello/world%d:%s-%s.sig", host, i, d.Algorithm, d.Hex)
+				if err := write(sigRef, sig); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			in, err := image.NewImage(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := in.Signatures()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.signed {
+				if got != nil {
+					t.Errorf("Signatures() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("Signatures() = nil, want the signature image")
+			}
+			m, err := got.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := sig.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Config.Digest != want.Config.Digest {
+				t.Errorf("Signatures() config = %s, want %s", m.Config.Digest, want.Config.Digest)
+			}
+		})
+	}
+}
+
+func TestNewImageWith(t *testing.T) {
+	reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	auth := image.WithAuth(&authn.Basic{Username: "user", Password: "pass"})
+
+	amd64, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arm64, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: amd64, Descriptor: gv1.Descriptor{Platform: &gv1.Platform{OS: "linux", Architecture: "amd64"}}},
+		mutate.IndexAddendum{Add: arm64, Descriptor: gv1.Descriptor{Platform: &gv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}}},
+	)
+	r, err := gname.ParseReference(host + "/hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(r, idx, remote.WithAuth(&authn.Basic{Username: "user", Password: "pass"})); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ref     string
+		opts    []image.Option
+		want    gv1.Image
+		wantErr bool
+	}{
+		{
+			name: "should pull the default platform",
+			ref:  host + "/hello/world:v1",
+			opts: []image.Option{auth},
+			want: amd64,
+		},
+		{
+			name: "should pull the selected platform",
+			ref:  host + "/hello/world:v1",
+			opts: []image.Option{auth, image.WithPlatform("linux/arm64")},
+			want: arm64,
+		},
+		{
+			name:    "should fail to pull without credentials",
+			ref:     host + "/hello/world:v1",
+			opts:    []image.Option{image.WithKeychain(authn.NewMultiKeychain())},
+			wantErr: true,
+		},
+		{
+			name:    "should only fail to pull a missing image once used",
+			ref:     host + "/hello/missing:v1",
+			opts:    []image.Option{auth},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := image.NewImageWith(tt.ref, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := img.Digest()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Digest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			want, err := tt.want.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("Digest() = %s, want %s", got, want)
+			}
+		})
+	}
+
+	// go-containerregistry options are still taken as they are
+	img, err := image.NewImage(host+"/hello/world:v1", remote.WithAuth(&authn.Basic{Username: "user", Password: "pass"}), remote.WithPlatform(gv1.Platform{OS: "linux", Architecture: "arm64"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := arm64.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("NewImage() with remote options = %s, want %s", got, want)
+	}
+	if _, err := image.NewIndex(host+"/hello/world:v1", remote.WithAuth(&authn.Basic{Username: "user", Password: "pass"})); err != nil {
+		t.Errorf("NewIndex() with remote options: %v", err)
+	}
+}
+
+func TestNewImage_Schema1(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	ref := host + "/hello/legacy:v1"
+	want, raw := writeSchema1(t, ref)
+
+	img, err := image.NewImageWith(ref, image.WithSchema1Original())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mt := img.MediaType(); mt != string(types.DockerManifestSchema2) {
+		t.Errorf("MediaType() = %s, want %s", mt, types.DockerManifestSchema2)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCfg, err := want.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.RootFS.DiffIDs, wantCfg.RootFS.DiffIDs) {
+		t.Errorf("ConfigFile() diff ids = %v, want %v", cfg.RootFS.DiffIDs, wantCfg.RootFS.DiffIDs)
+	}
+	if cfg.Architecture != "arm64" || len(cfg.History) != 3 || !cfg.History[2].EmptyLayer || cfg.History[2].CreatedBy != "/bin/sh -c #(nop) CMD [\"sh\"]" {
+		t.Errorf("ConfigFile() = %+v, want the arm64 config and history of the schema1 manifest", cfg)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLayers, err := want.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, l := range layers {
+		got, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w, _ := wantLayers[i].Digest(); got != w {
+			t.Errorf("Layers()[%d] = %s, want %s", i, got, w)
+		}
+	}
+
+	orig, err := img.Original()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orig == nil {
+		t.Fatal("Original() = nil, want the schema1 manifest")
+	}
+	ls, err := orig.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 {
+		t.Fatalf("Original() has %d layers, want 1", len(ls))
+	}
+	rc, err := ls[0].Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Errorf("Original() = %s, want %s", got, raw)
+	}
+
+	unkept, err := image.NewImage(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orig, err := unkept.Original(); err != nil || orig != nil {
+		t.Errorf("Original() without WithSchema1Original = %v, %v, want nil", orig, err)
+	}
+}
+
+// writeSchema1 pushes the layers of a random image to ref, under a docker schema1 manifest with a throwaway entry for
+// an empty layer on top
+func writeSchema1(t *testing.T, ref string) (gv1.Image, []byte) {
+	t.Helper()
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type blob struct {
+		BlobSum string `json:"blobSum"`
+	}
+	type entry struct {
+		V1Compatibility string `json:"v1Compatibility"`
+	}
+	m := struct {
+		SchemaVersion int     `json:"schemaVersion"`
+		Name          string  `json:"name"`
+		Tag           string  `json:"tag"`
+		Architecture  string  `json:"architecture"`
+		FSLayers      []blob  `json:"fsLayers"`
+		History       []entry `json:"history"`
+	}{SchemaVersion: 1, Name: "hello/legacy", Tag: "v1", Architecture: "arm64"}
+
+	m.FSLayers = append(m.FSLayers, blob{BlobSum: "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"})
+	m.History = append(m.History, entry{V1Compatibility: `{"id":"c","parent":"b","architecture":"arm64","os":"linux","config":{"Cmd":["sh"]},"container_config":{"Cmd":["/bin/sh","-c","#(nop) CMD [\"sh\"]"]},"throwaway":true}`})
+	for i := len(layers) - 1; i >= 0; i-- {
+		if err := remote.WriteLayer(r.Context(), layers[i]); err != nil {
+			t.Fatal(err)
+		}
+		d, err := layers[i].Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.FSLayers = append(m.FSLayers, blob{BlobSum: d.String()})
+		m.History = append(m.History, entry{V1Compatibility: fmt.Sprintf(`{"id":"%d","container_config":{"Cmd":["/bin/sh","-c","add layer %d"]}}`, i, i)})
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s/v2/%s/manifests/%s", r.Context().RegistryStr(), r.Context().RepositoryStr(), r.Identifier()), bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", string(types.DockerManifestSchema1))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT schema1 manifest: %s", resp.Status)
+	}
+	return img, raw
+}
+
+func write(ref string, img gv1.Image) error {
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return err
+	}
+	return remote.Write(r, img)
+}
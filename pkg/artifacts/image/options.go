@@ -0,0 +1,94 @@
+package image
+
+import (
+	"github.com/google/go-containerregistry/pkg/authn"
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+type Option func(*options)
+
+type options struct {
+	platform string
+	auth     authn.Authenticator
+	keychain authn.Keychain
+	remote   []remote.Option
+	original bool
+}
+
+// WithPlatform selects the manifest matching platform (ie: linux/arm64/v8) when the reference is an index, instead of
+// the default linux/amd64
+func WithPlatform(platform string) Option {
+	return func(o *options) {
+		o.platform = platform
+	}
+}
+
+// WithAuth authenticates to the registry with auth, ie: authn.FromConfig(authn.AuthConfig{...})
+func WithAuth(auth authn.Authenticator) Option {
+	return func(o *options) {
+		o.auth = auth
+	}
+}
+
+// WithKeychain resolves the credentials for the registry from keychain instead of the default docker config keychain
+func WithKeychain(keychain authn.Keychain) Option {
+	return func(o *options) {
+		o.keychain = keychain
+	}
+}
+
+// WithSchema1Original keeps the docker schema1 manifest of images converted as they're pulled, so the store attaches it
+// to the converted manifest for auditing
+func WithSchema1Original() Option {
+	return func(o *options) {
+		o.original = true
+	}
+}
+
+// WithRemoteOptions passes opts through to go-containerregistry for anything else, ie: remote.WithTransport
+func WithRemoteOptions(opts ...remote.Option) Option {
+	return func(o *options) {
+		o.remote = append(o.remote, opts...)
+	}
+}
+
+// remoteOptions converts the options to those of go-containerregistry for pulling from the repository of r
+func (o *options) remoteOptions(r gname.Reference) ([]remote.Option, error) {
+	var opts []remote.Option
+	switch {
+	case o.auth != nil:
+		opts = append(opts, remote.WithAuth(o.auth))
+	case o.keychain != nil:
+		opts = append(opts, remote.WithAuthFromKeychain(o.keychain))
+	default:
+		// go-containerregistry prefers a keychain to any authenticator, so the default one is resolved as an
+		// authenticator for remote.WithAuth passed through to override
+		opts = append(opts, remote.WithAuth(&keychainAuth{keychain: authn.DefaultKeychain, resource: r.Context()}))
+	}
+
+	if o.platform != "" {
+		p, err := parsePlatform(o.platform)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, remote.WithPlatform(p))
+	}
+
+	// anything passed through explicitly wins
+	return append(opts, o.remote...), nil
+}
+
+// keychainAuth authenticates to resource with the credentials keychain has for it, resolved as they're needed
+type keychainAuth struct {
+	keychain authn.Keychain
+	resource authn.Resource
+}
+
+func (a *keychainAuth) Authorization() (*authn.AuthConfig, error) {
+	auth, err := a.keychain.Resolve(a.resource)
+	if err != nil {
+		return nil, err
+	}
+	return auth.Authorization()
+}
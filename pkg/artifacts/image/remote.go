@@ -0,0 +1,159 @@
+package image
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/containerd/containerd/platforms"
+	gname "github.com/google/go-containerregistry/pkg/name"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+var _ gv1.Image = (*remoteImage)(nil)
+
+// remoteImage is a gv1.Image that isn't fetched from its registry until it's first used
+type remoteImage struct {
+	ref  gname.Reference
+	opts []remote.Option
+
+	once sync.Once
+	img  gv1.Image
+	err  error
+
+	// original is the docker schema1 manifest img was converted from, if it was
+	original     []byte
+	originalType types.MediaType
+}
+
+func (r *remoteImage) image() (gv1.Image, error) {
+	r.once.Do(func() {
+		r.img, r.err = remote.Image(r.ref, r.opts...)
+
+		// go-containerregistry refuses schema1, yet still fetches it as a plain descriptor
+		var serr *remote.ErrSchema1
+		if !errors.As(r.err, &serr) {
+			return
+		}
+		desc, err := remote.Get(r.ref, r.opts...)
+		if err != nil {
+			r.err = err
+			return
+		}
+		r.original, r.originalType = desc.Manifest, desc.MediaType
+		r.img, r.err = convertSchema1(r.ref, desc.Manifest, r.opts...)
+	})
+	return r.img, r.err
+}
+
+// schema1 returns the docker schema1 manifest the image was converted from, and its media type, or nil if it wasn't
+func (r *remoteImage) schema1() ([]byte, types.MediaType, error) {
+	if _, err := r.image(); err != nil {
+		return nil, "", err
+	}
+	return r.original, r.originalType, nil
+}
+
+func (r *remoteImage) Layers() ([]gv1.Layer, error) {
+	img, err := r.image()
+	if err != nil {
+		return nil, err
+	}
+	return img.Layers()
+}
+
+func (r *remoteImage) MediaType() (types.MediaType, error) {
+	img, err := r.image()
+	if err != nil {
+		return "", err
+	}
+	return img.MediaType()
+}
+
+func (r *remoteImage) Size() (int64, error) {
+	img, err := r.image()
+	if err != nil {
+		return 0, err
+	}
+	return img.Size()
+}
+
+func (r *remoteImage) ConfigName() (gv1.Hash, error) {
+	img, err := r.image()
+	if err != nil {
+		return gv1.Hash{}, err
+	}
+	return img.ConfigName()
+}
+
+func (r *remoteImage) ConfigFile() (*gv1.ConfigFile, error) {
+	img, err := r.image()
+	if err != nil {
+		return nil, err
+	}
+	return img.ConfigFile()
+}
+
+func (r *remoteImage) RawConfigFile() ([]byte, error) {
+	img, err := r.image()
+	if err != nil {
+		return nil, err
+	}
+	return img.RawConfigFile()
+}
+
+func (r *remoteImage) Digest() (gv1.Hash, error) {
+	img, err := r.image()
+	if err != nil {
+		return gv1.Hash{}, err
+	}
+	return img.Digest()
+}
+
+func (r *remoteImage) Manifest() (*gv1.Manifest, error) {
+	img, err := r.image()
+	if err != nil {
+		return nil, err
+	}
+	return img.Manifest()
+}
+
+func (r *remoteImage) RawManifest() ([]byte, error) {
+	img, err := r.image()
+	if err != nil {
+		return nil, err
+	}
+	return img.RawManifest()
+}
+
+func (r *remoteImage) LayerByDigest(h gv1.Hash) (gv1.Layer, error) {
+	img, err := r.image()
+	if err != nil {
+		return nil, err
+	}
+	return img.LayerByDigest(h)
+}
+
+func (r *remoteImage) LayerByDiffID(h gv1.Hash) (gv1.Layer, error) {
+	img, err := r.image()
+	if err != nil {
+		return nil, err
+	}
+	return img.LayerByDiffID(h)
+}
+
+// parsePlatform parses platform specifiers the way containerd does, ie: linux/arm64/v8 or just arm64
+func parsePlatform(platform string) (gv1.Platform, error) {
+	p, err := platforms.Parse(platform)
+	if err != nil {
+		return gv1.Platform{}, err
+	}
+	return gv1.Platform{
+		OS:           p.OS,
+		Architecture: p.Architecture,
+		Variant:      p.Variant,
+		OSVersion:    p.OSVersion,
+		OSFeatures:   p.OSFeatures,
+	}, nil
+}
@@ -0,0 +1,206 @@
+package image
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// ErrInvalidSchema1 is returned for docker schema1 manifests that can't be converted, ie: without any history
+var ErrInvalidSchema1 = errors.New("invalid schema1 manifest")
+
+// schema1Manifest is the part of a docker schema1 manifest needed to convert it, its layers and history newest first
+type schema1Manifest struct {
+	SchemaVersion int `json:"schemaVersion"`
+	FSLayers      []struct {
+		BlobSum string `json:"blobSum"`
+	} `json:"fsLayers"`
+	History []struct {
+		V1Compatibility string `json:"v1Compatibility"`
+	} `json:"history"`
+}
+
+// v1Compatibility is the part of a schema1 history entry that ends up in the history of the converted config
+type v1Compatibility struct {
+	Created         time.Time `json:"created"`
+	Author          string    `json:"author,omitempty"`
+	Comment         string    `json:"comment,omitempty"`
+	ThrowAway       bool      `json:"throwaway,omitempty"`
+	ContainerConfig struct {
+		Cmd []string `json:"Cmd"`
+	} `json:"container_config"`
+}
+
+// schema1 is a docker schema1 image converted to a docker schema2 one
+type schema1 struct {
+	manifest []byte
+	config   []byte
+	layers   map[gv1.Hash]gv1.Layer
+}
+
+var _ partial.CompressedImageCore = (*schema1)(nil)
+
+func (s *schema1) RawConfigFile() ([]byte, error) {
+	return s.config, nil
+}
+
+func (s *schema1) MediaType() (types.MediaType, error) {
+	return types.DockerManifestSchema2, nil
+}
+
+func (s *schema1) RawManifest() ([]byte, error) {
+	return s.manifest, nil
+}
+
+func (s *schema1) LayerByDigest(h gv1.Hash) (partial.CompressedLayer, error) {
+	l, ok := s.layers[h]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not found", h)
+	}
+	return l, nil
+}
+
+// convertSchema1 converts the docker schema1 manifest raw, pulled from ref, to a docker schema2 image
+// 	Schema1 manifests don't carry a config, so it's rebuilt from the newest history entry, which means reading every
+// 	layer once to compute the diff ids only the config holds.
+func convertSchema1(ref gname.Reference, raw []byte, opts ...remote.Option) (gv1.Image, error) {
+	var m schema1Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema1, err)
+	}
+	if m.SchemaVersion != 1 || len(m.History) == 0 || len(m.History) != len(m.FSLayers) {
+		return nil, fmt.Errorf("%w: %d layers and %d history entries", ErrInvalidSchema1, len(m.FSLayers), len(m.History))
+	}
+
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(m.History[0].V1Compatibility), &config); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema1, err)
+	}
+	// everything specific to the v1 image id chain has no place in a schema2 config
+	for _, k := range []string{"id", "parent", "Size", "parent_id", "layer_id", "throwaway"} {
+		delete(config, k)
+	}
+
+	s := &schema1{layers: make(map[gv1.Hash]gv1.Layer)}
+	var history []gv1.History
+	var diffIDs []gv1.Hash
+	var descs []gv1.Descriptor
+
+	// schema1 lists its layers newest first, schema2 oldest first
+	for i := len(m.History) - 1; i >= 0; i-- {
+		var v1c v1Compatibility
+		if err := json.Unmarshal([]byte(m.History[i].V1Compatibility), &v1c); err != nil {
+			return nil, fmt.Errorf("%w: history %d: %v", ErrInvalidSchema1, i, err)
+		}
+		history = append(history, gv1.History{
+			Created:    gv1.Time{Time: v1c.Created},
+			CreatedBy:  strings.Join(v1c.ContainerConfig.Cmd, " "),
+			Author:     v1c.Author,
+			Comment:    v1c.Comment,
+			EmptyLayer: v1c.ThrowAway,
+		})
+		if v1c.ThrowAway {
+			continue
+		}
+
+		h, err := gv1.NewHash(m.FSLayers[i].BlobSum)
+		if err != nil {
+			return nil, fmt.Errorf("%w: layer %d: %v", ErrInvalidSchema1, i, err)
+		}
+		l, err := remote.Layer(ref.Context().Digest(h.String()), opts...)
+		if err != nil {
+			return nil, err
+		}
+		size, diffID, err := measure(l)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %w", h, err)
+		}
+
+		s.layers[h] = l
+		diffIDs = append(diffIDs, diffID)
+		descs = append(descs, gv1.Descriptor{MediaType: types.DockerLayer, Size: size, Digest: h})
+	}
+
+	for k, v := range map[string]interface{}{
+		"rootfs":  gv1.RootFS{Type: "layers", DiffIDs: diffIDs},
+		"history": history,
+	} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		config[k] = data
+	}
+
+	var err error
+	if s.config, err = json.Marshal(config); err != nil {
+		return nil, err
+	}
+	cfgHash, cfgSize, err := gv1.SHA256(bytes.NewReader(s.config))
+	if err != nil {
+		return nil, err
+	}
+
+	s.manifest, err = json.Marshal(gv1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.DockerManifestSchema2,
+		Config:        gv1.Descriptor{MediaType: consts.DockerConfigJSON, Size: cfgSize, Digest: cfgHash},
+		Layers:        descs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return partial.CompressedToImage(s)
+}
+
+// measure reads the compressed layer l once, for both its size and the digest of its uncompressed content
+func measure(l gv1.Layer) (int64, gv1.Hash, error) {
+	rc, err := l.Compressed()
+	if err != nil {
+		return 0, gv1.Hash{}, err
+	}
+	defer rc.Close()
+
+	cr := &countingReader{Reader: rc}
+	zr, err := gzip.NewReader(cr)
+	if err != nil {
+		return 0, gv1.Hash{}, err
+	}
+	defer zr.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, zr); err != nil {
+		return 0, gv1.Hash{}, err
+	}
+	// drain anything trailing the gzip stream, so the size is that of the whole blob
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return 0, gv1.Hash{}, err
+	}
+	return cr.n, gv1.Hash{Algorithm: "sha256", Hex: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,41 @@
+package artifacts
+
+import (
+	"encoding/json"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+)
+
+// WithManifest is implemented by anything that can build a manifest, ie: every OCI
+type WithManifest interface {
+	Manifest() (*v1.Manifest, error)
+}
+
+// MarshalManifest serializes the manifest of m, along with its subject if it's also a Referrer and its artifactType if
+// it's also Typed
+// 	Artifacts that build their manifest rather than fetch it use it as their RawManifest.
+func MarshalManifest(m WithManifest) ([]byte, error) {
+	manifest, err := m.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var subject *v1.Descriptor
+	if r, ok := m.(Referrer); ok {
+		subject = r.Subject()
+	}
+	var artifactType string
+	if t, ok := m.(Typed); ok {
+		artifactType = t.ArtifactType()
+	}
+	if subject == nil && artifactType == "" {
+		return json.Marshal(manifest)
+	}
+
+	// image-spec v1.0 (and so v1.Manifest) predates the subject and artifactType fields
+	return json.Marshal(struct {
+		*v1.Manifest
+		ArtifactType string         `json:"artifactType,omitempty"`
+		Subject      *v1.Descriptor `json:"subject,omitempty"`
+	}{manifest, artifactType, subject})
+}
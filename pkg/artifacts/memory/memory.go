@@ -64,6 +64,10 @@ func (m *Memory) Manifest() (*v1.Manifest, error) {
 	return manifest, nil
 }
 
+func (m *Memory) RawManifest() ([]byte, error) {
+	return artifacts.MarshalManifest(m)
+}
+
 func (m *Memory) RawConfig() ([]byte, error) {
 	if m.config == nil {
 		return []byte(`{}`), nil
@@ -10,11 +10,45 @@ type OCI interface {
 
 	Manifest() (*v1.Manifest, error)
 
+	// RawManifest returns the exact bytes of the manifest, which stores keep as they are so its digest is preserved
+	RawManifest() ([]byte, error)
+
 	RawConfig() ([]byte, error)
 
 	Layers() ([]v1.Layer, error)
 }
 
+// Signed is implemented by artifacts that can fetch their own cosign signatures
+type Signed interface {
+	// Signatures returns the artifacts cosign signature image, or nil if it isn't signed
+	Signatures() (OCI, error)
+}
+
+// Converted is implemented by artifacts converted from another format as they're pulled, ie: docker schema1 images
+type Converted interface {
+	// Original returns what the artifact was converted from, or nil if it wasn't converted or isn't kept
+	Original() (OCI, error)
+}
+
+// Referrer is implemented by artifacts that refer to another manifest, ie: an sbom describing an image
+type Referrer interface {
+	// Subject returns the descriptor of the manifest referred to, or nil if there is none
+	Subject() *v1.Descriptor
+}
+
+// Typed is implemented by artifacts that declare what they are with the artifactType of image-spec v1.1, rather than
+// through the media type of their config
+type Typed interface {
+	// ArtifactType returns the artifactType of the manifest, or "" if it has none
+	ArtifactType() string
+}
+
+// Sourced is implemented by artifacts that know where they were fetched from
+type Sourced interface {
+	// Source returns the url, path or image reference the artifact was fetched from
+	Source() string
+}
+
 type OCICollection interface {
 	// Contents returns the list of contents in the collection
 	Contents() (map[string]OCI, error)
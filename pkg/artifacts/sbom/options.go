@@ -0,0 +1,25 @@
+package sbom
+
+import v1 "github.com/google/go-containerregistry/pkg/v1"
+
+type Option func(*SBOM)
+
+// WithMediaType sets the media type of the document, instead of detecting it
+func WithMediaType(mediaType string) Option {
+	return func(s *SBOM) {
+		s.mediaType = mediaType
+	}
+}
+
+// WithSubject records the manifest the document describes
+func WithSubject(subject v1.Descriptor) Option {
+	return func(s *SBOM) {
+		s.subject = &subject
+	}
+}
+
+func WithAnnotations(annotations map[string]string) Option {
+	return func(s *SBOM) {
+		s.annotations = annotations
+	}
+}
@@ -0,0 +1,118 @@
+package sbom
+
+import (
+	"encoding/json"
+	"errors"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+var (
+	_ artifacts.OCI      = (*SBOM)(nil)
+	_ artifacts.Referrer = (*SBOM)(nil)
+)
+
+// ErrUnknownFormat is returned for documents that are neither SPDX nor CycloneDX json
+var ErrUnknownFormat = errors.New("unknown sbom format")
+
+// SBOM implements the OCI interface for an SPDX or CycloneDX json document, optionally referring to the image it
+// describes
+type SBOM struct {
+	data        []byte
+	mediaType   string
+	subject     *v1.Descriptor
+	annotations map[string]string
+}
+
+type sbomConfig struct {
+	MediaType string `json:"mediaType,omitempty"`
+}
+
+func NewSBOM(data []byte, opts ...Option) (*SBOM, error) {
+	s := &SBOM{data: data}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.mediaType == "" {
+		mt, err := Detect(data)
+		if err != nil {
+			return nil, err
+		}
+		s.mediaType = mt
+	}
+	return s, nil
+}
+
+// Detect returns the media type of the sbom document data
+func Detect(data []byte) (string, error) {
+	var doc struct {
+		SPDXVersion string `json:"spdxVersion"`
+		BOMFormat   string `json:"bomFormat"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", ErrUnknownFormat
+	}
+
+	switch {
+	case doc.SPDXVersion != "":
+		return consts.SPDXJSONMediaType, nil
+	case doc.BOMFormat == "CycloneDX":
+		return consts.CycloneDXJSONMediaType, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+func (s *SBOM) MediaType() string {
+	return consts.OCIManifestSchema1
+}
+
+func (s *SBOM) Manifest() (*v1.Manifest, error) {
+	layer, err := partial.Descriptor(s.layer())
+	if err != nil {
+		return nil, err
+	}
+
+	cfgDesc, err := partial.Descriptor(s.config())
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.MediaType(s.MediaType()),
+		Config:        *cfgDesc,
+		Layers:        []v1.Descriptor{*layer},
+		Annotations:   s.annotations,
+	}, nil
+}
+
+func (s *SBOM) RawManifest() ([]byte, error) {
+	return artifacts.MarshalManifest(s)
+}
+
+func (s *SBOM) RawConfig() ([]byte, error) {
+	return s.config().Raw()
+}
+
+func (s *SBOM) Layers() ([]v1.Layer, error) {
+	return []v1.Layer{s.layer()}, nil
+}
+
+func (s *SBOM) Subject() *v1.Descriptor {
+	return s.subject
+}
+
+func (s *SBOM) layer() v1.Layer {
+	return static.NewLayer(s.data, types.MediaType(s.mediaType))
+}
+
+func (s *SBOM) config() artifacts.Config {
+	return artifacts.ToConfig(sbomConfig{MediaType: s.mediaType}, artifacts.WithConfigMediaType(consts.SBOMConfigMediaType))
+}
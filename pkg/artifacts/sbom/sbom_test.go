@@ -0,0 +1,76 @@
+package sbom_test
+
+import (
+	"errors"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/sbom"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+func TestNewSBOM(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		opts    []sbom.Option
+		want    string
+		wantErr error
+	}{
+		{
+			name: "should detect spdx",
+			data: `{"spdxVersion": "SPDX-2.3", "name": "hello"}`,
+			want: consts.SPDXJSONMediaType,
+		},
+		{
+			name: "should detect cyclonedx",
+			data: `{"bomFormat": "CycloneDX", "specVersion": "1.4"}`,
+			want: consts.CycloneDXJSONMediaType,
+		},
+		{
+			name: "should prefer an explicit media type",
+			data: `not json`,
+			opts: []sbom.Option{sbom.WithMediaType("text/spdx")},
+			want: "text/spdx",
+		},
+		{
+			name:    "should reject unknown documents",
+			data:    `{"hello": "world"}`,
+			wantErr: sbom.ErrUnknownFormat,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := sbom.NewSBOM([]byte(tt.data), tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewSBOM() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			m, err := s.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Layers) != 1 || string(m.Layers[0].MediaType) != tt.want {
+				t.Errorf("Manifest() layers = %+v, want a single %s layer", m.Layers, tt.want)
+			}
+			if string(m.Config.MediaType) != consts.SBOMConfigMediaType {
+				t.Errorf("Manifest() config media type = %s, want %s", m.Config.MediaType, consts.SBOMConfigMediaType)
+			}
+		})
+	}
+}
+
+func TestSBOM_Subject(t *testing.T) {
+	subject := v1.Descriptor{MediaType: consts.OCIManifestSchema1, Size: 1}
+	s, err := sbom.NewSBOM([]byte(`{"spdxVersion": "SPDX-2.3"}`), sbom.WithSubject(subject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Subject(); got == nil || got.MediaType != subject.MediaType {
+		t.Errorf("Subject() = %v, want %v", got, subject)
+	}
+}
@@ -0,0 +1,115 @@
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/stream"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+var _ v1.Layer = (*streamLayer)(nil)
+
+var (
+	// ErrNotComputed is returned for the digest and size of a streamed layer that hasn't been read through yet
+	// 	It's that of go-containerregistry, so its gzipped stream.Layer is streamed into the store the same way.
+	ErrNotComputed = stream.ErrNotComputed
+
+	// ErrConsumed is returned for reads of a streamed layer that has already been read
+	ErrConsumed = stream.ErrConsumed
+)
+
+// NewStreamLayer is a layer of the content read from rc, stored as is, ie: a pipe, network stream or generated content
+// 	The content is only read once, and its digest and size aren't known until it has been read through, so the
+// 	artifacts manifest can't be either.  The store writes the layers of an artifact before asking for its manifest, so
+// 	artifacts computing their manifest from their layers (as NewGeneric does) can be added with stream layers.
+func NewStreamLayer(rc io.ReadCloser, mediaType string) v1.Layer {
+	if mediaType == "" {
+		mediaType = consts.UnknownLayer
+	}
+	return &streamLayer{rc: rc, mediaType: mediaType}
+}
+
+type streamLayer struct {
+	mediaType string
+
+	mu       sync.Mutex
+	rc       io.ReadCloser
+	consumed bool
+	computed bool
+	digest   v1.Hash
+	size     int64
+}
+
+func (s *streamLayer) Digest() (v1.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.computed {
+		return v1.Hash{}, ErrNotComputed
+	}
+	return s.digest, nil
+}
+
+// DiffID is the Digest, since the content is stored as is
+func (s *streamLayer) DiffID() (v1.Hash, error) {
+	return s.Digest()
+}
+
+func (s *streamLayer) Size() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.computed {
+		return 0, ErrNotComputed
+	}
+	return s.size, nil
+}
+
+func (s *streamLayer) MediaType() (types.MediaType, error) {
+	return types.MediaType(s.mediaType), nil
+}
+
+func (s *streamLayer) Compressed() (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.consumed {
+		return nil, ErrConsumed
+	}
+	s.consumed = true
+	return &streamReader{s: s, h: sha256.New()}, nil
+}
+
+func (s *streamLayer) Uncompressed() (io.ReadCloser, error) {
+	return s.Compressed()
+}
+
+// streamReader hashes and counts what's read of the stream, computing its digest and size once it's been read through
+type streamReader struct {
+	s *streamLayer
+	h hash.Hash
+	n int64
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	n, err := r.s.rc.Read(p)
+	r.h.Write(p[:n])
+	r.n += int64(n)
+	if errors.Is(err, io.EOF) {
+		r.s.mu.Lock()
+		r.s.digest = v1.Hash{Algorithm: "sha256", Hex: hex.EncodeToString(r.h.Sum(nil))}
+		r.s.size = r.n
+		r.s.computed = true
+		r.s.mu.Unlock()
+	}
+	return n, err
+}
+
+func (r *streamReader) Close() error {
+	return r.s.rc.Close()
+}
@@ -0,0 +1,49 @@
+package artifacts_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+)
+
+func TestNewStreamLayer(t *testing.T) {
+	data := "streamed content"
+	l := artifacts.NewStreamLayer(ioutil.NopCloser(strings.NewReader(data)), "")
+
+	if _, err := l.Digest(); !errors.Is(err, artifacts.ErrNotComputed) {
+		t.Fatalf("Digest() before reading error = %v, want %v", err, artifacts.ErrNotComputed)
+	}
+
+	rc, err := l.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("read %q, want %q", got, data)
+	}
+
+	want, _, err := v1.SHA256(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := l.Digest(); err != nil || d != want {
+		t.Errorf("Digest() = %s, %v, want %s", d, err, want)
+	}
+	if size, err := l.Size(); err != nil || size != int64(len(data)) {
+		t.Errorf("Size() = %d, %v, want %d", size, err, len(data))
+	}
+	if _, err := l.Compressed(); !errors.Is(err, artifacts.ErrConsumed) {
+		t.Errorf("second Compressed() error = %v, want %v", err, artifacts.ErrConsumed)
+	}
+}
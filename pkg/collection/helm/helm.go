@@ -0,0 +1,130 @@
+package helm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/chart"
+	"github.com/rancherfederal/ocil/pkg/artifacts/file/getter"
+	"github.com/rancherfederal/ocil/pkg/collection/k8s"
+)
+
+// interface guard
+var _ artifacts.OCICollection = (*Chart)(nil)
+
+// Chart is the collection of a helm chart and every image it runs once rendered, those of its subcharts included
+type Chart struct {
+	chart  *chart.Chart
+	ref    string
+	images *k8s.Images
+}
+
+// NewChart fetches the packaged chart at source (any source a file can be fetched from) and renders it with helm
+// template, discovering the images of everything rendered
+// 	Subcharts are rendered along with the chart, so they must be packaged in it, as helm dependency build does.
+func NewChart(ctx context.Context, source string, opts ...Option) (*Chart, error) {
+	o := &options{helm: "helm"}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.client == nil {
+		o.client = getter.NewClient(getter.ClientOptions{})
+	}
+
+	rc, err := o.client.ContentFrom(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := chart.NewChart(data, chart.WithAnnotations(o.annotations))
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := o.render(ctx, ch, data)
+	if err != nil {
+		return nil, err
+	}
+	images, err := k8s.NewImages(rendered, o.image...)
+	if err != nil {
+		return nil, fmt.Errorf("discover images of chart %s: %w", ch.Reference(), err)
+	}
+
+	ref := o.ref
+	if ref == "" {
+		ref = ch.Reference()
+	}
+	return &Chart{chart: ch, ref: ref, images: images}, nil
+}
+
+// Images returns every image the rendered chart runs, sorted
+func (c *Chart) Images() []string {
+	return c.images.References()
+}
+
+// Contents returns the chart under its reference, and an image of every reference it runs
+func (c *Chart) Contents() (map[string]artifacts.OCI, error) {
+	contents, err := c.images.Contents()
+	if err != nil {
+		return nil, err
+	}
+	contents[c.ref] = c.chart
+	return contents, nil
+}
+
+// render runs helm template against the packaged chart data, returning the manifests rendered
+func (o *options) render(ctx context.Context, ch *chart.Chart, data []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "ocil-helm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	pkg := filepath.Join(dir, "chart.tgz")
+	if err := os.WriteFile(pkg, data, 0600); err != nil {
+		return nil, err
+	}
+
+	release := o.release
+	if release == "" {
+		release = ch.Metadata().Name
+	}
+	args := []string{"template", release, pkg}
+	for _, f := range o.valuesFiles {
+		args = append(args, "--values", f)
+	}
+	if o.values != nil {
+		values, err := yaml.Marshal(o.values)
+		if err != nil {
+			return nil, fmt.Errorf("marshal values: %w", err)
+		}
+		f := filepath.Join(dir, "values.yaml")
+		if err := os.WriteFile(f, values, 0600); err != nil {
+			return nil, err
+		}
+		args = append(args, "--values", f)
+	}
+	args = append(args, o.args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, o.helm, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("helm template: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
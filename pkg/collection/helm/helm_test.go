@@ -0,0 +1,105 @@
+package helm_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/collection/helm"
+)
+
+func TestNewChart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helm is a shell script")
+	}
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "helm")
+	script := "#!/bin/sh\n" +
+		// the chart is rendered with the images of its subchart, and a sidecar only when the values ask for one
+		"[ \"$1\" = template ] && [ \"$2\" = web ] && [ -s \"$3\" ] || { echo bad args >&2; exit 1; }\n" +
+		"while [ $# -gt 0 ]; do [ \"$1\" = --values ] && grep -q 'sidecar: true' \"$2\" && sidecar=1; shift; done\n" +
+		"cat <<EOF\n" +
+		"---\n# Source: web/templates/deployment.yaml\nkind: Deployment\nspec:\n  template:\n    spec:\n      containers:\n      - image: nginx:1.21\n" +
+		"---\n# Source: web/charts/redis/templates/statefulset.yaml\nkind: StatefulSet\nspec:\n  template:\n    spec:\n      containers:\n      - image: redis:6.2\n" +
+		"EOF\n" +
+		"[ -n \"$sidecar\" ] && printf -- '---\\nkind: Pod\\nspec:\\n  containers:\\n  - image: envoy:1.20\\n'\n" +
+		"exit 0\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := filepath.Join(dir, "web-1.0.0.tgz")
+	if err := os.WriteFile(pkg, packageChart(t, "apiVersion: v2\nname: web\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts []helm.Option
+		want []string
+	}{
+		{
+			name: "should discover the images of the chart and its subcharts",
+			want: []string{"nginx:1.21", "redis:6.2"},
+		},
+		{
+			name: "should render with values",
+			opts: []helm.Option{helm.WithValues(map[string]interface{}{"sidecar": true})},
+			want: []string{"envoy:1.20", "nginx:1.21", "redis:6.2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := helm.NewChart(context.Background(), pkg, append(tt.opts, helm.WithHelmPath(bin))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Images(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Images() = %v, want %v", got, tt.want)
+			}
+
+			contents, err := c.Contents()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var refs []string
+			for ref := range contents {
+				refs = append(refs, ref)
+			}
+			sort.Strings(refs)
+			want := append([]string{"web:1.0.0"}, tt.want...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(refs, want) {
+				t.Errorf("Contents() = %v, want %v", refs, want)
+			}
+		})
+	}
+}
+
+func packageChart(t *testing.T, chartYaml string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "web/Chart.yaml", Mode: 0644, Size: int64(len(chartYaml))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(chartYaml)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
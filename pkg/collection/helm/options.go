@@ -0,0 +1,83 @@
+package helm
+
+import (
+	"github.com/rancherfederal/ocil/pkg/artifacts/file/getter"
+	"github.com/rancherfederal/ocil/pkg/artifacts/image"
+)
+
+type Option func(*options)
+
+type options struct {
+	helm        string
+	args        []string
+	release     string
+	values      map[string]interface{}
+	valuesFiles []string
+
+	ref         string
+	annotations map[string]string
+	client      *getter.Client
+	image       []image.Option
+}
+
+// WithHelmPath runs the helm binary at path, instead of the first helm on PATH
+func WithHelmPath(path string) Option {
+	return func(o *options) {
+		o.helm = path
+	}
+}
+
+// WithHelmArgs passes args on to helm template (ie: --namespace, --kube-version, --set)
+func WithHelmArgs(args ...string) Option {
+	return func(o *options) {
+		o.args = append(o.args, args...)
+	}
+}
+
+// WithReleaseName renders the chart as the release name, instead of the name of the chart
+func WithReleaseName(name string) Option {
+	return func(o *options) {
+		o.release = name
+	}
+}
+
+// WithValues renders the chart with values, which win over those of any WithValuesFiles
+func WithValues(values map[string]interface{}) Option {
+	return func(o *options) {
+		o.values = values
+	}
+}
+
+// WithValuesFiles renders the chart with the values files at paths, later ones winning over earlier ones
+func WithValuesFiles(paths ...string) Option {
+	return func(o *options) {
+		o.valuesFiles = append(o.valuesFiles, paths...)
+	}
+}
+
+// WithRef stores the chart under ref, instead of its name and version
+func WithRef(ref string) Option {
+	return func(o *options) {
+		o.ref = ref
+	}
+}
+
+func WithAnnotations(m map[string]string) Option {
+	return func(o *options) {
+		o.annotations = m
+	}
+}
+
+// WithClient fetches the chart with c instead of a client using every known getter
+func WithClient(c *getter.Client) Option {
+	return func(o *options) {
+		o.client = c
+	}
+}
+
+// WithImageOptions pulls every image with opts, ie: image.WithKeychain for registries needing credentials
+func WithImageOptions(opts ...image.Option) Option {
+	return func(o *options) {
+		o.image = append(o.image, opts...)
+	}
+}
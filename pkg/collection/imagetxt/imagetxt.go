@@ -0,0 +1,116 @@
+package imagetxt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/containerd/containerd/platforms"
+	gname "github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/image"
+)
+
+// interface guard
+var _ artifacts.OCICollection = (*ImageTxt)(nil)
+
+// ErrInvalidLine is returned for lines of an images.txt that aren't an image, optionally followed by a platform
+var ErrInvalidLine = errors.New("invalid images.txt line")
+
+// Entry is an image listed in an images.txt
+type Entry struct {
+	Reference string
+
+	// Platform is the platform pulled of a multi-platform image, linux/amd64 when empty
+	Platform string
+}
+
+// ImageTxt is the collection of the images listed in an images.txt, one per line, as kubeadm config images list does
+// 	An image can be followed by the platform to pull of it (ie: registry.k8s.io/pause:3.6 linux/arm64), and anything
+// 	after a # is a comment.
+type ImageTxt struct {
+	entries []Entry
+	opts    []image.Option
+}
+
+// NewImageTxt reads the images listed in r, which are pulled with opts once the collection is added to a Layout
+func NewImageTxt(r io.Reader, opts ...image.Option) (*ImageTxt, error) {
+	seen := make(map[string]string)
+	t := &ImageTxt{opts: opts}
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%w %d: %q", ErrInvalidLine, n, s.Text())
+		}
+
+		e := Entry{Reference: fields[0]}
+		if _, err := gname.ParseReference(e.Reference); err != nil {
+			return nil, fmt.Errorf("%w %d: %v", ErrInvalidLine, n, err)
+		}
+		if len(fields) == 2 {
+			if _, err := platforms.Parse(fields[1]); err != nil {
+				return nil, fmt.Errorf("%w %d: %v", ErrInvalidLine, n, err)
+			}
+			e.Platform = fields[1]
+		}
+
+		// every image is stored under its reference, so only one platform of each can be
+		if platform, ok := seen[e.Reference]; ok {
+			if platform != e.Platform {
+				return nil, fmt.Errorf("%w %d: %s is already listed for another platform", ErrInvalidLine, n, e.Reference)
+			}
+			continue
+		}
+		seen[e.Reference] = e.Platform
+		t.entries = append(t.entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ReadFile reads the images listed in the images.txt at path, as NewImageTxt does
+func ReadFile(path string, opts ...image.Option) (*ImageTxt, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewImageTxt(f, opts...)
+}
+
+// Entries returns the images listed, in the order they are
+func (t *ImageTxt) Entries() []Entry {
+	return append([]Entry(nil), t.entries...)
+}
+
+// Contents returns an image of every entry, keyed by its reference
+func (t *ImageTxt) Contents() (map[string]artifacts.OCI, error) {
+	contents := make(map[string]artifacts.OCI, len(t.entries))
+	for _, e := range t.entries {
+		opts := t.opts
+		if e.Platform != "" {
+			opts = append(opts[:len(opts):len(opts)], image.WithPlatform(e.Platform))
+		}
+		img, err := image.NewImageWith(e.Reference, opts...)
+		if err != nil {
+			return nil, err
+		}
+		contents[e.Reference] = img
+	}
+	return contents, nil
+}
@@ -0,0 +1,80 @@
+package imagetxt_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/collection/imagetxt"
+)
+
+func TestNewImageTxt(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []imagetxt.Entry
+		wantErr error
+	}{
+		{
+			name: "should read kubeadm config images list output",
+			data: "registry.k8s.io/kube-apiserver:v1.23.0\nregistry.k8s.io/pause:3.6\n",
+			want: []imagetxt.Entry{
+				{Reference: "registry.k8s.io/kube-apiserver:v1.23.0"},
+				{Reference: "registry.k8s.io/pause:3.6"},
+			},
+		},
+		{
+			name: "should skip comments and blank lines, and read platforms",
+			data: "# control plane\n\nregistry.k8s.io/pause:3.6   linux/arm64 # for the arm nodes\n  nginx:1.21\n",
+			want: []imagetxt.Entry{
+				{Reference: "registry.k8s.io/pause:3.6", Platform: "linux/arm64"},
+				{Reference: "nginx:1.21"},
+			},
+		},
+		{
+			name: "should list duplicates once",
+			data: "nginx:1.21\nnginx:1.21\n",
+			want: []imagetxt.Entry{{Reference: "nginx:1.21"}},
+		},
+		{
+			name:    "should reject an image listed for two platforms",
+			data:    "nginx:1.21 linux/amd64\nnginx:1.21 linux/arm64\n",
+			wantErr: imagetxt.ErrInvalidLine,
+		},
+		{
+			name:    "should reject invalid references",
+			data:    "Not An Image\n",
+			wantErr: imagetxt.ErrInvalidLine,
+		},
+		{
+			name:    "should reject invalid platforms",
+			data:    "nginx:1.21 linux/amd64/v1/extra\n",
+			wantErr: imagetxt.ErrInvalidLine,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txt, err := imagetxt.NewImageTxt(strings.NewReader(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewImageTxt() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := txt.Entries(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Entries() = %v, want %v", got, tt.want)
+			}
+
+			contents, err := txt.Contents()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range tt.want {
+				if _, ok := contents[e.Reference]; !ok {
+					t.Errorf("Contents() has no image %s", e.Reference)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v2"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/image"
+)
+
+// interface guard
+var _ artifacts.OCICollection = (*Images)(nil)
+
+// ErrInvalidImage is returned for image fields that aren't image references, ie: an unrendered helm template
+var ErrInvalidImage = errors.New("invalid image reference")
+
+// containerFields are the fields of a pod spec holding containers, wherever the pod spec is found
+var containerFields = map[string]bool{
+	"containers":          true,
+	"initContainers":      true,
+	"ephemeralContainers": true,
+}
+
+// Images is the collection of every image the containers of some kubernetes manifests run
+type Images struct {
+	refs []string
+	opts []image.Option
+}
+
+// NewImages discovers every image in the kubernetes manifests of data, a stream of yaml documents as kubectl, helm
+// template or kustomize build output
+// 	Images are found in the containers of any pod spec, so workloads, their templates, Lists and custom resources
+// 	embedding pod specs are all searched.  Images are pulled with opts once the collection is added to a Layout.
+func NewImages(data []byte, opts ...image.Option) (*Images, error) {
+	return ReadImages(bytes.NewReader(data), opts...)
+}
+
+// ReadImages discovers every image in the kubernetes manifests read from r, as NewImages does
+func ReadImages(r io.Reader, opts ...image.Option) (*Images, error) {
+	seen := make(map[string]bool)
+	dec := yaml.NewDecoder(r)
+	for i := 0; ; i++ {
+		var doc interface{}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse document %d: %w", i, err)
+		}
+		if err := discover(doc, false, seen); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+
+	refs := make([]string, 0, len(seen))
+	for ref := range seen {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return &Images{refs: refs, opts: opts}, nil
+}
+
+// References returns every image discovered, sorted
+func (i *Images) References() []string {
+	return append([]string(nil), i.refs...)
+}
+
+// Contents returns an image of every reference discovered, keyed by that reference
+func (i *Images) Contents() (map[string]artifacts.OCI, error) {
+	contents := make(map[string]artifacts.OCI, len(i.refs))
+	for _, ref := range i.refs {
+		img, err := image.NewImageWith(ref, i.opts...)
+		if err != nil {
+			return nil, err
+		}
+		contents[ref] = img
+	}
+	return contents, nil
+}
+
+// discover walks node, adding the image of every container to seen
+// 	containers is whether node is the list of a containers field, whose elements are containers.
+func discover(node interface{}, containers bool, seen map[string]bool) error {
+	switch n := node.(type) {
+	case map[interface{}]interface{}:
+		if containers {
+			if ref, ok := n["image"].(string); ok && ref != "" {
+				if _, err := gname.ParseReference(ref); err != nil {
+					return fmt.Errorf("%w %q: %v", ErrInvalidImage, ref, err)
+				}
+				seen[ref] = true
+			}
+		}
+		for k, v := range n {
+			key, _ := k.(string)
+			if err := discover(v, containerFields[key], seen); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		for _, v := range n {
+			if err := discover(v, containers, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package k8s_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/collection/k8s"
+)
+
+func TestNewImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "should discover the images of a deployment",
+			data: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: registry.example.com/web/migrate:v1
+      containers:
+      - name: web
+        image: nginx:1.21
+        env:
+        - name: image
+          value: not-an-image
+      - name: sidecar
+        image: nginx:1.21
+`,
+			want: []string{"nginx:1.21", "registry.example.com/web/migrate:v1"},
+		},
+		{
+			name: "should discover images across helm rendered documents",
+			data: `
+---
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+---
+# Source: app/templates/cronjob.yaml
+apiVersion: batch/v1
+kind: CronJob
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: busybox@sha256:3fbc632167424a6d997e74f52b878d7cc478225cffac6bc977eedfe51c7f4e79
+---
+`,
+			want: []string{"busybox@sha256:3fbc632167424a6d997e74f52b878d7cc478225cffac6bc977eedfe51c7f4e79"},
+		},
+		{
+			name: "should discover images in lists and custom resources",
+			data: `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Pod
+  spec:
+    ephemeralContainers:
+    - name: debug
+      image: alpine:3.15
+- apiVersion: example.com/v1
+  kind: Workload
+  spec:
+    podTemplate:
+      spec:
+        containers:
+        - name: worker
+          image: ghcr.io/example/worker:v2
+`,
+			want: []string{"alpine:3.15", "ghcr.io/example/worker:v2"},
+		},
+		{
+			name:    "should reject unrendered templates",
+			data:    "kind: Pod\nspec:\n  containers:\n  - image: '{{ .Values.image }}'\n",
+			wantErr: k8s.ErrInvalidImage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := k8s.NewImages([]byte(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewImages() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := images.References(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("References() = %v, want %v", got, tt.want)
+			}
+
+			contents, err := images.Contents()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(contents) != len(tt.want) {
+				t.Errorf("Contents() has %d images, want %d", len(contents), len(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/containerd/containerd/platforms"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/chart"
+	"github.com/rancherfederal/ocil/pkg/artifacts/file"
+	"github.com/rancherfederal/ocil/pkg/artifacts/file/getter"
+	"github.com/rancherfederal/ocil/pkg/artifacts/image"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+// ErrInvalidChart is returned for charts that aren't packaged helm charts, ie: missing a Chart.yaml
+var ErrInvalidChart = chart.ErrInvalidChart
+
+// Load reads the manifest at path and adds everything it declares to l
+func Load(ctx context.Context, l *store.Layout, path string, opts ...Option) ([]ocispec.Descriptor, error) {
+	m, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return m.AddTo(ctx, l, opts...)
+}
+
+// AddTo fetches everything the manifest declares and adds it to l, returning the descriptors of what was added in the
+// order it is declared, images first, then charts and files
+// 	The first entry that fails to be fetched or added stops the rest from being added.
+func (m *Manifest) AddTo(ctx context.Context, l *store.Layout, opts ...Option) ([]ocispec.Descriptor, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.client == nil {
+		o.client = getter.NewClient(getter.ClientOptions{})
+	}
+
+	var descs []ocispec.Descriptor
+	for _, img := range m.Images {
+		desc, err := addImage(ctx, l, img, o)
+		if err != nil {
+			return nil, fmt.Errorf("add image %s: %w", img.Name, err)
+		}
+		descs = append(descs, desc)
+	}
+	for _, c := range m.Charts {
+		desc, err := addChart(ctx, l, c, o)
+		if err != nil {
+			return nil, fmt.Errorf("add chart %s: %w", c.Source, err)
+		}
+		descs = append(descs, desc)
+	}
+	for _, f := range m.Files {
+		desc, err := addFile(ctx, l, f, o)
+		if err != nil {
+			return nil, fmt.Errorf("add file %s: %w", f.Source, err)
+		}
+		descs = append(descs, desc)
+	}
+	return descs, nil
+}
+
+func addImage(ctx context.Context, l *store.Layout, img Image, o *options) (ocispec.Descriptor, error) {
+	ref := img.Ref
+	if ref == "" {
+		ref = img.Name
+	}
+
+	if len(img.Platforms) <= 1 {
+		opts := o.image
+		if len(img.Platforms) == 1 {
+			opts = append(opts[:len(opts):len(opts)], image.WithPlatform(img.Platforms[0]))
+		}
+		i, err := image.NewImageWith(img.Name, opts...)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		return l.AddImage(ctx, i.Image, ref)
+	}
+
+	var matchers []platforms.Matcher
+	for _, p := range img.Platforms {
+		spec, err := platforms.Parse(p)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		matchers = append(matchers, platforms.NewMatcher(spec))
+	}
+
+	idx, err := image.NewIndexWith(img.Name, o.image...)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	// everything but the platforms asked for is left out of the index
+	filtered := mutate.RemoveManifests(idx.ImageIndex, func(desc gv1.Descriptor) bool {
+		if desc.Platform == nil {
+			return true
+		}
+		p := ocispec.Platform{
+			OS:           desc.Platform.OS,
+			Architecture: desc.Platform.Architecture,
+			Variant:      desc.Platform.Variant,
+			OSVersion:    desc.Platform.OSVersion,
+			OSFeatures:   desc.Platform.OSFeatures,
+		}
+		for _, m := range matchers {
+			if m.Match(p) {
+				return false
+			}
+		}
+		return true
+	})
+	return l.AddImageIndex(ctx, filtered, ref)
+}
+
+func addChart(ctx context.Context, l *store.Layout, c Chart, o *options) (ocispec.Descriptor, error) {
+	rc, err := o.client.ContentFrom(ctx, c.Source)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	ch, err := chart.NewChart(data, chart.WithAnnotations(c.Annotations))
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	ref := c.Ref
+	if ref == "" {
+		ref = ch.Reference()
+	}
+	return l.AddOCI(ctx, ch, ref)
+}
+
+func addFile(ctx context.Context, l *store.Layout, f File, o *options) (ocispec.Descriptor, error) {
+	ref := f.Ref
+	if ref == "" {
+		ref = o.client.Name(f.Source) + ":latest"
+	}
+
+	opts := []file.Option{file.WithClient(o.client)}
+	if f.Annotations != nil {
+		opts = append(opts, file.WithAnnotations(f.Annotations))
+	}
+	if f.Checksum != "" {
+		d, err := digest.Parse(f.Checksum)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		opts = append(opts, file.WithChecksum(d))
+	}
+	return l.AddOCI(ctx, file.NewFile(f.Source, opts...), ref)
+}
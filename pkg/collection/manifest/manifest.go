@@ -0,0 +1,107 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ErrInvalidManifest is returned for manifests that can't be loaded, ie: listing an image without a name
+var ErrInvalidManifest = errors.New("invalid manifest")
+
+// Manifest declares the content of a bundle, everything of which AddTo fetches and adds to a Layout
+// 	Manifests are yaml or json, ie:
+//
+// 		images:
+// 		- name: docker.io/library/nginx:1.21
+// 		  platforms: [linux/amd64, linux/arm64]
+// 		charts:
+// 		- source: https://charts.example.com/nginx-1.0.0.tgz
+// 		files:
+// 		- source: https://get.example.com/install.sh
+// 		  ref: scripts/install.sh:v1
+type Manifest struct {
+	Images []Image `json:"images,omitempty" yaml:"images,omitempty"`
+	Charts []Chart `json:"charts,omitempty" yaml:"charts,omitempty"`
+	Files  []File  `json:"files,omitempty" yaml:"files,omitempty"`
+}
+
+// Image is an image pulled from a registry
+type Image struct {
+	// Name is the reference the image is pulled from
+	Name string `json:"name" yaml:"name"`
+
+	// Ref is the reference the image is stored under, Name when empty
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
+
+	// Platforms selects the platforms of a multi-platform image to store (ie: linux/arm64/v8), linux/amd64 alone when
+	// empty.  Given more than one, the image is stored as an index of those platforms.
+	Platforms []string `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+}
+
+// Chart is a packaged helm chart (a .tgz), fetched from any source a file can be
+type Chart struct {
+	// Source is the url or path the chart is fetched from
+	Source string `json:"source" yaml:"source"`
+
+	// Ref is the reference the chart is stored under, the name and version of the chart (ie: nginx:1.0.0) when empty
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
+
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+// File is a file or directory, fetched from any source the getter package supports
+type File struct {
+	// Source is the url or path the file is fetched from
+	Source string `json:"source" yaml:"source"`
+
+	// Ref is the reference the file is stored under, the name of the file tagged latest when empty
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
+
+	// Checksum is the digest the fetched file must match, ie: sha256:...
+	Checksum string `json:"checksum,omitempty" yaml:"checksum,omitempty"`
+
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+// Parse parses a yaml or json manifest, rejecting unknown fields so typos aren't silently ignored
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ReadFile parses the manifest at path
+func ReadFile(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func (m *Manifest) validate() error {
+	for i, img := range m.Images {
+		if img.Name == "" {
+			return fmt.Errorf("%w: image %d has no name", ErrInvalidManifest, i)
+		}
+	}
+	for i, c := range m.Charts {
+		if c.Source == "" {
+			return fmt.Errorf("%w: chart %d has no source", ErrInvalidManifest, i)
+		}
+	}
+	for i, f := range m.Files {
+		if f.Source == "" {
+			return fmt.Errorf("%w: file %d has no source", ErrInvalidManifest, i)
+		}
+	}
+	return nil
+}
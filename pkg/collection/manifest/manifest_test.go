@@ -0,0 +1,188 @@
+package manifest_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/rancherfederal/ocil/pkg/collection/manifest"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestManifest_AddTo(t *testing.T) {
+	ctx := context.Background()
+
+	reg := httptest.NewServer(registry.New())
+	defer reg.Close()
+	host := strings.TrimPrefix(reg.URL, "http://")
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	push(t, host+"/hello/world:v1", func(r name.Reference) error { return remote.Write(r, img) })
+
+	var idx v1.ImageIndex = empty.Index
+	for _, p := range []v1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64"}, {OS: "linux", Architecture: "s390x"}} {
+		p := p
+		pimg, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{Add: pimg, Descriptor: v1.Descriptor{Platform: &p}})
+	}
+	push(t, host+"/hello/multi:v1", func(r name.Reference) error { return remote.WriteIndex(r, idx) })
+
+	chart := packageChart(t, "apiVersion: v2\nname: nginx\nversion: 1.0.0\n")
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nginx-1.0.0.tgz":
+			w.Write(chart)
+		case "/install.sh":
+			w.Write([]byte("#!/bin/sh"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer files.Close()
+
+	m, err := manifest.Parse([]byte(fmt.Sprintf(`
+images:
+- name: %[1]s/hello/world:v1
+  ref: mirror/hello/world:v1
+- name: %[1]s/hello/multi:v1
+  platforms: [linux/amd64, linux/arm64]
+charts:
+- source: %[2]s/nginx-1.0.0.tgz
+files:
+- source: %[2]s/install.sh
+`, host, files.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	descs, err := m.AddTo(ctx, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descs) != 4 {
+		t.Fatalf("AddTo() added %d descriptors, want 4", len(descs))
+	}
+
+	records, err := l.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]store.Record)
+	for _, r := range records {
+		got[r.Reference] = r
+	}
+	for _, ref := range []string{"mirror/hello/world:v1", host + "/hello/multi:v1", "nginx:1.0.0", "install.sh:latest"} {
+		if _, ok := got[ref]; !ok {
+			t.Errorf("%s wasn't added to the layout", ref)
+		}
+	}
+
+	if p := got[host+"/hello/multi:v1"].Platforms; len(p) != 2 {
+		t.Errorf("index stored with platforms %v, want only the 2 asked for", p)
+	}
+	if at := got["nginx:1.0.0"].ArtifactType; at != consts.ChartConfigMediaType {
+		t.Errorf("chart stored as %s, want %s", at, consts.ChartConfigMediaType)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr error
+	}{
+		{
+			name: "should parse yaml",
+			data: "images:\n- name: nginx:1.21\nfiles:\n- source: ./install.sh\n",
+			want: 2,
+		},
+		{
+			name: "should parse json",
+			data: `{"images": [{"name": "nginx:1.21", "platforms": ["linux/amd64"]}]}`,
+			want: 1,
+		},
+		{
+			name:    "should reject unknown fields",
+			data:    "images:\n- nmae: nginx:1.21\n",
+			wantErr: manifest.ErrInvalidManifest,
+		},
+		{
+			name:    "should reject images without a name",
+			data:    "images:\n- ref: nginx:1.21\n",
+			wantErr: manifest.ErrInvalidManifest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := manifest.Parse([]byte(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := len(m.Images) + len(m.Charts) + len(m.Files); got != tt.want {
+				t.Errorf("Parse() found %d entries, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func push(t *testing.T, ref string, write func(name.Reference) error) {
+	t.Helper()
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := write(r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// packageChart returns a packaged chart of just chartYaml, as helm package would
+func packageChart(t *testing.T, chartYaml string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "nginx/Chart.yaml", Mode: 0644, Size: int64(len(chartYaml))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(chartYaml)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,27 @@
+package manifest
+
+import (
+	"github.com/rancherfederal/ocil/pkg/artifacts/file/getter"
+	"github.com/rancherfederal/ocil/pkg/artifacts/image"
+)
+
+type Option func(*options)
+
+type options struct {
+	image  []image.Option
+	client *getter.Client
+}
+
+// WithImageOptions pulls every image with opts, ie: image.WithKeychain for registries needing credentials
+func WithImageOptions(opts ...image.Option) Option {
+	return func(o *options) {
+		o.image = append(o.image, opts...)
+	}
+}
+
+// WithClient fetches charts and files with c instead of a client using every known getter
+func WithClient(c *getter.Client) Option {
+	return func(o *options) {
+		o.client = c
+	}
+}
@@ -1,8 +1,9 @@
 package consts
 
 const (
-	OCIManifestSchema1    = "application/vnd.oci.image.manifest.v1+json"
-	DockerManifestSchema2 = "application/vnd.docker.distribution.manifest.v2+json"
+	OCIManifestSchema1        = "application/vnd.oci.image.manifest.v1+json"
+	DockerManifestSchema2     = "application/vnd.docker.distribution.manifest.v2+json"
+	DockerManifestListSchema2 = "application/vnd.docker.distribution.manifest.list.v2+json"
 
 	DockerConfigJSON        = "application/vnd.docker.container.image.v1+json"
 	DockerLayer             = "application/vnd.docker.image.rootfs.diff.tar.gzip"
@@ -10,6 +11,10 @@ const (
 	DockerUncompressedLayer = "application/vnd.docker.image.rootfs.diff.tar"
 	OCILayer                = "application/vnd.oci.image.layer.v1.tar+gzip"
 
+	// OCIEmptyMediaType is the media type of the empty descriptor of image-spec v1.1, an empty json object, used as the
+	// config of artifacts that have none and as the only layer of those without any
+	OCIEmptyMediaType = "application/vnd.oci.empty.v1+json"
+
 	// ChartConfigMediaType is the reserved media type for the Helm chart manifest config
 	ChartConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
 
@@ -26,10 +31,32 @@ const (
 	FileLocalConfigMediaType     = "application/vnd.content.hauler.file.local.config.v1+json"
 	FileDirectoryConfigMediaType = "application/vnd.content.hauler.file.directory.config.v1+json"
 	FileHttpConfigMediaType      = "application/vnd.content.hauler.file.http.config.v1+json"
+	FileS3ConfigMediaType        = "application/vnd.content.hauler.file.s3.config.v1+json"
+	FileGCSConfigMediaType       = "application/vnd.content.hauler.file.gcs.config.v1+json"
+	FileAzureConfigMediaType     = "application/vnd.content.hauler.file.azure.config.v1+json"
 
 	// MemoryConfigMediaType
 	MemoryConfigMediaType = "application/vnd.content.hauler.memory.config.v1+json"
 
+	// SPDXJSONMediaType and CycloneDXJSONMediaType are the media types of sbom layers
+	SPDXJSONMediaType      = "application/spdx+json"
+	CycloneDXJSONMediaType = "application/vnd.cyclonedx+json"
+
+	// SBOMConfigMediaType is the reserved media type for SBOM config
+	SBOMConfigMediaType = "application/vnd.content.hauler.sbom.config.v1+json"
+
+	// InTotoMediaType is the media type of in-toto statement layers
+	InTotoMediaType = "application/vnd.in-toto+json"
+
+	// ScanReportConfigMediaType is the reserved media type for vulnerability scan report config
+	ScanReportConfigMediaType = "application/vnd.content.hauler.scan.config.v1+json"
+
+	// Schema1ConfigMediaType is the reserved media type for the config of preserved docker schema1 manifests
+	Schema1ConfigMediaType = "application/vnd.content.hauler.schema1.config.v1+json"
+
+	// AttestationConfigMediaType is the reserved media type for attestation config
+	AttestationConfigMediaType = "application/vnd.content.hauler.attestation.config.v1+json"
+
 	// WasmArtifactLayerMediaType is the reserved media type for WASM artifact layers
 	WasmArtifactLayerMediaType = "application/vnd.wasm.content.layer.v1+wasm"
 
@@ -43,4 +70,40 @@ const (
 	DockerVendorPrefix = "vnd.docker"
 	HaulerVendorPrefix = "vnd.hauler"
 	OCIImageIndexFile  = "index.json"
+
+	// CosignSignatureSuffix is the suffix of the "<alg>-<hex>.sig" tag cosign stores an images signatures under
+	CosignSignatureSuffix = "sig"
+
+	// CosignSBOMSuffix is the suffix of the "<alg>-<hex>.sbom" tag cosign attaches an images sboms under
+	CosignSBOMSuffix = "sbom"
+
+	// ScanSuffix is the suffix of the "<alg>-<hex>.scan" tag vulnerability scan reports are attached under
+	ScanSuffix = "scan"
+
+	// Schema1Suffix is the suffix of the "<alg>-<hex>.schema1" tag the schema1 manifest an image was converted from is
+	// attached under
+	Schema1Suffix = "schema1"
+
+	// CosignAttestationSuffix is the suffix of the "<alg>-<hex>.att" tag cosign attaches an images attestations under
+	CosignAttestationSuffix = "att"
+
+	// CosignSimpleSigningMediaType is the media type of the layers holding the payloads cosign signs
+	CosignSimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	// CosignSignatureAnnotation, CosignCertificateAnnotation and CosignChainAnnotation are the layer annotations cosign
+	// records a payloads signature, and for keyless signatures the signing certificate and its chain, under
+	CosignSignatureAnnotation   = "dev.cosignproject.cosign/signature"
+	CosignCertificateAnnotation = "dev.sigstore.cosign/certificate"
+	CosignChainAnnotation       = "dev.sigstore.cosign/chain"
+
+	// StoreVersionAnnotation is the index annotation recording the on-disk format version of a store
+	StoreVersionAnnotation = "io.rancherfederal.ocil.store.version"
+
+	// ProvenanceSourceAnnotation, ProvenanceReferenceAnnotation, ProvenanceFetchedAnnotation and
+	// ProvenanceToolAnnotation are the index descriptor annotations recording where an artifact came from, the
+	// reference it was added as, when it was fetched and the ocil version that added it
+	ProvenanceSourceAnnotation    = "io.rancherfederal.ocil.provenance.source"
+	ProvenanceReferenceAnnotation = "io.rancherfederal.ocil.provenance.reference"
+	ProvenanceFetchedAnnotation   = "io.rancherfederal.ocil.provenance.fetched"
+	ProvenanceToolAnnotation      = "io.rancherfederal.ocil.provenance.tool"
 )
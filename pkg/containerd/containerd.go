@@ -0,0 +1,192 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// DefaultNamespace is the namespace the kubelet of k3s and RKE2 (and the CRI plugin in general) runs images from
+const DefaultNamespace = "k8s.io"
+
+// Target is a target.Target writing straight into the content and image stores of containerd, so whatever is copied
+// to it can be run by the node without pulling it from a registry
+// 	Blobs are labeled with containerd's gc references as the manifests and indexes referring to them are written, and
+// 	the root of each copy is created (or updated) as the image named by the reference it was pushed to.  Until then
+// 	nothing keeps containerd's garbage collector from removing what was written, so copies are best made under a
+// 	lease (ie: with the context of client.WithLease).  References are stored as they are given, and the CRI plugin
+// 	only finds fully qualified ones (ie: docker.io/library/busybox:latest).
+type Target struct {
+	content   content.Store
+	images    images.Store
+	namespace string
+	labels    map[string]string
+}
+
+// Option configures a Target
+type Option func(*Target)
+
+// WithNamespace writes to the containerd namespace ns instead of DefaultNamespace
+func WithNamespace(ns string) Option {
+	return func(t *Target) {
+		t.namespace = ns
+	}
+}
+
+// WithImageLabels labels the images the target creates (ie: io.cri-containerd.image=managed for the CRI plugin to
+// treat them as its own)
+func WithImageLabels(labels map[string]string) Option {
+	return func(t *Target) {
+		t.labels = labels
+	}
+}
+
+// NewTarget returns the target writing to the content store cs and the image store is (ie: those of a containerd
+// client, or of its metadata database)
+func NewTarget(cs content.Store, is images.Store, opts ...Option) *Target {
+	t := &Target{
+		content:   cs,
+		images:    is,
+		namespace: DefaultNamespace,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Resolve returns the descriptor of the image named ref
+func (t *Target) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	img, err := t.images.Get(t.withNamespace(ctx), ref)
+	if err != nil {
+		return "", ocispec.Descriptor{}, fmt.Errorf("resolve %s: %w", ref, err)
+	}
+	return ref, img.Target, nil
+}
+
+// Fetcher returns a fetcher reading from the content store, whatever ref is
+func (t *Target) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	return t, nil
+}
+
+// Fetch opens the blob desc identifies in the content store
+func (t *Target) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	ra, err := t.content.ReaderAt(t.withNamespace(ctx), desc)
+	if err != nil {
+		return nil, err
+	}
+	return &readCloser{Reader: content.NewReader(ra), Closer: ra}, nil
+}
+
+// Pusher returns a pusher writing to the content store, naming the image ref after the manifest (or index) whose
+// digest ref is pinned to
+// 	A ref without a digest names every manifest (and index) pushed after it in turn, leaving the last one pushed.
+func (t *Target) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	name, root := ref, ""
+	if i := strings.LastIndex(ref, "@"); i != -1 {
+		name, root = ref[:i], ref[i+1:]
+	}
+	return &pusher{target: t, name: name, root: root}, nil
+}
+
+// withNamespace returns ctx in the namespace of the target
+func (t *Target) withNamespace(ctx context.Context) context.Context {
+	return namespaces.WithNamespace(ctx, t.namespace)
+}
+
+// tag creates (or updates) the image name to refer to desc
+func (t *Target) tag(ctx context.Context, name string, desc ocispec.Descriptor) error {
+	img := images.Image{Name: name, Target: desc, Labels: t.labels}
+	_, err := t.images.Create(ctx, img)
+	if !errdefs.IsAlreadyExists(err) {
+		return err
+	}
+
+	fields := []string{"target"}
+	for k := range t.labels {
+		fields = append(fields, "labels."+k)
+	}
+	_, err = t.images.Update(ctx, img, fields...)
+	return err
+}
+
+type pusher struct {
+	target *Target
+	name   string
+	root   string
+}
+
+// Push returns a writer of desc to the content store, or an error wrapping errdefs.ErrAlreadyExists if it already
+// holds it
+func (p *pusher) Push(ctx context.Context, desc ocispec.Descriptor) (content.Writer, error) {
+	ctx = p.target.withNamespace(ctx)
+
+	if _, err := p.target.content.Info(ctx, desc.Digest); err == nil {
+		if err := p.written(ctx, desc); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("content %s: %w", desc.Digest, errdefs.ErrAlreadyExists)
+	} else if !errdefs.IsNotFound(err) {
+		return nil, err
+	}
+
+	w, err := content.OpenWriter(ctx, p.target.content, content.WithRef(remotes.MakeRefKey(ctx, desc)), content.WithDescriptor(desc))
+	if err != nil {
+		if errdefs.IsAlreadyExists(err) {
+			if err := p.written(ctx, desc); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+	return &writer{Writer: w, pusher: p, desc: desc}, nil
+}
+
+// written labels the children of desc for the garbage collector once it's in the content store, and names the image
+// after it if it's the root
+func (p *pusher) written(ctx context.Context, desc ocispec.Descriptor) error {
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex, images.MediaTypeDockerSchema2Manifest, images.MediaTypeDockerSchema2ManifestList:
+	default:
+		return nil
+	}
+
+	if _, err := images.SetChildrenLabels(p.target.content, images.ChildrenHandler(p.target.content))(ctx, desc); err != nil {
+		return fmt.Errorf("label children of %s: %w", desc.Digest, err)
+	}
+	if p.root == "" || p.root == desc.Digest.String() {
+		if err := p.target.tag(ctx, p.name, desc); err != nil {
+			return fmt.Errorf("image %s: %w", p.name, err)
+		}
+	}
+	return nil
+}
+
+// writer is a content writer seeing to what the pusher does once the blob it writes is committed
+type writer struct {
+	content.Writer
+	pusher *pusher
+	desc   ocispec.Descriptor
+}
+
+func (w *writer) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...content.Opt) error {
+	ctx = w.pusher.target.withNamespace(ctx)
+	if err := w.Writer.Commit(ctx, size, expected, opts...); err != nil && !errdefs.IsAlreadyExists(err) {
+		return err
+	}
+	return w.pusher.written(ctx, w.desc)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
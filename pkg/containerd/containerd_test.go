@@ -0,0 +1,295 @@
+package containerd_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/oras"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/containerd"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestTarget(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "ocil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	s, err := store.NewLayout(tmpdir + "/store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, img, "docker.io/library/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+	platform, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add:        platform,
+		Descriptor: gv1.Descriptor{Platform: &gv1.Platform{OS: "linux", Architecture: "arm64"}},
+	})
+	if _, err := s.AddImageIndex(ctx, idx, "docker.io/library/multi:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err := local.NewLabeledStore(tmpdir+"/content", &labelStore{labels: make(map[digest.Digest]map[string]string)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	is := &imageStore{images: make(map[string]images.Image)}
+	labels := map[string]string{"io.cri-containerd.image": "managed"}
+	target := containerd.NewTarget(cs, is, containerd.WithImageLabels(labels))
+
+	tests := []struct {
+		name  string
+		ref   string
+		toRef string
+	}{
+		{name: "image", ref: "docker.io/library/app:v1"},
+		{name: "index", ref: "docker.io/library/multi:v1"},
+		{name: "retagged", ref: "docker.io/library/app:v1", toRef: "docker.io/library/app:latest"},
+		{name: "again", ref: "docker.io/library/app:v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc, err := s.Copy(ctx, tt.ref, target, tt.toRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := tt.toRef
+			if name == "" {
+				name = tt.ref
+			}
+
+			got, ok := is.images[containerd.DefaultNamespace+"/"+name]
+			if !ok {
+				t.Fatalf("no image %s in the %s namespace", name, containerd.DefaultNamespace)
+			}
+			if got.Target.Digest != desc.Digest {
+				t.Errorf("image %s targets %s, want %s", name, got.Target.Digest, desc.Digest)
+			}
+			if got.Labels["io.cri-containerd.image"] != "managed" {
+				t.Errorf("image %s labels = %v, want %v", name, got.Labels, labels)
+			}
+
+			_, resolved, err := target.Resolve(ctx, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resolved.Digest != desc.Digest {
+				t.Errorf("Resolve(%s) = %s, want %s", name, resolved.Digest, desc.Digest)
+			}
+
+			// everything the image refers to must be in the content store, and kept from gc by the labels of its parent
+			err = images.Walk(ctx, images.HandlerFunc(func(ctx context.Context, d ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+				info, err := cs.Info(ctx, d.Digest)
+				if err != nil {
+					return nil, err
+				}
+				children, err := images.Children(ctx, cs, d)
+				if err != nil {
+					return nil, err
+				}
+				refs := make(map[string]bool)
+				for _, v := range info.Labels {
+					refs[v] = true
+				}
+				for _, child := range children {
+					if !refs[child.Digest.String()] {
+						t.Errorf("%s has no gc reference to its child %s", d.Digest, child.Digest)
+					}
+				}
+				return children, nil
+			}), got.Target)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	if _, _, err := target.Resolve(ctx, "docker.io/library/missing:v1"); !errdefs.IsNotFound(err) {
+		t.Errorf("Resolve() of a missing image = %v, want an error wrapping %v", err, errdefs.ErrNotFound)
+	}
+
+	t.Run("namespace", func(t *testing.T) {
+		target := containerd.NewTarget(cs, is, containerd.WithNamespace("default"))
+		if _, err := s.Copy(ctx, "docker.io/library/app:v1", target, ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := is.images["default/docker.io/library/app:v1"]; !ok {
+			t.Errorf("no image docker.io/library/app:v1 in the default namespace")
+		}
+	})
+
+	t.Run("fetch", func(t *testing.T) {
+		dst, err := store.NewLayout(tmpdir + "/fetched")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := "docker.io/library/multi:v1"
+		desc, err := oras.Copy(ctx, target, ref, dst.OCI, "",
+			oras.WithAdditionalCachedMediaTypes(consts.DockerManifestSchema2, consts.DockerManifestListSchema2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := is.images[containerd.DefaultNamespace+"/"+ref].Target.Digest; desc.Digest != want {
+			t.Errorf("fetched %s, want %s", desc.Digest, want)
+		}
+	})
+}
+
+// labelStore is a local.LabelStore kept in memory
+type labelStore struct {
+	mu     sync.Mutex
+	labels map[digest.Digest]map[string]string
+}
+
+func (s *labelStore) Get(d digest.Digest) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	labels := make(map[string]string)
+	for k, v := range s.labels[d] {
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+func (s *labelStore) Set(d digest.Digest, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.labels[d] = make(map[string]string)
+	for k, v := range labels {
+		s.labels[d][k] = v
+	}
+	return nil
+}
+
+func (s *labelStore) Update(d digest.Digest, update map[string]string) (map[string]string, error) {
+	s.mu.Lock()
+	if s.labels[d] == nil {
+		s.labels[d] = make(map[string]string)
+	}
+	for k, v := range update {
+		if v == "" {
+			delete(s.labels[d], k)
+		} else {
+			s.labels[d][k] = v
+		}
+	}
+	s.mu.Unlock()
+	return s.Get(d)
+}
+
+// imageStore is an images.Store kept in memory, its images keyed by namespace/name
+type imageStore struct {
+	mu     sync.Mutex
+	images map[string]images.Image
+}
+
+func (s *imageStore) key(ctx context.Context, name string) (string, error) {
+	ns, err := namespaces.NamespaceRequired(ctx)
+	if err != nil {
+		return "", err
+	}
+	return ns + "/" + name, nil
+}
+
+func (s *imageStore) Get(ctx context.Context, name string) (images.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, err := s.key(ctx, name)
+	if err != nil {
+		return images.Image{}, err
+	}
+	img, ok := s.images[key]
+	if !ok {
+		return images.Image{}, fmt.Errorf("image %s: %w", name, errdefs.ErrNotFound)
+	}
+	return img, nil
+}
+
+func (s *imageStore) List(ctx context.Context, filters ...string) ([]images.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []images.Image
+	for _, img := range s.images {
+		list = append(list, img)
+	}
+	return list, nil
+}
+
+func (s *imageStore) Create(ctx context.Context, img images.Image) (images.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, err := s.key(ctx, img.Name)
+	if err != nil {
+		return images.Image{}, err
+	}
+	if _, ok := s.images[key]; ok {
+		return images.Image{}, fmt.Errorf("image %s: %w", img.Name, errdefs.ErrAlreadyExists)
+	}
+	s.images[key] = img
+	return img, nil
+}
+
+func (s *imageStore) Update(ctx context.Context, img images.Image, fieldpaths ...string) (images.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, err := s.key(ctx, img.Name)
+	if err != nil {
+		return images.Image{}, err
+	}
+	updated, ok := s.images[key]
+	if !ok {
+		return images.Image{}, fmt.Errorf("image %s: %w", img.Name, errdefs.ErrNotFound)
+	}
+	for _, path := range fieldpaths {
+		switch {
+		case path == "target":
+			updated.Target = img.Target
+		case strings.HasPrefix(path, "labels."):
+			if updated.Labels == nil {
+				updated.Labels = make(map[string]string)
+			}
+			k := strings.TrimPrefix(path, "labels.")
+			updated.Labels[k] = img.Labels[k]
+		}
+	}
+	s.images[key] = updated
+	return updated, nil
+}
+
+func (s *imageStore) Delete(ctx context.Context, name string, opts ...images.DeleteOpt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, err := s.key(ctx, name)
+	if err != nil {
+		return err
+	}
+	delete(s.images, key)
+	return nil
+}
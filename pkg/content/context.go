@@ -0,0 +1,34 @@
+package content
+
+import (
+	"context"
+)
+
+// contextFile is a blob opened for reading that fails reads once ctx is done, so large transfers can be aborted
+// between chunks
+type contextFile struct {
+	file readFile
+	ctx  context.Context
+}
+
+func (f *contextFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.file.Read(p)
+}
+
+func (f *contextFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.file.ReadAt(p, off)
+}
+
+func (f *contextFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *contextFile) Close() error {
+	return f.file.Close()
+}
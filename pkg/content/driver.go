@@ -0,0 +1,626 @@
+package content
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Driver is the storage a layout's blobs and index live in, its files named by slash separated paths relative to the
+// layout's root
+// 	It's an fs.FS with the writes a layout makes on top, so anything reading a layout (ie: fs.WalkDir) can do so
+// 	whatever its storage.  Files it opens must also be an io.ReaderAt and io.Seeker, as those of os.DirFS, embed.FS and
+// 	fstest.MapFS are.  Writes create whatever parent directories they need, and removals of files that don't exist
+// 	fail with an error satisfying os.IsNotExist.
+type Driver interface {
+	fs.ReadDirFS
+	fs.StatFS
+
+	// Create opens name for reading and writing, creating it if it doesn't exist
+	Create(name string) (File, error)
+
+	// WriteFile atomically replaces name with data
+	WriteFile(name string, data []byte) error
+
+	// Rename atomically replaces newname with oldname
+	Rename(oldname, newname string) error
+
+	// Remove removes the file name, and RemoveAll name along with everything beneath it
+	Remove(name string) error
+	RemoveAll(name string) error
+
+	// Lock blocks until it holds an exclusive lock on name, which is held across every process sharing the storage
+	// where the storage supports it, and returns the function releasing it
+	Lock(name string) (func(), error)
+}
+
+// File is a file of a Driver opened for writing
+type File interface {
+	io.ReadWriteSeeker
+	io.ReaderAt
+	io.Closer
+
+	Truncate(size int64) error
+	Sync() error
+}
+
+// readFile is a file of a Driver opened for reading
+type readFile interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+}
+
+var _ File = (*os.File)(nil)
+
+// LocalOption configures the Driver of NewLocalDriver
+type LocalOption func(*localDriver)
+
+// WithFileMode creates files with mode exactly, rather than 0644 less the umask
+func WithFileMode(mode fs.FileMode) LocalOption {
+	return func(d *localDriver) {
+		d.fileMode = mode.Perm()
+		d.exactFileMode = true
+	}
+}
+
+// WithDirMode creates directories with mode exactly, rather than 0777 less the umask
+func WithDirMode(mode fs.FileMode) LocalOption {
+	return func(d *localDriver) {
+		d.dirMode = mode.Perm()
+		d.exactDirMode = true
+	}
+}
+
+// NewLocalDriver returns the Driver of layouts rooted at root on the local filesystem, the default of NewOCI
+// 	On windows root is made absolute, so the paths beneath it can exceed MAX_PATH, and files are replaced even while
+// 	other processes have them open for reading.
+func NewLocalDriver(root string, opts ...LocalOption) Driver {
+	d := &localDriver{root: localRoot(root), fileMode: 0644, dirMode: os.ModePerm}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// EnforceModes sets the mode of everything already beneath the root of the local Driver d to those it creates files
+// and directories with, ie: after tightening them with WithFileMode and WithDirMode
+func EnforceModes(d Driver) error {
+	ld, ok := d.(*localDriver)
+	if !ok {
+		return fmt.Errorf("enforce modes: %T isn't on the local filesystem", d)
+	}
+	return filepath.WalkDir(ld.root, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case e.IsDir():
+			return os.Chmod(p, ld.dirMode)
+		case e.Type().IsRegular():
+			return os.Chmod(p, ld.fileMode)
+		}
+		return nil
+	})
+}
+
+// LocalPath returns the path the Driver d stores name at, if it stores it on the local filesystem
+func LocalPath(d Driver, name string) (string, bool) {
+	ld, ok := d.(*localDriver)
+	if !ok {
+		return "", false
+	}
+	return ld.path(name), true
+}
+
+type localDriver struct {
+	root string
+
+	fileMode, dirMode           fs.FileMode
+	exactFileMode, exactDirMode bool
+}
+
+func (d *localDriver) path(name string) string {
+	return filepath.Join(d.root, filepath.FromSlash(name))
+}
+
+func (d *localDriver) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Open(d.path(name))
+}
+
+func (d *localDriver) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(d.path(name))
+}
+
+func (d *localDriver) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(d.path(name))
+}
+
+// mkdirAll creates dir along with any parent it's missing, setting the mode of those it creates when it's exact
+func (d *localDriver) mkdirAll(dir string) error {
+	if !d.exactDirMode {
+		return os.MkdirAll(dir, d.dirMode)
+	}
+
+	var missing []string
+	for p := dir; ; p = filepath.Dir(p) {
+		if _, err := os.Stat(p); err == nil || filepath.Dir(p) == p {
+			break
+		}
+		missing = append(missing, p)
+	}
+	if err := os.MkdirAll(dir, d.dirMode); err != nil {
+		return err
+	}
+	for _, p := range missing {
+		if err := os.Chmod(p, d.dirMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openFile opens p with flag, setting its mode when it's exact
+func (d *localDriver) openFile(p string, flag int) (*os.File, error) {
+	f, err := os.OpenFile(p, flag, d.fileMode)
+	if err != nil {
+		return nil, err
+	}
+	if d.exactFileMode {
+		if err := f.Chmod(d.fileMode); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (d *localDriver) Create(name string) (File, error) {
+	p := d.path(name)
+	if err := d.mkdirAll(filepath.Dir(p)); err != nil {
+		return nil, err
+	}
+	return d.openFile(p, os.O_RDWR|os.O_CREATE)
+}
+
+// WriteFile writes data to a temporary file next to name, and renames it into place
+// 	The temporary file is created with the mode of the file rather than os.CreateTemp's 0600, so the umask applies.
+func (d *localDriver) WriteFile(name string, data []byte) error {
+	p := d.path(name)
+	if err := d.mkdirAll(filepath.Dir(p)); err != nil {
+		return err
+	}
+
+	var tmp *os.File
+	for {
+		var nonce [8]byte
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return err
+		}
+		f, err := d.openFile(filepath.Join(filepath.Dir(p), "."+filepath.Base(p)+"-"+hex.EncodeToString(nonce[:])), os.O_RDWR|os.O_CREATE|os.O_EXCL)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		tmp = f
+		break
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return rename(tmp.Name(), p)
+}
+
+func (d *localDriver) Rename(oldname, newname string) error {
+	p := d.path(newname)
+	if err := d.mkdirAll(filepath.Dir(p)); err != nil {
+		return err
+	}
+	return rename(d.path(oldname), p)
+}
+
+func (d *localDriver) Remove(name string) error {
+	return os.Remove(d.path(name))
+}
+
+func (d *localDriver) RemoveAll(name string) error {
+	return os.RemoveAll(d.path(name))
+}
+
+// Lock takes an advisory lock on name, so it's held across processes
+func (d *localDriver) Lock(name string) (func(), error) {
+	f, err := d.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	lf := f.(*os.File)
+	if err := lockFile(lf); err != nil {
+		lf.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(lf)
+		lf.Close()
+	}, nil
+}
+
+// NewFSDriver returns the read-only Driver of the layout at the root of fsys, ie: an embed.FS or an os.DirFS of a
+// mounted iso
+// 	Every write fails with ErrReadOnly, layouts using it are best opened WithReadOnly so they never attempt any.
+func NewFSDriver(fsys fs.FS) Driver {
+	return &fsDriver{fsys: fsys}
+}
+
+type fsDriver struct {
+	fsys fs.FS
+}
+
+func (d *fsDriver) Open(name string) (fs.File, error) {
+	return d.fsys.Open(name)
+}
+
+func (d *fsDriver) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(d.fsys, name)
+}
+
+func (d *fsDriver) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(d.fsys, name)
+}
+
+func (d *fsDriver) Create(name string) (File, error) {
+	return nil, &fs.PathError{Op: "create", Path: name, Err: ErrReadOnly}
+}
+
+func (d *fsDriver) WriteFile(name string, data []byte) error {
+	return &fs.PathError{Op: "write", Path: name, Err: ErrReadOnly}
+}
+
+func (d *fsDriver) Rename(oldname, newname string) error {
+	return &fs.PathError{Op: "rename", Path: oldname, Err: ErrReadOnly}
+}
+
+func (d *fsDriver) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+}
+
+func (d *fsDriver) RemoveAll(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+}
+
+func (d *fsDriver) Lock(name string) (func(), error) {
+	return nil, &fs.PathError{Op: "lock", Path: name, Err: ErrReadOnly}
+}
+
+// NewMemoryDriver returns a Driver keeping everything in memory, ie: for tests, or scratch layouts that never need to
+// outlive the process
+// 	Its locks are only held within the process.
+func NewMemoryDriver() Driver {
+	return &memoryDriver{files: make(map[string]*memoryEntry), locks: make(map[string]*sync.Mutex)}
+}
+
+type memoryDriver struct {
+	mu    sync.Mutex
+	files map[string]*memoryEntry
+	locks map[string]*sync.Mutex
+}
+
+type memoryEntry struct {
+	mu      sync.Mutex
+	data    []byte
+	modTime time.Time
+}
+
+var errNotDir = errors.New("not a directory")
+
+func (d *memoryDriver) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	d.mu.Lock()
+	e, ok := d.files[name]
+	d.mu.Unlock()
+	if ok {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		data := append([]byte(nil), e.data...)
+		return &memoryReader{Reader: bytes.NewReader(data), info: memoryInfo{name: path.Base(name), size: int64(len(data)), modTime: e.modTime}}, nil
+	}
+
+	entries, err := d.ReadDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memoryDir{info: memoryInfo{name: path.Base(name), dir: true}, entries: entries}, nil
+}
+
+// ReadDir lists name, directories only existing as long as there's a file beneath them
+func (d *memoryDriver) ReadDir(name string) ([]fs.DirEntry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.files[name]; ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+
+	seen := make(map[string]bool)
+	var entries []fs.DirEntry
+	for n, e := range d.files {
+		if !strings.HasPrefix(n, prefix) {
+			continue
+		}
+		rest := n[len(prefix):]
+		child, dir := rest, false
+		if i := strings.Index(rest, "/"); i != -1 {
+			child, dir = rest[:i], true
+		}
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+
+		info := memoryInfo{name: child, dir: dir}
+		if !dir {
+			e.mu.Lock()
+			info.size, info.modTime = int64(len(e.data)), e.modTime
+			e.mu.Unlock()
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (d *memoryDriver) Stat(name string) (fs.FileInfo, error) {
+	f, err := d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+func (d *memoryDriver) Create(name string) (File, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e, ok := d.files[name]
+	if !ok {
+		e = &memoryEntry{modTime: time.Now()}
+		d.files[name] = e
+	}
+	return &memoryFile{entry: e}, nil
+}
+
+func (d *memoryDriver) WriteFile(name string, data []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.files[name] = &memoryEntry{data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+func (d *memoryDriver) Rename(oldname, newname string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e, ok := d.files[oldname]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	delete(d.files, oldname)
+	d.files[newname] = e
+	return nil
+}
+
+func (d *memoryDriver) Remove(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(d.files, name)
+	return nil
+}
+
+func (d *memoryDriver) RemoveAll(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for n := range d.files {
+		if n == name || strings.HasPrefix(n, name+"/") || name == "." {
+			delete(d.files, n)
+		}
+	}
+	return nil
+}
+
+func (d *memoryDriver) Lock(name string) (func(), error) {
+	d.mu.Lock()
+	l, ok := d.locks[name]
+	if !ok {
+		l = &sync.Mutex{}
+		d.locks[name] = l
+	}
+	d.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock, nil
+}
+
+// memoryFile is a file of a memoryDriver opened for writing, writing straight through to its entry
+type memoryFile struct {
+	entry  *memoryEntry
+	offset int64
+}
+
+func (f *memoryFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memoryFile) ReadAt(p []byte, off int64) (int, error) {
+	f.entry.mu.Lock()
+	defer f.entry.mu.Unlock()
+
+	if off >= int64(len(f.entry.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.entry.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memoryFile) Write(p []byte) (int, error) {
+	f.entry.mu.Lock()
+	defer f.entry.mu.Unlock()
+
+	if end := f.offset + int64(len(p)); end > int64(len(f.entry.data)) {
+		f.entry.data = append(f.entry.data, make([]byte, end-int64(len(f.entry.data)))...)
+	}
+	n := copy(f.entry.data[f.offset:], p)
+	f.offset += int64(n)
+	f.entry.modTime = time.Now()
+	return n, nil
+}
+
+func (f *memoryFile) Seek(offset int64, whence int) (int64, error) {
+	f.entry.mu.Lock()
+	size := int64(len(f.entry.data))
+	f.entry.mu.Unlock()
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek to %d: %w", offset, fs.ErrInvalid)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memoryFile) Truncate(size int64) error {
+	f.entry.mu.Lock()
+	defer f.entry.mu.Unlock()
+
+	if size > int64(len(f.entry.data)) {
+		f.entry.data = append(f.entry.data, make([]byte, size-int64(len(f.entry.data)))...)
+	}
+	f.entry.data = f.entry.data[:size]
+	return nil
+}
+
+func (f *memoryFile) Sync() error {
+	return nil
+}
+
+func (f *memoryFile) Close() error {
+	return nil
+}
+
+// memoryReader is a file of a memoryDriver opened for reading, reading a copy of its content as it was opened
+type memoryReader struct {
+	*bytes.Reader
+	info memoryInfo
+}
+
+func (f *memoryReader) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *memoryReader) Close() error {
+	return nil
+}
+
+type memoryDir struct {
+	info    memoryInfo
+	entries []fs.DirEntry
+}
+
+func (d *memoryDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *memoryDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *memoryDir) Close() error {
+	return nil
+}
+
+func (d *memoryDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+type memoryInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i memoryInfo) Name() string       { return i.name }
+func (i memoryInfo) Size() int64        { return i.size }
+func (i memoryInfo) ModTime() time.Time { return i.modTime }
+func (i memoryInfo) IsDir() bool        { return i.dir }
+func (i memoryInfo) Sys() interface{}   { return nil }
+
+func (i memoryInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
@@ -0,0 +1,23 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/containerd/containerd/errdefs"
+)
+
+// Errors returned by layouts, wrapped with the reference or digest they're about so callers can tell them apart with
+// errors.Is
+// 	They wrap the matching containerd errors in turn, so errdefs.IsNotFound and errdefs.IsFailedPrecondition still
+// 	hold for anything built on containerd or oras.
+var (
+	ErrRefNotFound    = fmt.Errorf("reference %w", errdefs.ErrNotFound)
+	ErrBlobNotFound   = fmt.Errorf("blob %w", errdefs.ErrNotFound)
+	ErrDigestMismatch = fmt.Errorf("digest mismatch: %w", errdefs.ErrFailedPrecondition)
+	ErrSizeMismatch   = fmt.Errorf("size mismatch: %w", errdefs.ErrFailedPrecondition)
+	ErrReadOnly       = fmt.Errorf("layout is read-only: %w", errdefs.ErrFailedPrecondition)
+
+	// ErrIncompatibleLayout is returned for layouts whose oci-layout marker is unreadable or of an unsupported version
+	ErrIncompatibleLayout = errors.New("incompatible oci layout")
+)
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package content
+
+import (
+	"os"
+)
+
+func localRoot(root string) string {
+	return root
+}
+
+func rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
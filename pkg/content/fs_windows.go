@@ -0,0 +1,40 @@
+//go:build windows
+// +build windows
+
+package content
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// renameAttempts bounds how long rename waits for readers of the file it replaces
+const renameAttempts = 10
+
+// localRoot makes root absolute, as only absolute paths can exceed MAX_PATH, which os then prefixes with \\?\ for
+func localRoot(root string) string {
+	if abs, err := filepath.Abs(root); err == nil {
+		return abs
+	}
+	return root
+}
+
+// rename retries replacing newpath while it's open elsewhere, ie: index.json by a reader in another process, which
+// windows refuses rather than replacing the file from under it
+func rename(oldpath, newpath string) error {
+	var err error
+	for i := 1; i <= renameAttempts; i++ {
+		if err = os.Rename(oldpath, newpath); err == nil {
+			return nil
+		}
+		if !errors.Is(err, windows.ERROR_ACCESS_DENIED) && !errors.Is(err, windows.ERROR_SHARING_VIOLATION) {
+			return err
+		}
+		time.Sleep(time.Duration(i) * 10 * time.Millisecond)
+	}
+	return err
+}
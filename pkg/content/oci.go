@@ -2,20 +2,23 @@ package content
 
 import (
 	"context"
+	_ "crypto/sha512"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"path"
+	"sort"
 	"strings"
 	"sync"
 
 	ccontent "github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/remotes"
+	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/specs-go"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
-	"oras.land/oras-go/pkg/content"
 	"oras.land/oras-go/pkg/target"
 
 	"github.com/rancherfederal/ocil/pkg/consts"
@@ -23,79 +26,308 @@ import (
 
 var _ target.Target = (*OCI)(nil)
 
+// indexLockFile guards mutations of the index across processes sharing a store
+const indexLockFile = "index.json.lock"
+
 type OCI struct {
 	root    string
-	index   *ocispec.Index
+	driver  Driver
 	nameMap *sync.Map // map[string]ocispec.Descriptor
+
+	// mu guards index within this process, the index lock file guards it across processes
+	mu    sync.Mutex
+	index *ocispec.Index
+
+	// updateMu is held for writing across every load, change and save of the index, and for reading by every other
+	// load, so a load can't drop a change from nameMap before it is saved
+	updateMu sync.RWMutex
+
+	readOnly bool
+
+	log logr.Logger
+}
+
+type Option func(*OCI)
+
+// WithLogger logs what the layout writes and deletes to log, at V(1) and above
+func WithLogger(log logr.Logger) Option {
+	return func(o *OCI) {
+		o.log = log
+	}
 }
 
-func NewOCI(root string) (*OCI, error) {
+// WithDriver stores the layout with d rather than on the local filesystem, its root then only naming it
+func WithDriver(d Driver) Option {
+	return func(o *OCI) {
+		o.driver = d
+	}
+}
+
+// WithReadOnly rejects every write to the layout with ErrReadOnly, and never creates anything under its root, so it can
+// be read from read-only media
+func WithReadOnly() Option {
+	return func(o *OCI) {
+		o.readOnly = true
+	}
+}
+
+// NewOCI returns the layout rooted at root, writing its oci-layout marker if it doesn't have one yet
+// 	Layouts with a marker of an incompatible version are refused with an error wrapping ErrIncompatibleLayout.  Read-only
+// 	layouts are never given a marker, but their root must exist.
+func NewOCI(root string, opts ...Option) (*OCI, error) {
 	o := &OCI{
 		root:    root,
 		nameMap: &sync.Map{},
+		log:     logr.Discard(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.driver == nil {
+		o.driver = NewLocalDriver(root)
+	}
+	if err := o.ensureLayout(); err != nil {
+		return nil, err
 	}
 	return o, nil
 }
 
+// ensureLayout validates the layouts oci-layout marker, writing one if there is none
+// 	Other tools (ie: skopeo, crane) refuse to read a layout without it
+func (o *OCI) ensureLayout() error {
+	data, err := fs.ReadFile(o.driver, ocispec.ImageLayoutFile)
+	if os.IsNotExist(err) && o.readOnly {
+		_, err := o.driver.Stat(".")
+		return err
+	}
+	if os.IsNotExist(err) {
+		data, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+		if err != nil {
+			return err
+		}
+		return o.driver.WriteFile(ocispec.ImageLayoutFile, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	var layout ocispec.ImageLayout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return fmt.Errorf("%s: invalid %s: %v: %w", o.root, ocispec.ImageLayoutFile, err, ErrIncompatibleLayout)
+	}
+	// the major version is all that's breaking
+	if major := strings.SplitN(layout.Version, ".", 2)[0]; major != strings.SplitN(ocispec.ImageLayoutVersion, ".", 2)[0] {
+		return fmt.Errorf("%s: imageLayoutVersion %q, want %s: %w", o.root, layout.Version, ocispec.ImageLayoutVersion, ErrIncompatibleLayout)
+	}
+	return nil
+}
+
 // AddIndex adds a descriptor to the index and updates it
 // 	The descriptor must use AnnotationRefName to identify itself
 func (o *OCI) AddIndex(desc ocispec.Descriptor) error {
 	if _, ok := desc.Annotations[ocispec.AnnotationRefName]; !ok {
 		return fmt.Errorf("descriptor must contain a reference from the annotation: %s", ocispec.AnnotationRefName)
 	}
-	o.nameMap.Store(desc.Annotations[ocispec.AnnotationRefName], desc)
-	return o.SaveIndex()
+	o.log.V(1).Info("indexing reference", "reference", desc.Annotations[ocispec.AnnotationRefName], "digest", desc.Digest)
+	return o.updateIndex(func() error {
+		o.nameMap.Store(desc.Annotations[ocispec.AnnotationRefName], desc)
+		return nil
+	})
+}
+
+// RemoveIndex removes the given references from the index and updates it
+func (o *OCI) RemoveIndex(refs ...string) error {
+	o.log.V(1).Info("removing references from index", "references", refs)
+	return o.updateIndex(func() error {
+		for _, ref := range refs {
+			o.nameMap.Delete(ref)
+		}
+		return nil
+	})
+}
+
+// UpdateIndex adds the given descriptors to the index, and removes the given references from it, in a single update
+// 	Either every change is saved or, should saving fail, none of them are.
+func (o *OCI) UpdateIndex(add []ocispec.Descriptor, remove []string) error {
+	for _, desc := range add {
+		if _, ok := desc.Annotations[ocispec.AnnotationRefName]; !ok {
+			return fmt.Errorf("descriptor must contain a reference from the annotation: %s", ocispec.AnnotationRefName)
+		}
+	}
+	o.log.V(1).Info("updating index", "added", len(add), "removed", remove)
+	return o.updateIndex(func() error {
+		for _, ref := range remove {
+			o.nameMap.Delete(ref)
+		}
+		for _, desc := range add {
+			o.nameMap.Store(desc.Annotations[ocispec.AnnotationRefName], desc)
+		}
+		return nil
+	})
 }
 
 // LoadIndex will load the index from disk
+// 	It waits for any update of the index in progress to be saved first, so it's safe to call from any goroutine.
 func (o *OCI) LoadIndex() error {
-	path := o.path(consts.OCIImageIndexFile)
-	idx, err := os.Open(path)
+	o.updateMu.RLock()
+	defer o.updateMu.RUnlock()
+	return o.loadIndex()
+}
+
+func (o *OCI) loadIndex() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	idx, err := o.driver.Open(consts.OCIImageIndexFile)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return err
 		}
-		o.index = &ocispec.Index{
-			Versioned: specs.Versioned{
-				SchemaVersion: 2,
-			},
+		if o.index == nil {
+			o.index = &ocispec.Index{
+				Versioned: specs.Versioned{
+					SchemaVersion: 2,
+				},
+			}
 		}
 		return nil
 	}
 	defer idx.Close()
 
-	if err := json.NewDecoder(idx).Decode(&o.index); err != nil {
+	// always decode into a fresh index, descriptors handed out from a previous load must never be mutated
+	var index ocispec.Index
+	if err := json.NewDecoder(idx).Decode(&index); err != nil {
 		return err
 	}
+	o.index = &index
 
+	names := make(map[string]bool, len(o.index.Manifests))
 	for _, desc := range o.index.Manifests {
 		if name := desc.Annotations[ocispec.AnnotationRefName]; name != "" {
 			o.nameMap.Store(name, desc)
+			names[name] = true
 		}
 	}
+
+	// drop anything removed from disk since we last loaded, ie: by another process sharing the store
+	o.nameMap.Range(func(name, _ interface{}) bool {
+		if !names[name.(string)] {
+			o.nameMap.Delete(name)
+		}
+		return true
+	})
 	return nil
 }
 
+// IndexAnnotations returns a copy of the annotations recorded on the index itself
+func (o *OCI) IndexAnnotations() map[string]string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	annotations := make(map[string]string, len(o.index.Annotations))
+	for k, v := range o.index.Annotations {
+		annotations[k] = v
+	}
+	return annotations
+}
+
+// SetIndexAnnotation sets an annotation on the index itself, it is persisted the next time the index is saved
+func (o *OCI) SetIndexAnnotation(key, value string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.index.Annotations == nil {
+		o.index.Annotations = make(map[string]string)
+	}
+	o.index.Annotations[key] = value
+}
+
 // SaveIndex will update the index on disk
 func (o *OCI) SaveIndex() error {
-	var descs []ocispec.Descriptor
+	if o.readOnly {
+		return ErrReadOnly
+	}
+	o.updateMu.Lock()
+	defer o.updateMu.Unlock()
+
+	unlock, err := o.lockIndex()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return o.saveIndex()
+}
+
+// updateIndex applies fn to a freshly loaded index and saves the result, all while holding the index lock
+// 	Loading first ensures changes made by other processes sharing the store since we last loaded aren't clobbered,
+// 	and other goroutines of this one wait for the save before loading or updating in turn.
+func (o *OCI) updateIndex(fn func() error) error {
+	if o.readOnly {
+		return ErrReadOnly
+	}
+	o.updateMu.Lock()
+	defer o.updateMu.Unlock()
+
+	unlock, err := o.lockIndex()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := o.loadIndex(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return o.saveIndex()
+}
+
+// lockIndex takes an exclusive advisory lock guarding index mutations, and returns the function that releases it
+// 	The lock is held on a dedicated file, since index.json itself is replaced on every save
+func (o *OCI) lockIndex() (func(), error) {
+	unlock, err := o.driver.Lock(indexLockFile)
+	if err != nil {
+		return nil, fmt.Errorf("lock index: %w", err)
+	}
+	return unlock, nil
+}
+
+// saveIndex atomically replaces the index on disk
+// 	Manifests are sorted by reference, and encoding/json sorts map keys without adding whitespace, so the
+// 	same content always serializes to the same bytes no matter the order it was added in.
+func (o *OCI) saveIndex() error {
+	descs := []ocispec.Descriptor{}
 	o.nameMap.Range(func(name, desc interface{}) bool {
 		n := name.(string)
 		d := desc.(ocispec.Descriptor)
 
-		if d.Annotations == nil {
-			d.Annotations = make(map[string]string)
+		annotations := make(map[string]string, len(d.Annotations)+1)
+		for k, v := range d.Annotations {
+			annotations[k] = v
 		}
-		d.Annotations[ocispec.AnnotationRefName] = n
+		annotations[ocispec.AnnotationRefName] = n
+		d.Annotations = annotations
 		descs = append(descs, d)
 		return true
 	})
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].Annotations[ocispec.AnnotationRefName] < descs[j].Annotations[ocispec.AnnotationRefName]
+	})
+
+	o.mu.Lock()
 	o.index.Manifests = descs
 	data, err := json.Marshal(o.index)
+	o.mu.Unlock()
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(o.path(consts.OCIImageIndexFile), data, 0644)
+
+	// the marker is gone if the layout was flushed since it was opened
+	if err := o.ensureLayout(); err != nil {
+		return err
+	}
+	return o.driver.WriteFile(consts.OCIImageIndexFile, data)
 }
 
 // Resolve attempts to resolve the reference into a name and descriptor.
@@ -108,19 +340,61 @@ func (o *OCI) SaveIndex() error {
 // Dependending on the remote namespace, this may be immutable or mutable.
 // While the name may differ from ref, it should itself be a valid ref.
 //
-// If the resolution fails, an error will be returned.
+// If the resolution fails, an error will be returned, wrapping ErrRefNotFound when nothing is indexed under ref.
 func (o *OCI) Resolve(ctx context.Context, ref string) (name string, desc ocispec.Descriptor, err error) {
 	if err := o.LoadIndex(); err != nil {
 		return "", ocispec.Descriptor{}, err
 	}
-	d, ok := o.nameMap.Load(ref)
+	desc, ok := o.lookup(ref)
 	if !ok {
-		return "", ocispec.Descriptor{}, err
+		return "", ocispec.Descriptor{}, fmt.Errorf("%s: %w", ref, ErrRefNotFound)
 	}
-	desc = d.(ocispec.Descriptor)
 	return ref, desc, nil
 }
 
+// lookup finds the descriptor ref refers to: by name, by repo@<digest> for a manifest indexed anywhere in the same
+// repository, or by a bare digest for a manifest indexed anywhere at all
+func (o *OCI) lookup(ref string) (ocispec.Descriptor, bool) {
+	if d, ok := o.nameMap.Load(ref); ok {
+		return d.(ocispec.Descriptor), true
+	}
+
+	repo, encoded := "", ref
+	if i := strings.LastIndex(ref, "@"); i != -1 {
+		repo, encoded = ref[:i], ref[i+1:]
+	}
+	d, err := digest.Parse(encoded)
+	if err != nil {
+		return ocispec.Descriptor{}, false
+	}
+
+	// of several matches the first by name wins, so lookups are stable
+	var found ocispec.Descriptor
+	var foundName string
+	o.nameMap.Range(func(name, value interface{}) bool {
+		n, desc := name.(string), value.(ocispec.Descriptor)
+		if desc.Digest != d || (repo != "" && repository(n) != repository(repo)) {
+			return true
+		}
+		if foundName == "" || n < foundName {
+			found, foundName = desc, n
+		}
+		return true
+	})
+	return found, foundName != ""
+}
+
+// repository strips the tag or digest from ref
+func repository(ref string) string {
+	if i := strings.Index(ref, "@"); i != -1 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i != -1 && !strings.Contains(ref[i:], "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
+
 // Fetcher returns a new fetcher for the provided reference.
 // All content fetched from the returned fetcher will be
 // from the namespace referred to by ref.
@@ -128,33 +402,70 @@ func (o *OCI) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error)
 	if err := o.LoadIndex(); err != nil {
 		return nil, err
 	}
-	if _, ok := o.nameMap.Load(ref); !ok {
-		return nil, nil
+	if _, ok := o.lookup(ref); !ok {
+		return nil, fmt.Errorf("%s: %w", ref, ErrRefNotFound)
 	}
 	return o, nil
 }
 
+// Fetch opens the blob identified by desc, reads of which fail once ctx is done
+// 	What's read is verified against desc, so a corrupted or tampered blob fails the read that reaches its end with
+// 	ErrDigestMismatch (or ErrSizeMismatch) rather than going unnoticed.  A blob whose size on disk already differs
+// 	from that of desc isn't opened at all.
 func (o *OCI) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
 	readerAt, err := o.blobReaderAt(desc)
 	if err != nil {
 		return nil, err
 	}
-	return readerAt, nil
+
+	if desc.Size > 0 {
+		fi, err := readerAt.Stat()
+		if err != nil {
+			readerAt.Close()
+			return nil, err
+		}
+		if fi.Size() != desc.Size {
+			readerAt.Close()
+			return nil, fmt.Errorf("blob %s: size %d, expected %d: %w", desc.Digest, fi.Size(), desc.Size, ErrSizeMismatch)
+		}
+	}
+	rf, ok := readerAt.(readFile)
+	if !ok {
+		readerAt.Close()
+		return nil, fmt.Errorf("blob %s: the layout's driver opened it as a %T, which can't seek or read at", desc.Digest, readerAt)
+	}
+	return newVerifiedFile(&contextFile{file: rf, ctx: ctx}, desc), nil
+}
+
+// Delete removes the blob identified by desc from the layout
+// 	Nothing prevents deleting a blob that is still referenced, callers are expected to have checked
+func (o *OCI) Delete(ctx context.Context, desc ocispec.Descriptor) error {
+	if o.readOnly {
+		return fmt.Errorf("delete blob %s: %w", desc.Digest, ErrReadOnly)
+	}
+	err := o.driver.Remove(blobName(desc.Digest))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	o.log.V(1).Info("deleted blob", "digest", desc.Digest)
+	return nil
 }
 
 // Pusher returns a new pusher for the provided reference
 // The returned Pusher should satisfy content.Ingester and concurrent attempts
 // to push the same blob using the Ingester API should result in ErrUnavailable.
 func (o *OCI) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	if o.readOnly {
+		return nil, fmt.Errorf("push %s: %w", ref, ErrReadOnly)
+	}
 	if err := o.LoadIndex(); err != nil {
 		return nil, err
 	}
 
-	var baseRef, hash string
-	parts := strings.SplitN(ref, "@", 2)
-	baseRef = parts[0]
-	if len(parts) > 1 {
-		hash = parts[1]
+	// the root's digest is always last, a reference pinned to a digest already carries one of its own
+	baseRef, hash := ref, ""
+	if i := strings.LastIndex(ref, "@"); i != -1 {
+		baseRef, hash = ref[:i], ref[i+1:]
 	}
 	return &ociPusher{
 		oci:    o,
@@ -181,33 +492,22 @@ func (o *OCI) Walk(fn func(reference string, desc ocispec.Descriptor) error) err
 	return nil
 }
 
-func (o *OCI) blobReaderAt(desc ocispec.Descriptor) (*os.File, error) {
-	blobPath, err := o.ensureBlob(desc.Digest.Algorithm().String(), desc.Digest.Hex())
-	if err != nil {
-		return nil, err
+func (o *OCI) blobReaderAt(desc ocispec.Descriptor) (fs.File, error) {
+	f, err := o.driver.Open(blobName(desc.Digest))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %w", desc.Digest, ErrBlobNotFound)
 	}
-	return os.Open(blobPath)
+	return f, err
 }
 
-func (o *OCI) blobWriterAt(desc ocispec.Descriptor) (*os.File, error) {
-	blobPath, err := o.ensureBlob(desc.Digest.Algorithm().String(), desc.Digest.Hex())
-	if err != nil {
-		return nil, err
-	}
-	return os.OpenFile(blobPath, os.O_WRONLY|os.O_CREATE, 0644)
-}
-
-func (o *OCI) ensureBlob(alg string, hex string) (string, error) {
-	dir := o.path("blobs", alg)
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil && !os.IsExist(err) {
-		return "", err
-	}
-	return filepath.Join(dir, hex), nil
+// Driver returns the storage the layout's files live in
+func (o *OCI) Driver() Driver {
+	return o.driver
 }
 
-func (o *OCI) path(elem ...string) string {
-	complete := []string{string(o.root)}
-	return filepath.Join(append(complete, elem...)...)
+// blobName is the name of the blob d within the layout
+func blobName(d digest.Digest) string {
+	return path.Join("blobs", d.Algorithm().String(), d.Hex())
 }
 
 type ociPusher struct {
@@ -220,34 +520,17 @@ type ociPusher struct {
 // by the descriptor.
 func (p *ociPusher) Push(ctx context.Context, d ocispec.Descriptor) (ccontent.Writer, error) {
 	switch d.MediaType {
-	case ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex, consts.DockerManifestSchema2:
+	case ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex, consts.DockerManifestSchema2, consts.DockerManifestListSchema2:
 		// if the hash of the content matches that which was provided as the hash for the root, mark it
 		if p.digest != "" && p.digest == d.Digest.String() {
-			if err := p.oci.LoadIndex(); err != nil {
-				return nil, err
-			}
-			p.oci.nameMap.Store(p.ref, d)
-			if err := p.oci.SaveIndex(); err != nil {
+			if err := p.oci.updateIndex(func() error {
+				p.oci.nameMap.Store(p.ref, d)
+				return nil
+			}); err != nil {
 				return nil, err
 			}
 		}
 	}
 
-	blobPath, err := p.oci.ensureBlob(d.Digest.Algorithm().String(), d.Digest.Hex())
-	if err != nil {
-		return nil, err
-	}
-
-	if _, err := os.Stat(blobPath); err == nil {
-		// file already exists, discard (but validate digest)
-		return content.NewIoContentWriter(ioutil.Discard, content.WithOutputHash(d.Digest)), nil
-	}
-
-	f, err := os.Create(blobPath)
-	if err != nil {
-		return nil, err
-	}
-
-	w := content.NewIoContentWriter(f, content.WithInputHash(d.Digest), content.WithOutputHash(d.Digest))
-	return w, nil
+	return p.oci.Writer(ctx, d)
 }
@@ -0,0 +1,76 @@
+package content
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// verifiedFile is a blob opened for reading that checks what's read of it against its descriptor
+// 	Reading past the size of the descriptor fails with ErrSizeMismatch, and so does reaching the end of the blob short
+// 	of it, while reaching the end of a blob that doesn't hash to the digest of the descriptor fails with
+// 	ErrDigestMismatch.  Descriptors without a size (ie: built from just a digest) only have their digest checked.
+// 	Seeking anywhere but back to the start (ie: for range requests) only reads part of the blob, which can't be verified.
+// 	The file isn't embedded, its WriteTo would let io.Copy read around the verification.
+type verifiedFile struct {
+	f    *contextFile
+	desc ocispec.Descriptor
+
+	digester digest.Digester
+	read     int64
+	partial  bool
+}
+
+func newVerifiedFile(f *contextFile, desc ocispec.Descriptor) *verifiedFile {
+	return &verifiedFile{f: f, desc: desc, digester: desc.Digest.Algorithm().Digester()}
+}
+
+func (f *verifiedFile) Read(p []byte) (int, error) {
+	n, err := f.f.Read(p)
+	if f.partial {
+		return n, err
+	}
+
+	f.digester.Hash().Write(p[:n])
+	f.read += int64(n)
+	if f.desc.Size > 0 && f.read > f.desc.Size {
+		return n, fmt.Errorf("blob %s: read past its size %d: %w", f.desc.Digest, f.desc.Size, ErrSizeMismatch)
+	}
+	if err != io.EOF {
+		return n, err
+	}
+
+	if f.desc.Size > 0 && f.read != f.desc.Size {
+		return n, fmt.Errorf("blob %s: read %d bytes, expected %d: %w", f.desc.Digest, f.read, f.desc.Size, ErrSizeMismatch)
+	}
+	if got := f.digester.Digest(); got != f.desc.Digest {
+		return n, fmt.Errorf("blob %s: read content of digest %s: %w", f.desc.Digest, got, ErrDigestMismatch)
+	}
+	return n, err
+}
+
+func (f *verifiedFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.f.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+
+	// rewinding starts the verification over, anything else leaves it unverifiable
+	f.partial = pos != 0
+	if !f.partial {
+		f.digester = f.desc.Digest.Algorithm().Digester()
+		f.read = 0
+	}
+	return pos, nil
+}
+
+// ReadAt reads from anywhere in the blob, which is never verified
+func (f *verifiedFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.f.ReadAt(p, off)
+}
+
+func (f *verifiedFile) Close() error {
+	return f.f.Close()
+}
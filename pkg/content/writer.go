@@ -0,0 +1,197 @@
+package content
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// IngestDir is where blobs are staged while being written, they are only moved under blobs/ once their size and digest
+// have been validated
+const IngestDir = "ingest"
+
+var _ ccontent.Writer = (*blobWriter)(nil)
+
+// Writer returns a content writer for the blob identified by desc
+// 	Writes are staged in the ingest directory and resume from wherever a previous, interrupted write left off.  If the
+// 	blob already exists, an error satisfying errdefs.IsAlreadyExists is returned.  Writes fail once ctx is done, leaving
+// 	what was written so far staged for the next attempt.
+func (o *OCI) Writer(ctx context.Context, desc ocispec.Descriptor) (ccontent.Writer, error) {
+	if err := desc.Digest.Validate(); err != nil {
+		return nil, err
+	}
+	if o.readOnly {
+		return nil, fmt.Errorf("write blob %s: %w", desc.Digest, ErrReadOnly)
+	}
+
+	blobPath := blobName(desc.Digest)
+	if _, err := o.driver.Stat(blobPath); err == nil {
+		return nil, fmt.Errorf("blob %s: %w", desc.Digest, errdefs.ErrAlreadyExists)
+	}
+
+	// only one writer may stage a given blob at a time, whether in this process or another sharing the store
+	ingestPath := path.Join(IngestDir, desc.Digest.Algorithm().String(), desc.Digest.Hex())
+	unlock, err := o.driver.Lock(ingestPath + ".lock")
+	if err != nil {
+		return nil, fmt.Errorf("lock blob %s: %w", desc.Digest, err)
+	}
+
+	// whoever held the lock before us may have just committed the blob
+	if _, err := o.driver.Stat(blobPath); err == nil {
+		unlock()
+		return nil, fmt.Errorf("blob %s: %w", desc.Digest, errdefs.ErrAlreadyExists)
+	}
+
+	f, err := o.driver.Create(ingestPath)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	// rehash whatever a previous attempt managed to write, so we can pick up where it left off
+	digester := desc.Digest.Algorithm().Digester()
+	offset, err := io.Copy(digester.Hash(), &contextFile{file: f, ctx: ctx})
+	if err != nil {
+		f.Close()
+		unlock()
+		return nil, err
+	}
+
+	if offset > 0 {
+		o.log.V(1).Info("resuming staged blob", "digest", desc.Digest, "offset", offset)
+	}
+
+	now := time.Now()
+	return &blobWriter{
+		log:        o.log,
+		ctx:        ctx,
+		driver:     o.driver,
+		f:          f,
+		unlock:     unlock,
+		desc:       desc,
+		ingestPath: ingestPath,
+		blobPath:   blobPath,
+		digester:   digester,
+		offset:     offset,
+		startedAt:  now,
+		updatedAt:  now,
+	}, nil
+}
+
+// blobWriter writes a single blob to the ingest directory, moving it into place on Commit
+type blobWriter struct {
+	log        logr.Logger
+	ctx        context.Context
+	driver     Driver
+	f          File
+	unlock     func()
+	desc       ocispec.Descriptor
+	ingestPath string
+	blobPath   string
+	digester   digest.Digester
+	offset     int64
+
+	startedAt time.Time
+	updatedAt time.Time
+}
+
+func (w *blobWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := w.f.Write(p)
+	w.digester.Hash().Write(p[:n])
+	w.offset += int64(n)
+	w.updatedAt = time.Now()
+	return n, err
+}
+
+// Close leaves the staged blob in place, so a later write can resume it
+func (w *blobWriter) Close() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	w.unlock()
+	return err
+}
+
+func (w *blobWriter) Digest() digest.Digest {
+	return w.digester.Digest()
+}
+
+// Commit validates the staged blob against size and expected, and moves it into the layout
+// 	A blob failing validation is discarded, since resuming it would only ever produce the same invalid content
+func (w *blobWriter) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...ccontent.Opt) error {
+	if w.f == nil {
+		return fmt.Errorf("blob %s: writer is closed: %w", w.desc.Digest, errdefs.ErrFailedPrecondition)
+	}
+	defer w.Close()
+
+	if expected == "" {
+		expected = w.desc.Digest
+	}
+	if size > 0 && size != w.offset {
+		w.driver.Remove(w.ingestPath)
+		return fmt.Errorf("blob %s: unexpected commit size %d, expected %d: %w", expected, w.offset, size, errdefs.ErrFailedPrecondition)
+	}
+	if got := w.digester.Digest(); got != expected {
+		w.driver.Remove(w.ingestPath)
+		return fmt.Errorf("blob %s: unexpected commit digest %s: %w", expected, got, ErrDigestMismatch)
+	}
+
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+	// the staged file must be closed before it can be renamed on windows, but the lock is held until it's in place
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	w.f = nil
+	defer w.unlock()
+
+	if err := w.driver.Rename(w.ingestPath, w.blobPath); err != nil {
+		return err
+	}
+
+	// anyone still waiting on the lock will find the committed blob once they acquire it
+	w.driver.Remove(w.ingestPath + ".lock")
+	w.log.V(2).Info("committed blob", "digest", expected, "size", w.offset)
+	return nil
+}
+
+func (w *blobWriter) Status() (ccontent.Status, error) {
+	return ccontent.Status{
+		Ref:       w.desc.Digest.String(),
+		Offset:    w.offset,
+		Total:     w.desc.Size,
+		Expected:  w.desc.Digest,
+		StartedAt: w.startedAt,
+		UpdatedAt: w.updatedAt,
+	}, nil
+}
+
+// Truncate only supports discarding everything written so far, which is all that's needed to restart a write
+func (w *blobWriter) Truncate(size int64) error {
+	if size != 0 {
+		return fmt.Errorf("truncate to %d: %w", size, errdefs.ErrInvalidArgument)
+	}
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.f.Seek(0, 0); err != nil {
+		return err
+	}
+	w.digester = w.desc.Digest.Algorithm().Digester()
+	w.offset = 0
+	return nil
+}
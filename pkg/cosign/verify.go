@@ -0,0 +1,260 @@
+package cosign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// oidIssuer is the fulcio certificate extension recording the OIDC issuer that authenticated the signer
+var oidIssuer = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+
+// Verifier checks a single cosign signature over payload
+// 	annotations are those of the signature layer, which carry the signing certificate of keyless signatures
+type Verifier interface {
+	Verify(payload, signature []byte, annotations map[string]string) error
+}
+
+// Signatures is the subset of a cosign signature image needed to verify it, satisfied by both v1.Image and
+// artifacts.OCI
+type Signatures interface {
+	Manifest() (*gv1.Manifest, error)
+	Layers() ([]gv1.Layer, error)
+}
+
+// payload is the simple signing payload cosign signs
+type payload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// Verify checks that at least one of sigs is a signature of the manifest d that satisfies v
+func Verify(sigs Signatures, d digest.Digest, v Verifier) error {
+	m, err := sigs.Manifest()
+	if err != nil {
+		return err
+	}
+	layers, err := sigs.Layers()
+	if err != nil {
+		return err
+	}
+	if len(layers) != len(m.Layers) {
+		return fmt.Errorf("signature manifest lists %d layers, found %d", len(m.Layers), len(layers))
+	}
+
+	var errs []string
+	for i, desc := range m.Layers {
+		if string(desc.MediaType) != consts.CosignSimpleSigningMediaType {
+			continue
+		}
+
+		if err := verifyLayer(layers[i], desc.Annotations, d, v); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		return nil
+	}
+
+	if len(errs) == 0 {
+		return errors.New("no cosign signatures found")
+	}
+	return fmt.Errorf("no valid signatures: %s", strings.Join(errs, "; "))
+}
+
+func verifyLayer(layer gv1.Layer, annotations map[string]string, d digest.Digest, v Verifier) error {
+	rc, err := layer.Compressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(annotations[consts.CosignSignatureAnnotation])
+	if err != nil {
+		return fmt.Errorf("decode signature: %w", err)
+	}
+	if err := v.Verify(data, sig, annotations); err != nil {
+		return err
+	}
+
+	// only trust what the payload claims once we know who signed it
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+	if p.Critical.Image.DockerManifestDigest != d.String() {
+		return fmt.Errorf("signature is for %s, not %s", p.Critical.Image.DockerManifestDigest, d)
+	}
+	return nil
+}
+
+// NewKeyVerifier verifies signatures made with the private half of pub, which must be an ecdsa, rsa or ed25519 key
+func NewKeyVerifier(pub crypto.PublicKey) Verifier {
+	return &keyVerifier{pub: pub}
+}
+
+// LoadKeyVerifier verifies signatures against the PEM encoded public key in path, ie: cosign.pub
+func LoadKeyVerifier(path string) (Verifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded public key found in %s", path)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyVerifier(pub), nil
+}
+
+type keyVerifier struct {
+	pub crypto.PublicKey
+}
+
+func (k *keyVerifier) Verify(payload, signature []byte, _ map[string]string) error {
+	return verifySignature(k.pub, payload, signature)
+}
+
+// NewKeylessVerifier verifies keyless signatures, whose signing certificate must chain to roots and have been issued to
+// identity (an email address or URI) as authenticated by issuer
+// 	An empty identity or issuer matches any.  Certificates are validated as of when they were issued, since the
+// 	transparency log entries that would otherwise prove when the signature was made aren't consulted.
+func NewKeylessVerifier(roots *x509.CertPool, identity, issuer string) Verifier {
+	return &keylessVerifier{roots: roots, identity: identity, issuer: issuer}
+}
+
+type keylessVerifier struct {
+	roots    *x509.CertPool
+	identity string
+	issuer   string
+}
+
+func (k *keylessVerifier) Verify(payload, signature []byte, annotations map[string]string) error {
+	certs, err := parseCertificates(annotations[consts.CosignCertificateAnnotation])
+	if err != nil {
+		return err
+	}
+	if len(certs) == 0 {
+		return errors.New("keyless signature has no certificate")
+	}
+	leaf := certs[0]
+
+	chain, err := parseCertificates(annotations[consts.CosignChainAnnotation])
+	if err != nil {
+		return err
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range chain {
+		intermediates.AddCert(c)
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         k.roots,
+		Intermediates: intermediates,
+		CurrentTime:   leaf.NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return err
+	}
+
+	if k.identity != "" && !hasIdentity(leaf, k.identity) {
+		return fmt.Errorf("certificate was not issued to %s", k.identity)
+	}
+	if k.issuer != "" && certificateIssuer(leaf) != k.issuer {
+		return fmt.Errorf("certificate identity was not issued by %s", k.issuer)
+	}
+
+	return verifySignature(leaf.PublicKey, payload, signature)
+}
+
+func verifySignature(pub crypto.PublicKey, payload, signature []byte) error {
+	sum := sha256.Sum256(payload)
+
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, sum[:], signature) {
+			return errors.New("invalid ecdsa signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], signature); err != nil {
+			return fmt.Errorf("invalid rsa signature: %w", err)
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, payload, signature) {
+			return errors.New("invalid ed25519 signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return nil
+}
+
+func parseCertificates(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return certs, nil
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+}
+
+func hasIdentity(c *x509.Certificate, identity string) bool {
+	for _, e := range c.EmailAddresses {
+		if e == identity {
+			return true
+		}
+	}
+	for _, u := range c.URIs {
+		if u.String() == identity {
+			return true
+		}
+	}
+	return false
+}
+
+func certificateIssuer(c *x509.Certificate) string {
+	for _, ext := range c.Extensions {
+		if ext.Id.Equal(oidIssuer) {
+			return string(bytes.TrimSpace(ext.Value))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package cosign_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/cosign"
+)
+
+func TestVerify(t *testing.T) {
+	d := digest.FromString("manifest")
+
+	key := genKey(t)
+	other := genKey(t)
+
+	ca, caKey := genCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	cert := genLeaf(t, ca, caKey, &key.PublicKey, "someone@example.com", "https://issuer.example.com")
+
+	tests := []struct {
+		name     string
+		sigs     cosign.Signatures
+		verifier cosign.Verifier
+		wantErr  bool
+	}{
+		{
+			name:     "should verify a signature made with the key",
+			sigs:     sign(t, key, d, nil),
+			verifier: cosign.NewKeyVerifier(&key.PublicKey),
+		},
+		{
+			name:     "should reject a signature made with another key",
+			sigs:     sign(t, other, d, nil),
+			verifier: cosign.NewKeyVerifier(&key.PublicKey),
+			wantErr:  true,
+		},
+		{
+			name:     "should reject a signature of another manifest",
+			sigs:     sign(t, key, digest.FromString("other"), nil),
+			verifier: cosign.NewKeyVerifier(&key.PublicKey),
+			wantErr:  true,
+		},
+		{
+			name:     "should reject an image without signatures",
+			sigs:     empty.Image,
+			verifier: cosign.NewKeyVerifier(&key.PublicKey),
+			wantErr:  true,
+		},
+		{
+			name:     "should verify a keyless signature of the identity",
+			sigs:     sign(t, key, d, cert),
+			verifier: cosign.NewKeylessVerifier(roots, "someone@example.com", "https://issuer.example.com"),
+		},
+		{
+			name:     "should reject a keyless signature of another identity",
+			sigs:     sign(t, key, d, cert),
+			verifier: cosign.NewKeylessVerifier(roots, "someone-else@example.com", ""),
+			wantErr:  true,
+		},
+		{
+			name:     "should reject a keyless signature of another issuer",
+			sigs:     sign(t, key, d, cert),
+			verifier: cosign.NewKeylessVerifier(roots, "", "https://other.example.com"),
+			wantErr:  true,
+		},
+		{
+			name:     "should reject a keyless signature from an untrusted root",
+			sigs:     sign(t, key, d, cert),
+			verifier: cosign.NewKeylessVerifier(x509.NewCertPool(), "", ""),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := cosign.Verify(tt.sigs, d, tt.verifier); (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func genKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func genCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key := genKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, key
+}
+
+func genLeaf(t *testing.T, ca *x509.Certificate, caKey crypto.Signer, pub crypto.PublicKey, email, issuer string) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		NotBefore:      time.Now().Add(-time.Minute),
+		NotAfter:       time.Now().Add(10 * time.Minute),
+		EmailAddresses: []string{email},
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		ExtraExtensions: []pkix.Extension{{
+			Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1},
+			Value: []byte(issuer),
+		}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, pub, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+// sign builds a cosign signature image of d signed by key, as a keyless signature if cert is given
+func sign(t *testing.T, key *ecdsa.PrivateKey, d digest.Digest, cert *x509.Certificate) gv1.Image {
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"hello/world"},"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"},"optional":null}`, d))
+
+	sum := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	annotations := map[string]string{
+		consts.CosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+	}
+	if cert != nil {
+		annotations[consts.CosignCertificateAnnotation] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, types.MediaType(consts.CosignSimpleSigningMediaType)),
+		Annotations: annotations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
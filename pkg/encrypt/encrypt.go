@@ -0,0 +1,213 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeySize is the size of keys, AES-256
+const KeySize = 32
+
+// chunkSize is how much plaintext each sealed chunk of a stream holds, so neither end ever buffers more than that
+const chunkSize = 64 * 1024
+
+// magic identifies encrypted streams, and the version of their format
+const magic = "ocilenc1"
+
+// HeaderSize is the number of bytes Encrypted needs to identify a stream
+const HeaderSize = len(magic)
+
+const saltSize = 16
+
+var (
+	ErrInvalidKey = fmt.Errorf("key must be %d bytes", KeySize)
+
+	// ErrDecrypt is returned for streams that are corrupt, truncated, tampered with, or were encrypted with another key
+	ErrDecrypt = errors.New("decrypt: message authentication failed")
+)
+
+// GenerateKey returns a new random key
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Encrypted reports whether header, the first bytes of a stream, is that of an encrypted stream
+func Encrypted(header []byte) bool {
+	return bytes.HasPrefix(header, []byte(magic))
+}
+
+// NewWriter returns a writer encrypting everything written to it with AES-256-GCM into w
+// 	The stream is split into chunks that are sealed individually, each under a nonce binding its position and whether
+// 	it's the last one, so chunks can't be reordered, dropped, or truncated without the reader noticing.  Every stream
+// 	is encrypted under its own key, derived from key and a random salt.  Close must be called to seal the last chunk,
+// 	it does not close w.
+func NewWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := streamCipher(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(append([]byte(magic), salt...)); err != nil {
+		return nil, err
+	}
+	return &writer{w: w, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+// NewReader returns a reader decrypting the stream written by NewWriter to r
+// 	Plaintext is only ever returned once the chunk it's from is authenticated, and reads fail with ErrDecrypt as soon
+// 	as a chunk doesn't.
+func NewReader(r io.Reader, key []byte) (io.Reader, error) {
+	header := make([]byte, len(magic)+saltSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("not an encrypted stream: %w", ErrDecrypt)
+		}
+		return nil, err
+	}
+	if !Encrypted(header) {
+		return nil, fmt.Errorf("not an encrypted stream: %w", ErrDecrypt)
+	}
+
+	aead, err := streamCipher(key, header[len(magic):])
+	if err != nil {
+		return nil, err
+	}
+	return &reader{r: r, aead: aead, sealed: make([]byte, chunkSize+aead.Overhead())}, nil
+}
+
+func streamCipher(key []byte, salt []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce returns the nonce of the n-th chunk of a stream
+func nonce(n uint64, last bool) []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint64(b[3:11], n)
+	if last {
+		b[11] = 1
+	}
+	return b
+}
+
+type writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	buf    []byte
+	n      uint64
+	closed bool
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to a closed writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if len(w.buf) == chunkSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	// a full chunk is never the last, the reader can't tell it apart from one that's followed by another
+	if len(w.buf) == chunkSize {
+		if err := w.seal(false); err != nil {
+			return err
+		}
+	}
+	return w.seal(true)
+}
+
+func (w *writer) seal(last bool) error {
+	sealed := w.aead.Seal(nil, nonce(w.n, last), w.buf, nil)
+	w.n++
+	w.buf = w.buf[:0]
+	_, err := w.w.Write(sealed)
+	return err
+}
+
+type reader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	sealed []byte
+	buf    []byte
+	n      uint64
+	done   bool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// open reads and authenticates the next chunk, only full chunks are ever followed by another
+func (r *reader) open() error {
+	n, err := io.ReadFull(r.r, r.sealed)
+	last := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+
+	buf, err := r.aead.Open(r.sealed[:0:0], nonce(r.n, last), r.sealed[:n], nil)
+	if err != nil {
+		return ErrDecrypt
+	}
+	r.n++
+	r.buf = buf
+	r.done = last
+	return nil
+}
@@ -0,0 +1,115 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/encrypt"
+)
+
+func TestRoundTrip(t *testing.T) {
+	key, err := encrypt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const chunk = 64 * 1024
+	for _, size := range []int{0, 1, chunk - 1, chunk, chunk + 1, 3 * chunk} {
+		plaintext := make([]byte, size)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		w, err := encrypt.NewWriter(&buf, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(plaintext); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !encrypt.Encrypted(buf.Bytes()) {
+			t.Errorf("Encrypted() of a %d byte stream = false", size)
+		}
+		// too short and a match is down to chance
+		if size >= 16 && bytes.Contains(buf.Bytes(), plaintext) {
+			t.Errorf("%d byte stream holds the plaintext", size)
+		}
+
+		r, err := encrypt.NewReader(bytes.NewReader(buf.Bytes()), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("decrypt %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("round trip of %d bytes returned %d different bytes", size, len(got))
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	key, err := encrypt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := encrypt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w, err := encrypt.NewWriter(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(make([]byte, 2*64*1024+10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stream := buf.Bytes()
+
+	tampered := append([]byte{}, stream...)
+	tampered[len(tampered)/2] ^= 1
+
+	header := encrypt.HeaderSize + 16
+	sealed := 64*1024 + 16
+
+	tcs := []struct {
+		name   string
+		stream []byte
+		key    []byte
+	}{
+		{name: "wrong key", stream: stream, key: other},
+		{name: "tampered", stream: tampered, key: key},
+		{name: "truncated", stream: stream[:len(stream)-1], key: key},
+		{name: "truncated at a chunk", stream: stream[:header+2*sealed], key: key},
+		{name: "chunks dropped", stream: append(append([]byte{}, stream[:header]...), stream[header+sealed:]...), key: key},
+		{name: "not encrypted", stream: []byte("plain text, and then some more"), key: key},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := encrypt.NewReader(bytes.NewReader(tc.stream), tc.key)
+			if err == nil {
+				_, err = io.ReadAll(r)
+			}
+			if !errors.Is(err, encrypt.ErrDecrypt) {
+				t.Errorf("decrypt = %v, want %v", err, encrypt.ErrDecrypt)
+			}
+		})
+	}
+
+	if _, err := encrypt.NewReader(bytes.NewReader(stream), []byte("short")); !errors.Is(err, encrypt.ErrInvalidKey) {
+		t.Errorf("NewReader() with a short key = %v, want %v", err, encrypt.ErrInvalidKey)
+	}
+}
@@ -1,13 +1,20 @@
 package layer
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/url"
+	"strings"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 
 	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/s3"
 )
 
 /*
@@ -20,8 +27,53 @@ type Cache interface {
 	Get(v1.Hash) (v1.Layer, error)
 }
 
+// Pruner is a Cache that evicts layers, which every cache of this package is
+type Pruner interface {
+	// Prune evicts whatever the cache's Policy says it shouldn't keep
+	Prune(context.Context) (*PruneReport, error)
+}
+
+// StatsReporter is a Cache that counts its hits and misses, which every cache of this package is
+type StatsReporter interface {
+	// Stats are the cache's counters since it was created
+	Stats() Stats
+}
+
 var ErrLayerNotFound = errors.New("layer not found")
 
+// NewCache returns the cache at rawurl, choosing its backend by scheme
+// 	- a plain path, or file:///path, is a NewSharedCache, safe to put on a shared filesystem
+// 	- s3://bucket/prefix is a NewS3Cache, configured from the environment the way the aws cli is
+// 	- oci://registry/repository is a NewRegistryCache, authenticated with the default keychain, which opts don't apply to
+func NewCache(rawurl string, opts ...CacheOption) (Cache, error) {
+	if !strings.Contains(rawurl, "://") {
+		return NewSharedCache(rawurl, opts...), nil
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewSharedCache(u.Path, opts...), nil
+
+	case "s3":
+		c, err := s3.NewClient(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Cache(c, u.Host, strings.Trim(u.Path, "/"), opts...), nil
+
+	case "oci":
+		return NewRegistryCache(u.Host+strings.TrimSuffix(u.Path, "/"), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+
+	default:
+		return nil, fmt.Errorf("unsupported cache scheme %q: %s", u.Scheme, rawurl)
+	}
+}
+
 type oci struct {
 	artifacts.OCI
 
@@ -55,6 +107,10 @@ type lazyLayer struct {
 
 func (l *lazyLayer) Compressed() (io.ReadCloser, error) {
 	digest, err := l.inner.Digest()
+	if errors.Is(err, artifacts.ErrNotComputed) {
+		// streams can't be looked up until they've been read, and can only be read the once
+		return l.inner.Compressed()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -69,6 +125,9 @@ func (l *lazyLayer) Compressed() (io.ReadCloser, error) {
 
 func (l *lazyLayer) Uncompressed() (io.ReadCloser, error) {
 	diffID, err := l.inner.DiffID()
+	if errors.Is(err, artifacts.ErrNotComputed) {
+		return l.inner.Uncompressed()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,48 @@
+package layer_test
+
+import (
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/layer"
+)
+
+func TestNewCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{
+			name: "should open a plain path as a shared cache",
+			url:  t.TempDir(),
+		},
+		{
+			name: "should open a file url as a shared cache",
+			url:  "file://" + t.TempDir(),
+		},
+		{
+			name: "should open an s3 cache",
+			url:  "s3://bucket/prefix",
+		},
+		{
+			name: "should open a registry cache",
+			url:  "oci://registry.example.com/cache",
+		},
+		{
+			name:    "should fail on an unsupported scheme",
+			url:     "ftp://example.com/cache",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := layer.NewCache(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewCache() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && c == nil {
+				t.Error("NewCache() = nil")
+			}
+		})
+	}
+}
@@ -1,19 +1,23 @@
 package layer
 
 import (
+	"context"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 )
 
 type fs struct {
-	root string
+	root   string
+	policy Policy
 }
 
-func NewFilesystemCache(root string) Cache {
-	return &fs{root: root}
+// NewFilesystemCache caches layers in root, a layer's last use is the mtime of its file
+func NewFilesystemCache(root string, opts ...CacheOption) Cache {
+	return instrument(&fs{root: root, policy: makePolicy(opts...)})
 }
 
 func (f *fs) Put(l v1.Layer) (v1.Layer, error) {
@@ -39,7 +43,15 @@ func (f *fs) Get(h v1.Hash) (v1.Layer, error) {
 	if os.IsNotExist(err) {
 		return nil, ErrLayerNotFound
 	}
-	return l, err
+	if err != nil {
+		return nil, err
+	}
+	touch(layerpath(f.root, h))
+	return l, nil
+}
+
+func (f *fs) Prune(ctx context.Context) (*PruneReport, error) {
+	return prunePath(ctx, f.root, f.policy)
 }
 
 func (f *fs) open(h v1.Hash) Opener {
@@ -97,6 +109,69 @@ func layerpath(root string, h v1.Hash) string {
 	return filepath.Join(root, h.Algorithm, h.Hex)
 }
 
+// touch records a use of the layer at path, on a best effort basis since the cache may well be read only
+func touch(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// entries lists the layers cached under root, skipping anything that isn't named for its digest
+func entries(root string) ([]Entry, error) {
+	algs, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Entry
+	for _, alg := range algs {
+		if !alg.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(root, alg.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			h, err := v1.NewHash(alg.Name() + ":" + f.Name())
+			if err != nil || !f.Type().IsRegular() {
+				continue
+			}
+			info, err := f.Info()
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, Entry{Digest: h, Size: info.Size(), LastUsed: info.ModTime()})
+		}
+	}
+	return out, nil
+}
+
+// prunePath removes the layers cached under root that p evicts
+func prunePath(ctx context.Context, root string, p Policy) (*PruneReport, error) {
+	es, err := entries(root)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PruneReport{}
+	for _, e := range p.evictions(es, time.Now()) {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := os.Remove(layerpath(root, e.Digest)); err != nil && !os.IsNotExist(err) {
+			return report, err
+		}
+		report.add(e)
+	}
+	return report, nil
+}
+
 type readcloser struct {
 	t      io.Reader
 	closes []func() error
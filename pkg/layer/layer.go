@@ -33,13 +33,11 @@ func FromOpener(opener Opener, opts ...Option) (v1.Layer, error) {
 		opt(layer)
 	}
 
-	if layer.digest, layer.size, err = compute(layer.uncompressedOpener); err != nil {
-		return nil, err
-	}
-
-	if layer.diffID, _, err = compute(layer.compressedOpener); err != nil {
+	// content is stored as is, so the digest and diffID are one and the same and a single pass computes both
+	if layer.digest, layer.size, err = compute(layer.compressedOpener); err != nil {
 		return nil, err
 	}
+	layer.diffID = layer.digest
 
 	return layer, nil
 }
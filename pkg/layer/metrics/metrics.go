@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rancherfederal/ocil/pkg/layer"
+)
+
+// interface guard
+var _ prometheus.Collector = (*collector)(nil)
+
+type collector struct {
+	c layer.StatsReporter
+
+	hits, misses, served, fetched *prometheus.Desc
+}
+
+// NewCollector exports the Stats of c as the ocil_layer_cache_* counters, labeled with labels to tell caches apart
+// 	Nothing is exported until the collector is registered, ie: prometheus.MustRegister(metrics.NewCollector(c, nil)),
+// 	nor for caches that aren't a layer.StatsReporter.
+func NewCollector(c layer.Cache, labels prometheus.Labels) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("ocil", "layer_cache", name), help, nil, labels)
+	}
+
+	stats, _ := c.(layer.StatsReporter)
+	return &collector{
+		c:       stats,
+		hits:    desc("hits_total", "Lookups of layers the cache had."),
+		misses:  desc("misses_total", "Lookups of layers the cache didn't have."),
+		served:  desc("served_bytes_total", "Bytes of layers read from the cache."),
+		fetched: desc("fetched_bytes_total", "Bytes of layers read from their source on a miss."),
+	}
+}
+
+func (m *collector) Describe(ch chan<- *prometheus.Desc) {
+	if m.c == nil {
+		return
+	}
+	ch <- m.hits
+	ch <- m.misses
+	ch <- m.served
+	ch <- m.fetched
+}
+
+func (m *collector) Collect(ch chan<- prometheus.Metric) {
+	if m.c == nil {
+		return
+	}
+	s := m.c.Stats()
+	ch <- prometheus.MustNewConstMetric(m.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(m.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(m.served, prometheus.CounterValue, float64(s.ServedBytes))
+	ch <- prometheus.MustNewConstMetric(m.fetched, prometheus.CounterValue, float64(s.FetchedBytes))
+}
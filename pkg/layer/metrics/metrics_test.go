@@ -0,0 +1,58 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/rancherfederal/ocil/pkg/layer"
+	"github.com/rancherfederal/ocil/pkg/layer/metrics"
+)
+
+func TestNewCollector(t *testing.T) {
+	c := layer.NewFilesystemCache(t.TempDir())
+
+	l, err := random.Layer(16, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := l.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(d); err != layer.ErrLayerNotFound {
+		t.Fatalf("Get() error = %v, want %v", err, layer.ErrLayerNotFound)
+	}
+
+	want := `
+# HELP ocil_layer_cache_hits_total Lookups of layers the cache had.
+# TYPE ocil_layer_cache_hits_total counter
+ocil_layer_cache_hits_total{cache="layers"} 0
+# HELP ocil_layer_cache_misses_total Lookups of layers the cache didn't have.
+# TYPE ocil_layer_cache_misses_total counter
+ocil_layer_cache_misses_total{cache="layers"} 1
+`
+	collector := metrics.NewCollector(c, prometheus.Labels{"cache": "layers"})
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want),
+		"ocil_layer_cache_hits_total", "ocil_layer_cache_misses_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+// plainCache is a layer.Cache that counts nothing
+type plainCache struct{}
+
+func (plainCache) Put(l v1.Layer) (v1.Layer, error) { return l, nil }
+
+func (plainCache) Get(v1.Hash) (v1.Layer, error) { return nil, layer.ErrLayerNotFound }
+
+func TestNewCollector_WithoutStats(t *testing.T) {
+	collector := metrics.NewCollector(plainCache{}, nil)
+	if n := testutil.CollectAndCount(collector); n != 0 {
+		t.Errorf("collected %d metrics of a cache without stats, want none", n)
+	}
+}
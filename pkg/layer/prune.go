@@ -0,0 +1,86 @@
+package layer
+
+import (
+	"sort"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Policy bounds what a cache keeps, it is enforced by Prune
+type Policy struct {
+	// MaxSize is the total size entries are evicted down to, least recently used first, unbounded when 0
+	MaxSize int64
+
+	// MaxAge evicts entries that haven't been used for longer, unbounded when 0
+	MaxAge time.Duration
+}
+
+type CacheOption func(*Policy)
+
+func WithMaxSize(size int64) CacheOption {
+	return func(p *Policy) {
+		p.MaxSize = size
+	}
+}
+
+func WithMaxAge(age time.Duration) CacheOption {
+	return func(p *Policy) {
+		p.MaxAge = age
+	}
+}
+
+func makePolicy(opts ...CacheOption) Policy {
+	var p Policy
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return p
+}
+
+// Entry is a single cached layer
+type Entry struct {
+	Digest   v1.Hash
+	Size     int64
+	LastUsed time.Time
+}
+
+// PruneReport is what Prune evicted
+type PruneReport struct {
+	Evicted []Entry
+
+	// Reclaimed is the total size of the evicted entries
+	Reclaimed int64
+}
+
+func (r *PruneReport) add(e Entry) {
+	r.Evicted = append(r.Evicted, e)
+	r.Reclaimed += e.Size
+}
+
+// evictions returns the entries p evicts as of now: every entry older than MaxAge, then the least recently used of the
+// rest until they fit in MaxSize
+func (p Policy) evictions(entries []Entry, now time.Time) []Entry {
+	sorted := make([]Entry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].LastUsed.After(sorted[j].LastUsed)
+	})
+
+	var evict []Entry
+	var size int64
+	var full bool
+	for _, e := range sorted {
+		if p.MaxAge > 0 && now.Sub(e.LastUsed) > p.MaxAge {
+			evict = append(evict, e)
+			continue
+		}
+		// once an entry doesn't fit, neither does anything used less recently
+		if full = full || p.MaxSize > 0 && size+e.Size > p.MaxSize; full {
+			evict = append(evict, e)
+			continue
+		}
+		size += e.Size
+	}
+	return evict
+}
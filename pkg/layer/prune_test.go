@@ -0,0 +1,106 @@
+package layer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/rancherfederal/ocil/pkg/layer"
+)
+
+func TestCache_Prune(t *testing.T) {
+	now := time.Now()
+
+	// entries of 10 bytes each, last used the given number of hours ago
+	used := map[string]int{"a": 1, "b": 2, "c": 3, "d": 48}
+
+	tests := []struct {
+		name string
+		opts []layer.CacheOption
+		want []string
+	}{
+		{
+			name: "should keep everything without a policy",
+		},
+		{
+			name: "should evict entries unused for longer than the max age",
+			opts: []layer.CacheOption{layer.WithMaxAge(24 * time.Hour)},
+			want: []string{"d"},
+		},
+		{
+			name: "should evict the least recently used entries down to the max size",
+			opts: []layer.CacheOption{layer.WithMaxSize(25)},
+			want: []string{"c", "d"},
+		},
+		{
+			name: "should apply both limits",
+			opts: []layer.CacheOption{layer.WithMaxAge(150 * time.Minute), layer.WithMaxSize(15)},
+			want: []string{"b", "c", "d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			digests := make(map[v1.Hash]string)
+			for name, hours := range used {
+				h := v1.Hash{Algorithm: "sha256", Hex: fakeHex(name)}
+				digests[h] = name
+
+				p := filepath.Join(root, h.Algorithm, h.Hex)
+				if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte("0123456789"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				at := now.Add(-time.Duration(hours) * time.Hour)
+				if err := os.Chtimes(p, at, at); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// anything not named for a digest is left alone
+			if err := os.WriteFile(filepath.Join(root, "sha256", "unrelated"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := layer.NewFilesystemCache(root, tt.opts...).(layer.Pruner).Prune(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, e := range report.Evicted {
+				got = append(got, digests[e.Digest])
+				if _, err := os.Stat(filepath.Join(root, e.Digest.Algorithm, e.Digest.Hex)); !os.IsNotExist(err) {
+					t.Errorf("evicted %s still exists", digests[e.Digest])
+				}
+			}
+			sort.Strings(got)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Prune() evicted %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Prune() evicted %v, want %v", got, tt.want)
+				}
+			}
+			if want := int64(10 * len(tt.want)); report.Reclaimed != want {
+				t.Errorf("Reclaimed = %d, want %d", report.Reclaimed, want)
+			}
+			if _, err := os.Stat(filepath.Join(root, "sha256", "unrelated")); err != nil {
+				t.Errorf("unrelated file was pruned: %v", err)
+			}
+		})
+	}
+}
+
+// fakeHex is a valid sha256 hex made of name
+func fakeHex(name string) string {
+	return strings.Repeat("0", 64-len(name)) + name
+}
@@ -0,0 +1,155 @@
+package layer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+type registry struct {
+	repo gname.Repository
+	opts []remote.Option
+}
+
+// NewRegistryCache caches layers as blobs of the repository repo (ie: registry.example.com/cache), so repeated runs
+// anywhere with access to it skip fetching layers from their source again
+// 	Cached layers are found with a HEAD of the blob and streamed back from the registry.  Layers that aren't cached yet
+// 	are uploaded as they're read through, never buffered, and a failed upload only fails the read once its content has
+// 	been read in full.
+func NewRegistryCache(repo string, opts ...remote.Option) (Cache, error) {
+	r, err := gname.NewRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+	return instrument(&registry{repo: r, opts: opts}), nil
+}
+
+func (r *registry) Get(h v1.Hash) (v1.Layer, error) {
+	l, err := remote.Layer(r.repo.Digest(h.String()), r.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// a HEAD of the blob, which is all it takes to know whether it's there
+	if _, err := l.Size(); err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return nil, ErrLayerNotFound
+		}
+		return nil, err
+	}
+	return l, nil
+}
+
+func (r *registry) Put(l v1.Layer) (v1.Layer, error) {
+	return &uploadingLayer{Layer: l, r: r}, nil
+}
+
+// Prune evicts nothing, the registry API has no way to list blobs and registries garbage collect their own
+func (r *registry) Prune(ctx context.Context) (*PruneReport, error) {
+	return &PruneReport{}, nil
+}
+
+// uploadingLayer uploads its content to the cache registry as it is read
+type uploadingLayer struct {
+	v1.Layer
+	r *registry
+}
+
+func (l *uploadingLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	return l.r.upload(l.Layer, rc)
+}
+
+// upload returns a reader of rc that streams everything read from it to the cache registry as the blob of l
+func (r *registry) upload(l v1.Layer, rc io.ReadCloser) (io.ReadCloser, error) {
+	d, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+	size, err := l.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	blob, err := partial.CompressedToLayer(&pipeLayer{rc: pr, digest: d, size: size})
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := remote.WriteLayer(r.repo, blob, r.opts...)
+		// unblock the reader if the upload gave up early, ie: because the blob turned out to exist already
+		pr.CloseWithError(errUploadDone)
+		done <- err
+	}()
+
+	return &uploadReader{rc: rc, pw: pw, done: done}, nil
+}
+
+var errUploadDone = errors.New("upload finished")
+
+// uploadReader tees reads of rc into the upload, which it waits for on close
+type uploadReader struct {
+	rc   io.ReadCloser
+	pw   *io.PipeWriter
+	done chan error
+
+	eof       bool
+	abandoned bool
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.rc.Read(p)
+	if n > 0 && !u.abandoned {
+		if _, werr := u.pw.Write(p[:n]); werr != nil {
+			// the upload is done with content, one way or another, the read itself is still good
+			u.abandoned = true
+		}
+	}
+	if err == io.EOF {
+		u.eof = true
+	}
+	return n, err
+}
+
+func (u *uploadReader) Close() error {
+	err := u.rc.Close()
+	if !u.eof {
+		// a partial read would upload a partial, and so invalid, blob
+		u.pw.CloseWithError(io.ErrUnexpectedEOF)
+		<-u.done
+		return err
+	}
+
+	u.pw.Close()
+	if uerr := <-u.done; uerr != nil && err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// pipeLayer is a partial.CompressedLayer of content that can only be read once
+type pipeLayer struct {
+	rc     io.ReadCloser
+	digest v1.Hash
+	size   int64
+}
+
+func (p *pipeLayer) Digest() (v1.Hash, error)            { return p.digest, nil }
+func (p *pipeLayer) Compressed() (io.ReadCloser, error)  { return p.rc, nil }
+func (p *pipeLayer) Size() (int64, error)                { return p.size, nil }
+func (p *pipeLayer) MediaType() (types.MediaType, error) { return types.DockerLayer, nil }
@@ -0,0 +1,78 @@
+package layer_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+
+	"github.com/rancherfederal/ocil/pkg/layer"
+)
+
+func TestRegistryCache(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+
+	c, err := layer.NewRegistryCache(strings.TrimPrefix(srv.URL, "http://") + "/cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("cached layer contents")
+	l := static.NewLayer(data, "")
+	d, err := l.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get(d); !errors.Is(err, layer.ErrLayerNotFound) {
+		t.Fatalf("Get() before Put() error = %v, want %v", err, layer.ErrLayerNotFound)
+	}
+
+	// a partial read must not leave anything behind in the cache
+	put, err := c.Put(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := put.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if _, err := c.Get(d); !errors.Is(err, layer.ErrLayerNotFound) {
+		t.Fatalf("Get() after a partial read error = %v, want %v", err, layer.ErrLayerNotFound)
+	}
+
+	rc, err = put.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("read through Put() = %q, %v, want %q", got, err, data)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := c.Get(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err = cached.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Get() = %q, %v, want %q", got, err, data)
+	}
+}
@@ -0,0 +1,126 @@
+package layer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/rancherfederal/ocil/pkg/s3"
+)
+
+type s3cache struct {
+	client *s3.Client
+	bucket string
+	prefix string
+	policy Policy
+}
+
+// NewS3Cache caches layers as objects of bucket, keyed <prefix>/<algorithm>/<hex>
+// 	Like the registry cache, cached layers are found with a HEAD of the object and streamed back, and layers that
+// 	aren't cached yet are uploaded as they're read through.  A partial read aborts the upload rather than caching a
+// 	partial layer.  Objects keep no record of being read, so Prune ages and orders entries by when they were cached.
+func NewS3Cache(client *s3.Client, bucket, prefix string, opts ...CacheOption) Cache {
+	return instrument(&s3cache{client: client, bucket: bucket, prefix: prefix, policy: makePolicy(opts...)})
+}
+
+func (c *s3cache) key(h v1.Hash) string {
+	return path.Join(c.prefix, h.Algorithm, h.Hex)
+}
+
+func (c *s3cache) Get(h v1.Hash) (v1.Layer, error) {
+	size, err := c.client.Head(context.Background(), c.bucket, c.key(h))
+	if errors.Is(err, s3.ErrNotFound) {
+		return nil, ErrLayerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return partial.CompressedToLayer(&s3Layer{c: c, digest: h, size: size})
+}
+
+func (c *s3cache) Put(l v1.Layer) (v1.Layer, error) {
+	return &s3UploadingLayer{Layer: l, c: c}, nil
+}
+
+func (c *s3cache) Prune(ctx context.Context) (*PruneReport, error) {
+	var prefix string
+	if c.prefix != "" {
+		prefix = strings.TrimSuffix(c.prefix, "/") + "/"
+	}
+
+	objects, err := c.client.List(ctx, c.bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var es []Entry
+	for _, o := range objects {
+		h, err := v1.NewHash(strings.Replace(strings.TrimPrefix(o.Key, prefix), "/", ":", 1))
+		if err != nil {
+			continue
+		}
+		es = append(es, Entry{Digest: h, Size: o.Size, LastUsed: o.LastModified})
+	}
+
+	report := &PruneReport{}
+	for _, e := range c.policy.evictions(es, time.Now()) {
+		if err := c.client.Delete(ctx, c.bucket, c.key(e.Digest)); err != nil {
+			return report, err
+		}
+		report.add(e)
+	}
+	return report, nil
+}
+
+// s3Layer is a partial.CompressedLayer of a cached object
+type s3Layer struct {
+	c      *s3cache
+	digest v1.Hash
+	size   int64
+}
+
+func (l *s3Layer) Digest() (v1.Hash, error) { return l.digest, nil }
+func (l *s3Layer) Size() (int64, error)     { return l.size, nil }
+func (l *s3Layer) Compressed() (io.ReadCloser, error) {
+	return l.c.client.Get(context.Background(), l.c.bucket, l.c.key(l.digest))
+}
+func (l *s3Layer) MediaType() (types.MediaType, error) { return types.DockerLayer, nil }
+
+// s3UploadingLayer uploads its content to the cache bucket as it is read
+type s3UploadingLayer struct {
+	v1.Layer
+	c *s3cache
+}
+
+func (l *s3UploadingLayer) Compressed() (io.ReadCloser, error) {
+	d, err := l.Layer.Digest()
+	if err != nil {
+		return nil, err
+	}
+	size, err := l.Layer.Size()
+	if err != nil {
+		return nil, err
+	}
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := l.c.client.Put(context.Background(), l.c.bucket, l.c.key(d), pr, size)
+		pr.CloseWithError(errUploadDone)
+		done <- err
+	}()
+
+	return &uploadReader{rc: rc, pw: pw, done: done}, nil
+}
@@ -0,0 +1,223 @@
+package layer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+
+	"github.com/rancherfederal/ocil/pkg/layer"
+	"github.com/rancherfederal/ocil/pkg/s3"
+)
+
+// fakeS3 is just enough of an s3 compatible store to get, head, put, list and delete objects
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	modified map[string]time.Time
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), modified: make(map[string]time.Time)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(data)) != r.ContentLength {
+			http.Error(w, "incomplete body", http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = data
+		f.modified[r.URL.Path] = time.Now()
+
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodGet:
+		if r.URL.Query().Get("list-type") != "2" {
+			f.serve(w, r)
+			return
+		}
+
+		bucket := r.URL.Path
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, bucket+r.URL.Query().Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		fmt.Fprint(w, "<ListBucketResult>")
+		for _, k := range keys {
+			fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>%s</LastModified></Contents>",
+				strings.TrimPrefix(k, bucket), len(f.objects[k]), f.modified[k].UTC().Format(time.RFC3339))
+		}
+		fmt.Fprint(w, "</ListBucketResult>")
+
+	case http.MethodHead:
+		f.serve(w, r)
+	}
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	data, ok := f.objects[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+func TestS3Cache(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	c := layer.NewS3Cache(&s3.Client{Endpoint: srv.URL, Region: "us-east-1"}, "bucket", "layers")
+
+	data := []byte("cached layer contents")
+	l := static.NewLayer(data, "")
+	d, err := l.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get(d); !errors.Is(err, layer.ErrLayerNotFound) {
+		t.Fatalf("Get() before Put() error = %v, want %v", err, layer.ErrLayerNotFound)
+	}
+
+	// a partial read must not leave anything behind in the cache
+	put, err := c.Put(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := put.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if _, err := c.Get(d); !errors.Is(err, layer.ErrLayerNotFound) {
+		t.Fatalf("Get() after a partial read error = %v, want %v", err, layer.ErrLayerNotFound)
+	}
+
+	rc, err = put.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("read through Put() = %q, %v, want %q", got, err, data)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fake.objects["/bucket/layers/sha256/"+d.Hex]; !ok {
+		t.Errorf("objects = %v, want layers/sha256/%s", fake.objects, d.Hex)
+	}
+
+	cached, err := c.Get(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, err := cached.Size(); err != nil || size != int64(len(data)) {
+		t.Errorf("Size() = %d, %v, want %d", size, err, len(data))
+	}
+	rc, err = cached.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Get() = %q, %v, want %q", got, err, data)
+	}
+}
+
+func TestS3Cache_Prune(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	client := &s3.Client{Endpoint: srv.URL, Region: "us-east-1"}
+	c := layer.NewS3Cache(client, "bucket", "layers", layer.WithMaxAge(time.Hour))
+
+	fresh, stale := static.NewLayer([]byte("fresh"), ""), static.NewLayer([]byte("stale"), "")
+	for _, l := range []v1.Layer{fresh, stale} {
+		put, err := c.Put(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := put.Compressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(rc)
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// neither an object outside the prefix nor one not named for a digest is the cache's to prune
+	for _, key := range []string{"/bucket/other/old", "/bucket/layers/unrelated"} {
+		fake.objects[key] = nil
+	}
+
+	staleDigest, err := stale.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range fake.modified {
+		fake.modified[k] = time.Now().Add(-2 * time.Hour)
+	}
+	fake.modified["/bucket/layers/sha256/"+mustDigest(t, fresh).Hex] = time.Now()
+
+	report, err := c.(layer.Pruner).Prune(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Evicted) != 1 || report.Evicted[0].Digest != staleDigest {
+		t.Fatalf("Prune() evicted %v, want %s", report.Evicted, staleDigest)
+	}
+	if report.Reclaimed != int64(len("stale")) {
+		t.Errorf("Reclaimed = %d, want %d", report.Reclaimed, len("stale"))
+	}
+	if _, err := c.Get(staleDigest); !errors.Is(err, layer.ErrLayerNotFound) {
+		t.Errorf("Get() of a pruned layer error = %v, want %v", err, layer.ErrLayerNotFound)
+	}
+	if _, err := c.Get(mustDigest(t, fresh)); err != nil {
+		t.Errorf("Get() of a fresh layer error = %v", err)
+	}
+	if len(fake.objects) != 3 {
+		t.Errorf("objects = %v, want the fresh layer and both unrelated objects", fake.objects)
+	}
+}
+
+func mustDigest(t *testing.T, l v1.Layer) v1.Hash {
+	t.Helper()
+	d, err := l.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
@@ -0,0 +1,166 @@
+package layer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+type shared struct {
+	root   string
+	policy Policy
+}
+
+// NewSharedCache caches layers in root like NewFilesystemCache, but is safe to share between any number of processes
+// and hosts, ie: over nfs
+// 	Layers are written to a temporary file, verified against their digest and only then renamed into place, so a
+// 	partial or corrupt layer is never served.  A lock file per layer makes concurrent misses of the same layer wait on
+// 	whichever got there first rather than fetching it again.  Lock files outlive the layers they guard, it's unsafe
+// 	to remove a lock another process may be waiting on.
+func NewSharedCache(root string, opts ...CacheOption) Cache {
+	return instrument(&shared{root: root, policy: makePolicy(opts...)})
+}
+
+func (s *shared) Put(l v1.Layer) (v1.Layer, error) {
+	digest, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return &sharedLayer{Layer: l, path: layerpath(s.root, digest), digest: digest}, nil
+}
+
+func (s *shared) Get(h v1.Hash) (v1.Layer, error) {
+	l, err := FromOpener(func() (io.ReadCloser, error) {
+		return os.Open(layerpath(s.root, h))
+	})
+	if os.IsNotExist(err) {
+		return nil, ErrLayerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	touch(layerpath(s.root, h))
+	return l, nil
+}
+
+// Prune is safe alongside other processes using the cache, readers of a layer keep what they've already opened
+func (s *shared) Prune(ctx context.Context) (*PruneReport, error) {
+	return prunePath(ctx, s.root, s.policy)
+}
+
+// sharedLayer writes its content to the shared cache as it is read
+type sharedLayer struct {
+	v1.Layer
+
+	path   string
+	digest v1.Hash
+}
+
+func (l *sharedLayer) Compressed() (io.ReadCloser, error) {
+	if err := os.MkdirAll(filepath.Dir(l.path), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	lock, err := os.OpenFile(l.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("lock %s: %w", lock.Name(), err)
+	}
+	release := func() error {
+		defer lock.Close()
+		return unlockFile(lock)
+	}
+
+	// someone else may have cached it while we were waiting on the lock
+	if f, err := os.Open(l.path); err == nil {
+		release()
+		return f, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), l.digest.Hex+".*.tmp")
+	if err != nil {
+		release()
+		return nil, err
+	}
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		release()
+		return nil, err
+	}
+
+	return &sharedWriter{
+		rc:      rc,
+		tmp:     tmp,
+		h:       sha256.New(),
+		path:    l.path,
+		digest:  l.digest,
+		release: release,
+	}, nil
+}
+
+// sharedWriter tees reads of rc into tmp, which is renamed into place on close once it's been read in full and found
+// to match its digest
+type sharedWriter struct {
+	rc      io.ReadCloser
+	tmp     *os.File
+	h       hash.Hash
+	path    string
+	digest  v1.Hash
+	release func() error
+
+	eof  bool
+	werr error
+}
+
+func (w *sharedWriter) Read(p []byte) (int, error) {
+	n, err := w.rc.Read(p)
+	if n > 0 && w.werr == nil {
+		if _, werr := io.MultiWriter(w.tmp, w.h).Write(p[:n]); werr != nil {
+			// failing to cache doesn't fail the read
+			w.werr = werr
+		}
+	}
+	if err == io.EOF {
+		w.eof = true
+	}
+	return n, err
+}
+
+func (w *sharedWriter) Close() error {
+	defer w.release()
+
+	err := w.rc.Close()
+	if cerr := w.tmp.Close(); w.werr == nil {
+		w.werr = cerr
+	}
+
+	if !w.eof || w.werr != nil || w.digest.Algorithm != "sha256" {
+		os.Remove(w.tmp.Name())
+		return err
+	}
+
+	if got := hex.EncodeToString(w.h.Sum(nil)); got != w.digest.Hex {
+		os.Remove(w.tmp.Name())
+		if err == nil {
+			err = fmt.Errorf("layer content sha256:%s doesn't match its digest %s", got, w.digest)
+		}
+		return err
+	}
+
+	if rerr := os.Rename(w.tmp.Name(), w.path); rerr != nil {
+		os.Remove(w.tmp.Name())
+	}
+	return err
+}
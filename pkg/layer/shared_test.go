@@ -0,0 +1,140 @@
+package layer_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+
+	"github.com/rancherfederal/ocil/pkg/layer"
+)
+
+// countingLayer counts how many times its content is read
+type countingLayer struct {
+	v1.Layer
+	reads *int32
+}
+
+func (l *countingLayer) Compressed() (io.ReadCloser, error) {
+	atomic.AddInt32(l.reads, 1)
+	return l.Layer.Compressed()
+}
+
+func TestSharedCache(t *testing.T) {
+	root := t.TempDir()
+	c := layer.NewSharedCache(root)
+
+	data := []byte("cached layer contents")
+	var reads int32
+	l := &countingLayer{Layer: static.NewLayer(data, ""), reads: &reads}
+	d, err := l.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get(d); !errors.Is(err, layer.ErrLayerNotFound) {
+		t.Fatalf("Get() before Put() error = %v, want %v", err, layer.ErrLayerNotFound)
+	}
+
+	// a partial read must not leave anything behind in the cache
+	put, err := c.Put(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := put.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if _, err := c.Get(d); !errors.Is(err, layer.ErrLayerNotFound) {
+		t.Fatalf("Get() after a partial read error = %v, want %v", err, layer.ErrLayerNotFound)
+	}
+	atomic.StoreInt32(&reads, 0)
+
+	// concurrent misses for the same layer, as if from several hosts, fetch it once
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rc, err := put.Compressed()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer rc.Close()
+			if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("read through Put() = %q, %v, want %q", got, err, data)
+			}
+		}()
+	}
+	wg.Wait()
+	if reads != 1 {
+		t.Errorf("layer read %d times, want once", reads)
+	}
+
+	cached, err := c.Get(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cached.Digest(); err != nil || got != d {
+		t.Errorf("Digest() = %s, %v, want %s", got, err, d)
+	}
+
+	// nothing but the layer and its lock file is left behind
+	entries, err := os.ReadDir(filepath.Join(root, d.Algorithm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if len(names) != 2 || names[0] != d.Hex || names[1] != d.Hex+".lock" {
+		t.Errorf("cache contains %v, want the layer and its lock", names)
+	}
+}
+
+func TestSharedCache_Corrupt(t *testing.T) {
+	c := layer.NewSharedCache(t.TempDir())
+
+	good := static.NewLayer([]byte("good"), "")
+	d, err := good.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put, err := c.Put(&digestLayer{Layer: static.NewLayer([]byte("corrupt"), ""), digest: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := put.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(rc)
+	if err := rc.Close(); err == nil {
+		t.Error("Close() of content that doesn't match its digest succeeded")
+	}
+	if _, err := c.Get(d); !errors.Is(err, layer.ErrLayerNotFound) {
+		t.Errorf("Get() of a corrupt layer error = %v, want %v", err, layer.ErrLayerNotFound)
+	}
+}
+
+// digestLayer claims a digest its content doesn't have
+type digestLayer struct {
+	v1.Layer
+	digest v1.Hash
+}
+
+func (l *digestLayer) Digest() (v1.Hash, error) { return l.digest, nil }
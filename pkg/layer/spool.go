@@ -0,0 +1,86 @@
+package layer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"runtime"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// FromReader reads rc exactly once, teeing it into the digest computation and a temporary spool file that every
+// later read of the layer is served from
+// 	This keeps memory flat for content of any size that can only be read once (ie: a http response), without fetching
+// 	it again for every read.  The spool file is unlinked as soon as it's created where the platform allows it, and is
+// 	otherwise removed once the layer is garbage collected.
+func FromReader(rc io.ReadCloser, opts ...Option) (v1.Layer, error) {
+	defer rc.Close()
+
+	f, err := os.CreateTemp("", "ocil-layer-")
+	if err != nil {
+		return nil, err
+	}
+	s := &spool{f: f}
+	if err := os.Remove(f.Name()); err != nil {
+		// windows won't remove open files
+		s.path = f.Name()
+	}
+	runtime.SetFinalizer(s, (*spool).close)
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), rc)
+	if err != nil {
+		runtime.SetFinalizer(s, nil)
+		s.close()
+		return nil, err
+	}
+	s.size = n
+
+	digest := v1.Hash{Algorithm: "sha256", Hex: hex.EncodeToString(h.Sum(nil))}
+	opener := func() (io.ReadCloser, error) {
+		return &spoolReader{SectionReader: io.NewSectionReader(s.f, 0, s.size), spool: s}, nil
+	}
+
+	layer := &layer{
+		mediaType:          consts.UnknownLayer,
+		annotations:        make(map[string]string, 1),
+		digest:             digest,
+		diffID:             digest,
+		size:               n,
+		compressedOpener:   opener,
+		uncompressedOpener: opener,
+	}
+	for _, opt := range opts {
+		opt(layer)
+	}
+	return layer, nil
+}
+
+type spool struct {
+	f    *os.File
+	path string
+	size int64
+}
+
+func (s *spool) close() error {
+	err := s.f.Close()
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+	return err
+}
+
+// spoolReader keeps the spool alive for as long as it's being read from, closing it is left to the spool's finalizer
+// since the layer can be read again
+type spoolReader struct {
+	*io.SectionReader
+	spool *spool
+}
+
+func (r *spoolReader) Close() error {
+	return nil
+}
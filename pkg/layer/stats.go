@@ -0,0 +1,115 @@
+package layer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Stats are the counters of a cache since it was created
+type Stats struct {
+	Hits   int64
+	Misses int64
+
+	// ServedBytes were read from the cache, FetchedBytes from the source of layers it missed
+	ServedBytes  int64
+	FetchedBytes int64
+}
+
+// HitRatio is the share of lookups the cache had the layer for, 0 before any lookups
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// backend is everything a cache implements but its stats, which are counted the same for all of them
+type backend interface {
+	Put(v1.Layer) (v1.Layer, error)
+	Get(v1.Hash) (v1.Layer, error)
+	Prune(context.Context) (*PruneReport, error)
+}
+
+// instrumented counts the lookups of a backend and the bytes read through the layers it returns
+type instrumented struct {
+	// accessed atomically, and first to keep them 64 bit aligned
+	hits, misses, served, fetched int64
+
+	backend
+}
+
+// interface guards
+var (
+	_ Pruner        = (*instrumented)(nil)
+	_ StatsReporter = (*instrumented)(nil)
+)
+
+func instrument(b backend) Cache {
+	return &instrumented{backend: b}
+}
+
+func (i *instrumented) Get(h v1.Hash) (v1.Layer, error) {
+	l, err := i.backend.Get(h)
+	if errors.Is(err, ErrLayerNotFound) {
+		atomic.AddInt64(&i.misses, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&i.hits, 1)
+	return &countedLayer{Layer: l, n: &i.served}, nil
+}
+
+func (i *instrumented) Put(l v1.Layer) (v1.Layer, error) {
+	pl, err := i.backend.Put(l)
+	if err != nil {
+		return nil, err
+	}
+	return &countedLayer{Layer: pl, n: &i.fetched}, nil
+}
+
+func (i *instrumented) Stats() Stats {
+	return Stats{
+		Hits:         atomic.LoadInt64(&i.hits),
+		Misses:       atomic.LoadInt64(&i.misses),
+		ServedBytes:  atomic.LoadInt64(&i.served),
+		FetchedBytes: atomic.LoadInt64(&i.fetched),
+	}
+}
+
+// countedLayer adds everything read from it to n
+type countedLayer struct {
+	v1.Layer
+	n *int64
+}
+
+func (l *countedLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	return &countingReader{ReadCloser: rc, n: l.n}, nil
+}
+
+func (l *countedLayer) Uncompressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	return &countingReader{ReadCloser: rc, n: l.n}, nil
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
@@ -0,0 +1,63 @@
+package layer_test
+
+import (
+	"io"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+
+	"github.com/rancherfederal/ocil/pkg/layer"
+)
+
+func TestCache_Stats(t *testing.T) {
+	c := layer.NewFilesystemCache(t.TempDir())
+
+	data := []byte("cached layer contents")
+	l := static.NewLayer(data, "")
+	d, err := l.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a miss, fetched through the cache
+	if _, err := c.Get(d); err != layer.ErrLayerNotFound {
+		t.Fatalf("Get() error = %v, want %v", err, layer.ErrLayerNotFound)
+	}
+	put, err := c.Put(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(t, put)
+
+	// then two hits, only one of which is read
+	for i := 0; i < 2; i++ {
+		cached, err := c.Get(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			readAll(t, cached)
+		}
+	}
+
+	want := layer.Stats{Hits: 2, Misses: 1, ServedBytes: int64(len(data)), FetchedBytes: int64(len(data))}
+	if got := c.(layer.StatsReporter).Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if got, want := c.(layer.StatsReporter).Stats().HitRatio(), 2.0/3; got != want {
+		t.Errorf("HitRatio() = %v, want %v", got, want)
+	}
+}
+
+func readAll(t *testing.T, l v1.Layer) {
+	t.Helper()
+	rc, err := l.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,211 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// containerCredentialsHost serves the credentials of ECS tasks (and EKS pod identities) at a relative uri
+	containerCredentialsHost = "http://169.254.170.2"
+
+	// instanceMetadataEndpoint is the instance metadata service of EC2 instances
+	instanceMetadataEndpoint = "http://169.254.169.254"
+
+	// instanceMetadataTimeout bounds the calls to the instance metadata service, which nothing answers off of EC2
+	instanceMetadataTimeout = time.Second
+)
+
+// credentialsClient fetches credentials from the providers answering over http
+var credentialsClient = &http.Client{Timeout: 10 * time.Second}
+
+// webIdentityCredentials exchanges the token of AWS_WEB_IDENTITY_TOKEN_FILE for credentials of the role AWS_ROLE_ARN,
+// as EKS service accounts (IRSA) are set up to
+func webIdentityCredentials(ctx context.Context) (*Credentials, error) {
+	file, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+	if file == "" || role == "" {
+		return nil, nil
+	}
+	token, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("web identity token: %w", err)
+	}
+
+	session := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = fmt.Sprintf("ocil-%d", time.Now().UnixNano())
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_STS")
+	if endpoint == "" {
+		endpoint = "https://sts.amazonaws.com"
+		if region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"); region != "" {
+			endpoint = fmt.Sprintf("https://sts.%s.amazonaws.com", region)
+		}
+	}
+
+	query := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", strings.NewReader(query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := fetchCredentials(req, credentialsClient)
+	if err != nil {
+		return nil, fmt.Errorf("assume role %s with web identity: %w", role, err)
+	}
+	defer body.Close()
+
+	var resp struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("assume role %s with web identity: %w", role, err)
+	}
+	c := resp.Credentials
+	return &Credentials{AccessKeyID: c.AccessKeyId, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken}, nil
+}
+
+// containerCredentials fetches the credentials of the ECS task (or EKS pod identity) the process runs as, from
+// AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or AWS_CONTAINER_CREDENTIALS_FULL_URI
+func containerCredentials(ctx context.Context) (*Credentials, error) {
+	u := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+		u = containerCredentialsHost + rel
+	}
+	if u == "" {
+		return nil, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if file := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("container authorization token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	body, err := fetchCredentials(req, credentialsClient)
+	if err != nil {
+		return nil, fmt.Errorf("container credentials: %w", err)
+	}
+	defer body.Close()
+	return decodeCredentials(body)
+}
+
+// instanceCredentials fetches the credentials of the role of the EC2 instance through its metadata service (IMDSv2),
+// unless AWS_EC2_METADATA_DISABLED is true
+// 	Nil is returned off of EC2, or on instances without a role.
+func instanceCredentials(ctx context.Context) (*Credentials, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return nil, nil
+	}
+	endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if endpoint == "" {
+		endpoint = instanceMetadataEndpoint
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	client := &http.Client{Timeout: instanceMetadataTimeout}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	body, err := fetchCredentials(req, client)
+	if err != nil {
+		// nothing answering is no instance at all
+		return nil, nil
+	}
+	token, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, nil
+	}
+
+	get := func(path string) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/latest/meta-data/iam/security-credentials/"+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		return fetchCredentials(req, client)
+	}
+
+	body, err = get("")
+	if err != nil {
+		// an instance without a role
+		return nil, nil
+	}
+	roles, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return nil, nil
+	}
+
+	body, err = get(role)
+	if err != nil {
+		return nil, fmt.Errorf("instance credentials of role %s: %w", role, err)
+	}
+	defer body.Close()
+	return decodeCredentials(body)
+}
+
+// decodeCredentials decodes the json credentials the container and instance metadata services answer with
+func decodeCredentials(r io.Reader) (*Credentials, error) {
+	var c struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+	}
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, err
+	}
+	if c.AccessKeyId == "" || c.SecretAccessKey == "" {
+		return nil, fmt.Errorf("no access key in the credentials")
+	}
+	return &Credentials{AccessKeyID: c.AccessKeyId, SecretAccessKey: c.SecretAccessKey, SessionToken: c.Token}, nil
+}
+
+// fetchCredentials sends req with client, returning the body of successful responses
+func fetchCredentials(req *http.Request, client *http.Client) (io.ReadCloser, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL.Redacted(), resp.Status)
+	}
+	return resp.Body, nil
+}
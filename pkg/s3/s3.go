@@ -0,0 +1,375 @@
+package s3
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for objects that don't exist
+var ErrNotFound = errors.New("object not found")
+
+// Client is a minimal client for s3 compatible object storage, enough to get, head, put, list and delete objects
+type Client struct {
+	// Endpoint of an s3 compatible store addressed path style (ie: http://minio:9000), aws itself when empty
+	Endpoint string
+	Region   string
+
+	// Credentials signs requests, they're sent unsigned when nil
+	Credentials *Credentials
+	HTTP        *http.Client
+}
+
+// NewClient configures a client the way the aws cli is: AWS_REGION (or AWS_DEFAULT_REGION), AWS_ENDPOINT_URL and the
+// credentials found by DefaultCredentials
+func NewClient(ctx context.Context) (*Client, error) {
+	creds, err := DefaultCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &Client{
+		Endpoint:    os.Getenv("AWS_ENDPOINT_URL"),
+		Region:      region,
+		Credentials: creds,
+		HTTP:        http.DefaultClient,
+	}, nil
+}
+
+// Get returns the content of the object key in bucket
+func (c *Client) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, bucket, key, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Head returns the size of the object key in bucket
+func (c *Client) Head(ctx context.Context, bucket, key string) (int64, error) {
+	resp, err := c.do(ctx, http.MethodHead, bucket, key, nil, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// Put uploads the size bytes of r as the object key in bucket
+func (c *Client) Put(ctx context.Context, bucket, key string, r io.Reader, size int64) error {
+	resp, err := c.do(ctx, http.MethodPut, bucket, key, nil, r, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Delete removes the object key from bucket, it isn't an error if there's no such object
+func (c *Client) Delete(ctx context.Context, bucket, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, bucket, key, nil, nil, 0)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// List returns every object of bucket whose key starts with prefix
+func (c *Client) List(ctx context.Context, bucket, prefix string) ([]Object, error) {
+	var objects []Object
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := c.do(ctx, http.MethodGet, bucket, "", query, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Contents              []Object
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("list s3://%s/%s: %w", bucket, prefix, err)
+		}
+
+		objects = append(objects, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, bucket, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	var target string
+	if c.Endpoint != "" {
+		target = strings.TrimSuffix(c.Endpoint, "/") + "/" + Escape(bucket) + "/" + Escape(key)
+	} else {
+		target = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, c.Region, Escape(key))
+	}
+	if len(query) > 0 {
+		target += "?" + canonicalQuery(query)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if c.Credentials != nil {
+		c.Credentials.Sign(req, c.Region, time.Now().UTC())
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s s3://%s/%s: %w", method, bucket, key, ErrNotFound)
+	case resp.StatusCode == http.StatusForbidden && c.Credentials == nil:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s s3://%s/%s: %s: no aws credentials were found, the request was sent unsigned", method, bucket, key, resp.Status)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s s3://%s/%s: %s", method, bucket, key, resp.Status)
+	}
+	return resp, nil
+}
+
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// DefaultCredentials finds credentials through the chain of providers of the aws cli, but for sso and the assume role
+// settings of profiles: the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables,
+// the AWS_PROFILE (or default) profile of the shared credentials file, the web identity token of
+// AWS_WEB_IDENTITY_TOKEN_FILE for the role AWS_ROLE_ARN (ie: EKS service accounts), the ECS container credentials
+// service, then the role of the EC2 instance
+// 	Nil is returned when there are none.  The credentials of the last three are temporary, and aren't refreshed:
+// 	clients that outlive them have to be created again.
+func DefaultCredentials(ctx context.Context) (*Credentials, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return &Credentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			file = filepath.Join(home, ".aws", "credentials")
+		}
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	if file != "" {
+		creds, err := sharedCredentials(file, profile)
+		if creds != nil || err != nil {
+			return creds, err
+		}
+	}
+
+	for _, provider := range []func(context.Context) (*Credentials, error){webIdentityCredentials, containerCredentials, instanceCredentials} {
+		creds, err := provider(ctx)
+		if creds != nil || err != nil {
+			return creds, err
+		}
+	}
+	return nil, nil
+}
+
+// sharedCredentials reads profile from the ini formatted shared credentials file
+func sharedCredentials(file, profile string) (*Credentials, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var creds Credentials
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = v
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = v
+		case "aws_session_token":
+			creds.SessionToken = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", file, err)
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, nil
+	}
+	return &creds, nil
+}
+
+// Sign signs req with AWS signature version 4, leaving the payload unsigned so bodies can be streamed
+func (c *Credentials) Sign(req *http.Request, region string, now time.Time) {
+	const payload = "UNSIGNED-PAYLOAD"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payload)
+	if c.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", c.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// Escape percent encodes everything but the unreserved characters and slashes, as signature version 4 requires
+func Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) != -1 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// canonicalQuery encodes query sorted by key, with everything but the unreserved characters percent encoded
+func canonicalQuery(query url.Values) string {
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, k := range keys {
+		vs := query[k]
+		sort.Strings(vs)
+		for _, v := range vs {
+			params = append(params, escapeQuery(k)+"="+escapeQuery(v))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func escapeQuery(s string) string {
+	return strings.ReplaceAll(Escape(s), "/", "%2F")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
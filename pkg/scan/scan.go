@@ -0,0 +1,75 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Scanner scans an image for known vulnerabilities
+type Scanner interface {
+	Scan(ctx context.Context, img gv1.Image) (*Report, error)
+}
+
+// Severity of a vulnerability, ordered from the least to the most severe
+type Severity int
+
+const (
+	SeverityUnknown Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+func (s Severity) String() string {
+	if s < SeverityUnknown || s > SeverityCritical {
+		return severities[SeverityUnknown]
+	}
+	return severities[s]
+}
+
+// ParseSeverity parses the name of a Severity, case insensitively (ie: high, CRITICAL)
+func ParseSeverity(s string) (Severity, error) {
+	for i, name := range severities {
+		if strings.EqualFold(s, name) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityUnknown, fmt.Errorf("unknown severity %q", s)
+}
+
+// Vulnerability is a single finding of a scan
+type Vulnerability struct {
+	ID       string   `json:"id"`
+	Package  string   `json:"package"`
+	Version  string   `json:"version,omitempty"`
+	Severity Severity `json:"severity"`
+}
+
+// Report is what a Scanner found, along with its own report as it produced it
+type Report struct {
+	// Scanner is the name of the scanner that produced the report (ie: trivy)
+	Scanner string
+
+	// MediaType and Data are the scanners own report
+	MediaType string
+	Data      []byte
+
+	Vulnerabilities []Vulnerability
+}
+
+// AtLeast returns the vulnerabilities of the report that are at least as severe as s
+func (r *Report) AtLeast(s Severity) []Vulnerability {
+	var found []Vulnerability
+	for _, v := range r.Vulnerabilities {
+		if v.Severity >= s {
+			found = append(found, v)
+		}
+	}
+	return found
+}
@@ -0,0 +1,94 @@
+package scan_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/rancherfederal/ocil/pkg/scan"
+)
+
+func TestParseSeverity(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    scan.Severity
+		wantErr bool
+	}{
+		{name: "should parse upper case", s: "CRITICAL", want: scan.SeverityCritical},
+		{name: "should parse lower case", s: "medium", want: scan.SeverityMedium},
+		{name: "should parse unknown", s: "unknown", want: scan.SeverityUnknown},
+		{name: "should reject anything else", s: "urgent", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scan.ParseSeverity(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSeverity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSeverity() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport_AtLeast(t *testing.T) {
+	r := &scan.Report{Vulnerabilities: []scan.Vulnerability{
+		{ID: "CVE-1", Severity: scan.SeverityLow},
+		{ID: "CVE-2", Severity: scan.SeverityHigh},
+		{ID: "CVE-3", Severity: scan.SeverityCritical},
+	}}
+	for sev, want := range map[scan.Severity]int{
+		scan.SeverityUnknown:  3,
+		scan.SeverityMedium:   2,
+		scan.SeverityCritical: 1,
+	} {
+		if got := r.AtLeast(sev); len(got) != want {
+			t.Errorf("AtLeast(%s) = %v, want %d vulnerabilities", sev, got, want)
+		}
+	}
+}
+
+func TestTrivy_Scan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake trivy is a shell script")
+	}
+
+	report := `{"Results": [{"Vulnerabilities": [{"VulnerabilityID": "CVE-2022-0001", "PkgName": "openssl", "InstalledVersion": "1.1.1", "Severity": "HIGH"}]}]}`
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "trivy")
+	script := "#!/bin/sh\n" +
+		// the image must have been written where the input flag says
+		"while [ $# -gt 0 ]; do [ \"$1\" = --input ] && [ -s \"$2\" ] && found=1; shift; done\n" +
+		"[ -n \"$found\" ] || { echo no input >&2; exit 1; }\n" +
+		"echo '" + report + "'\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := scan.NewTrivy(scan.WithTrivyPath(bin)).Scan(context.Background(), img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.MediaType != scan.TrivyReportMediaType || len(r.Data) == 0 {
+		t.Errorf("Scan() report = %s (%d bytes), want a trivy report", r.MediaType, len(r.Data))
+	}
+	want := scan.Vulnerability{ID: "CVE-2022-0001", Package: "openssl", Version: "1.1.1", Severity: scan.SeverityHigh}
+	if len(r.Vulnerabilities) != 1 || r.Vulnerabilities[0] != want {
+		t.Errorf("Scan() vulnerabilities = %+v, want [%+v]", r.Vulnerabilities, want)
+	}
+
+	if _, err := scan.NewTrivy(scan.WithTrivyPath(filepath.Join(dir, "missing"))).Scan(context.Background(), img); err == nil {
+		t.Error("Scan() with a missing trivy succeeded")
+	}
+}
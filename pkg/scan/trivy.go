@@ -0,0 +1,102 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// TrivyReportMediaType is the media type of trivy's json reports
+const TrivyReportMediaType = "application/vnd.aquasec.trivy.report.v1+json"
+
+// Trivy is a Scanner running the trivy cli against an image tarball
+type Trivy struct {
+	path string
+	args []string
+}
+
+type TrivyOption func(*Trivy)
+
+// WithTrivyPath runs the trivy binary at path, instead of the first trivy on PATH
+func WithTrivyPath(path string) TrivyOption {
+	return func(t *Trivy) {
+		t.path = path
+	}
+}
+
+// WithTrivyArgs passes args on to every trivy image invocation (ie: --offline-scan, --skip-db-update)
+func WithTrivyArgs(args ...string) TrivyOption {
+	return func(t *Trivy) {
+		t.args = append(t.args, args...)
+	}
+}
+
+func NewTrivy(opts ...TrivyOption) *Trivy {
+	t := &Trivy{path: "trivy"}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// trivyReport is the subset of trivy's json report needed to build a Report
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			Severity         string `json:"Severity"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+func (t *Trivy) Scan(ctx context.Context, img gv1.Image) (*Report, error) {
+	dir, err := os.MkdirTemp("", "ocil-trivy")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "image.tar")
+	if err := tarball.WriteToFile(input, name.MustParseReference("scan/image:latest"), img); err != nil {
+		return nil, fmt.Errorf("write image for trivy: %w", err)
+	}
+
+	args := append([]string{"image", "--quiet", "--format", "json", "--input", input}, t.args...)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("trivy: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var tr trivyReport
+	if err := json.Unmarshal(stdout.Bytes(), &tr); err != nil {
+		return nil, fmt.Errorf("decode trivy report: %w", err)
+	}
+
+	r := &Report{Scanner: "trivy", MediaType: TrivyReportMediaType, Data: stdout.Bytes()}
+	for _, result := range tr.Results {
+		for _, v := range result.Vulnerabilities {
+			// severities trivy doesn't know are as good as unknown
+			sev, _ := ParseSeverity(v.Severity)
+			r.Vulnerabilities = append(r.Vulnerabilities, Vulnerability{
+				ID:       v.VulnerabilityID,
+				Package:  v.PkgName,
+				Version:  v.InstalledVersion,
+				Severity: sev,
+			})
+		}
+	}
+	return r, nil
+}
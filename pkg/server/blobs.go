@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+// verifiedBlobs remembers the blobs read back in full and found to match their descriptor, for them to be served as
+// files: ranges (and full reads stopping at the size of the blob) never read far enough to be verified as they're served
+type verifiedBlobs struct {
+	m sync.Map
+}
+
+// verify reads rs, the content of desc, in full and checks it against desc unless that was done already, leaving rs at
+// its start
+func (v *verifiedBlobs) verify(rs io.ReadSeeker, desc ocispec.Descriptor) error {
+	if _, ok := v.m.Load(desc.Digest); ok {
+		return nil
+	}
+
+	digester := desc.Digest.Algorithm().Digester()
+	n, err := io.Copy(digester.Hash(), rs)
+	if err != nil {
+		return err
+	}
+	if desc.Size > 0 && n != desc.Size {
+		return fmt.Errorf("blob %s: read %d bytes, expected %d: %w", desc.Digest, n, desc.Size, store.ErrSizeMismatch)
+	}
+	if got := digester.Digest(); got != desc.Digest {
+		return fmt.Errorf("blob %s: read content of digest %s: %w", desc.Digest, got, store.ErrDigestMismatch)
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	v.m.Store(desc.Digest, true)
+	return nil
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+// BrowseHandler serves a human-readable listing of everything in a store's layout
+// It is intended for operators at disconnected sites who want to verify what they received with nothing but a browser
+type BrowseHandler struct {
+	layout *store.Layout
+}
+
+func NewBrowseHandler(l *store.Layout) *BrowseHandler {
+	return &BrowseHandler{layout: l}
+}
+
+type browseEntry struct {
+	Repository string
+	Tag        string
+	Kind       string
+	Digest     string
+	Size       int64
+}
+
+type browseRepository struct {
+	Name    string
+	Entries []browseEntry
+}
+
+func (h *BrowseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	repos, err := h.repositories(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := browseTemplate.Execute(w, repos); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *BrowseHandler) repositories(ctx context.Context) ([]browseRepository, error) {
+	byRepo := make(map[string][]browseEntry)
+	err := h.layout.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		repo, tag := splitReference(reference)
+		size, err := h.size(ctx, desc)
+		if err != nil {
+			return err
+		}
+
+		byRepo[repo] = append(byRepo[repo], browseEntry{
+			Repository: repo,
+			Tag:        tag,
+			Kind:       kind(h.layout.Identify(ctx, desc)),
+			Digest:     desc.Digest.String(),
+			Size:       size,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []browseRepository
+	for name, entries := range byRepo {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Tag < entries[j].Tag })
+		repos = append(repos, browseRepository{Name: name, Entries: entries})
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+	return repos, nil
+}
+
+// size is the total footprint of a manifest: the manifest itself, its config and its layers
+func (h *BrowseHandler) size(ctx context.Context, desc ocispec.Descriptor) (int64, error) {
+	rc, err := h.layout.Fetch(ctx, desc)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	var m ocispec.Manifest
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return 0, err
+	}
+
+	total := desc.Size + m.Config.Size
+	for _, l := range m.Layers {
+		total += l.Size
+	}
+	return total, nil
+}
+
+// splitReference breaks a reference into its repository and tag (or digest)
+func splitReference(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "@"); i != -1 {
+		return ref[:i], ref[i+1:]
+	}
+	if i := strings.LastIndex(ref, ":"); i != -1 && !strings.Contains(ref[i:], "/") {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, "latest"
+}
+
+// kind maps a config media type to a human-readable artifact kind
+func kind(configMediaType string) string {
+	switch configMediaType {
+	case consts.DockerConfigJSON, ocispec.MediaTypeImageConfig:
+		return "image"
+	case consts.ChartConfigMediaType:
+		return "chart"
+	case consts.FileLocalConfigMediaType, consts.FileDirectoryConfigMediaType, consts.FileHttpConfigMediaType,
+		consts.FileS3ConfigMediaType, consts.FileGCSConfigMediaType, consts.FileAzureConfigMediaType:
+		return "file"
+	case consts.MemoryConfigMediaType:
+		return "memory"
+	case consts.WasmConfigMediaType:
+		return "wasm"
+	case consts.SBOMConfigMediaType:
+		return "sbom"
+	}
+	return "unknown"
+}
+
+func humanSize(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+var browseTemplate = template.Must(template.New("browse").Funcs(template.FuncMap{
+	"humanSize": humanSize,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>ocil store</title></head>
+<body>
+<h1>Store contents</h1>
+{{- if not . }}
+<p>The store is empty.</p>
+{{- end }}
+{{- range . }}
+<h2>{{ .Name }}</h2>
+<table>
+<tr><th>Tag</th><th>Kind</th><th>Size</th><th>Digest</th></tr>
+{{- range .Entries }}
+<tr><td>{{ .Tag }}</td><td>{{ .Kind }}</td><td>{{ humanSize .Size }}</td><td><code>{{ .Digest }}</code></td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`))
@@ -0,0 +1,45 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/server"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestBrowseHandler(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "ocil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	s, err := store.NewLayout(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.AddOCI(context.Background(), memory.NewMemory([]byte("data"), "random"), "hello/world:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	server.NewBrowseHandler(s).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	body, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"hello/world", "v1"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected browse page to contain %q, got:\n%s", want, body)
+		}
+	}
+}
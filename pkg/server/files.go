@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content/file"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+// FileHandler serves the files of the file artifacts in a store's layout under their original names, so hosts at
+// disconnected sites can fetch what was bundled with nothing but curl
+// 	Every file is served as /<reference>/<name> (ie: /registry.example.com/files/app:v1/config.yaml), and by /<name>
+// 	alone when no other artifact in the store has a file of the same name.  GET / lists them all, one per line.
+// 	Directories are served as the tar+gzip archive they were packaged as.
+type FileHandler struct {
+	layout *store.Layout
+
+	verified verifiedBlobs
+}
+
+func NewFileHandler(l *store.Layout) *FileHandler {
+	return &FileHandler{layout: l}
+}
+
+type storedFile struct {
+	Reference  string
+	Name       string
+	Descriptor ocispec.Descriptor
+}
+
+func (f storedFile) path() string {
+	return f.Reference + "/" + f.Name
+}
+
+func (h *FileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	files, err := h.files(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, f := range files {
+			fmt.Fprintln(w, "/"+f.path())
+		}
+		return
+	}
+
+	var matches []storedFile
+	for _, f := range files {
+		if f.path() == path {
+			h.serve(w, r, f)
+			return
+		}
+		if f.Name == path {
+			matches = append(matches, f)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		http.NotFound(w, r)
+	case 1:
+		h.serve(w, r, matches[0])
+	default:
+		var paths []string
+		for _, f := range matches {
+			paths = append(paths, "/"+f.path())
+		}
+		http.Error(w, fmt.Sprintf("%s is ambiguous, it is one of: %s", path, strings.Join(paths, ", ")), http.StatusConflict)
+	}
+}
+
+func (h *FileHandler) serve(w http.ResponseWriter, r *http.Request, f storedFile) {
+	rc, err := h.layout.Fetch(r.Context(), f.Descriptor)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	rs, seekable := rc.(io.ReadSeeker)
+	if seekable {
+		if err := h.verified.verify(rs, f.Descriptor); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// blobs never change, so their digest is as good a validator as any
+	w.Header().Set("ETag", `"`+f.Descriptor.Digest.String()+`"`)
+	if seekable {
+		http.ServeContent(w, r, f.Name, time.Time{}, rs)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if r.Method == http.MethodGet {
+		io.Copy(w, rc)
+	}
+}
+
+// files returns the named layers of every file artifact in the store, sorted by path
+func (h *FileHandler) files(ctx context.Context) ([]storedFile, error) {
+	var files []storedFile
+	err := h.layout.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if kind(h.layout.Identify(ctx, desc)) != "file" {
+			return nil
+		}
+
+		rc, err := h.layout.Fetch(ctx, desc)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		var m ocispec.Manifest
+		if err := json.NewDecoder(rc).Decode(&m); err != nil {
+			return fmt.Errorf("decode manifest of %s: %w", reference, err)
+		}
+
+		for _, l := range m.Layers {
+			name := l.Annotations[ocispec.AnnotationTitle]
+			if name == "" || strings.Contains(name, "/") {
+				continue
+			}
+			if l.Annotations[file.AnnotationUnpack] == "true" {
+				name += ".tar.gz"
+			}
+			files = append(files, storedFile{Reference: reference, Name: name, Descriptor: l})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].path() < files[j].path() })
+	return files, nil
+}
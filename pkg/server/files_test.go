@@ -0,0 +1,165 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/file"
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/server"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestFileHandler(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := t.TempDir()
+	for name, data := range map[string]string{
+		"config.yaml":      "config",
+		"tools/install.sh": "#!/bin/sh",
+		"other/notes.txt":  "notes",
+		"notes.txt":        "more notes",
+	} {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for ref, oci := range map[string]artifacts.OCI{
+		"registry.example.com/files/config:v1": file.NewFile(filepath.Join(src, "config.yaml")),
+		"registry.example.com/files/notes:v1":  file.NewFile(filepath.Join(src, "notes.txt")),
+		"registry.example.com/files/notes:v2":  file.NewFile(filepath.Join(src, "other", "notes.txt")),
+		"registry.example.com/files/tools:v1":  file.NewDirectory(filepath.Join(src, "tools")),
+	} {
+		if _, err := s.AddOCI(ctx, oci, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// anything but files is left out
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("data"), "random"), "hello/world:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(server.NewFileHandler(s))
+	defer srv.Close()
+
+	tcs := []struct {
+		path   string
+		status int
+		want   string
+	}{
+		{path: "/", status: http.StatusOK, want: strings.Join([]string{
+			"/registry.example.com/files/config:v1/config.yaml",
+			"/registry.example.com/files/notes:v1/notes.txt",
+			"/registry.example.com/files/notes:v2/notes.txt",
+			"/registry.example.com/files/tools:v1/tools.tar.gz",
+			"",
+		}, "\n")},
+		{path: "/registry.example.com/files/config:v1/config.yaml", status: http.StatusOK, want: "config"},
+		{path: "/config.yaml", status: http.StatusOK, want: "config"},
+		{path: "/registry.example.com/files/notes:v2/notes.txt", status: http.StatusOK, want: "notes"},
+		{path: "/notes.txt", status: http.StatusConflict},
+		{path: "/missing.txt", status: http.StatusNotFound},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.path, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("GET %s = %d, want %d: %s", tc.path, resp.StatusCode, tc.status, body)
+			}
+			if tc.want != "" && string(body) != tc.want {
+				t.Errorf("GET %s = %q, want %q", tc.path, body, tc.want)
+			}
+		})
+	}
+
+	t.Run("range", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/config.yaml", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", "bytes=2-")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusPartialContent || string(body) != "nfig" {
+			t.Errorf("GET with range = %d %q, want %d %q", resp.StatusCode, body, http.StatusPartialContent, "nfig")
+		}
+	})
+}
+
+func TestFileHandler_Corrupted(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("config"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, file.NewFile(path), "registry.example.com/files/config:v1"); err != nil {
+		t.Fatal(err)
+	}
+	// the same size, so only the digest gives it away
+	blob := filepath.Join(s.Root, "blobs", "sha256", digest.FromString("config").Encoded())
+	if err := os.WriteFile(blob, []byte("CONFIG"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(server.NewFileHandler(s))
+	defer srv.Close()
+
+	for _, rng := range []string{"", "bytes=2-"} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/config.yaml", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError || strings.Contains(string(body), "ONFIG") {
+			t.Errorf("GET of a corrupted file with range %q = %d %q, want %d", rng, resp.StatusCode, body, http.StatusInternalServerError)
+		}
+	}
+}
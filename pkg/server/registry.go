@@ -0,0 +1,511 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/image"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+// RegistryHandler serves a store's layout as a read-only registry over the distribution v2 API, so clusters at
+// disconnected sites can pull straight from the store without first copying it into a registry of their own
+// 	Repositories are named after the references in the store, with or without their registry: registry.example.com/app:v1
+// 	can be pulled as both <server>/registry.example.com/app:v1 and <server>/app:v1, the former winning if both exist.
+// 	Manifests are found by tag or digest, including those of the platforms of an index.  A repository only serves the
+// 	manifests and blobs its references reach, and manifests of at most 4 MiB.  Anything but GET and HEAD is refused.
+type RegistryHandler struct {
+	layout *store.Layout
+
+	upstream   string
+	remoteOpts []remote.Option
+
+	verified verifiedBlobs
+}
+
+type RegistryOption func(*RegistryHandler)
+
+// WithUpstream makes the handler a pull-through cache of registry (ie: registry-1.docker.io)
+// 	Manifests missing from the store are pulled from the same repository of registry, along with everything they
+// 	reference and their cosign signatures, and added to the store as <registry>/<repository>:<tag> before being
+// 	served.  Blobs missing from the store are served straight from registry, without being stored.  Tags are never
+// 	pulled again once in the store, Remove them to have them refreshed.
+func WithUpstream(registry string, opts ...remote.Option) RegistryOption {
+	return func(h *RegistryHandler) {
+		h.upstream = strings.TrimSuffix(registry, "/")
+		h.remoteOpts = opts
+	}
+}
+
+func NewRegistryHandler(l *store.Layout, opts ...RegistryOption) *RegistryHandler {
+	h := &RegistryHandler{layout: l}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// distribution error codes, as clients expect them
+const (
+	codeNameUnknown     = "NAME_UNKNOWN"
+	codeManifestUnknown = "MANIFEST_UNKNOWN"
+	codeBlobUnknown     = "BLOB_UNKNOWN"
+	codeDigestInvalid   = "DIGEST_INVALID"
+	codeUnsupported     = "UNSUPPORTED"
+)
+
+// maxManifestSize caps the manifests served, as registries cap those pushed to them
+const maxManifestSize = 4 << 20
+
+var (
+	errNameUnknown     = errors.New("repository not found")
+	errManifestUnknown = errors.New("manifest not found")
+	errBlobUnknown     = errors.New("blob not found")
+)
+
+func (h *RegistryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		registryError(w, http.StatusMethodNotAllowed, codeUnsupported, "the registry is read-only")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	if path == r.URL.Path {
+		http.NotFound(w, r)
+		return
+	}
+	if path == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+		return
+	}
+
+	if name := strings.TrimSuffix(path, "/tags/list"); name != path {
+		h.tags(w, r, name)
+		return
+	}
+	for _, route := range []struct {
+		sep   string
+		serve func(http.ResponseWriter, *http.Request, string, string)
+	}{
+		{"/manifests/", h.manifest},
+		{"/blobs/", h.blob},
+	} {
+		if i := strings.LastIndex(path, route.sep); i > 0 {
+			route.serve(w, r, path[:i], path[i+len(route.sep):])
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (h *RegistryHandler) tags(w http.ResponseWriter, r *http.Request, name string) {
+	refs, err := h.references(name)
+	if err == nil && len(refs) == 0 {
+		err = fmt.Errorf("%s: %w", name, errNameUnknown)
+	}
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	tags := []string{}
+	for tag := range refs {
+		// references pinned to a digest have no tag to list
+		if _, err := digest.Parse(tag); err != nil {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	// pagination, per the distribution spec
+	if last := r.URL.Query().Get("last"); last != "" {
+		i := sort.SearchStrings(tags, last)
+		if i < len(tags) && tags[i] == last {
+			i++
+		}
+		tags = tags[i:]
+	}
+	if n, err := strconv.Atoi(r.URL.Query().Get("n")); err == nil && n >= 0 && n < len(tags) {
+		tags = tags[:n]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}{name, tags})
+}
+
+func (h *RegistryHandler) manifest(w http.ResponseWriter, r *http.Request, name string, reference string) {
+	desc, data, err := h.localManifest(r.Context(), name, reference)
+	if h.upstream != "" && (errors.Is(err, errNameUnknown) || errors.Is(err, errManifestUnknown)) {
+		desc, data, err = h.pull(r.Context(), name, reference)
+	}
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", desc.MediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// localManifest returns the manifest of name the store has for reference
+func (h *RegistryHandler) localManifest(ctx context.Context, name string, reference string) (ocispec.Descriptor, []byte, error) {
+	refs, err := h.references(name)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	if len(refs) == 0 {
+		return ocispec.Descriptor{}, nil, fmt.Errorf("%s: %w", name, errNameUnknown)
+	}
+
+	desc, ok := refs[reference]
+	if !ok {
+		d, err := digest.Parse(reference)
+		if err != nil {
+			return ocispec.Descriptor{}, nil, fmt.Errorf("%s:%s: %w", name, reference, errManifestUnknown)
+		}
+		// not indexed itself but part of something that is, ie: the manifest of one platform of an index
+		reachable, err := h.reachable(ctx, refs)
+		if err != nil {
+			return ocispec.Descriptor{}, nil, err
+		}
+		if desc, ok = reachable[d]; !ok {
+			return ocispec.Descriptor{}, nil, fmt.Errorf("%s@%s: %w", name, d, errManifestUnknown)
+		}
+	}
+	if !isManifest(desc.MediaType) {
+		return ocispec.Descriptor{}, nil, fmt.Errorf("%s@%s is a %s, not a manifest: %w", name, desc.Digest, desc.MediaType, errManifestUnknown)
+	}
+
+	data, err := h.fetch(ctx, desc)
+	if errors.Is(err, store.ErrBlobNotFound) {
+		return ocispec.Descriptor{}, nil, fmt.Errorf("%s@%s: %w", name, desc.Digest, errManifestUnknown)
+	}
+	return desc, data, err
+}
+
+// pull adds the manifest of name for reference, and everything it references, to the store from upstream
+func (h *RegistryHandler) pull(ctx context.Context, name string, reference string) (ocispec.Descriptor, []byte, error) {
+	ref := h.upstream + "/" + name + ":" + reference
+	if _, err := digest.Parse(reference); err == nil {
+		ref = h.upstream + "/" + name + "@" + reference
+	}
+
+	r, err := gname.ParseReference(ref)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, fmt.Errorf("%s: %v: %w", ref, err, errManifestUnknown)
+	}
+	rd, err := remote.Get(r, append([]remote.Option{remote.WithContext(ctx)}, h.remoteOpts...)...)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, upstreamError(ref, err, errManifestUnknown)
+	}
+
+	sig, sigRef, err := h.pullSignatures(ctx, name, rd.Digest)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+
+	var desc ocispec.Descriptor
+	if rd.MediaType.IsIndex() {
+		idx, err := rd.ImageIndex()
+		if err != nil {
+			return ocispec.Descriptor{}, nil, err
+		}
+		if sig != nil {
+			idx = signedIndex{index: idx, sig: sig}
+		}
+		desc, err = h.layout.AddImageIndex(ctx, idx, ref)
+		if err != nil {
+			return ocispec.Descriptor{}, nil, err
+		}
+	} else {
+		img, err := rd.Image()
+		if err != nil {
+			return ocispec.Descriptor{}, nil, err
+		}
+		if sig != nil {
+			img = signedImage{Image: img, sig: sig}
+		}
+		desc, err = h.layout.AddImage(ctx, img, ref)
+		if err != nil {
+			return ocispec.Descriptor{}, nil, err
+		}
+	}
+
+	// the signatures are attached to what they sign, so they're only stored once it is
+	if sig != nil {
+		if _, err := h.layout.AddImage(ctx, sig.Image, sigRef); err != nil {
+			return ocispec.Descriptor{}, nil, err
+		}
+	}
+
+	data, err := h.fetch(ctx, desc)
+	return desc, data, err
+}
+
+// pullSignatures fetches the cosign signatures of the manifest d of name from upstream, and the reference they're
+// stored under, nil if it has none
+func (h *RegistryHandler) pullSignatures(ctx context.Context, name string, d gv1.Hash) (*image.Image, string, error) {
+	ref := fmt.Sprintf("%s/%s:%s-%s.%s", h.upstream, name, d.Algorithm, d.Hex, consts.CosignSignatureSuffix)
+	r, err := gname.NewTag(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	img, err := remote.Image(r, append([]remote.Option{remote.WithContext(ctx)}, h.remoteOpts...)...)
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("upstream %s: %w", ref, err)
+	}
+	return &image.Image{Name: ref, Image: img}, ref, nil
+}
+
+// signedImage is an image pulled from upstream along with its signatures, for the signature policy of the store
+type signedImage struct {
+	gv1.Image
+	sig artifacts.OCI
+}
+
+func (i signedImage) Signatures() (artifacts.OCI, error) {
+	return i.sig, nil
+}
+
+// signedIndex is an index pulled from upstream along with its signatures, for the signature policy of the store
+type signedIndex struct {
+	index
+	sig artifacts.OCI
+}
+
+// index is embedded under a name of its own, an ImageIndex field would hide the ImageIndex method
+type index = gv1.ImageIndex
+
+func (i signedIndex) Signatures() (artifacts.OCI, error) {
+	return i.sig, nil
+}
+
+func (h *RegistryHandler) blob(w http.ResponseWriter, r *http.Request, name string, reference string) {
+	d, err := digest.Parse(reference)
+	if err != nil {
+		registryError(w, http.StatusBadRequest, codeDigestInvalid, fmt.Sprintf("invalid digest %s", reference))
+		return
+	}
+
+	rc, err := h.localBlob(r.Context(), name, d)
+	if h.upstream != "" && (errors.Is(err, errNameUnknown) || errors.Is(err, errBlobUnknown)) {
+		rc, err = h.upstreamBlob(r.Context(), name, d)
+	}
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", d.String())
+
+	// blobs are files, which is all it takes to support range requests once they're verified
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		if err := h.verified.verify(rs, ocispec.Descriptor{Digest: d}); err != nil {
+			h.error(w, err)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, rs)
+		return
+	}
+	if r.Method == http.MethodGet {
+		io.Copy(w, rc)
+	}
+}
+
+func (h *RegistryHandler) localBlob(ctx context.Context, name string, d digest.Digest) (io.ReadCloser, error) {
+	refs, err := h.references(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("%s: %w", name, errNameUnknown)
+	}
+	reachable, err := h.reachable(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	desc, ok := reachable[d]
+	if !ok {
+		return nil, fmt.Errorf("%s@%s: %w", name, d, errBlobUnknown)
+	}
+
+	rc, err := h.layout.Fetch(ctx, desc)
+	if errors.Is(err, store.ErrBlobNotFound) {
+		return nil, fmt.Errorf("%s@%s: %w", name, d, errBlobUnknown)
+	}
+	return rc, err
+}
+
+func (h *RegistryHandler) upstreamBlob(ctx context.Context, name string, d digest.Digest) (io.ReadCloser, error) {
+	ref := h.upstream + "/" + name + "@" + d.String()
+	r, err := gname.NewDigest(ref)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %w", ref, err, errBlobUnknown)
+	}
+	l, err := remote.Layer(r, append([]remote.Option{remote.WithContext(ctx)}, h.remoteOpts...)...)
+	if err != nil {
+		return nil, upstreamError(ref, err, errBlobUnknown)
+	}
+	rc, err := l.Compressed()
+	if err != nil {
+		return nil, upstreamError(ref, err, errBlobUnknown)
+	}
+	return rc, nil
+}
+
+// error writes err as the distribution error it is
+func (h *RegistryHandler) error(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNameUnknown):
+		registryError(w, http.StatusNotFound, codeNameUnknown, err.Error())
+	case errors.Is(err, errManifestUnknown):
+		registryError(w, http.StatusNotFound, codeManifestUnknown, err.Error())
+	case errors.Is(err, errBlobUnknown):
+		registryError(w, http.StatusNotFound, codeBlobUnknown, err.Error())
+	default:
+		registryError(w, http.StatusInternalServerError, "", err.Error())
+	}
+}
+
+// upstreamError wraps err with unknown when upstream doesn't have ref either
+func upstreamError(ref string, err error, unknown error) error {
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", ref, unknown)
+	}
+	return fmt.Errorf("upstream %s: %w", ref, err)
+}
+
+// references returns the descriptors of the repository name, by tag (or digest, for references pinned to one)
+// 	A tag of the repository as named wins over the same tag of the repository of another registry.
+func (h *RegistryHandler) references(name string) (map[string]ocispec.Descriptor, error) {
+	exact := make(map[string]ocispec.Descriptor)
+	loose := make(map[string]ocispec.Descriptor)
+	err := h.layout.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		repo, tag := splitReference(reference)
+		switch {
+		case repo == name:
+			exact[tag] = desc
+		case stripRegistry(repo) == name:
+			loose[tag] = desc
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for tag, desc := range exact {
+		loose[tag] = desc
+	}
+	return loose, nil
+}
+
+// reachable returns every blob reachable from refs, by digest
+func (h *RegistryHandler) reachable(ctx context.Context, refs map[string]ocispec.Descriptor) (map[digest.Digest]ocispec.Descriptor, error) {
+	reachable := make(map[digest.Digest]ocispec.Descriptor)
+	for _, desc := range refs {
+		if _, ok := reachable[desc.Digest]; ok {
+			continue
+		}
+		descs, err := h.layout.Descendants(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		for d, desc := range descs {
+			reachable[d] = desc
+		}
+	}
+	return reachable, nil
+}
+
+// fetch reads the manifest desc, refusing any larger than maxManifestSize
+func (h *RegistryHandler) fetch(ctx context.Context, desc ocispec.Descriptor) ([]byte, error) {
+	if desc.Size > maxManifestSize {
+		return nil, fmt.Errorf("%s: manifest of %d bytes is larger than %d: %w", desc.Digest, desc.Size, maxManifestSize, errManifestUnknown)
+	}
+	rc, err := h.layout.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("%s: manifest is larger than %d bytes: %w", desc.Digest, maxManifestSize, errManifestUnknown)
+	}
+	return data, nil
+}
+
+// stripRegistry drops the registry from repo, if it has one
+func stripRegistry(repo string) string {
+	i := strings.Index(repo, "/")
+	if i == -1 {
+		return repo
+	}
+	if host := repo[:i]; strings.ContainsAny(host, ".:") || host == "localhost" {
+		return repo[i+1:]
+	}
+	return repo
+}
+
+// isManifest reports whether mediaType is that of a manifest (or index) clients can pull
+func isManifest(mediaType string) bool {
+	switch mediaType {
+	case ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex, consts.DockerManifestSchema2, consts.DockerManifestListSchema2:
+		return true
+	}
+	return false
+}
+
+func registryError(w http.ResponseWriter, status int, code string, message string) {
+	if code == "" {
+		code = "UNKNOWN"
+	}
+
+	type detail struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Errors []detail `json:"errors"`
+	}{[]detail{{Code: code, Message: message}}})
+}
@@ -0,0 +1,452 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/cosign"
+	"github.com/rancherfederal/ocil/pkg/server"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestRegistryHandler(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, err := os.MkdirTemp("", "ocil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	s, err := store.NewLayout(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, img, "registry.example.com/library/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, img, "registry.example.com/library/app:v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	platform, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add:        platform,
+		Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}},
+	})
+	if _, err := s.AddImageIndex(ctx, idx, "hello/world:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	big := mutate.Annotations(img, map[string]string{"padding": strings.Repeat("x", 4<<20)}).(v1.Image)
+	if _, err := s.AddImage(ctx, big, "hello/big:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(server.NewRegistryHandler(s))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("pull", func(t *testing.T) {
+		for _, ref := range []string{
+			u.Host + "/registry.example.com/library/app:v1",
+			u.Host + "/library/app:v2",
+		} {
+			r, err := name.ParseReference(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pulled, err := remote.Image(r)
+			if err != nil {
+				t.Fatalf("pull %s: %v", ref, err)
+			}
+			if err := validate.Image(pulled); err != nil {
+				t.Errorf("pulled %s is invalid: %v", ref, err)
+			}
+			if want, _ := img.Digest(); mustDigest(t, pulled) != want {
+				t.Errorf("pulled %s as %s, want %s", ref, mustDigest(t, pulled), want)
+			}
+		}
+	})
+
+	t.Run("pull platform", func(t *testing.T) {
+		r, err := name.ParseReference(u.Host + "/hello/world:v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pulled, err := remote.Image(r, remote.WithPlatform(v1.Platform{OS: "linux", Architecture: "arm64"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validate.Image(pulled); err != nil {
+			t.Errorf("pulled platform is invalid: %v", err)
+		}
+		if want, _ := platform.Digest(); mustDigest(t, pulled) != want {
+			t.Errorf("pulled the platform as %s, want %s", mustDigest(t, pulled), want)
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		repo, err := name.NewRepository(u.Host + "/library/app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags, err := remote.List(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(tags, ",") != "v1,v2" {
+			t.Errorf("List() = %v, want [v1 v2]", tags)
+		}
+
+		resp, err := http.Get(srv.URL + "/v2/library/app/tags/list?n=1&last=v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var page struct{ Tags []string }
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(page.Tags, ",") != "v2" {
+			t.Errorf("tags after v1 = %v, want [v2]", page.Tags)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		config, err := img.ConfigName()
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers, err := platform.Layers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		layer, err := layers[0].Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		platformDigest := mustDigest(t, platform)
+
+		tcs := []struct {
+			method string
+			path   string
+			status int
+			code   string
+		}{
+			{http.MethodGet, "/v2/missing/manifests/v1", http.StatusNotFound, "NAME_UNKNOWN"},
+			{http.MethodGet, "/v2/library/app/manifests/v3", http.StatusNotFound, "MANIFEST_UNKNOWN"},
+			{http.MethodGet, "/v2/library/app/blobs/sha256:" + strings.Repeat("0", 64), http.StatusNotFound, "BLOB_UNKNOWN"},
+			{http.MethodGet, "/v2/library/app/blobs/latest", http.StatusBadRequest, "DIGEST_INVALID"},
+			// only what a repository's references reach is served from it
+			{http.MethodGet, "/v2/library/app/manifests/" + platformDigest.String(), http.StatusNotFound, "MANIFEST_UNKNOWN"},
+			{http.MethodGet, "/v2/library/app/blobs/" + layer.String(), http.StatusNotFound, "BLOB_UNKNOWN"},
+			{http.MethodGet, "/v2/library/app/manifests/" + config.String(), http.StatusNotFound, "MANIFEST_UNKNOWN"},
+			{http.MethodGet, "/v2/hello/big/manifests/v1", http.StatusNotFound, "MANIFEST_UNKNOWN"},
+			{http.MethodPut, "/v2/library/app/manifests/v3", http.StatusMethodNotAllowed, "UNSUPPORTED"},
+			{http.MethodDelete, "/v2/library/app/manifests/v1", http.StatusMethodNotAllowed, "UNSUPPORTED"},
+		}
+		for _, tc := range tcs {
+			req, err := http.NewRequest(tc.method, srv.URL+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body struct {
+				Errors []struct{ Code string }
+			}
+			err = json.NewDecoder(resp.Body).Decode(&body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tc.status || len(body.Errors) != 1 || body.Errors[0].Code != tc.code {
+				t.Errorf("%s %s = %d %+v, want %d %s", tc.method, tc.path, resp.StatusCode, body.Errors, tc.status, tc.code)
+			}
+		}
+	})
+}
+
+func TestRegistryHandler_Corrupted(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, img, "registry.example.com/library/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same size, so only the digest gives it away
+	blob := filepath.Join(s.Root, "blobs", layer.Algorithm, layer.Hex)
+	data, err := os.ReadFile(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(blob, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(server.NewRegistryHandler(s))
+	defer srv.Close()
+
+	for _, rng := range []string{"", "bytes=0-9"} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/v2/library/app/blobs/"+layer.String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("GET of a corrupted blob with range %q = %d, want %d", rng, resp.StatusCode, http.StatusInternalServerError)
+		}
+	}
+}
+
+func TestRegistryHandler_Upstream(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer upstream.Close()
+	uu, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := name.ParseReference(uu.Host + "/library/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(r, img); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := mustDigest(t, img)
+	sigRef := fmt.Sprintf("%s/library/app:%s-%s.sig", uu.Host, d.Algorithm, d.Hex)
+	sr, err := name.ParseReference(sigRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(sr, sig); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(server.NewRegistryHandler(s, server.WithUpstream(uu.Host)))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pull := func() error {
+		r, err := name.ParseReference(u.Host + "/library/app:v1")
+		if err != nil {
+			return err
+		}
+		pulled, err := remote.Image(r)
+		if err != nil {
+			return err
+		}
+		if err := validate.Image(pulled); err != nil {
+			return err
+		}
+		if want, _ := img.Digest(); mustDigest(t, pulled) != want {
+			return fmt.Errorf("pulled %s, want %s", mustDigest(t, pulled), want)
+		}
+		return nil
+	}
+
+	if err := pull(); err != nil {
+		t.Fatalf("pull through: %v", err)
+	}
+	if _, err := s.Image(ctx, uu.Host+"/library/app:v1"); err != nil {
+		t.Errorf("pulled image wasn't added to the store: %v", err)
+	}
+	if _, err := s.Image(ctx, sigRef); err != nil {
+		t.Errorf("signatures of the pulled image weren't added to the store: %v", err)
+	}
+
+	resp, err := http.Get(srv.URL + "/v2/library/app/manifests/v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET of a manifest neither the store nor upstream has = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	// served from the store alone from then on
+	upstream.Close()
+	if err := pull(); err != nil {
+		t.Errorf("pull once upstream is gone: %v", err)
+	}
+}
+
+func TestRegistryHandler_UpstreamVerified(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.NewLayout(t.TempDir(), store.WithVerifier(cosign.NewKeyVerifier(&key.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer upstream.Close()
+	uu, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(ref string, img v1.Image) {
+		r, err := name.ParseReference(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(r, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signed, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(uu.Host+"/library/app:signed", signed)
+	d := mustDigest(t, signed)
+	sigRef := fmt.Sprintf("%s/library/app:%s-%s.sig", uu.Host, d.Algorithm, d.Hex)
+	write(sigRef, signature(t, key, d))
+	unsigned, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(uu.Host+"/library/app:unsigned", unsigned)
+
+	srv := httptest.NewServer(server.NewRegistryHandler(s, server.WithUpstream(uu.Host)))
+	defer srv.Close()
+
+	tcs := []struct {
+		tag  string
+		want int
+	}{
+		{tag: "signed", want: http.StatusOK},
+		{tag: "unsigned", want: http.StatusInternalServerError},
+	}
+	for _, tc := range tcs {
+		resp, err := http.Get(srv.URL + "/v2/library/app/manifests/" + tc.tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("GET of the %s manifest = %d, want %d", tc.tag, resp.StatusCode, tc.want)
+		}
+	}
+
+	// the signature follows what it signs into the store
+	if _, err := s.Image(ctx, sigRef); err != nil {
+		t.Errorf("signatures of the pulled image weren't added to the store: %v", err)
+	}
+	if _, err := s.Image(ctx, uu.Host+"/library/app:unsigned"); !errors.Is(err, store.ErrRefNotFound) {
+		t.Errorf("Image() of the unsigned image error = %v, want ErrRefNotFound", err)
+	}
+}
+
+// signature is a cosign signature of d made with key
+func signature(t *testing.T, key *ecdsa.PrivateKey, d v1.Hash) v1.Image {
+	payload := []byte(fmt.Sprintf(`{"critical":{"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"}}`, d))
+	sum := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, types.MediaType(consts.CosignSimpleSigningMediaType)),
+		Annotations: map[string]string{consts.CosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func mustDigest(t *testing.T, img v1.Image) v1.Hash {
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
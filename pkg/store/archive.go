@@ -0,0 +1,355 @@
+package store
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/content"
+	"github.com/rancherfederal/ocil/pkg/encrypt"
+)
+
+// archiveManifestFile is the first entry of every archive, listing the digest and size of everything after it
+const archiveManifestFile = "ocil-archive.json"
+
+type ArchiveOption func(*archiveOptions)
+
+type archiveOptions struct {
+	level  zstd.EncoderLevel
+	key    []byte
+	layout []Options
+}
+
+// WithArchiveLevel compresses the archive at the given zstd level (1-22) instead of the default
+func WithArchiveLevel(level int) ArchiveOption {
+	return func(o *archiveOptions) {
+		o.level = zstd.EncoderLevelFromZstd(level)
+	}
+}
+
+// WithArchiveKey encrypts the archive with key (see encrypt.NewWriter), or decrypts it when loaded
+func WithArchiveKey(key []byte) ArchiveOption {
+	return func(o *archiveOptions) {
+		o.key = key
+	}
+}
+
+// WithLayoutOptions configures the store LoadArchive returns
+func WithLayoutOptions(opts ...Options) ArchiveOption {
+	return func(o *archiveOptions) {
+		o.layout = append(o.layout, opts...)
+	}
+}
+
+type archiveManifest struct {
+	Files []archiveFile `json:"files"`
+}
+
+type archiveFile struct {
+	Name   string        `json:"name"`
+	Digest digest.Digest `json:"digest"`
+	Size   int64         `json:"size"`
+
+	// data is the content of anything but a blob as it was hashed, since it may be rewritten once listed
+	data []byte
+}
+
+// Archive packs the store's entire layout into a single zstd compressed tarball at path, along with a manifest of the
+// digest of every file in it for LoadArchive to check against
+// 	Writes in progress are left out, and the store is archived as it was when Archive started: GC and removals wait
+// 	for it to finish, and the index (along with everything else that isn't a blob) is archived as it was listed.  The
+// 	archive is only moved into place once complete, so an interrupted Archive never leaves a truncated file behind.
+func (l *Layout) Archive(ctx context.Context, path string, opts ...ArchiveOption) error {
+	o := &archiveOptions{level: zstd.SpeedDefault}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// blobs are never rewritten, only deleted
+	l.gcMu.RLock()
+	defer l.gcMu.RUnlock()
+
+	files, err := l.archiveFiles()
+	if err != nil {
+		return err
+	}
+	manifest, err := json.Marshal(archiveManifest{Files: files})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var w io.WriteCloser = f
+	if o.key != nil {
+		if w, err = encrypt.NewWriter(f, o.key); err != nil {
+			return err
+		}
+	}
+
+	zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(o.level))
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	if err := writeTarFile(tw, archiveManifestFile, manifest); err != nil {
+		return err
+	}
+	for _, af := range files {
+		if err := l.writeArchiveFile(ctx, tw, af); err != nil {
+			return fmt.Errorf("archive %s: %w", af.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if w != io.WriteCloser(f) {
+		// seals the last chunk
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// archiveFiles lists every file of the layout, sorted by name
+// 	Blobs are named after their digest already, everything else is hashed
+func (l *Layout) archiveFiles() ([]archiveFile, error) {
+	var files []archiveFile
+	err := fs.WalkDir(l.OCI.Driver(), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if name == content.IngestDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(name, ".lock") || strings.HasSuffix(name, ".tmp") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		af := archiveFile{Name: name, Size: info.Size()}
+
+		parts := strings.Split(name, "/")
+		if len(parts) == 3 && parts[0] == "blobs" {
+			af.Digest = digest.NewDigestFromEncoded(digest.Algorithm(parts[1]), parts[2])
+		} else {
+			f, err := l.OCI.Driver().Open(name)
+			if err != nil {
+				return err
+			}
+			af.data, err = io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			af.Digest = digest.FromBytes(af.data)
+			af.Size = int64(len(af.data))
+		}
+
+		files = append(files, af)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+func (l *Layout) writeArchiveFile(ctx context.Context, tw *tar.Writer, af archiveFile) error {
+	var r io.Reader = bytes.NewReader(af.data)
+	if af.data == nil {
+		f, err := l.OCI.Driver().Open(af.Name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     af.Name,
+		Size:     af.Size,
+		Mode:     0644,
+		ModTime:  time.Unix(0, 0),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.CopyN(tw, &contextReader{ctx: ctx, r: r}, af.Size)
+	return err
+}
+
+// LoadArchive extracts an archive written by Archive into dir, and returns the store it holds
+// 	Every file is checked against the digest and size the archive's manifest records for it, and anything the
+// 	manifest doesn't list is rejected.  dir must either not exist or be empty, archives are never merged into a store.
+// 	Encrypted archives are decrypted as they're read, nothing is written to dir before it's been authenticated.
+func LoadArchive(ctx context.Context, path string, dir string, opts ...ArchiveOption) (*Layout, error) {
+	o := &archiveOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("load archive %s: %s is not empty", path, dir)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	header, err := br.Peek(encrypt.HeaderSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var r io.Reader = br
+	switch {
+	case o.key != nil:
+		if r, err = encrypt.NewReader(br, o.key); err != nil {
+			return nil, fmt.Errorf("load archive %s: %w", path, err)
+		}
+	case encrypt.Encrypted(header):
+		return nil, fmt.Errorf("load archive %s: archive is encrypted, but no key was given", path)
+	}
+
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("load archive %s: %w", path, err)
+	}
+	if hdr.Name != archiveManifestFile {
+		return nil, fmt.Errorf("load archive %s: missing %s", path, archiveManifestFile)
+	}
+	var m archiveManifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("load archive %s: decode %s: %w", path, archiveManifestFile, err)
+	}
+
+	expected := make(map[string]archiveFile)
+	folded := foldedNames{}
+	for _, af := range m.Files {
+		if err := folded.add(af.Name); err != nil {
+			return nil, fmt.Errorf("load archive %s: %w", path, err)
+		}
+		expected[af.Name] = af
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("load archive %s: %w", path, err)
+		}
+
+		af, ok := expected[hdr.Name]
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("load archive %s: unexpected entry %s", path, hdr.Name)
+		}
+		delete(expected, hdr.Name)
+
+		if err := extractArchiveFile(ctx, tr, dir, af); err != nil {
+			return nil, fmt.Errorf("load archive %s: %w", path, err)
+		}
+	}
+
+	if len(expected) > 0 {
+		var missing []string
+		for name := range expected {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("load archive %s: missing %s", path, strings.Join(missing, ", "))
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, consts.OCIImageIndexFile)); err != nil {
+		return nil, fmt.Errorf("load archive %s: %w", path, err)
+	}
+	return NewLayout(dir, o.layout...)
+}
+
+func extractArchiveFile(ctx context.Context, r io.Reader, dir string, af archiveFile) error {
+	// names come from the manifest, which is no more trusted than the rest of the archive
+	target, err := localPath(dir, af.Name)
+	if err != nil {
+		return err
+	}
+	if err := af.Digest.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", af.Name, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.Create(target + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	verifier := af.Digest.Verifier()
+	n, err := io.Copy(io.MultiWriter(out, verifier), &contextReader{ctx: ctx, r: r})
+	if err != nil {
+		return err
+	}
+	if n != af.Size || !verifier.Verified() {
+		return fmt.Errorf("%s: %w", af.Name, ErrDigestMismatch)
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), target)
+}
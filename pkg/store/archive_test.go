@@ -0,0 +1,239 @@
+package store_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/ocil/pkg/encrypt"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Archive(t *testing.T) {
+	s := newLayout(t)
+	for _, ref := range []string{"registry.example.com/app:v1", "registry.example.com/app:v2"} {
+		if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archive := filepath.Join(t.TempDir(), "store.tar.zst")
+	if err := s.Archive(ctx, archive, store.WithArchiveLevel(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.LoadArchive(ctx, archive, filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(refs(t, loaded), ","), strings.Join(refs(t, s), ","); got != want {
+		t.Errorf("loaded store has %s, want %s", got, want)
+	}
+	fsck, err := loaded.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fsck.OK() {
+		t.Errorf("loaded store is unhealthy: %+v", fsck)
+	}
+
+	if _, err := store.LoadArchive(ctx, archive, loaded.Root); err == nil {
+		t.Error("LoadArchive() into a store that isn't empty succeeded")
+	}
+
+	// archives whose content doesn't match their manifest
+	tcs := []struct {
+		name     string
+		file     string
+		data     string
+		claim    string
+		mismatch bool
+	}{
+		{name: "tampered", file: "index.json", data: "{}", claim: "[]", mismatch: true},
+		{name: "outside the layout", file: "../index.json", data: "{}", claim: "{}"},
+		{name: "outside the layout on windows", file: "..\\index.json", data: "{}", claim: "{}"},
+		{name: "a volume on windows", file: "C:index.json", data: "{}", claim: "{}"},
+		{name: "a device on windows", file: "blobs/NUL.json", data: "{}", claim: "{}"},
+		{name: "a trailing dot", file: "index.json.", data: "{}", claim: "{}"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bad.tar.zst")
+			writeArchive(t, path, tc.file, tc.data, tc.claim)
+
+			dir := t.TempDir()
+			_, err := store.LoadArchive(ctx, path, filepath.Join(dir, "store"))
+			if err == nil {
+				t.Fatal("LoadArchive() succeeded")
+			}
+			if tc.mismatch && !errors.Is(err, store.ErrDigestMismatch) {
+				t.Errorf("LoadArchive() = %v, want a digest mismatch", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+				t.Error("LoadArchive() wrote outside of the layout")
+			}
+		})
+	}
+}
+
+func TestLayout_ArchiveConcurrent(t *testing.T) {
+	s := newLayout(t)
+	if _, err := s.AddOCI(ctx, genArtifact(t, "registry.example.com/app:v0"), "registry.example.com/app:v0"); err != nil {
+		t.Fatal(err)
+	}
+	// a large blob for the store to change while it's archived
+	img, err := random.Image(8*1024*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, img, "registry.example.com/large:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the store keeps changing underneath every archive, which must still load as a healthy store
+	done := make(chan struct{})
+	churned := make(chan error, 1)
+	go func() {
+		defer close(churned)
+		for i := 1; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			ref := fmt.Sprintf("registry.example.com/app:v%d", i)
+			if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+				churned <- err
+				return
+			}
+			if err := s.Remove(ctx, fmt.Sprintf("registry.example.com/app:v%d", i-1)); err != nil {
+				churned <- err
+				return
+			}
+			if _, err := s.GC(ctx); err != nil {
+				churned <- err
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		archive := filepath.Join(t.TempDir(), "store.tar.zst")
+		if err := s.Archive(ctx, archive); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := store.LoadArchive(ctx, archive, filepath.Join(t.TempDir(), "store"))
+		if err != nil {
+			t.Fatalf("LoadArchive() error = %v", err)
+		}
+		fsck, err := loaded.Fsck(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fsck.OK() {
+			t.Errorf("loaded store is unhealthy: %+v", fsck)
+		}
+	}
+	close(done)
+	if err := <-churned; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLayout_ArchiveWithKey(t *testing.T) {
+	s := newLayout(t)
+	if _, err := s.AddOCI(ctx, genArtifact(t, ""), "registry.example.com/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+	key, err := encrypt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := encrypt.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "store.tar.zst.enc")
+	if err := s.Archive(ctx, archive, store.WithArchiveKey(key)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.LoadArchive(ctx, archive, filepath.Join(t.TempDir(), "store")); err == nil {
+		t.Error("LoadArchive() of an encrypted archive without a key succeeded")
+	}
+	if _, err := store.LoadArchive(ctx, archive, filepath.Join(t.TempDir(), "store"), store.WithArchiveKey(other)); !errors.Is(err, encrypt.ErrDecrypt) {
+		t.Errorf("LoadArchive() with the wrong key = %v, want %v", err, encrypt.ErrDecrypt)
+	}
+
+	loaded, err := store.LoadArchive(ctx, archive, filepath.Join(t.TempDir(), "store"), store.WithArchiveKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(refs(t, loaded), ","), strings.Join(refs(t, s), ","); got != want {
+		t.Errorf("loaded store has %s, want %s", got, want)
+	}
+
+	var bundle bytes.Buffer
+	if _, err := s.ExportBundle(ctx, &bundle, store.WithBundleKey(key)); err != nil {
+		t.Fatal(err)
+	}
+	r, err := encrypt.NewReader(&bundle, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := t.TempDir()
+	extractBundle(t, r, site)
+	extracted, err := store.NewLayout(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(refs(t, extracted), ","), strings.Join(refs(t, s), ","); got != want {
+		t.Errorf("decrypted bundle has %s, want %s", got, want)
+	}
+}
+
+// writeArchive writes an archive holding a single file, whose manifest entry is the digest of claim
+func writeArchive(t *testing.T, path string, name string, data string, claim string) {
+	manifest, err := json.Marshal(map[string]interface{}{
+		"files": []map[string]interface{}{{"name": name, "digest": digest.FromString(claim), "size": len(claim)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(zw)
+	for _, e := range []struct{ name, data string }{{"ocil-archive.json", string(manifest)}, {name, data}} {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: e.name, Size: int64(len(e.data)), Mode: 0644}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
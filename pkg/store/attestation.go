@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// AddAttestation attaches the attestation artifact oci (ie: an attestation.Attestation) to the manifest stored as
+// subjectRef
+// 	Like AddSBOM, it is stored with subjectRef's manifest as its subject, under the cosign style "<alg>-<hex>.att" tag
+// 	of it in the same repository
+func (l *Layout) AddAttestation(ctx context.Context, oci artifacts.OCI, subjectRef string) (ocispec.Descriptor, error) {
+	subject, err := l.resolve(ctx, subjectRef)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	gd, err := fromOCIDescriptor(ocispec.Descriptor{
+		MediaType: subject.MediaType,
+		Digest:    subject.Digest,
+		Size:      subject.Size,
+	})
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	return l.AddOCI(ctx, &referrer{OCI: oci, subject: &gd}, attestationReference(subjectRef, subject.Digest))
+}
+
+// Attestations returns the references of every attestation attached to ref
+func (l *Layout) Attestations(ctx context.Context, ref string) ([]string, error) {
+	desc, err := l.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	attached, err := l.attached(ctx, desc.Digest, map[digest.Digest]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	var attestations []string
+	for _, a := range attached {
+		adesc, err := l.resolve(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(a, "."+consts.CosignAttestationSuffix) || l.Identify(ctx, adesc) == consts.AttestationConfigMediaType {
+			attestations = append(attestations, a)
+		}
+	}
+	return attestations, nil
+}
+
+// attestationReference is the reference cosign attaches the attestations of the manifest d in ref's repository under
+func attestationReference(ref string, d digest.Digest) string {
+	return fmt.Sprintf("%s:%s-%s.%s", repository(ref), d.Algorithm(), d.Hex(), consts.CosignAttestationSuffix)
+}
@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/attestation"
+)
+
+func TestLayout_AddAttestation(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	oci := genArtifact(t, ref)
+	desc, err := s.AddOCI(ctx, oci, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statement, err := attestation.NewProvenance(oci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	att, err := attestation.NewAttestation(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddAttestation(ctx, att, ref); err != nil {
+		t.Fatal(err)
+	}
+
+	attestations, err := s.Attestations(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attRef := fmt.Sprintf("hello/world:%s-%s.att", desc.Digest.Algorithm(), desc.Digest.Hex())
+	if len(attestations) != 1 || attestations[0] != attRef {
+		t.Fatalf("Attestations() = %v, want [%s]", attestations, attRef)
+	}
+
+	// an attestation isn't an sbom
+	sboms, err := s.SBOMs(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sboms) != 0 {
+		t.Errorf("SBOMs() = %v, want none", sboms)
+	}
+
+	_, adesc, err := s.Resolve(ctx, attRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := s.Fetch(ctx, adesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var m struct {
+		Subject *ocispec.Descriptor `json:"subject"`
+	}
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject == nil || m.Subject.Digest != desc.Digest {
+		t.Errorf("attestation subject = %v, want %s", m.Subject, desc.Digest)
+	}
+}
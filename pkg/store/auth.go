@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	auth "oras.land/oras-go/pkg/auth/docker"
+	"oras.land/oras-go/pkg/target"
+
+	"github.com/rancherfederal/ocil/pkg/transport"
+)
+
+// credentialFunc returns the username and secret to authenticate to host with
+// 	An empty username means secret is an identity (refresh) token, and no credentials at all means try the next source
+type credentialFunc func(host string) (string, string, error)
+
+// WithResolver copies to a nil target.Target through r, which is responsible for its own authentication
+func WithResolver(r remotes.Resolver) CopyOption {
+	return func(o *copyOptions) {
+		o.resolver = r
+	}
+}
+
+// WithDockerConfig authenticates copies to a nil target.Target with the credentials of the given docker config.json
+// files, falling back through them in order
+// 	With no paths, the default docker config (honoring DOCKER_CONFIG) and its credential helpers are used
+func WithDockerConfig(paths ...string) CopyOption {
+	return func(o *copyOptions) {
+		o.credentials = append(o.credentials, func(host string) (string, string, error) {
+			cli, err := auth.NewClient(paths...)
+			if err != nil {
+				return "", "", fmt.Errorf("load docker config: %w", err)
+			}
+			creds, ok := cli.(interface {
+				Credential(string) (string, string, error)
+			})
+			if !ok {
+				return "", "", nil
+			}
+			// a host missing from every config isn't an error, there's just nothing to offer
+			u, s, _ := creds.Credential(host)
+			return u, s, nil
+		})
+	}
+}
+
+// WithKeychain authenticates copies to a nil target.Target with the credentials kc resolves for each registry
+func WithKeychain(kc authn.Keychain) CopyOption {
+	return func(o *copyOptions) {
+		o.credentials = append(o.credentials, func(host string) (string, string, error) {
+			reg, err := name.NewRegistry(host)
+			if err != nil {
+				return "", "", err
+			}
+			a, err := kc.Resolve(reg)
+			if err != nil {
+				return "", "", err
+			}
+			cfg, err := a.Authorization()
+			if err != nil {
+				return "", "", err
+			}
+			if cfg.IdentityToken != "" {
+				return "", cfg.IdentityToken, nil
+			}
+			return cfg.Username, cfg.Password, nil
+		})
+	}
+}
+
+// WithBasicAuth authenticates copies to a nil target.Target as username, whichever registry they are headed for
+func WithBasicAuth(username, password string) CopyOption {
+	return func(o *copyOptions) {
+		o.credentials = append(o.credentials, func(string) (string, string, error) {
+			return username, password, nil
+		})
+	}
+}
+
+// WithBearerToken sends token as is with every request of copies to a nil target.Target, skipping the registries
+// token exchange entirely
+// 	It takes precedence over any other credentials given
+func WithBearerToken(token string) CopyOption {
+	return func(o *copyOptions) {
+		o.token = token
+	}
+}
+
+// WithTransport reaches the registry of copies to a nil target.Target as configured by opts, ie: to trust a custom CA
+// or speak plain http
+func WithTransport(opts ...transport.Options) CopyOption {
+	return func(o *copyOptions) {
+		o.transport = append(o.transport, opts...)
+	}
+}
+
+// remote returns the target.Target a copy to a nil target.Target is pushed through, logging to log
+// 	Registries are spoken to over https, unless configured otherwise with WithTransport
+func (o *copyOptions) remote(log logr.Logger) (target.Target, error) {
+	if o.resolver != nil {
+		return o.resolver, nil
+	}
+
+	rt, err := transport.New(o.transport...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Transport: rt}
+
+	var authorizer docker.Authorizer
+	if o.token != "" {
+		authorizer = bearerAuthorizer(o.token)
+	} else {
+		authorizer = docker.NewDockerAuthorizer(docker.WithAuthClient(client), docker.WithAuthCreds(o.credential))
+	}
+
+	hosts := docker.ConfigureDefaultRegistries(
+		docker.WithClient(client),
+		docker.WithAuthorizer(authorizer),
+	)
+	resolver := docker.NewResolver(docker.ResolverOptions{Hosts: hosts})
+	if o.chunkSize > 0 {
+		return &chunkedResolver{Resolver: resolver, hosts: hosts, size: o.chunkSize, streams: o.chunkStreams, log: log}, nil
+	}
+	return resolver, nil
+}
+
+// credential tries each credential source in the order they were given, returning the first with anything to offer
+func (o *copyOptions) credential(host string) (string, string, error) {
+	for _, creds := range o.credentials {
+		u, s, err := creds(host)
+		if err != nil {
+			return "", "", err
+		}
+		if u != "" || s != "" {
+			return u, s, nil
+		}
+	}
+	return "", "", nil
+}
+
+// bearerAuthorizer authorizes every request with a static bearer token
+type bearerAuthorizer string
+
+func (b bearerAuthorizer) Authorize(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(b))
+	return nil
+}
+
+// AddResponses never handles a challenge, there's nothing to exchange a static token for
+func (b bearerAuthorizer) AddResponses(ctx context.Context, responses []*http.Response) error {
+	return errdefs.ErrNotImplemented
+}
@@ -0,0 +1,125 @@
+package store_test
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+	"github.com/rancherfederal/ocil/pkg/transport"
+)
+
+func TestLayout_CopyWithAuth(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); ok && u == "user" && p == "pass" {
+			reg.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") == "Bearer token" {
+			reg.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := "localhost:" + u.Port()
+
+	tcs := []struct {
+		name    string
+		opts    []store.CopyOption
+		wantErr bool
+	}{
+		{name: "basic", opts: []store.CopyOption{store.WithBasicAuth("user", "pass")}},
+		{name: "bearer", opts: []store.CopyOption{store.WithBearerToken("token")}},
+		{name: "keychain", opts: []store.CopyOption{store.WithKeychain(staticKeychain{authn.FromConfig(authn.AuthConfig{Username: "user", Password: "pass"})})}},
+		{name: "wrong password", opts: []store.CopyOption{store.WithBasicAuth("user", "nope")}, wantErr: true},
+		{name: "anonymous", wantErr: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			toRef := fmt.Sprintf("%s/hello/%s:v1", host, strings.ReplaceAll(tc.name, " ", "-"))
+			opts := append(tc.opts, store.WithTransport(transport.WithPlainHTTP()))
+			if _, err := s.Copy(ctx, ref, nil, toRef, opts...); (err != nil) != tc.wantErr {
+				t.Fatalf("Copy() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestLayout_CopyWithTransport(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	// the untrusted case fails handshakes by design
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name    string
+		opts    []transport.Options
+		wantErr bool
+	}{
+		{name: "custom ca", opts: []transport.Options{transport.WithCAFile(ca)}},
+		{name: "insecure", opts: []transport.Options{transport.WithInsecureSkipVerify()}},
+		{name: "untrusted", wantErr: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			toRef := fmt.Sprintf("%s/hello/%s:v1", u.Host, strings.ReplaceAll(tc.name, " ", "-"))
+			if _, err := s.Copy(ctx, ref, nil, toRef, store.WithTransport(tc.opts...)); (err != nil) != tc.wantErr {
+				t.Fatalf("Copy() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+type staticKeychain struct {
+	authn.Authenticator
+}
+
+func (k staticKeychain) Resolve(authn.Resource) (authn.Authenticator, error) {
+	return k.Authenticator, nil
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/encrypt"
+)
+
+type BundleOption func(*bundleOptions)
+
+type bundleOptions struct {
+	digests []digest.Digest
+	indexes []ocispec.Index
+	key     []byte
+}
+
+// WithBaseline leaves the blobs identified by digests, ie: those the destination has already, out of the bundle
+func WithBaseline(digests ...digest.Digest) BundleOption {
+	return func(o *bundleOptions) {
+		o.digests = append(o.digests, digests...)
+	}
+}
+
+// WithBaselineIndex leaves everything reachable from the manifests of idx out of the bundle, ie: with the index.json
+// of the previous bundle shipped to the destination
+// 	Only what the store still has can be followed past the manifests themselves.
+func WithBaselineIndex(idx ocispec.Index) BundleOption {
+	return func(o *bundleOptions) {
+		o.indexes = append(o.indexes, idx)
+	}
+}
+
+// WithBundleKey encrypts the bundle with key, it's then read back through encrypt.NewReader
+// 	Encrypted bundles differ every time, even for the same content.
+func WithBundleKey(key []byte) BundleOption {
+	return func(o *bundleOptions) {
+		o.key = key
+	}
+}
+
+// BundleReport lists what ExportBundle wrote
+type BundleReport struct {
+	References []string
+
+	// Blobs were written to the bundle, Bytes is their total size
+	Blobs []digest.Digest
+	Bytes int64
+
+	// Skipped blobs are in the baseline, and were left out
+	Skipped      []digest.Digest
+	SkippedBytes int64
+}
+
+// ExportBundle writes the store to w as a tar of its oci layout, leaving out the blobs of the baseline so regular
+// updates to a disconnected site only ship what changed
+// 	The bundle always holds the complete index.json, so extracting it over the layout it's based on (ie: the previous
+// 	bundle, extracted) yields a copy of the store.  Without a baseline the bundle is the whole store.  Entries are
+// 	sorted and carry no timestamps or ownership, so the same content always produces the same bundle.
+func (l *Layout) ExportBundle(ctx context.Context, w io.Writer, opts ...BundleOption) (*BundleReport, error) {
+	o := &bundleOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// the index is shipped as it is on disk, and everything else follows from it
+	indexData, err := fs.ReadFile(l.OCI.Driver(), consts.OCIImageIndexFile)
+	if err != nil {
+		return nil, err
+	}
+	var idx ocispec.Index
+	if err := json.Unmarshal(indexData, &idx); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", consts.OCIImageIndexFile, err)
+	}
+
+	baseline := make(map[digest.Digest]bool)
+	for _, d := range o.digests {
+		baseline[d] = true
+	}
+	for _, bidx := range o.indexes {
+		for _, m := range bidx.Manifests {
+			seen := make(map[digest.Digest]ocispec.Descriptor)
+			if err := l.descendants(ctx, m, seen); err != nil {
+				// not ours anymore, the manifest itself is all that's known of it
+				seen = map[digest.Digest]ocispec.Descriptor{m.Digest: m}
+			}
+			for d := range seen {
+				baseline[d] = true
+			}
+		}
+	}
+
+	report := &BundleReport{}
+	needed := make(map[digest.Digest]ocispec.Descriptor)
+	for _, m := range idx.Manifests {
+		report.References = append(report.References, m.Annotations[ocispec.AnnotationRefName])
+		if err := l.descendants(ctx, m, needed); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(report.References)
+
+	included, skipped := make(map[digest.Digest]bool), make(map[digest.Digest]bool)
+	for d, desc := range needed {
+		if baseline[d] {
+			skipped[d] = true
+			report.SkippedBytes += desc.Size
+			continue
+		}
+		included[d] = true
+		report.Bytes += desc.Size
+	}
+	report.Blobs = sortedDigests(included)
+	report.Skipped = sortedDigests(skipped)
+
+	layout, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err != nil {
+		return nil, err
+	}
+
+	var ew io.WriteCloser
+	if o.key != nil {
+		if ew, err = encrypt.NewWriter(w, o.key); err != nil {
+			return nil, err
+		}
+		w = ew
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeTarFile(tw, ocispec.ImageLayoutFile, layout); err != nil {
+		return nil, err
+	}
+	if err := writeTarFile(tw, consts.OCIImageIndexFile, indexData); err != nil {
+		return nil, err
+	}
+
+	dirs := make(map[string]bool)
+	for _, d := range report.Blobs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		for _, dir := range []string{"blobs/", "blobs/" + d.Algorithm().String() + "/"} {
+			if dirs[dir] {
+				continue
+			}
+			dirs[dir] = true
+			if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir, Mode: 0755, ModTime: time.Unix(0, 0)}); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := l.writeTarBlob(ctx, tw, needed[d]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if ew != nil {
+		// seals the last chunk
+		if err := ew.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func (l *Layout) writeTarBlob(ctx context.Context, tw *tar.Writer, desc ocispec.Descriptor) error {
+	rc, err := l.OCI.Fetch(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Join("blobs", desc.Digest.Algorithm().String(), desc.Digest.Hex()),
+		Size:     desc.Size,
+		Mode:     0644,
+		ModTime:  time.Unix(0, 0),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(tw, rc, desc.Size); err != nil {
+		return fmt.Errorf("bundle blob %s: %w", desc.Digest, err)
+	}
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0644,
+		ModTime:  time.Unix(0, 0),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
@@ -0,0 +1,90 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_ExportBundle(t *testing.T) {
+	s := newLayout(t)
+	if _, err := s.AddOCI(ctx, genArtifact(t, ""), "registry.example.com/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var full bytes.Buffer
+	report, err := s.ExportBundle(ctx, &full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Blobs) != 5 || len(report.Skipped) != 0 {
+		t.Fatalf("ExportBundle() without a baseline = %d blobs and %d skipped, want 5 and 0", len(report.Blobs), len(report.Skipped))
+	}
+
+	var again bytes.Buffer
+	if _, err := s.ExportBundle(ctx, &again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(full.Bytes(), again.Bytes()) {
+		t.Error("ExportBundle() of the same content differs between runs")
+	}
+
+	site := t.TempDir()
+	extractBundle(t, &full, site)
+
+	// the next update only carries what's new
+	if _, err := s.AddOCI(ctx, genArtifact(t, ""), "registry.example.com/app:v2"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(site, consts.OCIImageIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var baseline ocispec.Index
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		t.Fatal(err)
+	}
+
+	var delta bytes.Buffer
+	report, err = s.ExportBundle(ctx, &delta, store.WithBaselineIndex(baseline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Blobs) != 5 || len(report.Skipped) != 5 || len(report.References) != 2 {
+		t.Fatalf("ExportBundle() with a baseline = %+v, want 5 blobs, 5 skipped and 2 references", report)
+	}
+
+	byDigest, err := s.ExportBundle(ctx, io.Discard, store.WithBaseline(report.Skipped...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(byDigest.Blobs) != fmt.Sprint(report.Blobs) {
+		t.Errorf("ExportBundle() with the baseline's digests = %v, want %v", byDigest.Blobs, report.Blobs)
+	}
+
+	extractBundle(t, &delta, site)
+	updated, err := store.NewLayout(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(refs(t, updated), ","); got != strings.Join(refs(t, s), ",") {
+		t.Errorf("updated site has %s, want %s", got, strings.Join(refs(t, s), ","))
+	}
+	fsck, err := updated.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fsck.OK() {
+		t.Errorf("updated site is unhealthy: %+v", fsck)
+	}
+}
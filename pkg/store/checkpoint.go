@@ -0,0 +1,103 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// WithCheckpoint journals every reference CopyAll copies to the file at path, so a CopyAll interrupted by a crash
+// or a failed copy picks up where it left off the next time it's run with the same journal
+// 	References the journal has are skipped, unless they've been updated since they were copied.  A journal only
+// 	makes sense for a single destination, and is removed once CopyAll copied everything.  Store it anywhere, the
+// 	store's root included (ie: filepath.Join(l.Root, "copy.journal")).
+func WithCheckpoint(path string) CopyOption {
+	return func(o *copyOptions) {
+		o.checkpoint = path
+	}
+}
+
+// checkpointEntry is a single line of the journal
+type checkpointEntry struct {
+	Reference  string             `json:"reference"`
+	To         string             `json:"to,omitempty"`
+	Source     digest.Digest      `json:"source"`
+	Descriptor ocispec.Descriptor `json:"descriptor"`
+}
+
+type checkpoint struct {
+	path string
+
+	mu   sync.Mutex
+	f    *os.File
+	done map[string]checkpointEntry
+}
+
+// openCheckpoint loads the journal at path, creating it when it doesn't exist yet
+// 	Lines that don't decode are the remains of a write cut short, and are skipped.
+func openCheckpoint(path string) (*checkpoint, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checkpoint{path: path, f: f, done: make(map[string]checkpointEntry)}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e checkpointEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		c.done[e.Reference+" "+e.To] = e
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// lookup returns what copying ref to toRef returned, if it was copied while ref pointed at source
+func (c *checkpoint) lookup(ref string, toRef string, source digest.Digest) (ocispec.Descriptor, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.done[ref+" "+toRef]
+	if !ok || e.Source != source {
+		return ocispec.Descriptor{}, false
+	}
+	return e.Descriptor, true
+}
+
+// record appends e to the journal, only returning once it's on disk
+func (c *checkpoint) record(e checkpointEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	c.done[e.Reference+" "+e.To] = e
+	return c.f.Sync()
+}
+
+func (c *checkpoint) close() error {
+	return c.f.Close()
+}
+
+// remove closes and removes the journal, once there is nothing left to resume
+func (c *checkpoint) remove() error {
+	if err := c.close(); err != nil {
+		return err
+	}
+	return os.Remove(c.path)
+}
@@ -0,0 +1,89 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_CopyAllWithCheckpoint(t *testing.T) {
+	var mu sync.Mutex
+	var copied []string
+	var others sync.WaitGroup
+	record := func(next store.Handler) store.Handler {
+		return func(ctx context.Context, req *store.Request) error {
+			if req.Operation != store.OperationCopy {
+				return next(ctx, req)
+			}
+			mu.Lock()
+			copied = append(copied, req.Reference)
+			mu.Unlock()
+			defer others.Done()
+			return next(ctx, req)
+		}
+	}
+	s := newLayout(t, store.WithMiddleware(record))
+	for _, ref := range []string{"registry.example.com/app:v1", "registry.example.com/app:v2", "registry.example.com/app:v3"} {
+		if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := tempLayout(t)
+	journal := filepath.Join(s.Root, "copy.journal")
+
+	// the process "crashes" on v3, once the others are copied
+	errCrash := errors.New("crash")
+	crashing := func(ref string) (string, error) {
+		if strings.HasSuffix(ref, ":v3") {
+			others.Wait()
+			return "", errCrash
+		}
+		return ref, nil
+	}
+	others.Add(2)
+	if _, err := s.CopyAll(ctx, dst.OCI, crashing, store.WithCheckpoint(journal), store.WithConcurrency(3)); !errors.Is(err, errCrash) {
+		t.Fatalf("CopyAll() = %v, want %v", err, errCrash)
+	}
+	if _, err := os.Stat(journal); err != nil {
+		t.Fatalf("interrupted CopyAll() left no journal: %v", err)
+	}
+
+	// v1 was updated in the meantime
+	if _, err := s.AddOCI(ctx, genArtifact(t, ""), "registry.example.com/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	copied = nil
+	others.Add(2)
+	identity := func(ref string) (string, error) { return ref, nil }
+	descs, err := s.CopyAll(ctx, dst.OCI, identity, store.WithCheckpoint(journal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(copied)
+	if want := "registry.example.com/app:v1,registry.example.com/app:v3"; strings.Join(copied, ",") != want {
+		t.Errorf("resumed CopyAll() copied %v, want %s", copied, want)
+	}
+	if len(descs) != 3 {
+		t.Fatalf("resumed CopyAll() = %d descriptors, want 3", len(descs))
+	}
+	for _, desc := range descs {
+		if desc.Digest == "" {
+			t.Errorf("resumed CopyAll() returned an empty descriptor for a skipped reference")
+		}
+	}
+	if _, err := os.Stat(journal); !os.IsNotExist(err) {
+		t.Errorf("complete CopyAll() left its journal behind: %v", err)
+	}
+	if got, want := strings.Join(refs(t, dst), ","), strings.Join(refs(t, s), ","); got != want {
+		t.Errorf("destination has %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,453 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/reference"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// WithChunkedUpload pushes blobs of at least chunkSize bytes copied to a nil target.Target in chunks of chunkSize,
+// through the registries chunked upload API
+// 	The distribution spec has chunks of an upload sent in order, so rather than sending several at once, up to
+// 	streams chunks are read ahead while the previous one is uploaded.  Registries that refuse chunked uploads are
+// 	pushed the blob in one piece instead, which is also how anything smaller than chunkSize is pushed, and is logged.
+// 	Uploads given up on before they're committed are cancelled at the registry.
+func WithChunkedUpload(chunkSize int64, streams int) CopyOption {
+	return func(o *copyOptions) {
+		o.chunkSize = chunkSize
+		o.chunkStreams = streams
+	}
+}
+
+// chunkedResolver is a remotes.Resolver whose pushers upload large blobs in chunks
+type chunkedResolver struct {
+	remotes.Resolver
+
+	hosts   docker.RegistryHosts
+	size    int64
+	streams int
+	log     logr.Logger
+}
+
+func (r *chunkedResolver) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	p, err := r.Resolver.Pusher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := reference.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := r.hosts(spec.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
+		if host.Capabilities.Has(docker.HostCapabilityPush) {
+			return &chunkedPusher{
+				Pusher:     p,
+				host:       host,
+				spec:       spec,
+				repository: strings.TrimPrefix(spec.Locator, spec.Hostname()+"/"),
+				size:       r.size,
+				streams:    r.streams,
+				log:        r.log,
+			}, nil
+		}
+	}
+	return p, nil
+}
+
+type chunkedPusher struct {
+	remotes.Pusher
+
+	host       docker.RegistryHost
+	spec       reference.Spec
+	repository string
+	size       int64
+	streams    int
+	log        logr.Logger
+}
+
+func (p *chunkedPusher) Push(ctx context.Context, desc ocispec.Descriptor) (ccontent.Writer, error) {
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, consts.DockerManifestSchema2, ocispec.MediaTypeImageIndex, consts.DockerManifestListSchema2:
+		return p.Pusher.Push(ctx, desc)
+	}
+	if desc.Size < p.size || !desc.Digest.Algorithm().Available() {
+		return p.Pusher.Push(ctx, desc)
+	}
+
+	// the registry is asked for a token to push to the repository, as the pusher would, once it challenges a request
+	ctx, err := p.scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := p.url("blobs", desc.Digest.String())
+	resp, err := p.do(ctx, http.MethodHead, blob, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("content %s on remote: %w", desc.Digest, errdefs.ErrAlreadyExists)
+	}
+
+	resp, err = p.do(ctx, http.MethodPost, p.url("blobs", "uploads")+"/", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if resp.StatusCode != http.StatusAccepted || err != nil {
+		// no chunked uploads here, the pusher is left to do as it would
+		p.log.Info("registry refused a chunked upload, pushing the blob in one piece", "digest", desc.Digest, "status", resp.Status)
+		return p.Pusher.Push(ctx, desc)
+	}
+
+	streams := p.streams
+	if streams < 1 {
+		streams = 1
+	}
+	w := &chunkedWriter{
+		ctx:      ctx,
+		pusher:   p,
+		desc:     desc,
+		location: location,
+		digester: desc.Digest.Algorithm().Digester(),
+		chunks:   make(chan []byte, streams),
+		done:     make(chan struct{}),
+		started:  time.Now(),
+	}
+	go w.upload()
+	return w, nil
+}
+
+// scoped is ctx carrying the scope of a push to the repository, for the authorizer to request a token with
+func (p *chunkedPusher) scoped(ctx context.Context) (context.Context, error) {
+	return docker.ContextWithRepositoryScope(ctx, p.spec, true)
+}
+
+func (p *chunkedPusher) url(ps ...string) string {
+	return fmt.Sprintf("%s://%s%s/%s/%s", p.host.Scheme, p.host.Host, p.host.Path, p.repository, strings.Join(ps, "/"))
+}
+
+// do sends a request to the registry, authorizing it and trying again once the registry has challenged it
+func (p *chunkedPusher) do(ctx context.Context, method string, u string, header http.Header, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range p.host.Header {
+			req.Header[k] = v
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.ContentLength = int64(len(body))
+		if p.host.Authorizer != nil {
+			if err := p.host.Authorizer.Authorize(ctx, req); err != nil {
+				return nil, err
+			}
+		}
+
+		client := p.host.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 || p.host.Authorizer == nil {
+			return resp, nil
+		}
+		if err := p.host.Authorizer.AddResponses(ctx, []*http.Response{resp}); err != nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
+
+// chunkedWriter gathers what's written to it into chunks, that are uploaded in order as they fill up
+type chunkedWriter struct {
+	ctx    context.Context
+	pusher *chunkedPusher
+	desc   ocispec.Descriptor
+
+	buf      []byte
+	offset   int64
+	digester digest.Digester
+	started  time.Time
+
+	chunks chan []byte
+	done   chan struct{}
+
+	mu        sync.Mutex
+	location  *url.URL
+	fallback  ccontent.Writer
+	err       error
+	closed    bool
+	committed bool
+	cancelled bool
+}
+
+func (w *chunkedWriter) Write(p []byte) (int, error) {
+	if err := w.failed(); err != nil {
+		return 0, err
+	}
+
+	size := int(w.pusher.size)
+	written := len(p)
+	w.digester.Hash().Write(p)
+	w.offset += int64(len(p))
+	for len(p) > 0 {
+		n := size - len(w.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+
+		if len(w.buf) == size {
+			if err := w.send(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *chunkedWriter) send() error {
+	select {
+	case w.chunks <- w.buf:
+	case <-w.done:
+		return w.failed()
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+	w.buf = make([]byte, 0, w.pusher.size)
+	return nil
+}
+
+func (w *chunkedWriter) failed() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// upload sends every chunk in order, switching to the pusher's own writer for good if the registry refuses the first
+func (w *chunkedWriter) upload() {
+	defer close(w.done)
+
+	var start int64
+	for chunk := range w.chunks {
+		w.mu.Lock()
+		fallback := w.fallback
+		w.mu.Unlock()
+
+		var err error
+		if fallback != nil {
+			_, err = fallback.Write(chunk)
+		} else {
+			err = w.patch(start, chunk)
+		}
+		if err != nil {
+			w.mu.Lock()
+			w.err = err
+			w.mu.Unlock()
+			// drain, so writers aren't left blocked
+			for range w.chunks {
+			}
+			return
+		}
+		start += int64(len(chunk))
+	}
+}
+
+func (w *chunkedWriter) patch(start int64, chunk []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Range", fmt.Sprintf("%d-%d", start, start+int64(len(chunk))-1))
+
+	w.mu.Lock()
+	location := w.location.String()
+	w.mu.Unlock()
+
+	resp, err := w.pusher.do(w.ctx, http.MethodPatch, location, header, chunk)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNoContent {
+		if start != 0 {
+			return fmt.Errorf("upload chunk %d-%d of %s: unexpected status %s", start, start+int64(len(chunk))-1, w.desc.Digest, resp.Status)
+		}
+
+		// the registry doesn't take chunks, drop the session and push the blob in one piece
+		w.pusher.log.Info("registry refused a chunk, pushing the blob in one piece", "digest", w.desc.Digest, "status", resp.Status)
+		if resp, err := w.pusher.do(w.ctx, http.MethodDelete, location, nil, nil); err == nil {
+			resp.Body.Close()
+		}
+		fallback, err := w.pusher.Pusher.Push(w.ctx, w.desc)
+		if err != nil {
+			return err
+		}
+		w.mu.Lock()
+		w.fallback = fallback
+		w.mu.Unlock()
+		_, err = fallback.Write(chunk)
+		return err
+	}
+
+	next, err := resp.Location()
+	if err != nil {
+		return fmt.Errorf("upload chunk of %s: %w", w.desc.Digest, err)
+	}
+	w.mu.Lock()
+	w.location = next
+	w.mu.Unlock()
+	return nil
+}
+
+// finish stops taking chunks, and waits for those already taken to be uploaded
+func (w *chunkedWriter) finish() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.chunks)
+	}
+	w.mu.Unlock()
+	<-w.done
+}
+
+// Close cancels the upload at the registry unless it was committed, so the registry isn't left holding the session
+func (w *chunkedWriter) Close() error {
+	w.finish()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed || w.cancelled {
+		return nil
+	}
+	w.cancelled = true
+	if w.fallback != nil {
+		return w.fallback.Close()
+	}
+
+	// the upload may be given up on because its context is done, which mustn't stop it being cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+	ctx, err := w.pusher.scoped(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := w.pusher.do(ctx, http.MethodDelete, w.location.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("cancel upload of %s: unexpected status %s", w.desc.Digest, resp.Status)
+	}
+	return nil
+}
+
+// cancelTimeout bounds how long cancelling an upload at the registry may take
+const cancelTimeout = 30 * time.Second
+
+func (w *chunkedWriter) Digest() digest.Digest {
+	return w.digester.Digest()
+}
+
+func (w *chunkedWriter) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...ccontent.Opt) error {
+	if len(w.buf) > 0 {
+		if err := w.send(); err != nil {
+			return err
+		}
+	}
+	w.finish()
+	if err := w.failed(); err != nil {
+		return err
+	}
+
+	if size > 0 && size != w.offset {
+		return fmt.Errorf("unexpected commit size %d, expected %d: %w", w.offset, size, errdefs.ErrFailedPrecondition)
+	}
+	if expected != "" && expected != w.Digest() {
+		return fmt.Errorf("unexpected commit digest %s, expected %s: %w", w.Digest(), expected, ErrDigestMismatch)
+	}
+
+	if w.fallback != nil {
+		if err := w.fallback.Commit(ctx, size, expected, opts...); err != nil {
+			return err
+		}
+		w.commit()
+		return nil
+	}
+
+	ctx, err := w.pusher.scoped(ctx)
+	if err != nil {
+		return err
+	}
+	u := *w.location
+	q := u.Query()
+	q.Set("digest", w.Digest().String())
+	u.RawQuery = q.Encode()
+	resp, err := w.pusher.do(ctx, http.MethodPut, u.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("complete upload of %s: unexpected status %s", w.desc.Digest, resp.Status)
+	}
+	w.commit()
+	return nil
+}
+
+func (w *chunkedWriter) commit() {
+	w.mu.Lock()
+	w.committed = true
+	w.mu.Unlock()
+}
+
+func (w *chunkedWriter) Status() (ccontent.Status, error) {
+	return ccontent.Status{
+		Ref:       w.desc.Digest.String(),
+		Offset:    w.offset,
+		Total:     w.desc.Size,
+		StartedAt: w.started,
+		UpdatedAt: time.Now(),
+	}, nil
+}
+
+func (w *chunkedWriter) Truncate(size int64) error {
+	if size != 0 || w.offset != 0 {
+		return fmt.Errorf("chunked uploads can't be truncated: %w", errdefs.ErrNotImplemented)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package store_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+	"github.com/rancherfederal/ocil/pkg/transport"
+)
+
+func TestLayout_CopyWithChunkedUpload(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	logger := funcr.New(func(prefix, args string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, args)
+	}, funcr.Options{})
+
+	s := newLayout(t, store.WithLogger(logger))
+
+	img, err := random.Image(256*1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, img, "chunked:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name         string
+		chunkSize    int64
+		refuse       bool
+		abandon      bool
+		wantPatches  bool
+		wantDeletes  bool
+		wantFallback bool
+	}{
+		{name: "chunked", chunkSize: 64 * 1024, wantPatches: true},
+		{name: "refused", chunkSize: 64 * 1024, refuse: true, wantDeletes: true, wantFallback: true},
+		{name: "abandoned", chunkSize: 64 * 1024, abandon: true, wantPatches: true, wantDeletes: true},
+		{name: "small blobs", chunkSize: 1024 * 1024},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			lines = nil
+			patches, deletes := 0, 0
+			mu.Unlock()
+
+			// the registry challenges every request without a token, only granting one to push with the push scope, and
+			// leaves the scope out of its challenges as registries may
+			reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+			var srv *httptest.Server
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/token" {
+					token := "pull"
+					for _, scope := range r.URL.Query()["scope"] {
+						if strings.HasSuffix(scope, "push") {
+							token = "push"
+						}
+					}
+					json.NewEncoder(w).Encode(map[string]string{"token": token})
+					return
+				}
+
+				want := "Bearer pull"
+				if r.Method != http.MethodGet && r.Method != http.MethodHead {
+					want = "Bearer push"
+				}
+				if got := r.Header.Get("Authorization"); got != want && got != "Bearer push" {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				switch {
+				case r.Method == http.MethodPatch && tc.refuse:
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				case r.Method == http.MethodPatch:
+					mu.Lock()
+					patches++
+					mu.Unlock()
+				case r.Method == http.MethodDelete:
+					mu.Lock()
+					deletes++
+					mu.Unlock()
+				case r.Method == http.MethodPut && tc.abandon && r.URL.Query().Get("digest") != "" && r.ContentLength == 0:
+					// complete monolithic uploads, but fail those of chunks
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				reg.ServeHTTP(w, r)
+			}))
+			defer srv.Close()
+
+			u, err := url.Parse(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			toRef := u.Host + "/chunked:v1"
+			_, err = s.Copy(ctx, "chunked:v1", nil, toRef, store.WithChunkedUpload(tc.chunkSize, 2), store.WithTransport(transport.WithPlainHTTP()))
+			if tc.abandon {
+				if err == nil {
+					t.Fatal("Copy() succeeded, want the failed upload to fail it")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if (patches > 0) != tc.wantPatches {
+				t.Errorf("Copy() sent %d chunks, want chunks %v", patches, tc.wantPatches)
+			}
+			if (deletes > 0) != tc.wantDeletes {
+				t.Errorf("Copy() cancelled %d uploads, want cancelled %v", deletes, tc.wantDeletes)
+			}
+			fellBack := false
+			for _, line := range lines {
+				if strings.Contains(line, "pushing the blob in one piece") {
+					fellBack = true
+				}
+			}
+			if fellBack != tc.wantFallback {
+				t.Errorf("Copy() logged falling back to pushing in one piece %v, want %v", fellBack, tc.wantFallback)
+			}
+			if tc.abandon {
+				return
+			}
+
+			pushedRef, err := name.ParseReference(toRef, name.Insecure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pushed, err := remote.Image(pushedRef, remote.WithAuth(&authn.Bearer{Token: "pull"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validate.Image(pushed); err != nil {
+				t.Errorf("pushed image is invalid: %v", err)
+			}
+		})
+	}
+}
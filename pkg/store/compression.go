@@ -0,0 +1,171 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// LayerCompression describes how efficiently a single layer is compressed
+type LayerCompression struct {
+	Digest           digest.Digest
+	MediaType        string
+	Algorithm        string
+	CompressedSize   int64
+	UncompressedSize int64
+
+	// ZstdSize is the size of the layer once recompressed with zstd at the default level
+	ZstdSize int64
+}
+
+// Ratio is the uncompressed size over the compressed size
+func (c LayerCompression) Ratio() float64 {
+	if c.CompressedSize == 0 {
+		return 0
+	}
+	return float64(c.UncompressedSize) / float64(c.CompressedSize)
+}
+
+// ZstdSavings is the number of bytes saved by transcoding the layer to zstd, negative values mean the layer would grow
+func (c LayerCompression) ZstdSavings() int64 {
+	return c.CompressedSize - c.ZstdSize
+}
+
+// CompressionReport is the per-layer compression analysis of a reference
+type CompressionReport struct {
+	Reference string
+	Layers    []LayerCompression
+}
+
+// CompressedSize is the total compressed size of every layer in the report
+func (r CompressionReport) CompressedSize() int64 {
+	var total int64
+	for _, l := range r.Layers {
+		total += l.CompressedSize
+	}
+	return total
+}
+
+// ZstdSavings is the total number of bytes saved by transcoding every layer in the report to zstd
+func (r CompressionReport) ZstdSavings() int64 {
+	var total int64
+	for _, l := range r.Layers {
+		total += l.ZstdSavings()
+	}
+	return total
+}
+
+// CompressionReport analyzes every layer of ref, reporting its compression algorithm, compressed and uncompressed
+// sizes, and the estimated size once transcoded to zstd
+// 	The estimate is produced by actually recompressing each layer, so expect this to be about as expensive as a transcode
+func (l *Layout) CompressionReport(ctx context.Context, ref string) (*CompressionReport, error) {
+	desc, err := l.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	layers, err := l.layers(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CompressionReport{Reference: ref}
+	seen := make(map[digest.Digest]bool)
+	for _, ld := range layers {
+		if seen[ld.Digest] {
+			continue
+		}
+		seen[ld.Digest] = true
+
+		rc, err := l.OCI.Fetch(ctx, ld)
+		if err != nil {
+			return nil, err
+		}
+		lc, err := analyzeCompression(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("analyze layer %s: %w", ld.Digest, err)
+		}
+
+		lc.Digest = ld.Digest
+		lc.MediaType = ld.MediaType
+		lc.CompressedSize = ld.Size
+		report.Layers = append(report.Layers, lc)
+	}
+	return report, nil
+}
+
+func analyzeCompression(r io.Reader) (LayerCompression, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return LayerCompression{}, err
+	}
+
+	lc := LayerCompression{Algorithm: CompressionNone}
+	var uncompressed io.Reader = br
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		lc.Algorithm = CompressionGzip
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return LayerCompression{}, err
+		}
+		defer zr.Close()
+		uncompressed = zr
+
+	case bytes.HasPrefix(magic, zstdMagic):
+		lc.Algorithm = CompressionZstd
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return LayerCompression{}, err
+		}
+		defer zr.Close()
+		uncompressed = zr
+	}
+
+	zc := &countingWriter{}
+	zw, err := zstd.NewWriter(zc)
+	if err != nil {
+		return LayerCompression{}, err
+	}
+
+	n, err := io.Copy(zw, uncompressed)
+	if err != nil {
+		zw.Close()
+		return LayerCompression{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return LayerCompression{}, err
+	}
+
+	lc.UncompressedSize = n
+	lc.ZstdSize = zc.n
+	return lc, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,33 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_CompressionReport(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.CompressionReport(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Layers) != 3 {
+		t.Fatalf("CompressionReport() returned %d layers, want 3", len(report.Layers))
+	}
+	for _, l := range report.Layers {
+		if l.Algorithm != store.CompressionGzip {
+			t.Errorf("layer %s algorithm = %s, want %s", l.Digest, l.Algorithm, store.CompressionGzip)
+		}
+		if l.UncompressedSize == 0 || l.ZstdSize == 0 {
+			t.Errorf("layer %s has unmeasured sizes: %+v", l.Digest, l)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package store
+
+import (
+	"context"
+	"io"
+)
+
+// contextReader fails reads once ctx is done, so copies out of sources that don't watch ctx themselves (ie: layers
+// being built on the fly) can still be aborted between chunks
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
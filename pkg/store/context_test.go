@@ -0,0 +1,94 @@
+package store_test
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_ContextCancellation(t *testing.T) {
+	s := newLayout(t)
+
+	data := make([]byte, 1<<20)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	blob := &cancelingLayer{Layer: static.NewLayer(data, types.OCILayer), cancel: cancel}
+	img, err := mutate.AppendLayers(empty.Image, blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the transfer is aborted partway through the layer, which is left out of the store
+	ref := "registry.example.com/app:v1"
+	if _, err := s.AddOCI(cctx, &mockArtifact{img}, ref); !errors.Is(err, context.Canceled) {
+		t.Fatalf("AddOCI() error = %v, want context.Canceled", err)
+	}
+	d, err := blob.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Fetch(ctx, ocispec.Descriptor{Digest: digest.Digest(d.String())}); !errors.Is(err, store.ErrBlobNotFound) {
+		t.Errorf("Fetch() of the aborted layer error = %v, want ErrBlobNotFound", err)
+	}
+
+	desc, err := s.AddOCI(ctx, &mockArtifact{img}, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, cancel := context.WithCancel(ctx)
+	cancel()
+	rc, err := s.Fetch(done, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadAll(rc); !errors.Is(err, context.Canceled) {
+		t.Errorf("read of a blob fetched with a cancelled context error = %v, want context.Canceled", err)
+	}
+	dst := tempLayout(t)
+	if _, err := s.Copy(done, ref, dst.OCI, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("Copy() with a cancelled context error = %v, want context.Canceled", err)
+	}
+}
+
+// cancelingLayer cancels its context once the first chunk of it has been read
+type cancelingLayer struct {
+	v1.Layer
+	cancel context.CancelFunc
+}
+
+func (l *cancelingLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	return &cancelingReader{ReadCloser: rc, cancel: l.cancel}, nil
+}
+
+type cancelingReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.cancel()
+	return n, err
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// addOriginal attaches what oci, added to the store as ref and desc, was converted from, if it kept it
+// 	ie: the docker schema1 manifest of images pulled with image.WithSchema1Original, stored under the
+// 	"<alg>-<hex>.schema1" tag of the converted manifest.
+func (l *Layout) addOriginal(ctx context.Context, oci artifacts.OCI, ref string, desc ocispec.Descriptor) error {
+	converted, ok := oci.(artifacts.Converted)
+	if !ok {
+		return nil
+	}
+
+	orig, err := converted.Original()
+	if err != nil {
+		return fmt.Errorf("original of %s: %w", ref, err)
+	}
+	if orig == nil {
+		return nil
+	}
+
+	gd, err := fromOCIDescriptor(ocispec.Descriptor{MediaType: desc.MediaType, Digest: desc.Digest, Size: desc.Size})
+	if err != nil {
+		return err
+	}
+	_, err = l.addOCI(ctx, &referrer{OCI: orig, subject: &gd}, originalReference(ref, desc.Digest))
+	return err
+}
+
+// originalReference is the reference the original of the converted manifest d in ref's repository is stored under
+func originalReference(ref string, d digest.Digest) string {
+	return fmt.Sprintf("%s:%s-%s.%s", repository(ref), d.Algorithm(), d.Hex(), consts.Schema1Suffix)
+}
@@ -0,0 +1,49 @@
+package store_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+)
+
+func TestLayout_AddOCIConverted(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/legacy:v1"
+	oci := &convertedArtifact{OCI: genArtifact(t, ref), orig: genArtifact(t, "schema1")}
+	desc, err := s.AddOCI(ctx, oci, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origRef := fmt.Sprintf("hello/legacy:%s-%s.schema1", desc.Digest.Algorithm(), desc.Digest.Hex())
+	if _, _, err := s.Resolve(ctx, origRef); err != nil {
+		t.Fatal(err)
+	}
+	referrers, err := s.Referrers(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 {
+		t.Errorf("Referrers() = %v, want the original manifest", referrers)
+	}
+
+	unkept := &convertedArtifact{OCI: genArtifact(t, "hello/other:v1")}
+	if _, err := s.AddOCI(ctx, unkept, "hello/other:v1"); err != nil {
+		t.Fatal(err)
+	}
+	// the original of the first is also recorded in the referrers tag fallback index of the converted manifest
+	if refs := refs(t, s); len(refs) != 4 {
+		t.Errorf("store references = %v, want both artifacts, one original and its referrers index", refs)
+	}
+}
+
+type convertedArtifact struct {
+	artifacts.OCI
+	orig artifacts.OCI
+}
+
+func (c *convertedArtifact) Original() (artifacts.OCI, error) {
+	return c.orig, nil
+}
@@ -0,0 +1,302 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	encconfig "github.com/containers/ocicrypt/config"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/target"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/content"
+	"github.com/rancherfederal/ocil/pkg/transport"
+)
+
+type CopyOption func(*copyOptions)
+
+type copyOptions struct {
+	platforms   []string
+	concurrency int64
+	attachments bool
+	attached    attachmentMap
+	filters     []Filter
+	pin         bool
+	decryption  *encconfig.DecryptConfig
+	checkpoint  string
+
+	transferLimit int64
+	chunkSize     int64
+	chunkStreams  int
+
+	retries int
+	backoff time.Duration
+
+	resolver    remotes.Resolver
+	credentials []credentialFunc
+	token       string
+	transport   []transport.Options
+}
+
+// WithPlatforms restricts copies of image indexes to the manifests matching at least one of the given platforms
+// (ie: linux/amd64, linux/arm64/v8)
+// 	Unmatched manifests are stripped from the copied index and their blobs are never transferred, which means the
+// 	copied index will have a different digest than the one in the store
+func WithPlatforms(platforms ...string) CopyOption {
+	return func(o *copyOptions) {
+		o.platforms = append(o.platforms, platforms...)
+	}
+}
+
+// WithConcurrency sets how many references CopyAll copies at once, the default being one at a time
+// 	Concurrent copies still share the Layouts connection limit, if one is set with WithMaxConcurrentConnections
+func WithConcurrency(n int64) CopyOption {
+	return func(o *copyOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithAttachments brings every artifact attached to a copied reference along with it (signatures, sboms, ...), tagged
+// the same in the destination repository
+func WithAttachments() CopyOption {
+	return func(o *copyOptions) {
+		o.attachments = true
+	}
+}
+
+// withAttachmentMap has copies find the attachments they bring along in m, rather than in a walk of the stores index
+// of their own
+func withAttachmentMap(m attachmentMap) CopyOption {
+	return func(o *copyOptions) {
+		o.attached = m
+	}
+}
+
+// WithFilter restricts CopyAll to the references matching every one of filters
+func WithFilter(filters ...Filter) CopyOption {
+	return func(o *copyOptions) {
+		o.filters = append(o.filters, filters...)
+	}
+}
+
+// WithDigestPin copies references to their digest rather than their tag (ie: repo:v1 to repo@sha256:...), so bundles
+// built from a store are reproducible no matter what the tags point at later on
+// 	The digest is that of what is actually copied, which differs from the stored one with WithPlatforms.  Attachments
+// 	keep their tags, that being how they're found.
+func WithDigestPin() CopyOption {
+	return func(o *copyOptions) {
+		o.pin = true
+	}
+}
+
+func makeCopyOptions(opts ...CopyOption) *copyOptions {
+	o := &copyOptions{concurrency: 1}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// source returns the target.Target ref should be copied from given the copy options
+func (l *Layout) source(ctx context.Context, ref string, o *copyOptions) (target.Target, error) {
+	from, err := l.filtered(ctx, ref, o)
+	if err != nil || o.decryption == nil {
+		return from, err
+	}
+	return decrypted(ctx, from, ref, o.decryption)
+}
+
+// filtered returns the target.Target serving ref with only the manifests matching the copy options platforms
+func (l *Layout) filtered(ctx context.Context, ref string, o *copyOptions) (target.Target, error) {
+	if len(o.platforms) == 0 {
+		return l.OCI, nil
+	}
+
+	desc, err := l.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, consts.DockerManifestListSchema2:
+	default:
+		// there is nothing to filter in a single manifest
+		return l.OCI, nil
+	}
+
+	var specs []ocispec.Platform
+	for _, p := range o.platforms {
+		spec, err := platforms.Parse(p)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+
+	f := &filteredIndex{OCI: l.OCI, ref: ref, indexes: make(map[digest.Digest][]byte)}
+	fdesc, ok, err := l.filterIndex(ctx, desc, platforms.Any(specs...), f.indexes)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no manifests in %s match platforms %v", ref, o.platforms)
+	}
+	f.desc = fdesc
+	return f, nil
+}
+
+// filterIndex strips the manifests not matching matcher from the index desc and the indexes nested in it, reporting
+// whether any are left
+// 	Indexes are edited as they're stored, so whatever else they hold is kept as is.  Those left unchanged keep their
+// 	digest, the others are added to filtered and returned with the digest and size of their filtered content.
+func (l *Layout) filterIndex(ctx context.Context, desc ocispec.Descriptor, matcher platforms.Matcher, filtered map[digest.Digest][]byte) (ocispec.Descriptor, bool, error) {
+	data, err := l.readBlob(ctx, desc)
+	if err != nil {
+		return ocispec.Descriptor{}, false, err
+	}
+	var idx map[string]json.RawMessage
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return ocispec.Descriptor{}, false, fmt.Errorf("parse index %s: %w", desc.Digest, err)
+	}
+	var manifests []json.RawMessage
+	if err := json.Unmarshal(idx["manifests"], &manifests); err != nil {
+		return ocispec.Descriptor{}, false, fmt.Errorf("parse index %s: %w", desc.Digest, err)
+	}
+
+	var matched []json.RawMessage
+	changed := false
+	for _, raw := range manifests {
+		var m ocispec.Descriptor
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return ocispec.Descriptor{}, false, fmt.Errorf("parse index %s: %w", desc.Digest, err)
+		}
+		if m.Platform != nil && !matcher.Match(*m.Platform) {
+			continue
+		}
+
+		switch m.MediaType {
+		case ocispec.MediaTypeImageIndex, consts.DockerManifestListSchema2:
+			nested, ok, err := l.filterIndex(ctx, m, matcher, filtered)
+			if err != nil {
+				return ocispec.Descriptor{}, false, err
+			}
+			if !ok {
+				continue
+			}
+			if nested.Digest != m.Digest {
+				changed = true
+				if raw, err = setJSON(raw, map[string]interface{}{"digest": nested.Digest, "size": nested.Size}); err != nil {
+					return ocispec.Descriptor{}, false, err
+				}
+			}
+		default:
+			if m.Platform == nil {
+				continue
+			}
+		}
+		matched = append(matched, raw)
+	}
+	if len(matched) == 0 {
+		return desc, false, nil
+	}
+	if !changed && len(matched) == len(manifests) {
+		return desc, true, nil
+	}
+
+	if data, err = setJSON(data, map[string]interface{}{"manifests": matched}); err != nil {
+		return ocispec.Descriptor{}, false, err
+	}
+	fdesc := desc
+	fdesc.Digest = digest.FromBytes(data)
+	fdesc.Size = int64(len(data))
+	filtered[fdesc.Digest] = data
+	return fdesc, true, nil
+}
+
+// setJSON sets fields of the json object data, leaving the others as they are
+func setJSON(data []byte, fields map[string]interface{}) ([]byte, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		obj[k] = raw
+	}
+	return json.Marshal(obj)
+}
+
+// pinned returns toRef, or ref if it's empty, pinned to the digest of what copying ref copies
+func (l *Layout) pinned(ctx context.Context, ref string, toRef string, o *copyOptions) (string, error) {
+	from, err := l.source(ctx, ref, o)
+	if err != nil {
+		return "", err
+	}
+	_, desc, err := from.Resolve(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	if toRef == "" {
+		toRef = ref
+	}
+	return repository(toRef) + "@" + desc.Digest.String(), nil
+}
+
+// digestTarget is a target.Target pushed to references that already carry a digest
+// 	Copies tell pushers the root digest by appending it to the reference, which leaves repo@<digest>@<digest>
+// 	behind that registries can't parse.  Layouts are left to take it as is, the reference they index being everything
+// 	before the last digest.
+type digestTarget struct {
+	target.Target
+}
+
+func (t *digestTarget) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	if i := strings.LastIndex(ref, "@"); i != -1 && strings.Contains(ref[:i], "@") {
+		ref = ref[:i]
+	}
+	return t.Target.Pusher(ctx, ref)
+}
+
+// filteredIndex is a target.Target serving a filtered copy of an index in place of the stored one, along with the
+// filtered copies of the indexes nested in it
+type filteredIndex struct {
+	*content.OCI
+
+	ref     string
+	desc    ocispec.Descriptor
+	indexes map[digest.Digest][]byte
+}
+
+func (f *filteredIndex) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	if ref == f.ref {
+		return ref, f.desc, nil
+	}
+	return f.OCI.Resolve(ctx, ref)
+}
+
+func (f *filteredIndex) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	if _, err := f.OCI.Fetcher(ctx, ref); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *filteredIndex) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	if data, ok := f.indexes[desc.Digest]; ok {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return f.OCI.Fetch(ctx, desc)
+}
@@ -0,0 +1,317 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/sbom"
+	"github.com/rancherfederal/ocil/pkg/store"
+	"github.com/rancherfederal/ocil/pkg/transport"
+)
+
+func TestLayout_CopyWithPlatforms(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/multiarch:v1"
+	if _, err := s.AddImageIndex(ctx, genIndex(t, "linux/amd64", "linux/arm64"), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := tempLayout(t)
+	desc, err := s.Copy(ctx, ref, dst.OCI, "", store.WithPlatforms("linux/arm64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := dst.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var idx ocispec.Index
+	if err := json.NewDecoder(rc).Decode(&idx); err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Manifests) != 1 || idx.Manifests[0].Platform.Architecture != "arm64" {
+		t.Errorf("copied index manifests = %+v, want only linux/arm64", idx.Manifests)
+	}
+
+	// the index, and the manifest, config and layer of linux/arm64
+	report, err := dst.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Checked != 4 {
+		t.Errorf("unexpected blobs copied: %+v", report)
+	}
+
+	t.Run("should filter nested indexes and keep what it doesn't know of", func(t *testing.T) {
+		ref := "hello/nested:v1"
+		idx := mutate.AppendManifests(empty.Index,
+			mutate.IndexAddendum{Add: genIndex(t, "linux/amd64", "linux/arm64")},
+			mutate.IndexAddendum{Add: genPlatformImage(t, "linux", "amd64"), Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}},
+		)
+		stored, err := s.AddImageIndex(ctx, &extraFieldIndex{index: idx}, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dst := tempLayout(t)
+		desc, err := s.Copy(ctx, ref, dst.OCI, "", store.WithPlatforms("linux/arm64"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var root struct {
+			ocispec.Index
+			Extra string `json:"extra"`
+		}
+		fetchJSON(t, dst, desc, &root)
+		if root.Extra != "kept" {
+			t.Errorf("copied index lost its extra field: %+v", root)
+		}
+		if len(root.Manifests) != 1 || root.Manifests[0].MediaType != ocispec.MediaTypeImageIndex {
+			t.Fatalf("copied index manifests = %+v, want only the nested index", root.Manifests)
+		}
+		var nested ocispec.Index
+		fetchJSON(t, dst, root.Manifests[0], &nested)
+		if len(nested.Manifests) != 1 || nested.Manifests[0].Platform.Architecture != "arm64" {
+			t.Errorf("copied nested index manifests = %+v, want only linux/arm64", nested.Manifests)
+		}
+
+		// nothing is stripped when every platform is copied, so neither is the index changed
+		desc, err = s.Copy(ctx, ref, dst.OCI, "", store.WithPlatforms("linux/amd64", "linux/arm64"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if desc.Digest != stored.Digest {
+			t.Errorf("copied index digest = %s, want the stored %s", desc.Digest, stored.Digest)
+		}
+	})
+}
+
+// extraFieldIndex is an index with a field image-spec doesn't define
+type extraFieldIndex struct {
+	index
+}
+
+func (i *extraFieldIndex) RawManifest() ([]byte, error) {
+	raw, err := i.index.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	return append(bytes.TrimSuffix(bytes.TrimSpace(raw), []byte("}")), []byte(`,"extra":"kept"}`)...), nil
+}
+
+func (i *extraFieldIndex) Digest() (v1.Hash, error) {
+	raw, err := i.RawManifest()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	h, _, err := v1.SHA256(bytes.NewReader(raw))
+	return h, err
+}
+
+func fetchJSON(t *testing.T, s *store.Layout, desc ocispec.Descriptor, v interface{}) {
+	t.Helper()
+	rc, err := s.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLayout_CopyAllWithConcurrency(t *testing.T) {
+	s := newLayout(t)
+
+	for i := 0; i < 5; i++ {
+		ref := fmt.Sprintf("hello/world:v%d", i)
+		if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := tempLayout(t)
+	descs, err := s.CopyAll(ctx, dst.OCI, nil, store.WithConcurrency(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descs) != 5 {
+		t.Fatalf("CopyAll() returned %d descriptors, want 5", len(descs))
+	}
+
+	copied := 0
+	if err := dst.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		copied++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if copied != 5 {
+		t.Errorf("CopyAll() copied %d references, want 5", copied)
+	}
+
+	report, err := dst.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("copied store is unhealthy: %+v", report)
+	}
+
+	boom := errors.New("boom")
+	if _, err := s.CopyAll(ctx, dst.OCI, func(string) (string, error) { return "", boom }, store.WithConcurrency(3)); !errors.Is(err, boom) {
+		t.Errorf("CopyAll() error = %v, want %v", err, boom)
+	}
+}
+
+func TestLayout_CopyAllWithAttachments(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := sbom.NewSBOM([]byte(`{"spdxVersion": "SPDX-2.3", "name": "hello/world"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddSBOM(ctx, doc, ref); err != nil {
+		t.Fatal(err)
+	}
+
+	var copied []string
+	defer s.Subscribe(func(e store.Event) {
+		if e.Type == store.EventCopied {
+			copied = append(copied, e.Reference)
+		}
+	})()
+
+	dst := tempLayout(t)
+	descs, err := s.CopyAll(ctx, dst.OCI, func(reference string) (string, error) {
+		return strings.Replace(reference, "hello/", "mirror/", 1), nil
+	}, store.WithAttachments())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the sbom and its referrers tag are copied along with the image, not once more on their own
+	if strings.Join(copied, ",") != ref {
+		t.Errorf("CopyAll() copied %v, want [%s]", copied, ref)
+	}
+	want := refs(t, s)
+	if len(descs) != len(want) {
+		t.Errorf("CopyAll() returned %d descriptors, want %d", len(descs), len(want))
+	}
+	for i := range want {
+		want[i] = strings.Replace(want[i], "hello/", "mirror/", 1)
+	}
+	if got := refs(t, dst); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("copied references = %v, want %v", got, want)
+	}
+}
+
+func TestLayout_CopyWithDigestPin(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "registry.example.com/app:v1"
+	desc, err := s.AddOCI(ctx, genArtifact(t, "app:v1"), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := "registry.example.com/app@" + desc.Digest.String()
+
+	t.Run("layout", func(t *testing.T) {
+		dst := tempLayout(t)
+		if _, err := s.Copy(ctx, ref, dst.OCI, "", store.WithDigestPin()); err != nil {
+			t.Fatal(err)
+		}
+		if got := refs(t, dst); strings.Join(got, ",") != pinned {
+			t.Errorf("Copy() copied to %v, want %s", got, pinned)
+		}
+	})
+
+	t.Run("registry", func(t *testing.T) {
+		srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+		defer srv.Close()
+
+		u, err := url.Parse(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		toRef := u.Host + "/app:v1"
+		if _, err := s.Copy(ctx, ref, nil, toRef, store.WithDigestPin(), store.WithTransport(transport.WithPlainHTTP())); err != nil {
+			t.Fatal(err)
+		}
+
+		// pushed by digest only, the tag was never created
+		for path, want := range map[string]int{
+			"/v2/app/manifests/" + desc.Digest.String(): http.StatusOK,
+			"/v2/app/manifests/v1":                      http.StatusNotFound,
+		} {
+			resp, err := http.Head(srv.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != want {
+				t.Errorf("HEAD %s = %d, want %d", path, resp.StatusCode, want)
+			}
+		}
+	})
+}
+
+func TestLayout_CopyAttachment(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "registry.example.com/app:v1"
+	desc, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := sbom.NewSBOM([]byte(`{"spdxVersion": "SPDX-2.3", "name": "app"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddSBOM(ctx, doc, ref); err != nil {
+		t.Fatal(err)
+	}
+	sbomRef := fmt.Sprintf("registry.example.com/app:%s-%s.sbom", desc.Digest.Algorithm(), desc.Digest.Hex())
+
+	dst := tempLayout(t)
+	if _, err := s.Copy(ctx, sbomRef, dst.OCI, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// the subject of a manifest isn't part of what's copied with it
+	if got := refs(t, dst); strings.Join(got, ",") != sbomRef {
+		t.Errorf("Copy() copied %v, want [%s]", got, sbomRef)
+	}
+	rc, err := dst.Fetch(ctx, desc)
+	if err == nil {
+		rc.Close()
+	}
+	if !errors.Is(err, store.ErrBlobNotFound) {
+		t.Errorf("Fetch() of the subject of the copied sbom error = %v, want ErrBlobNotFound", err)
+	}
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// CopyToDaemon loads the image stored under ref into a running docker daemon, tagged as ref
+// 	This is the equivalent of a `docker load` on a docker-archive of the image, without ever writing the archive to
+// 	disk: it's streamed to the /images/load API as it's written.  The daemon answers a load it fails with a message
+// 	rather than an error status, so that message is returned as the error.
+func (l *Layout) CopyToDaemon(ctx context.Context, ref string, opts ...daemon.Option) (string, error) {
+	tag, err := gname.NewTag(ref)
+	if err != nil {
+		return "", err
+	}
+
+	img, err := l.Image(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	opts = append([]daemon.Option{daemon.WithContext(ctx)}, opts...)
+	response, err := daemon.Write(tag, img, opts...)
+	if err != nil {
+		return response, err
+	}
+	return response, loadError(response)
+}
+
+// LoadToDaemon loads the image stored under ref into a running docker daemon, tagged as ref
+//
+// Deprecated: use CopyToDaemon, which this is the same as.
+func (l *Layout) LoadToDaemon(ctx context.Context, ref string, opts ...daemon.Option) (string, error) {
+	return l.CopyToDaemon(ctx, ref, opts...)
+}
+
+// loadError returns the error reported by the stream of json messages the daemon answered a load with, if any
+func loadError(response string) error {
+	dec := json.NewDecoder(strings.NewReader(response))
+	for {
+		var msg struct {
+			Error       string `json:"error"`
+			ErrorDetail struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			// a response that isn't a stream of messages (ie: of an older api) has nothing more to tell
+			return nil
+		}
+		if msg.ErrorDetail.Message != "" {
+			return fmt.Errorf("daemon load: %s", msg.ErrorDetail.Message)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("daemon load: %s", msg.Error)
+		}
+	}
+}
+
+// Image returns the stored image identified by ref as a v1.Image, reading its blobs from the store as they're needed
+func (l *Layout) Image(ctx context.Context, ref string) (gv1.Image, error) {
+	desc, err := l.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, consts.DockerManifestSchema2:
+	default:
+		return nil, fmt.Errorf("reference %s is not an image manifest: %s", ref, desc.MediaType)
+	}
+
+	raw, err := l.readBlob(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	m, err := gv1.ParseManifest(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	return partial.CompressedToImage(&storedImage{l: l, ctx: ctx, raw: raw, manifest: m})
+}
+
+// storedImage is an image manifest of the store as a v1.Image
+type storedImage struct {
+	l        *Layout
+	ctx      context.Context
+	raw      []byte
+	manifest *gv1.Manifest
+}
+
+func (i *storedImage) MediaType() (types.MediaType, error) {
+	return i.manifest.MediaType, nil
+}
+
+func (i *storedImage) RawManifest() ([]byte, error) {
+	return i.raw, nil
+}
+
+func (i *storedImage) RawConfigFile() ([]byte, error) {
+	return i.l.readBlob(i.ctx, toOCIDescriptor(i.manifest.Config))
+}
+
+func (i *storedImage) LayerByDigest(h gv1.Hash) (partial.CompressedLayer, error) {
+	for _, d := range i.manifest.Layers {
+		if d.Digest == h {
+			return &storedLayer{l: i.l, ctx: i.ctx, desc: d}, nil
+		}
+	}
+	return nil, fmt.Errorf("layer %s: %w", h, ErrBlobNotFound)
+}
+
+// storedLayer is a layer blob of the store
+type storedLayer struct {
+	l    *Layout
+	ctx  context.Context
+	desc gv1.Descriptor
+}
+
+func (s *storedLayer) Digest() (gv1.Hash, error) {
+	return s.desc.Digest, nil
+}
+
+func (s *storedLayer) Size() (int64, error) {
+	return s.desc.Size, nil
+}
+
+func (s *storedLayer) MediaType() (types.MediaType, error) {
+	return s.desc.MediaType, nil
+}
+
+func (s *storedLayer) Compressed() (io.ReadCloser, error) {
+	return s.l.Fetch(s.ctx, toOCIDescriptor(s.desc))
+}
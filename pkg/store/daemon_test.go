@@ -0,0 +1,99 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	dtypes "github.com/docker/docker/api/types"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+func TestLayout_CopyToDaemon(t *testing.T) {
+	s := newLayout(t)
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		response string
+		wantErr  bool
+	}{
+		{name: "loaded", response: `{"stream":"Loaded image: hello/world:v1\n"}`},
+		{name: "plain", response: "Loaded image: hello/world:v1\n"},
+		{
+			name:     "failed",
+			response: `{"stream":"Loading layer\n"}{"errorDetail":{"message":"no space left on device"},"error":"no space left on device"}`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &fakeDaemon{response: tt.response}
+			got, err := s.CopyToDaemon(ctx, ref, daemon.WithClient(d))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CopyToDaemon() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.response {
+				t.Errorf("CopyToDaemon() = %q, want %q", got, tt.response)
+			}
+
+			m, err := tarball.LoadManifest(func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(d.loaded)), nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m) != 1 || len(m[0].RepoTags) != 1 || m[0].RepoTags[0] != ref {
+				t.Errorf("loaded archive manifest = %+v, want only %s", m, ref)
+			}
+		})
+	}
+
+	if _, err := s.CopyToDaemon(ctx, "hello/missing:v1", daemon.WithClient(&fakeDaemon{})); err == nil {
+		t.Errorf("CopyToDaemon() of a missing reference should fail")
+	}
+
+	d := &fakeDaemon{response: `{"stream":"Loaded image: hello/world:v1\n"}`}
+	if _, err := s.LoadToDaemon(ctx, ref, daemon.WithClient(d)); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.loaded) == 0 {
+		t.Errorf("LoadToDaemon() loaded nothing into the daemon")
+	}
+}
+
+// fakeDaemon is a docker daemon client keeping the archive it's asked to load, and answering the load with response
+type fakeDaemon struct {
+	response string
+	loaded   []byte
+}
+
+func (d *fakeDaemon) NegotiateAPIVersion(ctx context.Context) {}
+
+func (d *fakeDaemon) ImageSave(ctx context.Context, refs []string) (io.ReadCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (d *fakeDaemon) ImageLoad(ctx context.Context, r io.Reader, quiet bool) (dtypes.ImageLoadResponse, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return dtypes.ImageLoadResponse{}, err
+	}
+	d.loaded = data
+	return dtypes.ImageLoadResponse{Body: io.NopCloser(strings.NewReader(d.response)), JSON: true}, nil
+}
+
+func (d *fakeDaemon) ImageTag(ctx context.Context, source, target string) error {
+	return nil
+}
+
+func (d *fakeDaemon) ImageInspectWithRaw(ctx context.Context, ref string) (dtypes.ImageInspect, []byte, error) {
+	return dtypes.ImageInspect{}, nil, errors.New("not implemented")
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/ocil/pkg/content"
+)
+
+// DedupeReport lists the blobs two stores have in common
+type DedupeReport struct {
+	// Shared blobs are in both stores, SharedBytes is their total size
+	Shared      []digest.Digest
+	SharedBytes int64
+
+	// Linked blobs were separate copies that Dedupe replaced with a hard link, ReclaimedBytes is the space that freed
+	Linked         []digest.Digest
+	ReclaimedBytes int64
+}
+
+// SharedBlobs reports the blobs l and other have in common, without changing either
+func (l *Layout) SharedBlobs(ctx context.Context, other *Layout) (*DedupeReport, error) {
+	report, _, err := l.sharedBlobs(ctx, other)
+	return report, err
+}
+
+// Dedupe replaces every blob other has in common with l with a hard link to l's copy, so stores sharing base layers
+// on one disk only store them once
+// 	Both stores must be on the same local filesystem.  Blobs are content addressed and never written to once complete, so
+// 	sharing them is safe: a store removing a blob only removes its own link.  Only blobs that hash to their digest are
+// 	linked, a corrupted blob is left for Fsck to find rather than spread to other.
+func (l *Layout) Dedupe(ctx context.Context, other *Layout) (*DedupeReport, error) {
+	if err := other.writable("dedupe"); err != nil {
+		return nil, err
+	}
+	report, names, err := l.sharedBlobs(ctx, other)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range report.Shared {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		src, ok := content.LocalPath(l.OCI.Driver(), names[d][0])
+		if !ok {
+			return report, fmt.Errorf("dedupe: %s isn't on the local filesystem", l.Root)
+		}
+		dst, ok := content.LocalPath(other.OCI.Driver(), names[d][1])
+		if !ok {
+			return report, fmt.Errorf("dedupe: %s isn't on the local filesystem", other.Root)
+		}
+		srcInfo, err := os.Stat(src)
+		if err != nil {
+			return report, err
+		}
+		dstInfo, err := os.Stat(dst)
+		if err != nil {
+			return report, err
+		}
+		if os.SameFile(srcInfo, dstInfo) {
+			continue
+		}
+
+		s, err := hashBlob(ctx, l.OCI.Driver(), names[d][0], d)
+		if err != nil {
+			return report, err
+		}
+		if !s.valid {
+			continue
+		}
+
+		// link next to the copy being replaced and rename over it, so there's never a moment other is missing the blob
+		tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+"-link")
+		os.Remove(tmp)
+		if err := os.Link(src, tmp); err != nil {
+			return report, fmt.Errorf("link %s: %w", d, err)
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			os.Remove(tmp)
+			return report, fmt.Errorf("link %s: %w", d, err)
+		}
+
+		report.Linked = append(report.Linked, d)
+		report.ReclaimedBytes += dstInfo.Size()
+	}
+	return report, nil
+}
+
+// sharedBlobs reports the blobs l and other have in common, along with the names of each in l and other
+func (l *Layout) sharedBlobs(ctx context.Context, other *Layout) (*DedupeReport, map[digest.Digest][2]string, error) {
+	ours, err := l.blobNames(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	theirs, err := other.blobNames(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &DedupeReport{}
+	shared := make(map[digest.Digest]bool)
+	names := make(map[digest.Digest][2]string)
+	for d, p := range ours {
+		if q, ok := theirs[d]; ok {
+			shared[d] = true
+			names[d] = [2]string{p, q}
+		}
+	}
+	report.Shared = sortedDigests(shared)
+
+	for _, d := range report.Shared {
+		info, err := l.OCI.Driver().Stat(names[d][0])
+		if err != nil {
+			return nil, nil, err
+		}
+		report.SharedBytes += info.Size()
+	}
+	return report, names, nil
+}
+
+// blobNames lists the name of every blob stored within the layout
+func (l *Layout) blobNames(ctx context.Context) (map[digest.Digest]string, error) {
+	names := make(map[digest.Digest]string)
+
+	algs, err := l.OCI.Driver().ReadDir("blobs")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return names, nil
+		}
+		return nil, err
+	}
+
+	for _, alg := range algs {
+		if !alg.IsDir() {
+			continue
+		}
+
+		blobs, err := l.OCI.Driver().ReadDir(path.Join("blobs", alg.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, b := range blobs {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			d := digest.NewDigestFromEncoded(digest.Algorithm(alg.Name()), b.Name())
+			if err := d.Validate(); err != nil || !b.Type().IsRegular() {
+				continue
+			}
+			names[d] = path.Join("blobs", alg.Name(), b.Name())
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,89 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Dedupe(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	a, err := store.NewLayout(filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := store.NewLayout(filepath.Join(root, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared := genArtifact(t, "base:v1")
+	for _, s := range []*store.Layout{a, b} {
+		if _, err := s.AddOCI(ctx, shared, "base:v1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := b.AddOCI(ctx, memory.NewMemory([]byte("only in b"), "random"), "b:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := a.SharedBlobs(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// manifest, config and 3 layers of base:v1
+	if len(before.Shared) != 5 || before.SharedBytes == 0 {
+		t.Fatalf("SharedBlobs() = %d blobs of %d bytes, want 5", len(before.Shared), before.SharedBytes)
+	}
+	if len(before.Linked) != 0 {
+		t.Errorf("SharedBlobs() linked %v", before.Linked)
+	}
+
+	report, err := a.Dedupe(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Linked) != 5 || report.ReclaimedBytes != before.SharedBytes {
+		t.Errorf("Dedupe() linked %d blobs reclaiming %d bytes, want 5 and %d", len(report.Linked), report.ReclaimedBytes, before.SharedBytes)
+	}
+	for _, d := range report.Linked {
+		ai, err := os.Stat(filepath.Join(a.Root, "blobs", d.Algorithm().String(), d.Encoded()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bi, err := os.Stat(filepath.Join(b.Root, "blobs", d.Algorithm().String(), d.Encoded()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(ai, bi) {
+			t.Errorf("%s isn't linked", d)
+		}
+	}
+
+	// linking again is a no-op
+	again, err := a.Dedupe(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Shared) != 5 || len(again.Linked) != 0 {
+		t.Errorf("Dedupe() again shared %d and linked %d blobs, want 5 and 0", len(again.Shared), len(again.Linked))
+	}
+
+	for _, s := range []*store.Layout{a, b} {
+		if _, err := s.Image(ctx, "base:v1"); err != nil {
+			t.Errorf("Dedupe() broke base:v1: %v", err)
+		}
+		fsck, err := s.Fsck(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fsck.OK() {
+			t.Errorf("Fsck() after Dedupe() = %+v", fsck)
+		}
+	}
+}
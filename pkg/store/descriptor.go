@@ -0,0 +1,140 @@
+package store
+
+import (
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// DescriptorHook is invoked with every layer and manifest descriptor as it is committed during an Add, and may mutate it
+// 	Layer descriptors are mutated before the manifest is serialized, so changes to them are reflected in the manifest
+type DescriptorHook func(*ocispec.Descriptor) error
+
+// WithDescriptorHook appends hook to the hooks run during an Add
+func WithDescriptorHook(hook DescriptorHook) Options {
+	return func(l *Layout) {
+		l.descriptorHooks = append(l.descriptorHooks, hook)
+	}
+}
+
+// WithDescriptorAnnotations stamps annotations on the index descriptor of everything added to the Layout (ie: a build
+// id or source url)
+// 	They take precedence over the annotations of the manifest itself, which are carried over to its descriptor, but
+// 	never over the reference name.
+func WithDescriptorAnnotations(annotations map[string]string) Options {
+	return func(l *Layout) {
+		if l.annotations == nil {
+			l.annotations = make(map[string]string)
+		}
+		for k, v := range annotations {
+			l.annotations[k] = v
+		}
+	}
+}
+
+// indexAnnotations returns the annotations of the index descriptor of v, with a manifest annotated with manifest,
+// added as ref
+func (l *Layout) indexAnnotations(v interface{}, manifest map[string]string, ref string) map[string]string {
+	annotations := make(map[string]string, len(manifest)+len(l.annotations)+1)
+	for k, v := range manifest {
+		annotations[k] = v
+	}
+	for k, v := range l.provenanceAnnotations(v, ref) {
+		annotations[k] = v
+	}
+	for k, v := range l.annotations {
+		annotations[k] = v
+	}
+	annotations[ocispec.AnnotationRefName] = ref
+	return annotations
+}
+
+func (l *Layout) runDescriptorHooks(desc *ocispec.Descriptor) error {
+	for _, hook := range l.descriptorHooks {
+		if err := hook(desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hookManifest returns a copy of m with every layer descriptor passed through the descriptor hooks
+func (l *Layout) hookManifest(m *gv1.Manifest) (*gv1.Manifest, error) {
+	if len(l.descriptorHooks) == 0 {
+		return m, nil
+	}
+
+	hooked := *m
+	hooked.Layers = make([]gv1.Descriptor, len(m.Layers))
+	for i, ld := range m.Layers {
+		desc := toOCIDescriptor(ld)
+		if err := l.runDescriptorHooks(&desc); err != nil {
+			return nil, err
+		}
+
+		gd, err := fromOCIDescriptor(desc)
+		if err != nil {
+			return nil, err
+		}
+		hooked.Layers[i] = gd
+	}
+	return &hooked, nil
+}
+
+func toOCIDescriptor(d gv1.Descriptor) ocispec.Descriptor {
+	desc := ocispec.Descriptor{
+		MediaType:   string(d.MediaType),
+		Digest:      digest.Digest(d.Digest.String()),
+		Size:        d.Size,
+		URLs:        d.URLs,
+		Annotations: copyAnnotations(d.Annotations),
+	}
+	if d.Platform != nil {
+		desc.Platform = &ocispec.Platform{
+			Architecture: d.Platform.Architecture,
+			OS:           d.Platform.OS,
+			OSVersion:    d.Platform.OSVersion,
+			OSFeatures:   d.Platform.OSFeatures,
+			Variant:      d.Platform.Variant,
+		}
+	}
+	return desc
+}
+
+func fromOCIDescriptor(desc ocispec.Descriptor) (gv1.Descriptor, error) {
+	// gv1.NewHash only parses sha256, but the store may address what it built with any available algorithm
+	if err := desc.Digest.Validate(); err != nil {
+		return gv1.Descriptor{}, err
+	}
+	h := gv1.Hash{Algorithm: desc.Digest.Algorithm().String(), Hex: desc.Digest.Hex()}
+
+	d := gv1.Descriptor{
+		MediaType:   types.MediaType(desc.MediaType),
+		Digest:      h,
+		Size:        desc.Size,
+		URLs:        desc.URLs,
+		Annotations: desc.Annotations,
+	}
+	if desc.Platform != nil {
+		d.Platform = &gv1.Platform{
+			Architecture: desc.Platform.Architecture,
+			OS:           desc.Platform.OS,
+			OSVersion:    desc.Platform.OSVersion,
+			OSFeatures:   desc.Platform.OSFeatures,
+			Variant:      desc.Platform.Variant,
+		}
+	}
+	return d, nil
+}
+
+func copyAnnotations(a map[string]string) map[string]string {
+	if a == nil {
+		return nil
+	}
+	c := make(map[string]string, len(a))
+	for k, v := range a {
+		c[k] = v
+	}
+	return c
+}
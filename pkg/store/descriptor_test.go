@@ -0,0 +1,93 @@
+package store_test
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_WithDescriptorHook(t *testing.T) {
+	hook := func(desc *ocispec.Descriptor) error {
+		if desc.Annotations == nil {
+			desc.Annotations = make(map[string]string)
+		}
+		desc.Annotations["example.com/ingested"] = "true"
+		return nil
+	}
+
+	s := newLayout(t, store.WithDescriptorHook(hook))
+
+	desc, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1"), "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Annotations["example.com/ingested"] != "true" {
+		t.Errorf("manifest descriptor was not passed through the hook: %v", desc.Annotations)
+	}
+
+	img, err := s.Image(ctx, "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range m.Layers {
+		if l.Annotations["example.com/ingested"] != "true" {
+			t.Errorf("layer %s was not passed through the hook: %v", l.Digest, l.Annotations)
+		}
+	}
+}
+
+func TestLayout_WithDescriptorAnnotations(t *testing.T) {
+	s := newLayout(t, store.WithDescriptorAnnotations(map[string]string{
+		"example.com/build":       "42",
+		"example.com/source":      "https://example.com/src",
+		ocispec.AnnotationRefName: "overridden",
+	}))
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = mutate.Annotations(img, map[string]string{
+		"example.com/source": "manifest",
+		"example.com/owner":  "team",
+	}).(v1.Image)
+
+	desc, err := s.AddImage(ctx, img, "image:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"example.com/build":       "42",
+		"example.com/source":      "https://example.com/src",
+		"example.com/owner":       "team",
+		ocispec.AnnotationRefName: "image:v1",
+	}
+	for k, v := range want {
+		if got := desc.Annotations[k]; got != v {
+			t.Errorf("AddImage() annotation %s = %q, want %q", k, got, v)
+		}
+	}
+
+	var found bool
+	if err := s.Walk(func(reference string, d ocispec.Descriptor) error {
+		if d.Digest == desc.Digest {
+			found = d.Annotations["example.com/owner"] == "team" && d.Annotations["example.com/build"] == "42"
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Errorf("index descriptor of %s is missing its annotations", desc.Digest)
+	}
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// DiffReport is what changed from image A to image B
+type DiffReport struct {
+	A string
+	B string
+
+	// Added layers are only in B, Removed layers only in A and Shared layers in both, in the order of their image
+	Added   []ocispec.Descriptor
+	Removed []ocispec.Descriptor
+	Shared  []ocispec.Descriptor
+
+	// SizeDelta is how many more bytes of blobs (config and layers) B is made of than A, negative when B is smaller
+	SizeDelta int64
+
+	// ConfigChanges are the fields of the config that differ, sorted by field
+	ConfigChanges []ConfigChange
+}
+
+// ConfigChange is a field of an image config that differs between two images
+// 	Field is the dotted path of the field (ie: config.Env), and A or B is nil when the field is missing from that image.
+type ConfigChange struct {
+	Field string
+	A     interface{}
+	B     interface{}
+}
+
+// Identical reports whether A and B are made of the same layers and config
+func (r DiffReport) Identical() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.ConfigChanges) == 0
+}
+
+// Diff compares the images stored under refA and refB, reporting the layers that differ, the size delta and the
+// config fields that changed, ie: to see what updating a bundle to a newer version of an image actually brings in
+// 	The rootfs of the configs isn't compared, since it only changes along with the layers.
+func (l *Layout) Diff(ctx context.Context, refA string, refB string) (*DiffReport, error) {
+	a, err := l.diffable(ctx, refA)
+	if err != nil {
+		return nil, err
+	}
+	b, err := l.diffable(ctx, refB)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DiffReport{A: refA, B: refB, SizeDelta: b.size() - a.size()}
+	inA, inB := a.digests(), b.digests()
+	for _, d := range a.layers {
+		if inB[d.Digest] {
+			report.Shared = append(report.Shared, d)
+		} else {
+			report.Removed = append(report.Removed, d)
+		}
+	}
+	for _, d := range b.layers {
+		if !inA[d.Digest] {
+			report.Added = append(report.Added, d)
+		}
+	}
+
+	delete(a.config, "rootfs")
+	delete(b.config, "rootfs")
+	report.ConfigChanges = diffFields("", a.config, b.config, nil)
+	sort.Slice(report.ConfigChanges, func(i, j int) bool {
+		return report.ConfigChanges[i].Field < report.ConfigChanges[j].Field
+	})
+	return report, nil
+}
+
+// diffImage is what Diff compares of an image
+type diffImage struct {
+	config     map[string]interface{}
+	configSize int64
+	layers     []ocispec.Descriptor
+}
+
+// diffable reads what Diff compares of the image stored under ref
+func (l *Layout) diffable(ctx context.Context, ref string) (*diffImage, error) {
+	img, err := l.Image(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := img.RawConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &diffImage{configSize: m.Config.Size}
+	if err := json.Unmarshal(raw, &d.config); err != nil {
+		return nil, fmt.Errorf("config of %s: %w", ref, err)
+	}
+	for _, layer := range m.Layers {
+		d.layers = append(d.layers, toOCIDescriptor(layer))
+	}
+	return d, nil
+}
+
+// digests is the set of the digests of the layers of the image
+func (d *diffImage) digests() map[digest.Digest]bool {
+	digests := make(map[digest.Digest]bool)
+	for _, layer := range d.layers {
+		digests[layer.Digest] = true
+	}
+	return digests
+}
+
+// size is the total size of the distinct blobs of the image
+func (d *diffImage) size() int64 {
+	size := d.configSize
+	seen := make(map[digest.Digest]bool)
+	for _, layer := range d.layers {
+		if !seen[layer.Digest] {
+			seen[layer.Digest] = true
+			size += layer.Size
+		}
+	}
+	return size
+}
+
+// diffFields appends the fields of a and b that differ to changes, descending into the objects both have under a field
+// and comparing anything else (arrays included) as a whole
+func diffFields(prefix string, a, b map[string]interface{}, changes []ConfigChange) []ConfigChange {
+	fields := make(map[string]bool)
+	for k := range a {
+		fields[k] = true
+	}
+	for k := range b {
+		fields[k] = true
+	}
+
+	for k := range fields {
+		field := k
+		if prefix != "" {
+			field = prefix + "." + k
+		}
+
+		va, vb := a[k], b[k]
+		ma, aok := va.(map[string]interface{})
+		mb, bok := vb.(map[string]interface{})
+		if aok && bok {
+			changes = diffFields(field, ma, mb, changes)
+			continue
+		}
+		if !reflect.DeepEqual(va, vb) {
+			changes = append(changes, ConfigChange{Field: field, A: va, B: vb})
+		}
+	}
+	return changes
+}
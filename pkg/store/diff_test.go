@@ -0,0 +1,96 @@
+package store_test
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestLayout_Diff(t *testing.T) {
+	s := newLayout(t)
+
+	base, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := mutate.Config(base, v1.Config{Env: []string{"VERSION=1"}, User: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := random.Layer(2048, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := mutate.AppendLayers(a, added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err = mutate.Config(b, v1.Config{Env: []string{"VERSION=2"}, User: "app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.AddImage(ctx, a, "images/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, b, "images/app:v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.Diff(ctx, "images/app:v1", "images/app:v2")
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	addedDigest, err := added.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Added) != 1 || report.Added[0].Digest.String() != addedDigest.String() {
+		t.Errorf("Diff() added = %+v, want only %s", report.Added, addedDigest)
+	}
+	if len(report.Removed) != 0 || len(report.Shared) != 2 {
+		t.Errorf("Diff() removed %d and shared %d layers, want 0 and 2", len(report.Removed), len(report.Shared))
+	}
+
+	size := func(img v1.Image) int64 {
+		m, err := img.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := m.Config.Size
+		for _, l := range m.Layers {
+			total += l.Size
+		}
+		return total
+	}
+	if want := size(b) - size(a); report.SizeDelta != want {
+		t.Errorf("Diff() size delta = %d, want %d", report.SizeDelta, want)
+	}
+
+	var fields []string
+	for _, c := range report.ConfigChanges {
+		fields = append(fields, c.Field)
+	}
+	// appending a layer records it in the history too
+	if strings.Join(fields, ",") != "config.Env,history" {
+		t.Errorf("Diff() config changes = %v, want config.Env and history", fields)
+	}
+	if report.Identical() {
+		t.Errorf("Diff() of different images is identical")
+	}
+
+	same, err := s.Diff(ctx, "images/app:v1", "images/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same.Identical() || same.SizeDelta != 0 {
+		t.Errorf("Diff() of an image with itself = %+v, want identical", same)
+	}
+
+	if _, err := s.Diff(ctx, "images/app:v1", "images/missing:v1"); err == nil {
+		t.Errorf("Diff() with a missing reference error = nil")
+	}
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	_ "crypto/sha512"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// digestsDir is where secondary digest sidecars live, alongside (never inside) the oci-layout's blobs
+const digestsDir = "digests"
+
+// WithSecondaryDigest computes a second digest of every blob written by the Layout using alg, and records it in a
+// sidecar under the stores root
+// 	This allows a store to later be verified against a stronger hash without re-reading everything in it up front
+// 	Only blobs written through the Layout (ie: AddOCI) are covered, not those pushed directly to its content.OCI
+func WithSecondaryDigest(alg digest.Algorithm) Options {
+	return func(l *Layout) {
+		l.secondaryDigest = alg
+	}
+}
+
+// WithDigestAlgorithm addresses the manifests the Layout builds itself (those of AddOCI, and referrers indexes) with
+// alg rather than sha256, ie: digest.SHA512
+// 	Everything those manifests reference keeps the digest it's referenced by, as do images and indexes added with
+// 	AddImage or AddImageIndex, which are stored byte for byte.  oras only transfers sha256 manifests, so copies of
+// 	anything addressed otherwise fail.
+func WithDigestAlgorithm(alg digest.Algorithm) Options {
+	return func(l *Layout) {
+		l.digestAlgorithm = alg
+	}
+}
+
+// SecondaryDigest returns the recorded secondary digest of the blob identified by d
+func (l *Layout) SecondaryDigest(d digest.Digest) (digest.Digest, error) {
+	data, err := fs.ReadFile(l.OCI.Driver(), digestName(d))
+	if err != nil {
+		return "", err
+	}
+	return digest.Parse(strings.TrimSpace(string(data)))
+}
+
+// VerifySecondaryDigest rehashes the blob identified by d and compares it to its recorded secondary digest
+func (l *Layout) VerifySecondaryDigest(ctx context.Context, d digest.Digest) error {
+	want, err := l.SecondaryDigest(d)
+	if err != nil {
+		return err
+	}
+
+	rc, err := l.OCI.Fetch(ctx, ocispec.Descriptor{Digest: d})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	got, err := want.Algorithm().FromReader(rc)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("blob %s failed secondary digest verification: got %s, want %s: %w", d, got, want, ErrDigestMismatch)
+	}
+	return nil
+}
+
+// secondaryDigester returns the writer w should be teed into and the function that records the resulting digest for d
+// 	When no secondary digest is configured, w is returned as is and recording is a no-op
+func (l *Layout) secondaryDigester(w io.Writer, d digest.Digest) (io.Writer, func() error, error) {
+	if l.secondaryDigest == "" {
+		return w, func() error { return nil }, nil
+	}
+	if !l.secondaryDigest.Available() {
+		return nil, nil, fmt.Errorf("secondary digest algorithm %s is unavailable", l.secondaryDigest)
+	}
+
+	digester := l.secondaryDigest.Digester()
+	record := func() error {
+		return l.OCI.Driver().WriteFile(digestName(d), []byte(digester.Digest().String()))
+	}
+	return io.MultiWriter(w, digester.Hash()), record, nil
+}
+
+// digestName is the name of the secondary digest sidecar of d within the layout
+func digestName(d digest.Digest) string {
+	return path.Join(digestsDir, d.Algorithm().String(), d.Hex())
+}
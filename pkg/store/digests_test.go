@@ -0,0 +1,87 @@
+package store_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_WithSecondaryDigest(t *testing.T) {
+	s := newLayout(t, store.WithSecondaryDigest(digest.SHA512))
+
+	data := []byte("data")
+	if _, err := s.AddOCI(ctx, memory.NewMemory(data, "random"), "hello/world:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	d := digest.FromBytes(data)
+	got, err := s.SecondaryDigest(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := digest.SHA512.FromBytes(data); got != want {
+		t.Errorf("SecondaryDigest() = %s, want %s", got, want)
+	}
+	if err := s.VerifySecondaryDigest(ctx, d); err != nil {
+		t.Errorf("VerifySecondaryDigest() error = %v", err)
+	}
+}
+
+func TestLayout_WithDigestAlgorithm(t *testing.T) {
+	if _, err := store.NewLayout(t.TempDir(), store.WithDigestAlgorithm("md5")); err == nil {
+		t.Error("NewLayout() with an unavailable digest algorithm succeeded")
+	}
+
+	s := newLayout(t, store.WithDigestAlgorithm(digest.SHA512))
+
+	ref := "hello/world:v1"
+	desc, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest.Algorithm() != digest.SHA512 {
+		t.Fatalf("AddOCI() digest = %s, want a sha512 digest", desc.Digest)
+	}
+	if _, err := os.Stat(filepath.Join(root, "blobs", "sha512", desc.Digest.Hex())); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, got, err := s.Resolve(ctx, "hello/world@"+desc.Digest.String()); err != nil || got.Digest != desc.Digest {
+		t.Errorf("Resolve() by sha512 digest = %s, %v, want %s", got.Digest, err, desc.Digest)
+	}
+	rc, err := s.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Errorf("Fetch() of a sha512 manifest error = %v", err)
+	}
+
+	sbomRef := "hello/world:sbom"
+	if _, err := s.AddSBOM(ctx, memory.NewMemory([]byte("sbom"), "application/spdx+json"), ref); err != nil {
+		t.Fatal(err)
+	}
+	referrers, err := s.Referrers(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 {
+		t.Errorf("Referrers() = %v, want the sbom of %s", referrers, sbomRef)
+	}
+
+	report, err := s.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("Fsck() = %+v, want a healthy store", report)
+	}
+}
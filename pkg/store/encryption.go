@@ -0,0 +1,543 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/containers/ocicrypt"
+	encconfig "github.com/containers/ocicrypt/config"
+	encspec "github.com/containers/ocicrypt/spec"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/target"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/layer"
+)
+
+// encryptedSuffix marks the media types of layers encrypted per the oci encryption spec
+const encryptedSuffix = "+encrypted"
+
+// encryptedMediaTypes maps the layer media types that can be encrypted onto their encrypted counterpart
+var encryptedMediaTypes = map[types.MediaType]string{
+	types.OCILayer:                       encspec.MediaTypeLayerEnc,
+	types.OCIUncompressedLayer:           encspec.MediaTypeLayerEnc,
+	types.DockerLayer:                    encspec.MediaTypeLayerGzipEnc,
+	types.DockerUncompressedLayer:        encspec.MediaTypeLayerEnc,
+	types.DockerForeignLayer:             encspec.MediaTypeLayerNonDistributableGzipEnc,
+	types.OCIRestrictedLayer:             encspec.MediaTypeLayerNonDistributableGzipEnc,
+	types.OCIUncompressedRestrictedLayer: encspec.MediaTypeLayerNonDistributableEnc,
+}
+
+// WithEncryption encrypts the layers of every image added to the store with ec, per the oci image encryption spec
+// (see github.com/containers/ocicrypt/config for the JWE, PKCS#7, PKCS#11 and keyprovider constructors)
+// 	Only image layers are encrypted, configs and anything else (ie: the layers of file artifacts) are stored as is.
+// 	Layers are encrypted as they're added, their plaintext never reaches the store.  Since encrypted layers have
+// 	digests of their own, so do the manifests and indexes holding them, AddImage and AddImageIndex included.
+func WithEncryption(ec *encconfig.EncryptConfig) Options {
+	return func(l *Layout) {
+		l.encryption = ec
+	}
+}
+
+// WithDecryption decrypts the encrypted layers of copied images with dc, the destination receiving them (and the
+// manifests and indexes holding them) as they were before being encrypted
+// 	Layers are decrypted as they're copied, which means once up front to find their size, and once more to copy them.
+func WithDecryption(dc *encconfig.DecryptConfig) CopyOption {
+	return func(o *copyOptions) {
+		o.decryption = dc
+	}
+}
+
+// encryptLayers returns descs with every layer that can be encrypted replaced by its encrypted counterpart, and the
+// encrypted layers by their digest
+// 	Encrypted layers are spooled to temporary files, so ciphertext is only ever produced once.
+func encryptLayers(ec *encconfig.EncryptConfig, descs []v1.Descriptor, layers []v1.Layer) ([]v1.Descriptor, map[v1.Hash]v1.Layer, error) {
+	byDigest := make(map[v1.Hash]v1.Layer)
+	for _, lyr := range layers {
+		d, err := lyr.Digest()
+		if err != nil {
+			return nil, nil, err
+		}
+		byDigest[d] = lyr
+	}
+
+	encrypted := make([]v1.Descriptor, len(descs))
+	encryptedLayers := make(map[v1.Hash]v1.Layer)
+	for i, desc := range descs {
+		mt, ok := encryptedMediaTypes[desc.MediaType]
+		lyr := byDigest[desc.Digest]
+		if !ok || lyr == nil {
+			encrypted[i] = desc
+			continue
+		}
+
+		edesc, elyr, err := encryptLayer(ec, desc, mt, lyr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("encrypt layer %s: %w", desc.Digest, err)
+		}
+		encrypted[i] = edesc
+		encryptedLayers[edesc.Digest] = elyr
+	}
+	return encrypted, encryptedLayers, nil
+}
+
+func encryptLayer(ec *encconfig.EncryptConfig, desc v1.Descriptor, mt string, lyr v1.Layer) (v1.Descriptor, v1.Layer, error) {
+	rc, err := lyr.Compressed()
+	if err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+	defer rc.Close()
+
+	odesc := ocispec.Descriptor{
+		MediaType:   string(desc.MediaType),
+		Digest:      digest.NewDigestFromEncoded(digest.Algorithm(desc.Digest.Algorithm), desc.Digest.Hex),
+		Size:        desc.Size,
+		Annotations: desc.Annotations,
+	}
+	r, finalize, err := ocicrypt.EncryptLayer(ec, rc, odesc)
+	if err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+
+	elyr, err := layer.FromReader(ioutil.NopCloser(r), layer.WithMediaType(mt))
+	if err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+	encAnnotations, err := finalize()
+	if err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+
+	d, err := elyr.Digest()
+	if err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+	size, err := elyr.Size()
+	if err != nil {
+		return v1.Descriptor{}, nil, err
+	}
+
+	annotations := make(map[string]string)
+	for k, v := range desc.Annotations {
+		annotations[k] = v
+	}
+	for k, v := range encAnnotations {
+		annotations[k] = v
+	}
+	return v1.Descriptor{MediaType: types.MediaType(mt), Digest: d, Size: size, Annotations: annotations}, elyr, nil
+}
+
+// encryptOCI returns oci with its layers encrypted
+func encryptOCI(ec *encconfig.EncryptConfig, oci artifacts.OCI) (artifacts.OCI, error) {
+	m, err := oci.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	layers, err := oci.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	descs, encrypted, err := encryptLayers(ec, m.Layers, layers)
+	if err != nil {
+		return nil, err
+	}
+	em := m.DeepCopy()
+	em.Layers = descs
+
+	return &encryptedOCI{OCI: oci, manifest: em, layers: encryptedLayerList(layers, m.Layers, descs, encrypted)}, nil
+}
+
+// encryptedLayerList returns layers, with those that were encrypted swapped for their encrypted counterpart
+func encryptedLayerList(layers []v1.Layer, descs []v1.Descriptor, encryptedDescs []v1.Descriptor, encrypted map[v1.Hash]v1.Layer) []v1.Layer {
+	swap := make(map[v1.Hash]v1.Layer)
+	for i := range descs {
+		if elyr, ok := encrypted[encryptedDescs[i].Digest]; ok {
+			swap[descs[i].Digest] = elyr
+		}
+	}
+
+	var out []v1.Layer
+	for _, lyr := range layers {
+		d, err := lyr.Digest()
+		if elyr, ok := swap[d]; err == nil && ok {
+			lyr = elyr
+		}
+		out = append(out, lyr)
+	}
+	return out
+}
+
+type encryptedOCI struct {
+	artifacts.OCI
+
+	manifest *v1.Manifest
+	layers   []v1.Layer
+}
+
+func (o *encryptedOCI) Manifest() (*v1.Manifest, error) {
+	return o.manifest, nil
+}
+
+// RawManifest marshals the encrypted manifest, rather than passing through that of the plaintext layers
+func (o *encryptedOCI) RawManifest() ([]byte, error) {
+	return artifacts.MarshalManifest(o)
+}
+
+func (o *encryptedOCI) Layers() ([]v1.Layer, error) {
+	return o.layers, nil
+}
+
+// encryptImage returns img with its layers encrypted
+func encryptImage(ec *encconfig.EncryptConfig, img v1.Image) (v1.Image, error) {
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	descs, encrypted, err := encryptLayers(ec, m.Layers, layers)
+	if err != nil {
+		return nil, err
+	}
+	em := m.DeepCopy()
+	em.Layers = descs
+	raw, err := json.Marshal(em)
+	if err != nil {
+		return nil, err
+	}
+
+	return partial.CompressedToImage(&encryptedImage{Image: img, raw: raw, layers: encrypted})
+}
+
+// encryptedImage is the partial.CompressedImageCore of an image with encrypted layers
+type encryptedImage struct {
+	v1.Image
+
+	raw    []byte
+	layers map[v1.Hash]v1.Layer
+}
+
+func (i *encryptedImage) RawManifest() ([]byte, error) {
+	return i.raw, nil
+}
+
+func (i *encryptedImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	if lyr, ok := i.layers[h]; ok {
+		return lyr, nil
+	}
+	return i.Image.LayerByDigest(h)
+}
+
+// encryptIndex returns idx with the layers of every image in it encrypted
+func encryptIndex(ec *encconfig.EncryptConfig, idx v1.ImageIndex) (v1.ImageIndex, error) {
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	eidx := &encryptedIndex{
+		base:    idx,
+		images:  make(map[v1.Hash]v1.Image),
+		indexes: make(map[v1.Hash]v1.ImageIndex),
+	}
+	em := im.DeepCopy()
+	for i, child := range im.Manifests {
+		var sized partial.Describable
+		switch {
+		case child.MediaType.IsIndex():
+			cidx, err := idx.ImageIndex(child.Digest)
+			if err != nil {
+				return nil, err
+			}
+			ecidx, err := encryptIndex(ec, cidx)
+			if err != nil {
+				return nil, err
+			}
+			d, err := ecidx.Digest()
+			if err != nil {
+				return nil, err
+			}
+			eidx.indexes[d] = ecidx
+			sized = ecidx
+
+		case child.MediaType.IsImage():
+			img, err := idx.Image(child.Digest)
+			if err != nil {
+				return nil, err
+			}
+			eimg, err := encryptImage(ec, img)
+			if err != nil {
+				return nil, err
+			}
+			d, err := eimg.Digest()
+			if err != nil {
+				return nil, err
+			}
+			eidx.images[d] = eimg
+			sized = eimg
+
+		default:
+			continue
+		}
+
+		if em.Manifests[i].Digest, err = sized.Digest(); err != nil {
+			return nil, err
+		}
+		if em.Manifests[i].Size, err = sized.Size(); err != nil {
+			return nil, err
+		}
+	}
+
+	if eidx.raw, err = json.Marshal(em); err != nil {
+		return nil, err
+	}
+	eidx.manifest = em
+	return eidx, nil
+}
+
+// encryptedIndex is an image index whose images have encrypted layers
+type encryptedIndex struct {
+	base v1.ImageIndex
+
+	raw      []byte
+	manifest *v1.IndexManifest
+	images   map[v1.Hash]v1.Image
+	indexes  map[v1.Hash]v1.ImageIndex
+}
+
+func (i *encryptedIndex) MediaType() (types.MediaType, error) {
+	return i.base.MediaType()
+}
+
+func (i *encryptedIndex) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(i.raw))
+	return h, err
+}
+
+func (i *encryptedIndex) Size() (int64, error) {
+	return int64(len(i.raw)), nil
+}
+
+func (i *encryptedIndex) IndexManifest() (*v1.IndexManifest, error) {
+	return i.manifest, nil
+}
+
+func (i *encryptedIndex) RawManifest() ([]byte, error) {
+	return i.raw, nil
+}
+
+func (i *encryptedIndex) Image(h v1.Hash) (v1.Image, error) {
+	if img, ok := i.images[h]; ok {
+		return img, nil
+	}
+	return i.base.Image(h)
+}
+
+func (i *encryptedIndex) ImageIndex(h v1.Hash) (v1.ImageIndex, error) {
+	if idx, ok := i.indexes[h]; ok {
+		return idx, nil
+	}
+	return i.base.ImageIndex(h)
+}
+
+// decryptedTarget is a target.Target serving the images reachable from ref with their layers decrypted
+type decryptedTarget struct {
+	target.Target
+
+	dc   *encconfig.DecryptConfig
+	ref  string
+	root ocispec.Descriptor
+
+	fetcher remotes.Fetcher
+	// blobs are the rewritten manifests and indexes, layers the encrypted layers by their decrypted digest
+	blobs  map[digest.Digest][]byte
+	layers map[digest.Digest]ocispec.Descriptor
+}
+
+// decrypted returns from with the layers of everything reachable from ref decrypted with dc
+func decrypted(ctx context.Context, from target.Target, ref string, dc *encconfig.DecryptConfig) (target.Target, error) {
+	_, root, err := from.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	fetcher, err := from.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &decryptedTarget{
+		Target:  from,
+		dc:      dc,
+		ref:     ref,
+		fetcher: fetcher,
+		blobs:   make(map[digest.Digest][]byte),
+		layers:  make(map[digest.Digest]ocispec.Descriptor),
+	}
+	if t.root, err = t.rewrite(ctx, root); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// rewrite returns the descriptor of desc once its layers (or those of its manifests) are decrypted, which is desc
+// itself when nothing in it is encrypted
+func (t *decryptedTarget) rewrite(ctx context.Context, desc ocispec.Descriptor) (ocispec.Descriptor, error) {
+	var data []byte
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, consts.DockerManifestListSchema2:
+		var idx ocispec.Index
+		if err := t.fetchJSON(ctx, desc, &idx); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+
+		changed := false
+		for i, m := range idx.Manifests {
+			rm, err := t.rewrite(ctx, m)
+			if err != nil {
+				return ocispec.Descriptor{}, err
+			}
+			changed = changed || rm.Digest != m.Digest
+			idx.Manifests[i] = rm
+		}
+		if !changed {
+			return desc, nil
+		}
+
+		var err error
+		if data, err = json.Marshal(idx); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+
+	case ocispec.MediaTypeImageManifest, consts.DockerManifestSchema2:
+		var m ocispec.Manifest
+		if err := t.fetchJSON(ctx, desc, &m); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+
+		changed := false
+		for i, l := range m.Layers {
+			if !strings.HasSuffix(l.MediaType, encryptedSuffix) {
+				continue
+			}
+			dl, err := t.decryptLayer(ctx, l)
+			if err != nil {
+				return ocispec.Descriptor{}, fmt.Errorf("decrypt layer %s: %w", l.Digest, err)
+			}
+			m.Layers[i] = dl
+			changed = true
+		}
+		if !changed {
+			return desc, nil
+		}
+
+		var err error
+		if data, err = json.Marshal(m); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+
+	default:
+		return desc, nil
+	}
+
+	rdesc := desc
+	rdesc.Digest = digest.FromBytes(data)
+	rdesc.Size = int64(len(data))
+	t.blobs[rdesc.Digest] = data
+	return rdesc, nil
+}
+
+// decryptLayer decrypts desc once to find the digest and size of its plaintext
+func (t *decryptedTarget) decryptLayer(ctx context.Context, desc ocispec.Descriptor) (ocispec.Descriptor, error) {
+	rc, err := t.fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	defer rc.Close()
+
+	r, d, err := ocicrypt.DecryptLayer(t.dc, rc, desc, false)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	digester := digest.Canonical.Digester()
+	n, err := io.Copy(digester.Hash(), &contextReader{ctx: ctx, r: r})
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if d != "" && digester.Digest() != d {
+		return ocispec.Descriptor{}, fmt.Errorf("decrypted to %s, want %s: %w", digester.Digest(), d, ErrDigestMismatch)
+	}
+
+	decrypted := ocispec.Descriptor{
+		MediaType:   strings.TrimSuffix(desc.MediaType, encryptedSuffix),
+		Digest:      digester.Digest(),
+		Size:        n,
+		Annotations: ocicrypt.FilterOutAnnotations(desc.Annotations),
+	}
+	if len(decrypted.Annotations) == 0 {
+		decrypted.Annotations = nil
+	}
+	t.layers[decrypted.Digest] = desc
+	return decrypted, nil
+}
+
+func (t *decryptedTarget) fetchJSON(ctx context.Context, desc ocispec.Descriptor, v interface{}) error {
+	rc, err := t.fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return json.NewDecoder(rc).Decode(v)
+}
+
+func (t *decryptedTarget) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	if ref == t.ref {
+		return ref, t.root, nil
+	}
+	return t.Target.Resolve(ctx, ref)
+}
+
+func (t *decryptedTarget) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	if _, err := t.Target.Fetcher(ctx, ref); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *decryptedTarget) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	if data, ok := t.blobs[desc.Digest]; ok {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	encrypted, ok := t.layers[desc.Digest]
+	if !ok {
+		return t.fetcher.Fetch(ctx, desc)
+	}
+	rc, err := t.fetcher.Fetch(ctx, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	r, _, err := ocicrypt.DecryptLayer(t.dc, rc, encrypted, false)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, rc}, nil
+}
@@ -0,0 +1,159 @@
+package store_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	encconfig "github.com/containers/ocicrypt/config"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_WithEncryption(t *testing.T) {
+	pub, priv := genEncryptionKeys(t)
+	_, wrong := genEncryptionKeys(t)
+	enc, err := encconfig.EncryptWithJwe([][]byte{pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := encconfig.DecryptWithPrivKeys([][]byte{priv}, [][]byte{nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongDec, err := encconfig.DecryptWithPrivKeys([][]byte{wrong}, [][]byte{nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newLayout(t, store.WithEncryption(enc.EncryptConfig))
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, img, "registry.example.com/secret:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, desc, err := s.Resolve(ctx, "registry.example.com/secret:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m ocispec.Manifest
+	rc, err := s.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.NewDecoder(rc).Decode(&m)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := blobSizes(t, s.Root)
+	for i, l := range m.Layers {
+		if !strings.HasSuffix(l.MediaType, "+encrypted") || l.Annotations["org.opencontainers.image.enc.keys.jwe"] == "" {
+			t.Errorf("stored layer %d is %s %v, want it encrypted", i, l.MediaType, l.Annotations)
+		}
+		d, err := plain[i].Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := stored[digest.Digest(d.String())]; ok {
+			t.Errorf("plaintext of layer %d is in the store", i)
+		}
+	}
+
+	t.Run("decrypted", func(t *testing.T) {
+		dst := tempLayout(t)
+		if _, err := s.Copy(ctx, "registry.example.com/secret:v1", dst.OCI, "", store.WithDecryption(dec.DecryptConfig)); err != nil {
+			t.Fatal(err)
+		}
+
+		copied, err := dst.Image(ctx, "registry.example.com/secret:v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validate.Image(copied); err != nil {
+			t.Errorf("decrypted image is invalid: %v", err)
+		}
+		layers, err := copied.Layers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range layers {
+			got, _ := layers[i].Digest()
+			want, _ := plain[i].Digest()
+			if got != want {
+				t.Errorf("decrypted layer %d = %s, want %s", i, got, want)
+			}
+		}
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		dst := tempLayout(t)
+		copied, err := s.Copy(ctx, "registry.example.com/secret:v1", dst.OCI, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if copied.Digest != desc.Digest {
+			t.Errorf("Copy() without a key = %s, want the encrypted %s", copied.Digest, desc.Digest)
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		dst := tempLayout(t)
+		if _, err := s.Copy(ctx, "registry.example.com/secret:v1", dst.OCI, "", store.WithDecryption(wrongDec.DecryptConfig)); err == nil {
+			t.Error("Copy() with the wrong key succeeded")
+		}
+	})
+
+	t.Run("index", func(t *testing.T) {
+		idx := genIndex(t, "linux/amd64", "linux/arm64")
+		if _, err := s.AddImageIndex(ctx, idx, "registry.example.com/secret:v2"); err != nil {
+			t.Fatal(err)
+		}
+
+		dst := tempLayout(t)
+		if _, err := s.Copy(ctx, "registry.example.com/secret:v2", dst.OCI, "", store.WithDecryption(dec.DecryptConfig), store.WithPlatforms("linux/arm64")); err != nil {
+			t.Fatal(err)
+		}
+		copied, err := layout.Path(dst.Root).ImageIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validate.Index(copied); err != nil {
+			t.Errorf("decrypted index is invalid: %v", err)
+		}
+	})
+}
+
+// genEncryptionKeys returns a new PEM encoded ecdsa key pair
+func genEncryptionKeys(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: priv})
+}
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"github.com/rancherfederal/ocil/pkg/content"
+)
+
+// Errors wrapped by the Layouts methods, test for them with errors.Is
+var (
+	// ErrRefNotFound is returned for references that aren't indexed in the store
+	ErrRefNotFound = content.ErrRefNotFound
+
+	// ErrBlobNotFound is returned for blobs that aren't in the store, ie: those of a manifest that was only partially
+	// copied or since garbage collected
+	ErrBlobNotFound = content.ErrBlobNotFound
+
+	// ErrDigestMismatch is returned for content that doesn't hash to the digest it was given or recorded under
+	ErrDigestMismatch = content.ErrDigestMismatch
+
+	// ErrSizeMismatch is returned for blobs read from the store that aren't the size of the descriptor they're read by
+	ErrSizeMismatch = content.ErrSizeMismatch
+
+	// ErrReadOnly is returned for operations that would change a layout opened WithReadOnly
+	ErrReadOnly = content.ErrReadOnly
+
+	// ErrIncompatibleLayout is returned by NewLayout for directories holding a layout of a version it can't read
+	ErrIncompatibleLayout = content.ErrIncompatibleLayout
+)
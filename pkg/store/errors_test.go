@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Errors(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "registry.example.com/app:v1"
+	desc, err := s.AddOCI(ctx, genArtifact(t, "app:v1"), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := ocispec.Descriptor{Digest: digest.FromString("missing")}
+	data := []byte("content")
+
+	tcs := []struct {
+		name string
+		fn   func() error
+		want error
+	}{
+		{name: "resolve", want: store.ErrRefNotFound, fn: func() error {
+			_, _, err := s.Resolve(ctx, "registry.example.com/app:missing")
+			return err
+		}},
+		{name: "fetcher", want: store.ErrRefNotFound, fn: func() error {
+			_, err := s.Fetcher(ctx, "registry.example.com/app:missing")
+			return err
+		}},
+		{name: "copy", want: store.ErrRefNotFound, fn: func() error {
+			_, err := s.Copy(ctx, "registry.example.com/app:missing", s.OCI, "registry.example.com/app:v2")
+			return err
+		}},
+		{name: "fetch", want: store.ErrBlobNotFound, fn: func() error {
+			_, err := s.Fetch(ctx, missing)
+			return err
+		}},
+		{name: "commit", want: store.ErrDigestMismatch, fn: func() error {
+			w, err := s.OCI.Writer(ctx, ocispec.Descriptor{Digest: missing.Digest, Size: int64(len(data))})
+			if err != nil {
+				return err
+			}
+			defer w.Close()
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			return w.Commit(ctx, int64(len(data)), missing.Digest)
+		}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.fn(); !errors.Is(err, tc.want) {
+				t.Errorf("error = %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	// the containerd error kinds still hold, oras relies on them
+	if _, err := s.Fetch(ctx, missing); !errdefs.IsNotFound(err) {
+		t.Errorf("Fetch() error = %v, want errdefs.IsNotFound", err)
+	}
+	if _, err := s.Fetch(ctx, desc); err != nil {
+		t.Errorf("Fetch() error = %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// EventType identifies what happened to the store
+type EventType string
+
+const (
+	EventAdded    EventType = "added"
+	EventRemoved  EventType = "removed"
+	EventTagged   EventType = "tagged"
+	EventUntagged EventType = "untagged"
+	EventCopied   EventType = "copied"
+
+	// EventCollected is a blob deleted by GC
+	EventCollected EventType = "collected"
+
+	// EventVerificationFailed is an artifact refused by the Layouts signature or scan policy, or a blob Fsck found
+	// corrupted, truncated or missing
+	EventVerificationFailed EventType = "verification-failed"
+)
+
+// Event describes a single change to the store, or a failed verification of its content
+type Event struct {
+	Type      EventType
+	Reference string
+
+	// To is the reference a copy was copied to, empty when the destination had no reference
+	To string
+
+	// Descriptor is the root descriptor of the reference, or the blob collected or failing verification
+	Descriptor ocispec.Descriptor
+
+	// Err is why verification failed
+	Err error
+
+	Time time.Time
+}
+
+// operationEvents are the events emitted by operations that succeeded
+var operationEvents = map[Operation]EventType{
+	OperationAdd:    EventAdded,
+	OperationRemove: EventRemoved,
+	OperationTag:    EventTagged,
+	OperationUntag:  EventUntagged,
+}
+
+type subscriber struct {
+	fn func(Event)
+}
+
+// Subscribe calls fn with every Event of the Layout from now on, until the returned function is called
+// 	fn is called synchronously by the operation emitting the event, concurrently when operations run concurrently, so
+// 	it should hand anything slow (ie: a webhook) off to a goroutine of its own.
+func (l *Layout) Subscribe(fn func(Event)) func() {
+	s := &subscriber{fn: fn}
+
+	l.subscribersMu.Lock()
+	defer l.subscribersMu.Unlock()
+	l.subscribers = append(l.subscribers, s)
+
+	return func() {
+		l.subscribersMu.Lock()
+		defer l.subscribersMu.Unlock()
+		for i, sub := range l.subscribers {
+			if sub == s {
+				l.subscribers = append(l.subscribers[:i:i], l.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// emit delivers e to every subscriber
+func (l *Layout) emit(e Event) {
+	l.subscribersMu.Lock()
+	subscribers := l.subscribers
+	l.subscribersMu.Unlock()
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, s := range subscribers {
+		s.fn(e)
+	}
+}
+
+// notified wraps op so its outcome is emitted as an Event, once it has run
+// 	Copies are emitted by Copy itself, which knows where they went.
+func (l *Layout) notified(op Handler) Handler {
+	return func(ctx context.Context, req *Request) error {
+		err := op(ctx, req)
+		if err != nil {
+			var perr *PolicyError
+			var serr *ScanError
+			if errors.As(err, &perr) || errors.As(err, &serr) {
+				l.emit(Event{Type: EventVerificationFailed, Reference: req.Reference, Descriptor: req.Descriptor, Err: err})
+			}
+			return err
+		}
+
+		if t, ok := operationEvents[req.Operation]; ok {
+			l.emit(Event{Type: t, Reference: req.Reference, Descriptor: req.Descriptor})
+		}
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package store_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/cosign"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Subscribe(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newLayout(t)
+
+	var mu sync.Mutex
+	var events []store.Event
+	unsubscribe := s.Subscribe(func(e store.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+
+	ref := "hello/world:v1"
+	desc, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Tag(ctx, ref, "hello/world:v2"); err != nil {
+		t.Fatal(err)
+	}
+	dst := tempLayout(t)
+	if _, err := s.Copy(ctx, ref, dst.OCI, "copied:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Untag(ctx, "hello/world:v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GC(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, e := range events {
+		if e.Time.IsZero() {
+			t.Errorf("%s event has no time", e.Type)
+		}
+		if e.Type != store.EventCollected && e.Descriptor.Digest != desc.Digest {
+			t.Errorf("%s event descriptor = %s, want %s", e.Type, e.Descriptor.Digest, desc.Digest)
+		}
+		if e.Type == store.EventCopied && e.To != "copied:v1" {
+			t.Errorf("copied event to = %q, want copied:v1", e.To)
+		}
+		// every blob collected is one event, only the first is kept
+		if e.Type == store.EventCollected && len(got) > 0 && got[len(got)-1] == string(e.Type) {
+			continue
+		}
+		got = append(got, string(e.Type))
+	}
+	if want := "added,tagged,copied,untagged,removed,collected"; strings.Join(got, ",") != want {
+		t.Errorf("Subscribe() got events %s, want %s", strings.Join(got, ","), want)
+	}
+
+	unsubscribe()
+	n := len(events)
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != n {
+		t.Errorf("unsubscribed func got %d more events", len(events)-n)
+	}
+
+	// refused artifacts are verification failures
+	verified := tempLayout(t, store.WithVerifier(cosign.NewKeyVerifier(&key.PublicKey)))
+	var failed []store.Event
+	verified.Subscribe(func(e store.Event) {
+		failed = append(failed, e)
+	})
+	if _, err := verified.AddOCI(ctx, genArtifact(t, ref), ref); err == nil {
+		t.Fatal("AddOCI() of an unsigned artifact succeeded")
+	}
+	if len(failed) != 1 || failed[0].Type != store.EventVerificationFailed || !errors.Is(failed[0].Err, store.ErrUnsigned) {
+		t.Errorf("Subscribe() got events %+v, want a single verification failure", failed)
+	}
+}
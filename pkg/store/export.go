@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// Export writes the images identified by refs to w as a `docker save` compatible tarball, suitable for `docker load`
+// 	When no refs are given, every image in the store is exported.  Non-image content (files, charts, ...) can't be
+// 	represented in a docker archive, and is skipped when exporting everything or rejected when explicitly requested.
+func (l *Layout) Export(ctx context.Context, w io.Writer, refs ...string) error {
+	images := make(map[gname.Reference]gv1.Image)
+
+	add := func(ref string) error {
+		r, err := gname.ParseReference(ref)
+		if err != nil {
+			return err
+		}
+		img, err := l.Image(ctx, ref)
+		if err != nil {
+			return err
+		}
+		images[r] = img
+		return nil
+	}
+
+	if len(refs) == 0 {
+		err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+			switch l.Identify(ctx, desc) {
+			case consts.DockerConfigJSON, ocispec.MediaTypeImageConfig:
+				return add(reference)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range refs {
+		desc, err := l.resolve(ctx, ref)
+		if err != nil {
+			return err
+		}
+		switch cmt := l.Identify(ctx, desc); cmt {
+		case consts.DockerConfigJSON, ocispec.MediaTypeImageConfig:
+		default:
+			return fmt.Errorf("reference %s is not an image and can't be exported to a docker archive: %s", ref, cmt)
+		}
+		if err := add(ref); err != nil {
+			return err
+		}
+	}
+
+	return tarball.MultiRefWrite(images, w)
+}
@@ -0,0 +1,42 @@
+package store_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+)
+
+func TestLayout_Export(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("data"), "random"), "not/an/image:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Export(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := tarball.LoadManifest(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 1 || len(m[0].RepoTags) != 1 || m[0].RepoTags[0] != ref {
+		t.Errorf("exported archive manifest = %+v, want only %s", m, ref)
+	}
+
+	if err := s.Export(ctx, io.Discard, "not/an/image:v1"); err == nil {
+		t.Errorf("Export() of a non-image reference should fail")
+	}
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content/file"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// Extract materializes the artifact stored under ref into dir, returning the paths it wrote
+// 	Images and indexes are written as an OCI image layout at dir, charts as the <name>-<version>.tgz helm packaged
+// 	them as (with their provenance file, if any), and everything else (files, ...) as the files its layers were named
+// 	for, directories being unpacked back into the tree they were packaged from.  Layers without a name are written
+// 	under the hex of their digest.
+func (l *Layout) Extract(ctx context.Context, ref string, dir string) ([]string, error) {
+	desc, err := l.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, consts.DockerManifestListSchema2:
+		return l.extractLayout(ctx, ref, dir)
+	}
+
+	var m ocispec.Manifest
+	if err := l.fetchJSON(ctx, desc, &m); err != nil {
+		return nil, fmt.Errorf("manifest of %s: %w", ref, err)
+	}
+
+	switch m.Config.MediaType {
+	case consts.DockerConfigJSON, ocispec.MediaTypeImageConfig:
+		return l.extractLayout(ctx, ref, dir)
+	case consts.ChartConfigMediaType:
+		return l.extractChart(ctx, m, dir)
+	}
+	return l.extractLayers(ctx, m.Layers, dir)
+}
+
+// extractLayout copies the image (or index) under ref to a new layout at dir
+func (l *Layout) extractLayout(ctx context.Context, ref string, dir string) ([]string, error) {
+	dst, err := NewLayout(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.Copy(ctx, ref, dst.OCI, ""); err != nil {
+		return nil, err
+	}
+	return []string{dir}, nil
+}
+
+// extractChart writes the chart layer of m as <name>-<version>.tgz, and its provenance layer beside it
+func (l *Layout) extractChart(ctx context.Context, m ocispec.Manifest, dir string) ([]string, error) {
+	var meta struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := l.fetchJSON(ctx, m.Config, &meta); err != nil {
+		return nil, fmt.Errorf("chart config: %w", err)
+	}
+	name := meta.Name + "-" + meta.Version + ".tgz"
+
+	var paths []string
+	for _, layer := range m.Layers {
+		var p string
+		switch layer.MediaType {
+		case consts.ChartLayerMediaType:
+			p = name
+		case consts.ProvLayerMediaType:
+			p = name + ".prov"
+		default:
+			continue
+		}
+
+		path, err := l.extractBlob(ctx, layer, dir, p)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// extractLayers writes each of layers into dir under its title, unpacking those annotated to be
+func (l *Layout) extractLayers(ctx context.Context, layers []ocispec.Descriptor, dir string) ([]string, error) {
+	var paths []string
+	for _, layer := range layers {
+		name := layer.Annotations[ocispec.AnnotationTitle]
+		if name == "" {
+			name = layer.Digest.Encoded()
+		}
+
+		if layer.Annotations[file.AnnotationUnpack] != "true" {
+			path, err := l.extractBlob(ctx, layer, dir, name)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, path)
+			continue
+		}
+
+		path, err := localPath(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.unpackBlob(ctx, layer, dir); err != nil {
+			return nil, fmt.Errorf("unpack %s: %w", name, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// extractBlob writes the content of desc to name beneath dir
+func (l *Layout) extractBlob(ctx context.Context, desc ocispec.Descriptor, dir string, name string) (string, error) {
+	path, err := localPath(dir, name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return "", err
+	}
+
+	rc, err := l.Fetch(ctx, desc)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, &contextReader{ctx: ctx, r: rc}); err != nil {
+		out.Close()
+		return "", err
+	}
+	return path, out.Close()
+}
+
+// unpackBlob extracts the tar+gzip archive desc is into dir
+func (l *Layout) unpackBlob(ctx context.Context, desc ocispec.Descriptor, dir string) error {
+	rc, err := l.Fetch(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return extractTar(ctx, zr, dir)
+}
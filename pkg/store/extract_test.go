@@ -0,0 +1,297 @@
+package store_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	orasfile "oras.land/oras-go/v2/content/file"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/chart"
+	"github.com/rancherfederal/ocil/pkg/artifacts/file"
+)
+
+func TestLayout_Extract(t *testing.T) {
+	s := newLayout(t)
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(src, "conf", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "conf", "sub", "app.yaml"), []byte("app: true"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, file.NewFile(filepath.Join(src, "notes.txt")), "files/notes:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, file.NewDirectory(filepath.Join(src, "conf")), "files/conf:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	chartYaml := "apiVersion: v2\nname: nginx\nversion: 1.0.0\n"
+	if err := tw.WriteHeader(&tar.Header{Name: "nginx/Chart.yaml", Mode: 0644, Size: int64(len(chartYaml))}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte(chartYaml))
+	tw.Close()
+	zw.Close()
+	c, err := chart.NewChart(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, c, c.Reference()); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, img, "images/random:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		ref   string
+		files map[string]string
+	}{
+		{
+			name:  "should write files under their original names",
+			ref:   "files/notes:v1",
+			files: map[string]string{"notes.txt": "notes"},
+		},
+		{
+			name:  "should unpack directories",
+			ref:   "files/conf:v1",
+			files: map[string]string{"conf/sub/app.yaml": "app: true"},
+		},
+		{
+			name:  "should write charts as their package",
+			ref:   "nginx:1.0.0",
+			files: map[string]string{"nginx-1.0.0.tgz": buf.String()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if _, err := s.Extract(ctx, tt.ref, dir); err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			for name, want := range tt.files {
+				got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("Extract() wrote %s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("should write images as an OCI layout", func(t *testing.T) {
+		dir := t.TempDir()
+		if _, err := s.Extract(ctx, "images/random:v1", dir); err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+		p, err := layout.FromPath(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx, err := p.ImageIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		im, err := idx.IndexManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(im.Manifests) != 1 || im.Manifests[0].Digest != want {
+			t.Fatalf("Extract() layout holds %+v, want only %s", im.Manifests, want)
+		}
+		extracted, err := p.Image(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validate.Image(extracted); err != nil {
+			t.Errorf("Extract() wrote an invalid image: %v", err)
+		}
+	})
+
+	if _, err := s.Extract(ctx, "files/missing:v1", t.TempDir()); err == nil {
+		t.Errorf("Extract() of a missing reference error = nil")
+	}
+}
+
+func TestLayout_ExtractRoundTrip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows has no permission bits, and symlinks need privileges")
+	}
+
+	s := newLayout(t)
+
+	t.Run("directories", func(t *testing.T) {
+		mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		src := filepath.Join(t.TempDir(), "tree")
+		if err := os.MkdirAll(filepath.Join(src, "bin"), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, "bin", "run.sh"), []byte("#!/bin/sh"), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, "conf.yaml"), []byte("conf: true"), 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("bin/run.sh", filepath.Join(src, "run")); err != nil {
+			t.Fatal(err)
+		}
+
+		d := file.NewDirectory(src, file.WithPreservedModes(), file.WithModTime(mtime))
+		if _, err := s.AddOCI(ctx, d, "files/tree:v1"); err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		if _, err := s.Extract(ctx, "files/tree:v1", dir); err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+
+		modes := map[string]os.FileMode{
+			"tree":            os.ModeDir | 0750,
+			"tree/bin":        os.ModeDir | 0750,
+			"tree/bin/run.sh": 0750,
+			"tree/conf.yaml":  0640,
+			"tree/run":        os.ModeSymlink,
+		}
+		for name, want := range modes {
+			fi, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want == os.ModeSymlink {
+				if fi.Mode()&os.ModeSymlink == 0 {
+					t.Errorf("Extract() wrote %s as %s, want a symlink", name, fi.Mode())
+				}
+				continue
+			}
+			if fi.Mode() != want {
+				t.Errorf("Extract() wrote %s with mode %s, want %s", name, fi.Mode(), want)
+			}
+			if !fi.ModTime().Equal(mtime) {
+				t.Errorf("Extract() wrote %s with mtime %s, want %s", name, fi.ModTime(), mtime)
+			}
+		}
+
+		got, err := os.ReadFile(filepath.Join(dir, "tree", "run"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "#!/bin/sh" {
+			t.Errorf("Extract() linked run to %q, want the content of bin/run.sh", got)
+		}
+	})
+
+	t.Run("links", func(t *testing.T) {
+		outside := t.TempDir()
+		entries := []tar.Header{
+			{Typeflag: tar.TypeDir, Name: "tree/", Mode: 0755},
+			{Typeflag: tar.TypeReg, Name: "tree/data", Mode: 0644, Size: 4},
+			{Typeflag: tar.TypeLink, Name: "tree/hard", Linkname: "tree/data"},
+			{Typeflag: tar.TypeSymlink, Name: "tree/abs", Linkname: "/tree/data"},
+			{Typeflag: tar.TypeSymlink, Name: "tree/climbs", Linkname: "../../../tree/data"},
+			{Typeflag: tar.TypeSymlink, Name: "tree/escape", Linkname: outside},
+			{Typeflag: tar.TypeReg, Name: "tree/escape/written", Mode: 0644, Size: 4},
+		}
+
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(zw)
+		for _, h := range entries {
+			h := h
+			if err := tw.WriteHeader(&h); err != nil {
+				t.Fatal(err)
+			}
+			if h.Size > 0 {
+				tw.Write([]byte("data"))
+			}
+		}
+		tw.Close()
+		zw.Close()
+
+		img, err := mutate.Append(empty.Image, mutate.Addendum{
+			Layer: static.NewLayer(buf.Bytes(), types.OCILayer),
+			Annotations: map[string]string{
+				ocispec.AnnotationTitle:   "tree",
+				orasfile.AnnotationUnpack: "true",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img = mutate.ConfigMediaType(mutate.MediaType(img, types.OCIManifestSchema1), "application/vnd.ocil.test.config.v1+json")
+		if _, err := s.AddImage(ctx, img, "files/links:v1"); err != nil {
+			t.Fatal(err)
+		}
+
+		dir := t.TempDir()
+		if _, err := s.Extract(ctx, "files/links:v1", dir); err != nil {
+			t.Fatalf("Extract() error = %v", err)
+		}
+
+		data, err := os.Stat(filepath.Join(dir, "tree", "data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hard, err := os.Stat(filepath.Join(dir, "tree", "hard"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(data, hard) {
+			t.Errorf("Extract() wrote tree/hard as a file of its own, want a hardlink to tree/data")
+		}
+
+		for _, name := range []string{"abs", "climbs"} {
+			link, err := filepath.EvalSymlinks(filepath.Join(dir, "tree", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := filepath.EvalSymlinks(filepath.Join(dir, "tree", "data"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if link != want {
+				t.Errorf("Extract() linked tree/%s to %s, want %s", name, link, want)
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(outside, "written")); !os.IsNotExist(err) {
+			t.Errorf("Extract() wrote through a symlink outside of the destination (%v)", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(outside), "written")); err != nil {
+			t.Errorf("Extract() didn't write tree/escape/written beneath the destination: %v", err)
+		}
+	})
+}
@@ -0,0 +1,314 @@
+package store
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// Filter narrows down the references Walk, List and CopyAll visit
+// 	A reference has to match every filter given, and at least one of the values given to each.
+type Filter func(*filter)
+
+// filter holds what each Filter given matches, one entry per Filter for those matching any of several values
+type filter struct {
+	references    [][]*regexp.Regexp
+	mediaTypes    []map[string]bool
+	artifactTypes []map[string]bool
+	annotations   []annotationSelector
+	labels        []annotationSelector
+	platforms     [][]string
+}
+
+// MatchReference matches references against globs, where * and ? match anything but a /, and ** matches anything at
+// all (ie: registry.example.com/team-a/* or **/nginx:*)
+func MatchReference(globs ...string) Filter {
+	return func(f *filter) {
+		res := make([]*regexp.Regexp, 0, len(globs))
+		for _, g := range globs {
+			res = append(res, globRegexp(g))
+		}
+		if len(res) > 0 {
+			f.references = append(f.references, res)
+		}
+	}
+}
+
+// MatchReferenceRegexp matches references against regular expressions
+func MatchReferenceRegexp(res ...*regexp.Regexp) Filter {
+	return func(f *filter) {
+		if len(res) > 0 {
+			f.references = append(f.references, res)
+		}
+	}
+}
+
+// MatchMediaType matches the media type of the referenced manifest or index
+func MatchMediaType(mediaTypes ...string) Filter {
+	return func(f *filter) {
+		f.mediaTypes = append(f.mediaTypes, setOf(mediaTypes))
+	}
+}
+
+// MatchArtifactType matches the artifactType of the referenced manifest, or the media type of its config (ie:
+// consts.ChartConfigMediaType for only helm charts)
+func MatchArtifactType(artifactTypes ...string) Filter {
+	return func(f *filter) {
+		f.artifactTypes = append(f.artifactTypes, setOf(artifactTypes))
+	}
+}
+
+// MatchAnnotations matches annotations of the referenced manifest or its index descriptor with selectors, modeled on
+// kubernetes label selectors: key=value, key!=value, key (is set) and !key (isn't set)
+// 	Unlike the other filters, every selector has to match.
+func MatchAnnotations(selectors ...string) Filter {
+	return func(f *filter) {
+		for _, s := range selectors {
+			f.annotations = append(f.annotations, parseAnnotationSelector(s))
+		}
+	}
+}
+
+// MatchLabels matches the labels of images with selectors, as MatchAnnotations does annotations
+// 	An index matches when any of its images does, and anything that isn't an image never matches.
+func MatchLabels(selectors ...string) Filter {
+	return func(f *filter) {
+		for _, s := range selectors {
+			f.labels = append(f.labels, parseAnnotationSelector(s))
+		}
+	}
+}
+
+// MatchPlatform matches images for any of platforms, and indexes with an image for any of them, as os/arch[/variant]
+// 	A platform without a variant matches every variant of it (ie: linux/arm64 matches linux/arm64/v8).
+func MatchPlatform(platforms ...string) Filter {
+	return func(f *filter) {
+		if len(platforms) > 0 {
+			f.platforms = append(f.platforms, platforms)
+		}
+	}
+}
+
+func setOf(values []string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
+
+func makeFilter(filters ...Filter) *filter {
+	f := &filter{}
+	for _, fn := range filters {
+		fn(f)
+	}
+	return f
+}
+
+// matches reports whether reference passes the filter, only fetching the manifest if the filter needs it
+func (f *filter) matches(ctx context.Context, l *Layout, reference string, desc ocispec.Descriptor) (bool, error) {
+	for _, res := range f.references {
+		if !matchesAny(res, reference) {
+			return false, nil
+		}
+	}
+
+	for _, mediaTypes := range f.mediaTypes {
+		if !mediaTypes[desc.MediaType] {
+			return false, nil
+		}
+	}
+
+	if len(f.artifactTypes) == 0 && len(f.annotations) == 0 && len(f.labels) == 0 && len(f.platforms) == 0 {
+		return true, nil
+	}
+
+	var m manifestRecord
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, consts.DockerManifestSchema2, ocispec.MediaTypeImageIndex, consts.DockerManifestListSchema2:
+		if err := l.fetchJSON(ctx, desc, &m); err != nil {
+			return false, err
+		}
+	}
+
+	at := m.ArtifactType
+	if at == "" {
+		at = m.Config.MediaType
+	}
+	for _, artifactTypes := range f.artifactTypes {
+		if !artifactTypes[at] {
+			return false, nil
+		}
+	}
+
+	annotations := copyAnnotations(m.Annotations)
+	for k, v := range desc.Annotations {
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[k] = v
+	}
+	for _, s := range f.annotations {
+		if !s.matches(annotations) {
+			return false, nil
+		}
+	}
+
+	if len(f.labels) == 0 && len(f.platforms) == 0 {
+		return true, nil
+	}
+	images, err := l.imageConfigs(ctx, m)
+	if err != nil {
+		return false, err
+	}
+	for _, img := range images {
+		if f.matchesImage(img) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchesImage reports whether the config of an image passes the label and platform filters
+func (f *filter) matchesImage(img imageConfig) bool {
+	for _, s := range f.labels {
+		if !s.matches(img.Config.Labels) {
+			return false
+		}
+	}
+	p := formatPlatform(img.Platform)
+	for _, platforms := range f.platforms {
+		if !matchesPlatform(platforms, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesPlatform reports whether p is any of platforms, or a variant of one without a variant of its own
+func matchesPlatform(platforms []string, p string) bool {
+	for _, want := range platforms {
+		if p == want || strings.HasPrefix(p, want+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageConfig is the part of an image config the filters match
+type imageConfig struct {
+	ocispec.Platform
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// imageConfigs returns the config of the image m is, or of every image of the index m is
+func (l *Layout) imageConfigs(ctx context.Context, m manifestRecord) ([]imageConfig, error) {
+	switch m.Config.MediaType {
+	case ocispec.MediaTypeImageConfig, consts.DockerConfigJSON:
+		var cfg imageConfig
+		if err := l.fetchJSON(ctx, m.Config, &cfg); err != nil {
+			return nil, err
+		}
+		return []imageConfig{cfg}, nil
+	}
+
+	var configs []imageConfig
+	for _, d := range m.Manifests {
+		switch d.MediaType {
+		case ocispec.MediaTypeImageManifest, consts.DockerManifestSchema2, ocispec.MediaTypeImageIndex, consts.DockerManifestListSchema2:
+		default:
+			continue
+		}
+		var child manifestRecord
+		if err := l.fetchJSON(ctx, d, &child); err != nil {
+			return nil, err
+		}
+		cfgs, err := l.imageConfigs(ctx, child)
+		if err != nil {
+			return nil, err
+		}
+		// the platform an index gives an image is what it's selected by, whatever its config says
+		if d.Platform != nil && len(child.Manifests) == 0 {
+			for i := range cfgs {
+				cfgs[i].Platform = *d.Platform
+			}
+		}
+		configs = append(configs, cfgs...)
+	}
+	return configs, nil
+}
+
+// Walk walks the references of the store, only visiting those that match every one of filters
+func (l *Layout) Walk(fn func(reference string, desc ocispec.Descriptor) error, filters ...Filter) error {
+	f := makeFilter(filters...)
+	return l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		ok, err := f.matches(context.Background(), l, reference, desc)
+		if err != nil || !ok {
+			return err
+		}
+		return fn(reference, desc)
+	})
+}
+
+type annotationSelector struct {
+	key, value string
+	// exists alone checks only whether key is set, otherwise equals checks its value
+	exists, negate bool
+}
+
+func parseAnnotationSelector(s string) annotationSelector {
+	if i := strings.Index(s, "!="); i != -1 {
+		return annotationSelector{key: s[:i], value: s[i+2:], negate: true}
+	}
+	if i := strings.Index(s, "="); i != -1 {
+		return annotationSelector{key: s[:i], value: s[i+1:]}
+	}
+	if strings.HasPrefix(s, "!") {
+		return annotationSelector{key: s[1:], exists: true, negate: true}
+	}
+	return annotationSelector{key: s, exists: true}
+}
+
+func (s annotationSelector) matches(annotations map[string]string) bool {
+	v, ok := annotations[s.key]
+	if s.exists {
+		return ok != s.negate
+	}
+	return (ok && v == s.value) != s.negate
+}
+
+// globRegexp translates a reference glob into an anchored regular expression
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
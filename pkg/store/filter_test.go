@@ -0,0 +1,132 @@
+package store_test
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_WalkWithFilters(t *testing.T) {
+	s := newLayout(t)
+
+	chart := memory.NewMemory([]byte("chart"), "random",
+		memory.WithConfig(map[string]string{}, consts.ChartConfigMediaType),
+		memory.WithAnnotations(map[string]string{"team": "b", "tier": "prod"}))
+	contents := map[string]artifacts.OCI{
+		"registry.example.com/team-a/app:v1":     genArtifact(t, "app"),
+		"registry.example.com/team-a/sub/app:v1": genArtifact(t, "sub"),
+		"registry.example.com/team-b/chart:v1":   chart,
+		"registry.example.com/team-b/data:v1":    memory.NewMemory([]byte("data"), "random", memory.WithAnnotations(map[string]string{"team": "b"})),
+	}
+	for ref, a := range contents {
+		if _, err := s.AddOCI(ctx, a, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		filters []store.Filter
+		want    []string
+	}{
+		{
+			name: "should visit everything without filters",
+			want: []string{"registry.example.com/team-a/app:v1", "registry.example.com/team-a/sub/app:v1", "registry.example.com/team-b/chart:v1", "registry.example.com/team-b/data:v1"},
+		},
+		{
+			name:    "should match a glob within a repository path segment",
+			filters: []store.Filter{store.MatchReference("registry.example.com/team-a/*")},
+			want:    []string{"registry.example.com/team-a/app:v1"},
+		},
+		{
+			name:    "should match a glob across path segments",
+			filters: []store.Filter{store.MatchReference("registry.example.com/team-a/**")},
+			want:    []string{"registry.example.com/team-a/app:v1", "registry.example.com/team-a/sub/app:v1"},
+		},
+		{
+			name:    "should match any glob of a filter",
+			filters: []store.Filter{store.MatchReference("**/app:*", "**/chart:*")},
+			want:    []string{"registry.example.com/team-a/app:v1", "registry.example.com/team-a/sub/app:v1", "registry.example.com/team-b/chart:v1"},
+		},
+		{
+			name:    "should match every glob filter",
+			filters: []store.Filter{store.MatchReference("registry.example.com/team-a/**"), store.MatchReference("**/sub/*")},
+			want:    []string{"registry.example.com/team-a/sub/app:v1"},
+		},
+		{
+			name:    "should match every reference filter",
+			filters: []store.Filter{store.MatchReference("**/team-b/*"), store.MatchReferenceRegexp(regexp.MustCompile(`/data:`))},
+			want:    []string{"registry.example.com/team-b/data:v1"},
+		},
+		{
+			name:    "should match a regexp",
+			filters: []store.Filter{store.MatchReferenceRegexp(regexp.MustCompile(`/(chart|data):`))},
+			want:    []string{"registry.example.com/team-b/chart:v1", "registry.example.com/team-b/data:v1"},
+		},
+		{
+			name:    "should match a media type",
+			filters: []store.Filter{store.MatchMediaType(string(types.DockerManifestSchema2))},
+			want:    []string{"registry.example.com/team-a/app:v1", "registry.example.com/team-a/sub/app:v1"},
+		},
+		{
+			name:    "should match every media type filter",
+			filters: []store.Filter{store.MatchMediaType(string(types.DockerManifestSchema2)), store.MatchMediaType(ocispec.MediaTypeImageManifest)},
+		},
+		{
+			name:    "should match an artifact type",
+			filters: []store.Filter{store.MatchArtifactType(consts.ChartConfigMediaType)},
+			want:    []string{"registry.example.com/team-b/chart:v1"},
+		},
+		{
+			name:    "should match every annotation selector",
+			filters: []store.Filter{store.MatchAnnotations("team=b", "!tier")},
+			want:    []string{"registry.example.com/team-b/data:v1"},
+		},
+		{
+			name:    "should match every filter",
+			filters: []store.Filter{store.MatchReference("**/team-b/*"), store.MatchAnnotations("tier!=dev", "tier")},
+			want:    []string{"registry.example.com/team-b/chart:v1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			if err := s.Walk(func(reference string, desc ocispec.Descriptor) error {
+				got = append(got, reference)
+				return nil
+			}, tt.filters...); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Walk() = %v, want %v", got, tt.want)
+			}
+
+			records, err := s.List(ctx, tt.filters...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != len(tt.want) {
+				t.Errorf("List() = %d records, want %d", len(records), len(tt.want))
+			}
+		})
+	}
+
+	dst := tempLayout(t)
+	descs, err := s.CopyAll(ctx, dst.OCI, nil, store.WithFilter(store.MatchReference("registry.example.com/team-a/**")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descs) != 2 {
+		t.Errorf("CopyAll() copied %d references, want 2", len(descs))
+	}
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+)
+
+// Query selects references of the store, a reference having to match every field that is set, and at least one of
+// the values of each (but every selector of Annotations and Labels)
+type Query struct {
+	// References are globs of references, as with MatchReference
+	References []string
+
+	// MediaTypes are media types of manifests (or indexes), as with MatchMediaType
+	MediaTypes []string
+
+	// ArtifactTypes are artifact types or config media types, as with MatchArtifactType
+	ArtifactTypes []string
+
+	// Annotations are selectors of annotations, as with MatchAnnotations
+	Annotations []string
+
+	// Labels are selectors of image labels, as with MatchLabels
+	Labels []string
+
+	// Platforms are os/arch[/variant] platforms of images, as with MatchPlatform
+	Platforms []string
+}
+
+// Filters returns the filters matching what q selects, for Walk or CopyAll
+func (q Query) Filters() []Filter {
+	var filters []Filter
+	if len(q.References) > 0 {
+		filters = append(filters, MatchReference(q.References...))
+	}
+	if len(q.MediaTypes) > 0 {
+		filters = append(filters, MatchMediaType(q.MediaTypes...))
+	}
+	if len(q.ArtifactTypes) > 0 {
+		filters = append(filters, MatchArtifactType(q.ArtifactTypes...))
+	}
+	if len(q.Annotations) > 0 {
+		filters = append(filters, MatchAnnotations(q.Annotations...))
+	}
+	if len(q.Labels) > 0 {
+		filters = append(filters, MatchLabels(q.Labels...))
+	}
+	if len(q.Platforms) > 0 {
+		filters = append(filters, MatchPlatform(q.Platforms...))
+	}
+	return filters
+}
+
+// Find returns a Record of every reference of the store q selects, sorted by reference
+func (l *Layout) Find(ctx context.Context, q Query) ([]Record, error) {
+	return l.List(ctx, q.Filters()...)
+}
@@ -0,0 +1,110 @@
+package store_test
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Find(t *testing.T) {
+	s := newLayout(t)
+
+	labeled := func(os, arch string, labels map[string]string) v1.Image {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg = cfg.DeepCopy()
+		cfg.OS, cfg.Architecture = os, arch
+		cfg.Config.Labels = labels
+		if img, err = mutate.ConfigFile(img, cfg); err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+	images := map[string]v1.Image{
+		"images/api:v1": labeled("linux", "amd64", map[string]string{"team": "a", "tier": "prod"}),
+		"images/web:v1": labeled("linux", "arm64", map[string]string{"team": "b"}),
+	}
+	for ref, img := range images {
+		if _, err := s.AddImage(ctx, img, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.AddImageIndex(ctx, genIndex(t, "windows/amd64"), "images/win:v1"); err != nil {
+		t.Fatal(err)
+	}
+	data := memory.NewMemory([]byte("data"), "random",
+		memory.WithConfig(map[string]string{}, consts.MemoryConfigMediaType),
+		memory.WithAnnotations(map[string]string{"team": "a"}))
+	if _, err := s.AddOCI(ctx, data, "memory/data:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query store.Query
+		want  []string
+	}{
+		{
+			name: "should find everything with an empty query",
+			want: []string{"images/api:v1", "images/web:v1", "images/win:v1", "memory/data:v1"},
+		},
+		{
+			name:  "should find images by label",
+			query: store.Query{Labels: []string{"team=a"}},
+			want:  []string{"images/api:v1"},
+		},
+		{
+			name:  "should find images by every label selector",
+			query: store.Query{Labels: []string{"team", "!tier"}},
+			want:  []string{"images/web:v1"},
+		},
+		{
+			name:  "should find images by platform",
+			query: store.Query{Platforms: []string{"linux/arm64"}},
+			want:  []string{"images/web:v1"},
+		},
+		{
+			name:  "should find indexes by the platforms of their images",
+			query: store.Query{Platforms: []string{"windows/amd64", "linux/amd64"}},
+			want:  []string{"images/api:v1", "images/win:v1"},
+		},
+		{
+			name:  "should find by annotation and artifact type",
+			query: store.Query{Annotations: []string{"team=a"}, ArtifactTypes: []string{consts.MemoryConfigMediaType}},
+			want:  []string{"memory/data:v1"},
+		},
+		{
+			name:  "should find by every field",
+			query: store.Query{References: []string{"images/*"}, Platforms: []string{"linux/amd64"}, Labels: []string{"tier=prod"}},
+			want:  []string{"images/api:v1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := s.Find(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			var got []string
+			for _, r := range records {
+				got = append(got, r.Reference)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Find() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
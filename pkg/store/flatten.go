@@ -0,0 +1,266 @@
+package store
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// whiteoutPrefix marks an entry removing what lower layers hold of the path it prefixes
+	whiteoutPrefix = ".wh."
+
+	// opaqueWhiteout marks a directory as hiding everything lower layers hold beneath it
+	opaqueWhiteout = whiteoutPrefix + whiteoutPrefix + ".opq"
+
+	// maxSymlinks is how many symlinks are followed resolving a single path before giving up on it
+	maxSymlinks = 255
+)
+
+// Flatten writes the root filesystem of the image stored under ref into dir, its layers applied oldest first
+// 	Whiteouts remove what lower layers hold of a path, opaque whiteouts everything beneath a directory, and neither is
+// 	written itself.  Symlinks are resolved as if dir were the root they will be, so no entry ever lands outside of
+// 	it.  Devices, fifos and ownership can't be recreated without privileges and are skipped, and the owner is always
+// 	left able to read (and traverse) what it extracted.
+func (l *Layout) Flatten(ctx context.Context, ref string, dir string) error {
+	img, err := l.Image(ctx, ref)
+	if err != nil {
+		return err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	for i, layer := range layers {
+		if err := applyLayer(ctx, layer, dir); err != nil {
+			return fmt.Errorf("flatten %s: layer %d: %w", ref, i, err)
+		}
+	}
+	return nil
+}
+
+// applyLayer applies the entries of layer, whatever it's compressed with, on top of dir
+func applyLayer(ctx context.Context, layer gv1.Layer, dir string) error {
+	rc, err := layer.Compressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	br := bufio.NewReader(rc)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	var r io.Reader = br
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(&contextReader{ctx: ctx, r: r})
+	// what this layer wrote, so its own opaque whiteouts leave it be
+	written := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if name == "" {
+			continue
+		}
+		parent, base := path.Split(name)
+		parentPath, err := rootPath(dir, parent)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case base == opaqueWhiteout:
+			entries, err := os.ReadDir(parentPath)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			for _, e := range entries {
+				if written[path.Join(parent, e.Name())] {
+					continue
+				}
+				if err := os.RemoveAll(filepath.Join(parentPath, e.Name())); err != nil {
+					return err
+				}
+			}
+			continue
+
+		case strings.HasPrefix(base, whiteoutPrefix):
+			target, err := whiteoutTarget(dir, parentPath, strings.TrimPrefix(base, whiteoutPrefix))
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := applyEntry(tr, hdr, dir, filepath.Join(parentPath, base)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		written[name] = true
+	}
+}
+
+// applyEntry writes the entry hdr describes to target, replacing anything a lower layer left there
+func applyEntry(tr *tar.Reader, hdr *tar.Header, dir string, target string) error {
+	mode := hdr.FileInfo().Mode().Perm()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(target, os.ModePerm); err != nil {
+			return err
+		}
+		return os.Chmod(target, mode|0700)
+
+	case tar.TypeReg:
+		if err := replace(target); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode|0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+
+	case tar.TypeSymlink:
+		if err := replace(target); err != nil {
+			return err
+		}
+		return os.Symlink(hdr.Linkname, target)
+
+	case tar.TypeLink:
+		linkname := strings.TrimPrefix(path.Clean("/"+hdr.Linkname), "/")
+		parent, base := path.Split(linkname)
+		parentPath, err := rootPath(dir, parent)
+		if err != nil {
+			return err
+		}
+		if err := replace(target); err != nil {
+			return err
+		}
+		return os.Link(filepath.Join(parentPath, base), target)
+	}
+	return nil
+}
+
+// whiteoutTarget returns the path beneath root that the whiteout of name, in the directory parentPath, removes
+// 	Names that aren't a single element of a path (ie: "", "." or "..") are refused, as is anything that isn't
+// 	strictly beneath root.
+func whiteoutTarget(root string, parentPath string, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid whiteout of %q", name)
+	}
+	target := filepath.Join(parentPath, name)
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("whiteout of %q is outside of %s", name, root)
+	}
+	return target, nil
+}
+
+// replace removes whatever is at target, making sure the directory it's in exists
+func replace(target string) error {
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	return os.MkdirAll(filepath.Dir(target), os.ModePerm)
+}
+
+// rootPath returns the path beneath root of the slash separated name, following any symlink along it as if root
+// were "/"
+// 	Neither ".." nor a link (absolute or not) can climb above root, much like a chroot.
+func rootPath(root string, name string) (string, error) {
+	var resolved string
+	rest := strings.Split(name, "/")
+	for links := 0; len(rest) > 0; {
+		elem := rest[0]
+		rest = rest[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if resolved = path.Dir(resolved); resolved == "." {
+				resolved = ""
+			}
+			continue
+		}
+
+		next := path.Join(resolved, elem)
+		fi, err := os.Lstat(filepath.Join(root, filepath.FromSlash(next)))
+		if os.IsNotExist(err) || err == nil && fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if links++; links > maxSymlinks {
+			return "", fmt.Errorf("%s: too many levels of symbolic links", name)
+		}
+		target, err := os.Readlink(filepath.Join(root, filepath.FromSlash(next)))
+		if err != nil {
+			return "", err
+		}
+		target = filepath.ToSlash(target)
+		if path.IsAbs(target) {
+			resolved = ""
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return filepath.Join(root, filepath.FromSlash(resolved)), nil
+}
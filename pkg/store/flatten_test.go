@@ -0,0 +1,180 @@
+package store_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+func TestLayout_Flatten(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks on windows takes privileges")
+	}
+	s := newLayout(t)
+
+	img, err := mutate.AppendLayers(empty.Image,
+		tarLayer(t,
+			tarEntry{hdr: tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+			tarEntry{hdr: tar.Header{Name: "etc/removed", Mode: 0644}, data: "removed"},
+			tarEntry{hdr: tar.Header{Name: "etc/kept", Mode: 0644}, data: "kept"},
+			tarEntry{hdr: tar.Header{Name: "opt/old", Mode: 0644}, data: "old"},
+			tarEntry{hdr: tar.Header{Name: "usr/lib/", Typeflag: tar.TypeDir, Mode: 0755}},
+			tarEntry{hdr: tar.Header{Name: "lib", Typeflag: tar.TypeSymlink, Linkname: "usr/lib"}},
+			tarEntry{hdr: tar.Header{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: "/../../.."}},
+		),
+		tarLayer(t,
+			tarEntry{hdr: tar.Header{Name: "etc/.wh.removed"}},
+			tarEntry{hdr: tar.Header{Name: "opt/.wh..wh..opq"}},
+			tarEntry{hdr: tar.Header{Name: "opt/new", Mode: 0644}, data: "new"},
+			tarEntry{hdr: tar.Header{Name: "lib/libz.so", Mode: 0755}, data: "libz"},
+			tarEntry{hdr: tar.Header{Name: "etc/linked", Typeflag: tar.TypeLink, Linkname: "etc/kept"}},
+			tarEntry{hdr: tar.Header{Name: "escape/escaped", Mode: 0644}, data: "escaped"},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, img, "images/layered:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "rootfs")
+	if err := s.Flatten(ctx, "images/layered:v1", dir); err != nil {
+		t.Fatalf("Flatten() error = %v", err)
+	}
+
+	want := map[string]string{
+		"etc/kept":        "kept",
+		"etc/linked":      "kept",
+		"opt/new":         "new",
+		"usr/lib/libz.so": "libz",
+		"escaped":         "escaped",
+	}
+	for name, data := range want {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Flatten() didn't write %s: %v", name, err)
+			continue
+		}
+		if string(got) != data {
+			t.Errorf("Flatten() wrote %s = %q, want %q", name, got, data)
+		}
+	}
+	for _, name := range []string{"etc/removed", "etc/.wh.removed", "opt/old", "opt/.wh..wh..opq"} {
+		if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("Flatten() left %s behind, error = %v", name, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(filepath.Dir(dir), "escaped")); !os.IsNotExist(err) {
+		t.Errorf("Flatten() wrote outside of its directory, error = %v", err)
+	}
+
+	if err := s.Flatten(ctx, "images/missing:v1", t.TempDir()); err == nil {
+		t.Errorf("Flatten() of a missing reference error = nil")
+	}
+}
+
+func TestLayout_FlattenWhiteouts(t *testing.T) {
+	s := newLayout(t)
+
+	tcs := []struct {
+		name     string
+		whiteout string
+		wantErr  bool
+	}{
+		{name: "parent", whiteout: ".wh...", wantErr: true},
+		{name: "root", whiteout: ".wh..", wantErr: true},
+		{name: "empty", whiteout: ".wh.", wantErr: true},
+		{name: "nested parent", whiteout: "etc/.wh...", wantErr: true},
+		{name: "opaque root", whiteout: ".wh..wh..opq"},
+	}
+	for i, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := mutate.AppendLayers(empty.Image,
+				tarLayer(t,
+					tarEntry{hdr: tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+					tarEntry{hdr: tar.Header{Name: "lower", Mode: 0644}, data: "lower"},
+				),
+				tarLayer(t,
+					tarEntry{hdr: tar.Header{Name: tc.whiteout}},
+					tarEntry{hdr: tar.Header{Name: "upper", Mode: 0644}, data: "upper"},
+				),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ref := fmt.Sprintf("images/whiteout:v%d", i)
+			if _, err := s.AddImage(ctx, img, ref); err != nil {
+				t.Fatal(err)
+			}
+
+			parent := t.TempDir()
+			sentinel := filepath.Join(parent, "sentinel")
+			if err := os.WriteFile(sentinel, []byte("kept"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			dir := filepath.Join(parent, "rootfs")
+
+			err = s.Flatten(ctx, ref, dir)
+			if tc.wantErr != (err != nil) {
+				t.Errorf("Flatten() error = %v, want an error: %v", err, tc.wantErr)
+			}
+			if _, err := os.Stat(sentinel); err != nil {
+				t.Errorf("Flatten() removed what's beside its directory: %v", err)
+			}
+			if _, err := os.Stat(dir); err != nil {
+				t.Errorf("Flatten() removed its own directory: %v", err)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			// an opaque whiteout of the root only hides what the lower layers hold
+			if _, err := os.Lstat(filepath.Join(dir, "lower")); !os.IsNotExist(err) {
+				t.Errorf("Flatten() left lower behind, error = %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "upper")); err != nil {
+				t.Errorf("Flatten() didn't write upper: %v", err)
+			}
+		})
+	}
+}
+
+// tarEntry is an entry of a layer built by tarLayer
+type tarEntry struct {
+	hdr  tar.Header
+	data string
+}
+
+// tarLayer returns a gzipped layer holding entries, in order
+func tarLayer(t *testing.T, entries ...tarEntry) v1.Layer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.data))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
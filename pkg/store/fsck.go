@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// FsckReport lists every problem found while verifying a store
+type FsckReport struct {
+	// Checked is the number of blobs on disk that were re-hashed
+	Checked int
+
+	// Corrupted blobs don't hash to their filename's digest, or are larger than a manifest says they should be
+	Corrupted []digest.Digest
+
+	// Truncated blobs are smaller than a manifest says they should be
+	Truncated []digest.Digest
+
+	// Missing blobs are referenced by a manifest but aren't on disk
+	Missing []digest.Digest
+}
+
+// OK is true when no problems were found
+func (r *FsckReport) OK() bool {
+	return len(r.Corrupted) == 0 && len(r.Truncated) == 0 && len(r.Missing) == 0
+}
+
+type blobState struct {
+	size  int64
+	valid bool
+}
+
+// Fsck verifies the integrity of the store
+// 	Every blob on disk is re-hashed and validated against the digest in its filename, and every blob reachable from
+// 	the index is checked for presence and against the size recorded by whatever references it
+func (l *Layout) Fsck(ctx context.Context) (*FsckReport, error) {
+	report := &FsckReport{}
+
+	onDisk, err := l.hashBlobs(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+
+	corrupted := make(map[digest.Digest]bool)
+	for d, s := range onDisk {
+		if !s.valid {
+			corrupted[d] = true
+		}
+	}
+	truncated := make(map[digest.Digest]bool)
+	missing := make(map[digest.Digest]bool)
+
+	seen := make(map[digest.Digest]bool)
+	var visit func(desc ocispec.Descriptor) error
+	visit = func(desc ocispec.Descriptor) error {
+		if seen[desc.Digest] {
+			return nil
+		}
+		seen[desc.Digest] = true
+
+		s, ok := onDisk[desc.Digest]
+		switch {
+		case !ok:
+			missing[desc.Digest] = true
+			return nil
+		case desc.Size > 0 && s.size < desc.Size:
+			truncated[desc.Digest] = true
+			delete(corrupted, desc.Digest)
+			return nil
+		case desc.Size > 0 && s.size > desc.Size:
+			corrupted[desc.Digest] = true
+			return nil
+		case !s.valid:
+			return nil
+		}
+
+		succs, err := l.successors(ctx, desc)
+		if err != nil {
+			// the blob hashed correctly, so this is a manifest that was invalid when it was written
+			corrupted[desc.Digest] = true
+			return nil
+		}
+		for _, succ := range succs {
+			if err := visit(succ); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		return visit(desc)
+	}); err != nil {
+		return nil, err
+	}
+
+	report.Corrupted = sortedDigests(corrupted)
+	report.Truncated = sortedDigests(truncated)
+	report.Missing = sortedDigests(missing)
+
+	for _, problem := range []struct {
+		name    string
+		digests []digest.Digest
+	}{
+		{"corrupted", report.Corrupted},
+		{"truncated", report.Truncated},
+		{"missing", report.Missing},
+	} {
+		for _, d := range problem.digests {
+			l.emit(Event{Type: EventVerificationFailed, Descriptor: ocispec.Descriptor{Digest: d}, Err: fmt.Errorf("blob %s is %s", d, problem.name)})
+		}
+	}
+	return report, nil
+}
+
+// hashBlobs re-hashes every blob on disk
+func (l *Layout) hashBlobs(ctx context.Context, report *FsckReport) (map[digest.Digest]blobState, error) {
+	states := make(map[digest.Digest]blobState)
+
+	algs, err := l.OCI.Driver().ReadDir("blobs")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return states, nil
+		}
+		return nil, err
+	}
+
+	for _, alg := range algs {
+		if !alg.IsDir() {
+			continue
+		}
+
+		blobs, err := l.OCI.Driver().ReadDir(path.Join("blobs", alg.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, b := range blobs {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			d := digest.NewDigestFromEncoded(digest.Algorithm(alg.Name()), b.Name())
+			if err := d.Validate(); err != nil {
+				continue
+			}
+
+			s, err := hashBlob(ctx, l.OCI.Driver(), path.Join("blobs", alg.Name(), b.Name()), d)
+			if err != nil {
+				return nil, err
+			}
+			states[d] = s
+			report.Checked++
+		}
+	}
+	return states, nil
+}
+
+func hashBlob(ctx context.Context, fsys fs.FS, name string, d digest.Digest) (blobState, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return blobState{}, err
+	}
+	defer f.Close()
+
+	verifier := d.Verifier()
+	n, err := io.Copy(verifier, &contextReader{ctx: ctx, r: f})
+	if err != nil {
+		return blobState{}, err
+	}
+	return blobState{size: n, valid: verifier.Verified()}, nil
+}
+
+func sortedDigests(set map[digest.Digest]bool) []digest.Digest {
+	var ds []digest.Digest
+	for d := range set {
+		ds = append(ds, d)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	return ds
+}
@@ -0,0 +1,56 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestLayout_Fsck(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("Fsck() found problems in a healthy store: %+v", report)
+	}
+
+	img, err := s.Image(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob := func(h v1.Hash) string {
+		return filepath.Join(root, "blobs", h.Algorithm, h.Hex)
+	}
+	if err := os.Remove(blob(m.Layers[0].Digest)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(blob(m.Layers[1].Digest), 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(blob(m.Layers[2].Digest), make([]byte, m.Layers[2].Size), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = s.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Missing) != 1 || len(report.Truncated) != 1 || len(report.Corrupted) != 1 {
+		t.Errorf("Fsck() = %+v, want one missing, truncated and corrupted blob", report)
+	}
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// GCReport summarizes a garbage collection run
+type GCReport struct {
+	Deleted        []digest.Digest
+	ReclaimedBytes int64
+}
+
+// GC deletes every blob in the layout that isn't reachable from the stores index
+// 	Reachability is computed by walking every indexed manifest (and the manifests of every indexed index), anything
+// 	under blobs/ that isn't part of that set is removed.  What open transactions have staged is reachable as well,
+// 	and GC waits for the adds in flight to be indexed (or staged) before it starts.
+func (l *Layout) GC(ctx context.Context) (*GCReport, error) {
+	if err := l.writable("gc"); err != nil {
+		return nil, err
+	}
+	l.gcMu.Lock()
+	defer l.gcMu.Unlock()
+
+	reachable, err := l.reachable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &GCReport{}
+	algs, err := l.OCI.Driver().ReadDir("blobs")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return report, nil
+		}
+		return nil, err
+	}
+
+	for _, alg := range algs {
+		if !alg.IsDir() {
+			continue
+		}
+
+		blobs, err := l.OCI.Driver().ReadDir(path.Join("blobs", alg.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, b := range blobs {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			d := digest.NewDigestFromEncoded(digest.Algorithm(alg.Name()), b.Name())
+			if err := d.Validate(); err != nil {
+				// not something we wrote, leave it be
+				continue
+			}
+			if _, ok := reachable[d]; ok {
+				continue
+			}
+
+			info, err := b.Info()
+			if err != nil {
+				return nil, err
+			}
+			if err := l.deleteBlob(ctx, ocispec.Descriptor{Digest: d}); err != nil {
+				return nil, err
+			}
+
+			report.Deleted = append(report.Deleted, d)
+			report.ReclaimedBytes += info.Size()
+			l.emit(Event{Type: EventCollected, Descriptor: ocispec.Descriptor{Digest: d, Size: info.Size()}})
+			if l.metrics != nil {
+				l.metrics.Collected(info.Size())
+			}
+		}
+	}
+	return report, nil
+}
+
+type stagingKey struct{}
+
+// staging holds GC off until done is called, so the blobs written with the returned context aren't collected before
+// they're indexed
+// 	Operations running within one holding it (ie: the AddImage of each image ImportArchive imports) don't take it
+// 	again, which would deadlock with a GC waiting for it.
+func (l *Layout) staging(ctx context.Context) (context.Context, func()) {
+	if ctx.Value(stagingKey{}) != nil {
+		return ctx, func() {}
+	}
+	l.gcMu.RLock()
+	return context.WithValue(ctx, stagingKey{}, true), l.gcMu.RUnlock
+}
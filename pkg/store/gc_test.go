@@ -0,0 +1,38 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+)
+
+func TestLayout_GC(t *testing.T) {
+	s := newLayout(t)
+
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("orphaned"), "random"), "a:v1"); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.AddOCI(ctx, genArtifact(t, "b:v1"), "b:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(ctx, "a:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.GC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// manifest, config and layer of a:v1
+	if len(report.Deleted) != 3 {
+		t.Errorf("GC() deleted %d blobs, want 3", len(report.Deleted))
+	}
+	if report.ReclaimedBytes == 0 {
+		t.Errorf("GC() reported no reclaimed bytes")
+	}
+	if _, err := s.Image(ctx, "b:v1"); err != nil {
+		t.Errorf("GC() broke reachable reference %s: %v", kept.Digest, err)
+	}
+}
@@ -0,0 +1,248 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// Predecessors returns every manifest (or index) in the store that directly references the blob identified by d
+// 	Nested manifests of an index are searched as well, so a layer shared by several platforms reports each of them
+func (l *Layout) Predecessors(ctx context.Context, d digest.Digest) ([]ocispec.Descriptor, error) {
+	var preds []ocispec.Descriptor
+	seen := make(map[digest.Digest]bool)
+
+	var visit func(desc ocispec.Descriptor) error
+	visit = func(desc ocispec.Descriptor) error {
+		if seen[desc.Digest] {
+			return nil
+		}
+		seen[desc.Digest] = true
+
+		succs, err := l.successors(ctx, desc)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range succs {
+			if s.Digest == d {
+				preds = append(preds, desc)
+				break
+			}
+		}
+		for _, s := range succs {
+			if err := visit(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		return visit(desc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return preds, nil
+}
+
+// Descendants returns desc and every blob reachable from it, by digest
+func (l *Layout) Descendants(ctx context.Context, desc ocispec.Descriptor) (map[digest.Digest]ocispec.Descriptor, error) {
+	seen := make(map[digest.Digest]ocispec.Descriptor)
+	if err := l.descendants(ctx, desc, seen); err != nil {
+		return nil, err
+	}
+	return seen, nil
+}
+
+// resolve returns the descriptor indexed under ref, with an error wrapping ErrRefNotFound if there is none
+func (l *Layout) resolve(ctx context.Context, ref string) (ocispec.Descriptor, error) {
+	if desc, ok, err := l.staged(ctx, ref); ok {
+		return desc, err
+	}
+	_, desc, err := l.OCI.Resolve(ctx, ref)
+	return desc, err
+}
+
+// reachable returns the digests of every blob reachable from the stores index, or from what open transactions have
+// staged
+func (l *Layout) reachable(ctx context.Context) (map[digest.Digest]ocispec.Descriptor, error) {
+	seen := make(map[digest.Digest]ocispec.Descriptor)
+	err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		return l.descendants(ctx, desc, seen)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range l.openTxs() {
+		if err := l.descendants(ctx, desc, seen); err != nil {
+			return nil, err
+		}
+	}
+	return seen, nil
+}
+
+// descendants records desc and everything reachable from it into seen, skipping anything seen already
+func (l *Layout) descendants(ctx context.Context, desc ocispec.Descriptor, seen map[digest.Digest]ocispec.Descriptor) error {
+	if _, ok := seen[desc.Digest]; ok {
+		return nil
+	}
+	seen[desc.Digest] = desc
+
+	succs, err := l.successors(ctx, desc)
+	if err != nil {
+		return err
+	}
+	for _, s := range succs {
+		if err := l.descendants(ctx, s, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// layers returns the layer descriptors of desc, descending into every manifest of an index
+func (l *Layout) layers(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, consts.DockerManifestSchema2:
+		var m ocispec.Manifest
+		if err := l.fetchJSON(ctx, desc, &m); err != nil {
+			return nil, err
+		}
+		return m.Layers, nil
+
+	case ocispec.MediaTypeImageIndex, consts.DockerManifestListSchema2:
+		var idx ocispec.Index
+		if err := l.fetchJSON(ctx, desc, &idx); err != nil {
+			return nil, err
+		}
+
+		var layers []ocispec.Descriptor
+		for _, m := range idx.Manifests {
+			ls, err := l.layers(ctx, m)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, ls...)
+		}
+		return layers, nil
+	}
+	return nil, nil
+}
+
+// successors returns the descriptors directly referenced by desc, or nothing if desc isn't a manifest or index
+func (l *Layout) successors(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, consts.DockerManifestSchema2:
+		var m ocispec.Manifest
+		if err := l.fetchJSON(ctx, desc, &m); err != nil {
+			return nil, err
+		}
+		return append([]ocispec.Descriptor{m.Config}, m.Layers...), nil
+
+	case ocispec.MediaTypeImageIndex, consts.DockerManifestListSchema2:
+		var idx ocispec.Index
+		if err := l.fetchJSON(ctx, desc, &idx); err != nil {
+			return nil, err
+		}
+		return idx.Manifests, nil
+	}
+	return nil, nil
+}
+
+// subject returns the subject of the manifest identified by desc, or nil if it has none
+func (l *Layout) subject(ctx context.Context, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, consts.DockerManifestSchema2, ocispec.MediaTypeImageIndex:
+	default:
+		return nil, nil
+	}
+
+	// indexes carry a subject too, so only decode what both have
+	var m struct {
+		Subject *ocispec.Descriptor `json:"subject,omitempty"`
+	}
+	if err := l.fetchJSON(ctx, desc, &m); err != nil {
+		return nil, err
+	}
+	return m.Subject, nil
+}
+
+// marshalManifest serializes m, along with its artifactType and the subject it refers to if it has them
+func marshalManifest(m *gv1.Manifest, artifactType string, subject *gv1.Descriptor) ([]byte, error) {
+	if subject == nil && artifactType == "" {
+		return json.Marshal(m)
+	}
+
+	// image-spec v1.0 (and so gv1.Manifest) predates the subject and artifactType fields
+	return json.Marshal(struct {
+		*gv1.Manifest
+		ArtifactType string          `json:"artifactType,omitempty"`
+		Subject      *gv1.Descriptor `json:"subject,omitempty"`
+	}{m, artifactType, subject})
+}
+
+// preserveManifest returns the raw manifest of oci rather than mdata, what the store is about to write referring to
+// subject, whenever both describe the same manifest, so its digest doesn't change with key ordering, whitespace or
+// fields gv1.Manifest lacks
+// 	mdata is only kept when the raw manifest is actually changed, ie: by descriptor hooks, encryption or a subject.
+func preserveManifest(oci artifacts.OCI, mdata []byte, artifactType string, subject *gv1.Descriptor) ([]byte, error) {
+	raw, err := oci.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed struct {
+		gv1.Manifest
+		ArtifactType string          `json:"artifactType,omitempty"`
+		Subject      *gv1.Descriptor `json:"subject,omitempty"`
+	}
+	// gv1.Manifest can't parse everything, ie: a subject that isn't sha256, and what it can't parse can't be compared
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return mdata, nil
+	}
+	if subject != nil && (parsed.Subject == nil || parsed.Subject.Digest != subject.Digest) {
+		return mdata, nil
+	}
+
+	if artifactType != "" && parsed.ArtifactType != artifactType {
+		return mdata, nil
+	}
+
+	remarshaled, err := marshalManifest(&parsed.Manifest, artifactType, subject)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(remarshaled, mdata) {
+		return mdata, nil
+	}
+	return raw, nil
+}
+
+func (l *Layout) fetchJSON(ctx context.Context, desc ocispec.Descriptor, v interface{}) error {
+	rc, err := l.OCI.Fetch(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return json.NewDecoder(rc).Decode(v)
+}
+
+// readBlob reads the whole of the blob desc, which is expected to be small (ie: a manifest or config)
+func (l *Layout) readBlob(ctx context.Context, desc ocispec.Descriptor) ([]byte, error) {
+	rc, err := l.OCI.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
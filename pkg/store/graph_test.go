@@ -0,0 +1,31 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+func TestLayout_Predecessors(t *testing.T) {
+	s := newLayout(t)
+
+	data := []byte("shared")
+	a := memory.NewMemory(data, "random", memory.WithConfig(map[string]string{"name": "a"}, consts.MemoryConfigMediaType))
+	b := memory.NewMemory(data, "random", memory.WithConfig(map[string]string{"name": "b"}, consts.MemoryConfigMediaType))
+	for ref, oci := range map[string]*memory.Memory{"a:v1": a, "b:v1": b} {
+		if _, err := s.AddOCI(ctx, oci, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	preds, err := s.Predecessors(ctx, digest.FromBytes(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preds) != 2 {
+		t.Errorf("Predecessors() returned %d manifests, want 2", len(preds))
+	}
+}
@@ -0,0 +1,233 @@
+package store_test
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+var (
+	ctx  context.Context
+	root string
+)
+
+func setup(t *testing.T) func() error {
+	tmpdir, err := os.MkdirTemp("", "ocil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = tmpdir
+
+	ctx = context.Background()
+
+	return func() error {
+		os.RemoveAll(tmpdir)
+		return nil
+	}
+}
+
+// newLayout sets t up with a Layout at root, removed once t is done
+func newLayout(t *testing.T, opts ...store.Options) *store.Layout {
+	t.Helper()
+	teardown := setup(t)
+	t.Cleanup(func() { teardown() })
+
+	s, err := store.NewLayout(root, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// tempLayout is a Layout in a directory of its own, removed once t is done
+func tempLayout(t *testing.T, opts ...store.Options) *store.Layout {
+	t.Helper()
+	s, err := store.NewLayout(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+type mockArtifact struct {
+	v1.Image
+}
+
+func (m mockArtifact) MediaType() string {
+	mt, err := m.Image.MediaType()
+	if err != nil {
+		return ""
+	}
+	return string(mt)
+}
+
+func (m mockArtifact) RawConfig() ([]byte, error) {
+	return m.RawConfigFile()
+}
+
+func genArtifact(t *testing.T, ref string) artifacts.OCI {
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &mockArtifact{
+		img,
+	}
+}
+
+// genPlatformImage returns a random image whose config says it's for os/arch
+func genPlatformImage(t *testing.T, os, arch string) v1.Image {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = cfg.DeepCopy()
+	cfg.OS, cfg.Architecture = os, arch
+	if img, err = mutate.ConfigFile(img, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func genIndex(t *testing.T, platforms ...string) v1.ImageIndex {
+	var adds []mutate.IndexAddendum
+	for _, p := range platforms {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parts := strings.SplitN(p, "/", 2)
+		adds = append(adds, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Platform: &v1.Platform{OS: parts[0], Architecture: parts[1]},
+			},
+		})
+	}
+	return mutate.AppendManifests(empty.Index, adds...)
+}
+
+type signedArtifact struct {
+	artifacts.OCI
+	sig artifacts.OCI
+}
+
+func (s *signedArtifact) Signatures() (artifacts.OCI, error) {
+	return s.sig, nil
+}
+
+// index embeds a v1.ImageIndex under a name of its own, that of its type being that of one of its methods
+type index = v1.ImageIndex
+
+// blobSizes returns the size of every blob in the layout at root
+func blobSizes(t *testing.T, root string) map[digest.Digest]int64 {
+	sizes := make(map[digest.Digest]int64)
+	err := filepath.Walk(filepath.Join(root, "blobs"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		sizes[digest.NewDigestFromEncoded(digest.Algorithm(filepath.Base(filepath.Dir(path))), info.Name())] = info.Size()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sizes
+}
+
+// refs returns the sorted references in s
+func refs(t *testing.T, s *store.Layout) []string {
+	var refs []string
+	if err := s.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		refs = append(refs, reference)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+func extractBundle(t *testing.T, r io.Reader, dir string) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(dir, hdr.Name)
+		if hdr.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// tarDir writes the regular files under dir to the tarball at path
+func tarDir(t *testing.T, dir string, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: filepath.ToSlash(rel), Size: info.Size(), Mode: 0644}); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,361 @@
+package store
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/cosign"
+)
+
+// containerdImageNameAnnotation is the annotation containerd (and nerdctl, buildkit, ...) record full image names under
+// in oci-archives, where the ref.name annotation is often only a tag
+const containerdImageNameAnnotation = "io.containerd.image.name"
+
+// ImportArchive adds every image in the archive at path to the store, the archive may either be a `docker save`
+// tarball or an oci-archive
+// 	Images in a docker archive are added under each of their repo tags, and images in an oci-archive under their
+// 	containerd image name or ref name annotation.  Untagged images are skipped, since there's nothing to index them by.
+func (l *Layout) ImportArchive(ctx context.Context, path string) ([]ocispec.Descriptor, error) {
+	if err := l.writable("import " + path); err != nil {
+		return nil, err
+	}
+	kind, err := archiveKind(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case consts.OCIImageIndexFile:
+		return l.importOCIArchive(ctx, path)
+	case dockerArchiveManifest:
+		return l.importDockerArchive(ctx, path)
+	}
+	return nil, fmt.Errorf("%s is neither a docker nor an oci archive", path)
+}
+
+const dockerArchiveManifest = "manifest.json"
+
+// archiveKind returns the name of the top level file identifying the kind of archive at path
+func archiveKind(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch name := strings.TrimPrefix(filepath.Clean(hdr.Name), "/"); name {
+		case consts.OCIImageIndexFile, dockerArchiveManifest:
+			return name, nil
+		}
+	}
+}
+
+func (l *Layout) importDockerArchive(ctx context.Context, path string) ([]ocispec.Descriptor, error) {
+	opener := func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+
+	m, err := tarball.LoadManifest(opener)
+	if err != nil {
+		return nil, err
+	}
+
+	var descs []ocispec.Descriptor
+	for _, entry := range m {
+		for _, t := range entry.RepoTags {
+			tag, err := gname.NewTag(t)
+			if err != nil {
+				return nil, err
+			}
+
+			img, err := tarball.Image(opener, &tag)
+			if err != nil {
+				return nil, err
+			}
+
+			desc, err := l.AddImage(ctx, img, t)
+			if err != nil {
+				return nil, err
+			}
+			descs = append(descs, desc)
+		}
+	}
+	return descs, nil
+}
+
+func (l *Layout) importOCIArchive(ctx context.Context, path string) ([]ocispec.Descriptor, error) {
+	tmpdir, err := os.MkdirTemp("", "ocil-import")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	if err := untar(ctx, path, tmpdir); err != nil {
+		return nil, err
+	}
+
+	p := layout.Path(tmpdir)
+	ii, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	// signatures (and whatever else is tagged after what it's attached to) are added after what they're attached to,
+	// for the signature policy to find it, which itself verifies with the signatures found beside it in the archive
+	refOf := func(m gv1.Descriptor) string {
+		if ref := m.Annotations[containerdImageNameAnnotation]; ref != "" {
+			return ref
+		}
+		return m.Annotations[ocispec.AnnotationRefName]
+	}
+	manifests := append([]gv1.Descriptor(nil), im.Manifests...)
+	sort.SliceStable(manifests, func(i, j int) bool {
+		_, ai := taggedSubject(refOf(manifests[i]))
+		_, aj := taggedSubject(refOf(manifests[j]))
+		return !ai && aj
+	})
+	archived := func(ref string, d gv1.Hash) func() (cosign.Signatures, error) {
+		return func() (cosign.Signatures, error) {
+			sigRef := signatureReference(ref, digest.Digest(d.String()))
+			for _, m := range manifests {
+				if refOf(m) == sigRef && m.MediaType.IsImage() {
+					return ii.Image(m.Digest)
+				}
+			}
+			return nil, nil
+		}
+	}
+
+	var descs []ocispec.Descriptor
+	for _, m := range manifests {
+		ref := refOf(m)
+		if ref == "" {
+			continue
+		}
+
+		var desc ocispec.Descriptor
+		switch {
+		case m.MediaType.IsImage():
+			img, err := ii.Image(m.Digest)
+			if err != nil {
+				return nil, err
+			}
+			a := admits(img, func() (digest.Digest, error) {
+				return hashDigest(img.Digest())
+			})
+			a.signatures = archived(ref, m.Digest)
+			desc, err = l.admitImage(ctx, img, ref, a)
+			if err != nil {
+				return nil, err
+			}
+
+		case m.MediaType.IsIndex():
+			idx, err := ii.ImageIndex(m.Digest)
+			if err != nil {
+				return nil, err
+			}
+			a := admits(idx, func() (digest.Digest, error) {
+				return hashDigest(idx.Digest())
+			})
+			a.signatures = archived(ref, m.Digest)
+			desc, err = l.admitImageIndex(ctx, idx, ref, a)
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, fmt.Errorf("unsupported media type %s for %s", m.MediaType, ref)
+		}
+		descs = append(descs, desc)
+	}
+	return descs, nil
+}
+
+// untar extracts the tarball at path into dir, rejecting any entry localPath does
+func untar(ctx context.Context, path string, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return extractTar(ctx, f, dir)
+}
+
+// extractTar extracts the directories, regular files, symlinks and hardlinks of the tarball read from r into dir, as
+// untar does
+// 	Entries are extracted beneath dir whatever the links before them point at, and links are rooted at dir: absolute
+// 	links and those climbing out of dir point at where they would were dir the root of the filesystem.  Modes and
+// 	mtimes are those of the entries, as is ownership when running as root, directories getting theirs once everything in
+// 	them has been extracted.
+func extractTar(ctx context.Context, r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	folded := foldedNames{}
+	var dirs []*tar.Header
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg, tar.TypeSymlink, tar.TypeLink:
+		default:
+			continue
+		}
+
+		if _, err := localPath(dir, hdr.Name); err != nil {
+			return err
+		}
+		if err := folded.add(hdr.Name); err != nil {
+			return err
+		}
+		target, err := rootedEntry(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if err := extractEntry(ctx, tr, hdr, dir, target); err != nil {
+			return fmt.Errorf("extract %s: %w", hdr.Name, err)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, hdr)
+			continue
+		}
+		if err := applyMetadata(target, hdr); err != nil {
+			return fmt.Errorf("extract %s: %w", hdr.Name, err)
+		}
+	}
+
+	// deepest first, so setting the mtime of a directory isn't undone by setting that of one inside it
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target, err := rootedEntry(dir, dirs[i].Name)
+		if err != nil {
+			return err
+		}
+		if err := applyMetadata(target, dirs[i]); err != nil {
+			return fmt.Errorf("extract %s: %w", dirs[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// rootedEntry is where the entry name of an archive extracts to beneath dir, the links leading to it resolved by
+// rootedPath but not the entry itself, which replaces whatever is there
+func rootedEntry(dir, name string) (string, error) {
+	clean := path.Clean(name)
+	parent, err := rootedPath(dir, path.Dir(clean))
+	if err != nil {
+		return "", err
+	}
+	if clean == "." {
+		return parent, nil
+	}
+	return filepath.Join(parent, path.Base(clean)), nil
+}
+
+func extractEntry(ctx context.Context, r io.Reader, hdr *tar.Header, dir, target string) error {
+	if hdr.Typeflag == tar.TypeDir {
+		if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+		return os.MkdirAll(target, os.ModePerm)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	// an entry replaces what's there rather than writing through it, were it a link
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		link := hdr.Linkname
+		if !path.IsAbs(link) {
+			link = path.Join(path.Dir(path.Clean(hdr.Name)), link)
+		}
+		to, err := rootedPath(dir, link)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.Dir(target), to)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(rel, target)
+
+	case tar.TypeLink:
+		if _, err := localPath(dir, hdr.Linkname); err != nil {
+			return err
+		}
+		from, err := rootedPath(dir, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		return os.Link(from, target)
+	}
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, &contextReader{ctx: ctx, r: r}); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// applyMetadata gives target the ownership (when running as root), mode and mtime of hdr, symlinks only their
+// ownership as their mode is never used and their mtime can't be set portably
+func applyMetadata(target string, hdr *tar.Header) error {
+	if os.Geteuid() == 0 {
+		if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		return nil
+	case tar.TypeLink:
+		// the file linked to is given its metadata by its own entry
+		return nil
+	}
+	if err := os.Chmod(target, hdr.FileInfo().Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+}
@@ -0,0 +1,104 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLayout_ImportArchive(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "archive.tar")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Export(ctx, f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dst := tempLayout(t)
+	descs, err := dst.ImportArchive(ctx, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descs) != 1 {
+		t.Fatalf("ImportArchive() imported %d images, want 1", len(descs))
+	}
+
+	want, err := s.Image(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := dst.Image(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCfg, _ := want.ConfigName()
+	gotCfg, _ := got.ConfigName()
+	if wantCfg != gotCfg {
+		t.Errorf("imported image config = %s, want %s", gotCfg, wantCfg)
+	}
+
+	report, err := dst.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("imported store is unhealthy: %+v", report)
+	}
+}
+
+func TestLayout_ImportArchive_OCI(t *testing.T) {
+	s := newLayout(t)
+
+	refs := []string{"hello/world:v1", "hello/multi:v1"}
+	if _, err := s.AddImage(ctx, genPlatformImage(t, "linux", "amd64"), refs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImageIndex(ctx, genIndex(t, "linux/amd64", "linux/arm64"), refs[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the store is an oci layout itself, the archive is its tarball
+	archive := filepath.Join(t.TempDir(), "archive.tar")
+	tarDir(t, root, archive)
+
+	dst := tempLayout(t)
+	descs, err := dst.ImportArchive(ctx, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descs) != len(refs) {
+		t.Fatalf("ImportArchive() imported %d artifacts, want %d", len(descs), len(refs))
+	}
+
+	for _, ref := range refs {
+		_, want, err := s.Resolve(ctx, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, got, err := dst.Resolve(ctx, ref)
+		if err != nil {
+			t.Fatalf("Resolve(%s) of the imported store: %v", ref, err)
+		}
+		if got.Digest != want.Digest || got.MediaType != want.MediaType {
+			t.Errorf("imported %s = %s %s, want %s %s", ref, got.MediaType, got.Digest, want.MediaType, want.Digest)
+		}
+	}
+
+	report, err := dst.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("imported store is unhealthy: %+v", report)
+	}
+}
@@ -0,0 +1,313 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// AddImageIndex adds a multi-platform image (an oci image index or docker manifest list) to the store
+// 	The index and every manifest it references are stored byte for byte, so platform descriptors and digests survive
+// 	a round trip through the store.  For the same reason, descriptor hooks only see the top level index descriptor.
+func (l *Layout) AddImageIndex(ctx context.Context, idx gv1.ImageIndex, ref string) (ocispec.Descriptor, error) {
+	return l.admitImageIndex(ctx, idx, ref, admits(idx, func() (digest.Digest, error) {
+		return hashDigest(idx.Digest())
+	}))
+}
+
+// admitImageIndex is AddImageIndex, admitting idx with a
+func (l *Layout) admitImageIndex(ctx context.Context, idx gv1.ImageIndex, ref string, a *admission) (ocispec.Descriptor, error) {
+	req := &Request{Operation: OperationAdd, Reference: ref, admits: a}
+	err := l.intercept(ctx, req, func(ctx context.Context, req *Request) error {
+		reports, err := l.scanIndex(ctx, idx, req.Reference)
+		if err != nil {
+			return err
+		}
+
+		desc, err := l.addImageIndex(ctx, idx, req.Reference)
+		req.Descriptor = desc
+		if err != nil {
+			return err
+		}
+		return l.addIndexScanReports(ctx, reports, req.Reference, desc)
+	})
+	return req.Descriptor, err
+}
+
+func (l *Layout) addImageIndex(ctx context.Context, idx gv1.ImageIndex, ref string) (ocispec.Descriptor, error) {
+	source := idx
+	if l.encryption != nil {
+		encrypted, err := encryptIndex(l.encryption, idx)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		idx = encrypted
+	}
+
+	desc, err := l.writeImageIndex(ctx, idx)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc.Annotations = l.indexAnnotations(source, im.Annotations, ref)
+	if err := l.runDescriptorHooks(&desc); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	return desc, l.addIndex(ctx, desc)
+}
+
+// writeImageIndex writes idx and everything it references to the layout, returning the descriptor of idx
+func (l *Layout) writeImageIndex(ctx context.Context, idx gv1.ImageIndex) (ocispec.Descriptor, error) {
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	for _, child := range im.Manifests {
+		switch {
+		case child.MediaType.IsIndex():
+			ci, err := idx.ImageIndex(child.Digest)
+			if err != nil {
+				return ocispec.Descriptor{}, err
+			}
+			if _, err := l.writeImageIndex(ctx, ci); err != nil {
+				return ocispec.Descriptor{}, err
+			}
+
+		case child.MediaType.IsImage():
+			img, err := idx.Image(child.Digest)
+			if err != nil {
+				return ocispec.Descriptor{}, err
+			}
+			if err := l.writeImage(ctx, img); err != nil {
+				return ocispec.Descriptor{}, err
+			}
+
+		default:
+			return ocispec.Descriptor{}, fmt.Errorf("unsupported media type %s for manifest %s", child.MediaType, child.Digest)
+		}
+	}
+
+	raw, err := idx.RawManifest()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := l.writeBlobData(ctx, raw); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	mt, err := idx.MediaType()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return ocispec.Descriptor{
+		MediaType: string(mt),
+		Digest:    digest.FromBytes(raw),
+		Size:      int64(len(raw)),
+	}, nil
+}
+
+// writeImage writes the manifest, config and layers of img to the layout, without touching the index
+func (l *Layout) writeImage(ctx context.Context, img gv1.Image) error {
+	raw, err := img.RawManifest()
+	if err != nil {
+		return err
+	}
+	if err := l.writeBlobData(ctx, raw); err != nil {
+		return err
+	}
+
+	cfg, err := img.RawConfigFile()
+	if err != nil {
+		return err
+	}
+	if err := l.writeBlobData(ctx, cfg); err != nil {
+		return err
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+
+	var g errgroup.Group
+	for _, lyr := range layers {
+		lyr := lyr
+		g.Go(func() error {
+			return l.writeLayer(ctx, lyr)
+		})
+	}
+	return g.Wait()
+}
+
+// AddImage adds img to the store as is, preserving its manifest byte for byte
+func (l *Layout) AddImage(ctx context.Context, img gv1.Image, ref string) (ocispec.Descriptor, error) {
+	return l.admitImage(ctx, img, ref, admits(img, func() (digest.Digest, error) {
+		return hashDigest(img.Digest())
+	}))
+}
+
+// admitImage is AddImage, admitting img with a
+func (l *Layout) admitImage(ctx context.Context, img gv1.Image, ref string, a *admission) (ocispec.Descriptor, error) {
+	req := &Request{Operation: OperationAdd, Reference: ref, admits: a}
+	err := l.intercept(ctx, req, func(ctx context.Context, req *Request) error {
+		report, err := l.scan(ctx, img, req.Reference)
+		if err != nil {
+			return err
+		}
+
+		desc, err := l.addImage(ctx, img, req.Reference)
+		req.Descriptor = desc
+		if err != nil {
+			return err
+		}
+		return l.addScanReport(ctx, report, req.Reference, desc)
+	})
+	return req.Descriptor, err
+}
+
+func (l *Layout) addImage(ctx context.Context, img gv1.Image, ref string) (ocispec.Descriptor, error) {
+	source := img
+	if l.encryption != nil {
+		encrypted, err := encryptImage(l.encryption, img)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		img = encrypted
+	}
+
+	if err := l.writeImage(ctx, img); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	raw, err := img.RawManifest()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	desc := ocispec.Descriptor{
+		MediaType:   string(mt),
+		Digest:      digest.FromBytes(raw),
+		Size:        int64(len(raw)),
+		Annotations: l.indexAnnotations(source, m.Annotations, ref),
+	}
+	if err := l.runDescriptorHooks(&desc); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	return desc, l.addIndex(ctx, desc)
+}
+
+// CreateIndex adds an oci image index of the images stored under memberRefs as newRef, each listed for the platform
+// its config is built for, ie: to publish a multi-arch reference of images added one platform at a time
+// 	The images are referenced as they are stored, so only the index itself is written.  Every member has to be an
+// 	image, and no two of them can be for the same platform.
+func (l *Layout) CreateIndex(ctx context.Context, newRef string, memberRefs ...string) (ocispec.Descriptor, error) {
+	req := &Request{Operation: OperationAdd, Reference: newRef}
+	err := l.intercept(ctx, req, func(ctx context.Context, req *Request) error {
+		if len(memberRefs) == 0 {
+			return fmt.Errorf("index %s has no members", req.Reference)
+		}
+
+		idx := ocispec.Index{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: ocispec.MediaTypeImageIndex,
+		}
+		platforms := make(map[string]string)
+		for _, ref := range memberRefs {
+			desc, p, err := l.indexMember(ctx, ref)
+			if err != nil {
+				return err
+			}
+			if other, ok := platforms[formatPlatform(p)]; ok {
+				return fmt.Errorf("%s and %s are both for %s", other, ref, formatPlatform(p))
+			}
+			platforms[formatPlatform(p)] = ref
+
+			idx.Manifests = append(idx.Manifests, ocispec.Descriptor{
+				MediaType: desc.MediaType,
+				Digest:    desc.Digest,
+				Size:      desc.Size,
+				Platform:  &p,
+			})
+		}
+
+		data, err := json.Marshal(idx)
+		if err != nil {
+			return err
+		}
+		d, err := l.writeManifestData(ctx, data)
+		if err != nil {
+			return err
+		}
+
+		desc := ocispec.Descriptor{
+			MediaType:   ocispec.MediaTypeImageIndex,
+			Digest:      d,
+			Size:        int64(len(data)),
+			Annotations: l.indexAnnotations(nil, nil, req.Reference),
+		}
+		if err := l.runDescriptorHooks(&desc); err != nil {
+			return err
+		}
+		req.Descriptor = desc
+		if err := l.verify(ctx, req.Reference, admitsDigest(d)); err != nil {
+			return err
+		}
+		return l.addIndex(ctx, desc)
+	})
+	return req.Descriptor, err
+}
+
+// indexMember returns the descriptor of the image stored under ref, and the platform its config is for
+func (l *Layout) indexMember(ctx context.Context, ref string) (ocispec.Descriptor, ocispec.Platform, error) {
+	desc, err := l.resolve(ctx, ref)
+	if err != nil {
+		return ocispec.Descriptor{}, ocispec.Platform{}, err
+	}
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, consts.DockerManifestSchema2:
+	default:
+		return ocispec.Descriptor{}, ocispec.Platform{}, fmt.Errorf("reference %s is not an image manifest: %s", ref, desc.MediaType)
+	}
+
+	var m ocispec.Manifest
+	if err := l.fetchJSON(ctx, desc, &m); err != nil {
+		return ocispec.Descriptor{}, ocispec.Platform{}, err
+	}
+	switch m.Config.MediaType {
+	case ocispec.MediaTypeImageConfig, consts.DockerConfigJSON:
+	default:
+		return ocispec.Descriptor{}, ocispec.Platform{}, fmt.Errorf("reference %s is not an image: %s", ref, m.Config.MediaType)
+	}
+
+	var p ocispec.Platform
+	if err := l.fetchJSON(ctx, m.Config, &p); err != nil {
+		return ocispec.Descriptor{}, ocispec.Platform{}, err
+	}
+	if p.OS == "" || p.Architecture == "" {
+		return ocispec.Descriptor{}, ocispec.Platform{}, fmt.Errorf("config of %s doesn't say which platform it's for", ref)
+	}
+	return desc, p, nil
+}
@@ -0,0 +1,242 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_SharedIndex(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	// two layouts on the same root stand in for two processes sharing a store
+	var g errgroup.Group
+	for i := 0; i < 2; i++ {
+		s, err := store.NewLayout(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		i := i
+		g.Go(func() error {
+			for j := 0; j < 10; j++ {
+				ref := fmt.Sprintf("layout%d/artifact:%d", i, j)
+				if _, err := s.AddOCI(ctx, memory.NewMemory([]byte(ref), "random"), ref); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refs int
+	if err := s.Walk(func(reference string, desc ocispec.Descriptor) error {
+		refs++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if refs != 20 {
+		t.Errorf("index has %d references, want 20", refs)
+	}
+}
+
+func TestLayout_AddImageIndex(t *testing.T) {
+	s := newLayout(t)
+
+	idx := genIndex(t, "linux/amd64", "linux/arm64")
+	want, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := "hello/multiarch:v1"
+	desc, err := s.AddImageIndex(ctx, idx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest.String() != want.String() {
+		t.Errorf("AddImageIndex() digest = %s, want %s", desc.Digest, want)
+	}
+
+	// round trip through a second store
+	dst := tempLayout(t)
+	if _, err := s.Copy(ctx, ref, dst.OCI, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	_, got, err := dst.Resolve(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Digest.String() != want.String() {
+		t.Errorf("copied index digest = %s, want %s", got.Digest, want)
+	}
+
+	report, err := dst.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Checked != 7 {
+		t.Errorf("copied index is incomplete: %+v", report)
+	}
+}
+
+func TestLayout_ReproducibleIndex(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	var contents []artifacts.OCI
+	var trefs []string
+	for i := 0; i < 5; i++ {
+		contents = append(contents, genArtifact(t, ""))
+		trefs = append(trefs, fmt.Sprintf("registry.example.com/app%d:v1", i))
+	}
+
+	// the same content added in opposite orders
+	var indexes [][]byte
+	for _, reverse := range []bool{false, true} {
+		dir := t.TempDir()
+		s, err := store.NewLayout(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range contents {
+			if reverse {
+				i = len(contents) - 1 - i
+			}
+			if _, err := s.AddOCI(ctx, contents[i], trefs[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, consts.OCIImageIndexFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexes = append(indexes, data)
+	}
+
+	if !bytes.Equal(indexes[0], indexes[1]) {
+		t.Errorf("index.json differs with the order content was added in:\n%s\n%s", indexes[0], indexes[1])
+	}
+
+	var idx ocispec.Index
+	if err := json.Unmarshal(indexes[0], &idx); err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range idx.Manifests {
+		if got := m.Annotations[ocispec.AnnotationRefName]; got != trefs[i] {
+			t.Errorf("manifest %d is %s, want %s", i, got, trefs[i])
+		}
+	}
+}
+
+func TestLayout_CreateIndex(t *testing.T) {
+	s := newLayout(t)
+
+	members := map[string]v1.Image{
+		"images/app:v1-amd64": genPlatformImage(t, "linux", "amd64"),
+		"images/app:v1-arm64": genPlatformImage(t, "linux", "arm64"),
+		"images/app:v0-arm64": genPlatformImage(t, "linux", "arm64"),
+	}
+	for ref, img := range members {
+		if _, err := s.AddImage(ctx, img, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("data"), "random"), "memory/data:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	desc, err := s.CreateIndex(ctx, "images/app:v1", "images/app:v1-amd64", "images/app:v1-arm64")
+	if err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+	if desc.MediaType != ocispec.MediaTypeImageIndex {
+		t.Errorf("CreateIndex() media type = %s, want %s", desc.MediaType, ocispec.MediaTypeImageIndex)
+	}
+
+	dst := tempLayout(t)
+	rc, err := s.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var idx ocispec.Index
+	if err := json.NewDecoder(rc).Decode(&idx); err != nil {
+		t.Fatal(err)
+	}
+	platforms := make(map[string]string)
+	for _, m := range idx.Manifests {
+		if m.Platform == nil {
+			t.Fatalf("CreateIndex() listed %s without a platform", m.Digest)
+		}
+		platforms[m.Platform.OS+"/"+m.Platform.Architecture] = m.Digest.String()
+	}
+	for ref, platform := range map[string]string{"images/app:v1-amd64": "linux/amd64", "images/app:v1-arm64": "linux/arm64"} {
+		want, err := members[ref].Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if platforms[platform] != want.String() {
+			t.Errorf("CreateIndex() lists %s for %s, want %s", platforms[platform], platform, want)
+		}
+	}
+	if len(idx.Manifests) != 2 {
+		t.Errorf("CreateIndex() listed %d manifests, want 2", len(idx.Manifests))
+	}
+
+	// the index is an image index like any other
+	if _, err := s.Copy(ctx, "images/app:v1", dst.OCI, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		members []string
+	}{
+		{
+			name: "should reject an index without members",
+		},
+		{
+			name:    "should reject members for the same platform",
+			members: []string{"images/app:v1-arm64", "images/app:v0-arm64"},
+		},
+		{
+			name:    "should reject members that aren't images",
+			members: []string{"images/app:v1-amd64", "memory/data:v1"},
+		},
+		{
+			name:    "should reject missing members",
+			members: []string{"images/app:missing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.CreateIndex(ctx, "images/app:bad", tt.members...); err == nil {
+				t.Errorf("CreateIndex() error = nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// Inspection is the parsed config of a stored manifest, what `crane config` or `docker inspect` would show of it
+type Inspection struct {
+	Reference  string
+	Descriptor ocispec.Descriptor
+
+	// ConfigMediaType is the media type of the config, telling images apart from other artifacts
+	ConfigMediaType string
+
+	// ArtifactType is the artifactType of the manifest, falling back to the media type of its config
+	ArtifactType string
+
+	// Image is the config of an image (its entrypoint, env, labels, history, ...), and nil for any other artifact
+	Image *gv1.ConfigFile
+
+	// Config is the config as it's stored, for artifacts whose config isn't an image config
+	Config json.RawMessage
+
+	// Annotations of the manifest
+	Annotations map[string]string
+}
+
+// Inspect returns the config of the manifest stored under ref, parsed for images and as it's stored for anything else
+// 	Indexes don't have a config, so the manifests of an index have to be inspected one by one.
+func (l *Layout) Inspect(ctx context.Context, ref string) (*Inspection, error) {
+	desc, err := l.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, consts.DockerManifestListSchema2:
+		return nil, fmt.Errorf("reference %s is an index, its manifests can be inspected but it has no config itself", ref)
+	}
+
+	var m struct {
+		ocispec.Manifest
+		ArtifactType string `json:"artifactType,omitempty"`
+	}
+	if err := l.fetchJSON(ctx, desc, &m); err != nil {
+		return nil, fmt.Errorf("manifest of %s: %w", ref, err)
+	}
+	raw, err := l.readBlob(ctx, m.Config)
+	if err != nil {
+		return nil, fmt.Errorf("config of %s: %w", ref, err)
+	}
+
+	i := &Inspection{
+		Reference:       ref,
+		Descriptor:      desc,
+		ConfigMediaType: m.Config.MediaType,
+		ArtifactType:    m.ArtifactType,
+		Config:          raw,
+		Annotations:     m.Annotations,
+	}
+	if i.ArtifactType == "" {
+		i.ArtifactType = m.Config.MediaType
+	}
+	switch m.Config.MediaType {
+	case consts.DockerConfigJSON, ocispec.MediaTypeImageConfig:
+		if i.Image, err = gv1.ParseConfigFile(bytes.NewReader(raw)); err != nil {
+			return nil, fmt.Errorf("config of %s: %w", ref, err)
+		}
+	}
+	return i, nil
+}
@@ -0,0 +1,69 @@
+package store_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+func TestLayout_Inspect(t *testing.T) {
+	s := newLayout(t)
+
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Config(base, v1.Config{
+		Entrypoint: []string{"/app"},
+		Env:        []string{"VERSION=1"},
+		Labels:     map[string]string{"org.example.team": "platform"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, img, "images/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("data"), "random", memory.WithConfig(map[string]string{"key": "value"}, consts.MemoryConfigMediaType)), "memory/data:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImageIndex(ctx, genIndex(t, "linux/amd64"), "images/index:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := s.Inspect(ctx, "images/app:v1")
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	if i.Image == nil {
+		t.Fatalf("Inspect() of an image has no image config")
+	}
+	if c := i.Image.Config; len(c.Entrypoint) != 1 || c.Entrypoint[0] != "/app" || c.Labels["org.example.team"] != "platform" || len(c.Env) != 1 {
+		t.Errorf("Inspect() image config = %+v", c)
+	}
+	if len(i.Image.History) != 1 {
+		t.Errorf("Inspect() image history = %+v, want one entry", i.Image.History)
+	}
+
+	i, err = s.Inspect(ctx, "memory/data:v1")
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	if i.Image != nil || i.ConfigMediaType != consts.MemoryConfigMediaType {
+		t.Errorf("Inspect() of an artifact = %+v, want only its %s config", i, consts.MemoryConfigMediaType)
+	}
+	var cfg map[string]string
+	if err := json.Unmarshal(i.Config, &cfg); err != nil || cfg["key"] != "value" {
+		t.Errorf("Inspect() artifact config = %s, error = %v", i.Config, err)
+	}
+
+	if _, err := s.Inspect(ctx, "images/index:v1"); err == nil {
+		t.Errorf("Inspect() of an index error = nil")
+	}
+}
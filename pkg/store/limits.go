@@ -0,0 +1,250 @@
+package store
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+	"oras.land/oras-go/pkg/content"
+	"oras.land/oras-go/pkg/target"
+)
+
+// WithMaxConcurrentWrites bounds the number of blobs written to disk at once, across every operation on the Layout
+func WithMaxConcurrentWrites(n int64) Options {
+	return func(l *Layout) {
+		l.writes = semaphore.NewWeighted(n)
+	}
+}
+
+// WithMaxConcurrentConnections bounds the number of transfers in flight at once, across every operation on the Layout
+// 	Each request a copy makes of what it copies to counts for as long as it's in flight, unless that's a layout, and so
+// 	does fetching each layer of what's added to the store, wherever it comes from.
+func WithMaxConcurrentConnections(n int64) Options {
+	return func(l *Layout) {
+		l.conns = semaphore.NewWeighted(n)
+	}
+}
+
+// WithBandwidthLimit caps the combined rate blobs are transferred at to bytesPerSecond, across every operation on the
+// Layout
+// 	Both what's copied out of the store and what's added to it counts, whether it comes from a registry or not.
+func WithBandwidthLimit(bytesPerSecond int64) Options {
+	return func(l *Layout) {
+		l.bandwidth = newLimiter(bytesPerSecond)
+	}
+}
+
+// WithTransferLimit caps the rate each blob is copied at to bytesPerSecond, on top of the Layouts WithBandwidthLimit
+func WithTransferLimit(bytesPerSecond int64) CopyOption {
+	return func(o *copyOptions) {
+		o.transferLimit = bytesPerSecond
+	}
+}
+
+// maxBurst bounds how far ahead of its limit a transfer may run, which is also the most read at once
+const maxBurst = 32 * 1024
+
+func newLimiter(bytesPerSecond int64) *rate.Limiter {
+	burst := bytesPerSecond
+	if burst > maxBurst {
+		burst = maxBurst
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(burst))
+}
+
+// acquire blocks until a slot from sem is available, and returns the function that releases it
+// 	A nil sem is unbounded
+func acquire(ctx context.Context, sem *semaphore.Weighted) (func(), error) {
+	if sem == nil {
+		return func() {}, nil
+	}
+	if err := sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	return func() { sem.Release(1) }, nil
+}
+
+// throttled wraps r so reading it waits on the Layouts bandwidth limit, and on a limit of its own of bytesPerSecond
+// unless that is zero
+func (l *Layout) throttled(ctx context.Context, r io.Reader, bytesPerSecond int64) io.Reader {
+	var limiters []*rate.Limiter
+	if l.bandwidth != nil {
+		limiters = append(limiters, l.bandwidth)
+	}
+	if bytesPerSecond > 0 {
+		limiters = append(limiters, newLimiter(bytesPerSecond))
+	}
+	if len(limiters) == 0 {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, limiters: limiters}
+}
+
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rate.Limiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	for _, lim := range r.limiters {
+		if b := lim.Burst(); len(p) > b {
+			p = p[:b]
+		}
+	}
+
+	n, err := r.r.Read(p)
+	for _, lim := range r.limiters {
+		if werr := lim.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// throttledSource wraps from so blobs fetched from it are throttled per o, and by the Layouts bandwidth limit
+func (l *Layout) throttledSource(from target.Target, o *copyOptions) target.Target {
+	if l.bandwidth == nil && o.transferLimit == 0 {
+		return from
+	}
+	return &throttledTarget{Target: from, l: l, limit: o.transferLimit}
+}
+
+type throttledTarget struct {
+	target.Target
+	l     *Layout
+	limit int64
+}
+
+func (t *throttledTarget) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	f, err := t.Target.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return remotes.FetcherFunc(func(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+		rc, err := f.Fetch(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{t.l.throttled(ctx, rc, t.limit), rc}, nil
+	}), nil
+}
+
+// connected wraps open so what it opens holds one of the Layouts connections until it's closed
+func (l *Layout) connected(ctx context.Context, open func() (io.ReadCloser, error)) func() (io.ReadCloser, error) {
+	if l.conns == nil {
+		return open
+	}
+	return func() (io.ReadCloser, error) {
+		release, err := acquire(ctx, l.conns)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := open()
+		if err != nil {
+			release()
+			return nil, err
+		}
+		return &connectedReader{ReadCloser: rc, release: release}, nil
+	}
+}
+
+type connectedReader struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *connectedReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// connectedTarget wraps to so resolving, fetching and pushing each hold one of the Layouts connections while they're in
+// flight, unless to is a layout
+func (l *Layout) connectedTarget(to target.Target) target.Target {
+	if _, layout := to.(*content.OCI); layout || l.conns == nil {
+		return to
+	}
+	return &connectedTarget{Target: to, l: l}
+}
+
+type connectedTarget struct {
+	target.Target
+	l *Layout
+}
+
+func (t *connectedTarget) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	release, err := acquire(ctx, t.l.conns)
+	if err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+	defer release()
+	return t.Target.Resolve(ctx, ref)
+}
+
+func (t *connectedTarget) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	f, err := t.Target.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return remotes.FetcherFunc(func(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+		return t.l.connected(ctx, func() (io.ReadCloser, error) {
+			return f.Fetch(ctx, desc)
+		})()
+	}), nil
+}
+
+func (t *connectedTarget) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	p, err := t.Target.Pusher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return remotes.PusherFunc(func(ctx context.Context, desc ocispec.Descriptor) (ccontent.Writer, error) {
+		release, err := acquire(ctx, t.l.conns)
+		if err != nil {
+			return nil, err
+		}
+		w, err := p.Push(ctx, desc)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		return &connectedWriter{Writer: w, release: release}, nil
+	}), nil
+}
+
+// connectedWriter lets go of its connection once the blob it pushes is committed, or given up on
+type connectedWriter struct {
+	ccontent.Writer
+	once    sync.Once
+	release func()
+}
+
+func (w *connectedWriter) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...ccontent.Opt) error {
+	err := w.Writer.Commit(ctx, size, expected, opts...)
+	w.once.Do(w.release)
+	return err
+}
+
+func (w *connectedWriter) Close() error {
+	err := w.Writer.Close()
+	w.once.Do(w.release)
+	return err
+}
@@ -0,0 +1,238 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/content"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_WithBandwidthLimit(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	// 3 layers of 128KiB, with a burst of 32KiB up front
+	img, err := random.Image(128*1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name   string
+		layout []store.Options
+		copy   []store.CopyOption
+		min    time.Duration
+	}{
+		{name: "unlimited"},
+		{name: "global", layout: []store.Options{store.WithBandwidthLimit(512 * 1024)}, min: 500 * time.Millisecond},
+		{name: "per transfer", copy: []store.CopyOption{store.WithTransferLimit(128 * 1024)}, min: 500 * time.Millisecond},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tempLayout(t, tc.layout...)
+			if _, err := s.AddImage(ctx, img, "registry.example.com/app:v1"); err != nil {
+				t.Fatal(err)
+			}
+			dst := tempLayout(t)
+
+			start := time.Now()
+			if _, err := s.Copy(ctx, "registry.example.com/app:v1", dst.OCI, "", tc.copy...); err != nil {
+				t.Fatal(err)
+			}
+			elapsed := time.Since(start)
+
+			if elapsed < tc.min {
+				t.Errorf("Copy() took %s, want at least %s", elapsed, tc.min)
+			}
+			if tc.min == 0 && elapsed > time.Second {
+				t.Errorf("unlimited Copy() took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestLayout_WithMaxConcurrent(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	t.Run("copies", func(t *testing.T) {
+		tcs := []struct {
+			name   string
+			layout []store.Options
+			max    int
+		}{
+			{name: "unlimited"},
+			{name: "connections", layout: []store.Options{store.WithMaxConcurrentConnections(2)}, max: 2},
+		}
+		for _, tc := range tcs {
+			t.Run(tc.name, func(t *testing.T) {
+				s := tempLayout(t, tc.layout...)
+				for i := 0; i < 4; i++ {
+					ref := fmt.Sprintf("hello/world:v%d", i)
+					if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+						t.Fatal(err)
+					}
+				}
+				dst := tempLayout(t)
+
+				to := &peakTarget{OCI: dst.OCI}
+				if _, err := s.CopyAll(ctx, to, nil, store.WithConcurrency(4)); err != nil {
+					t.Fatal(err)
+				}
+				if tc.max == 0 && to.peak.max <= 2 {
+					t.Errorf("unlimited pushes peaked at %d at once, want more than 2 to show they overlap", to.peak.max)
+				}
+				if tc.max > 0 && to.peak.max > tc.max {
+					t.Errorf("pushes peaked at %d at once, want at most %d", to.peak.max, tc.max)
+				}
+			})
+		}
+	})
+
+	t.Run("adds", func(t *testing.T) {
+		tcs := []struct {
+			name   string
+			layout []store.Options
+			max    int
+		}{
+			{name: "unlimited"},
+			{name: "connections", layout: []store.Options{store.WithMaxConcurrentConnections(2)}, max: 2},
+			{name: "writes", layout: []store.Options{store.WithMaxConcurrentWrites(1)}, max: 1},
+		}
+		for _, tc := range tcs {
+			t.Run(tc.name, func(t *testing.T) {
+				s := tempLayout(t, tc.layout...)
+
+				var p peak
+				var layers []v1.Layer
+				for i := 0; i < 6; i++ {
+					lyr, err := random.Layer(1024, types.DockerLayer)
+					if err != nil {
+						t.Fatal(err)
+					}
+					layers = append(layers, &peakLayer{Layer: lyr, peak: &p})
+				}
+				img, err := mutate.AppendLayers(empty.Image, layers...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := s.AddImage(ctx, img, "registry.example.com/app:v1"); err != nil {
+					t.Fatal(err)
+				}
+				if tc.max == 0 && p.max <= 2 {
+					t.Errorf("unlimited layer fetches peaked at %d at once, want more than 2 to show they overlap", p.max)
+				}
+				if tc.max > 0 && p.max > tc.max {
+					t.Errorf("layer fetches peaked at %d at once, want at most %d", p.max, tc.max)
+				}
+			})
+		}
+	})
+}
+
+// peak records the most of something in flight at once, each one held in flight for a while so overlapping ones are
+// seen overlapping
+type peak struct {
+	mu     sync.Mutex
+	active int
+	max    int
+}
+
+func (p *peak) enter() func() {
+	p.mu.Lock()
+	p.active++
+	if p.active > p.max {
+		p.max = p.active
+	}
+	p.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			p.active--
+			p.mu.Unlock()
+		})
+	}
+}
+
+// peakTarget records the most pushes to it in flight at once
+type peakTarget struct {
+	*content.OCI
+	peak peak
+}
+
+func (t *peakTarget) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	p, err := t.OCI.Pusher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return remotes.PusherFunc(func(ctx context.Context, desc ocispec.Descriptor) (ccontent.Writer, error) {
+		leave := t.peak.enter()
+		w, err := p.Push(ctx, desc)
+		if err != nil {
+			leave()
+			return nil, err
+		}
+		return &peakWriter{Writer: w, leave: leave}, nil
+	}), nil
+}
+
+type peakWriter struct {
+	ccontent.Writer
+	leave func()
+}
+
+func (w *peakWriter) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...ccontent.Opt) error {
+	defer w.leave()
+	return w.Writer.Commit(ctx, size, expected, opts...)
+}
+
+func (w *peakWriter) Close() error {
+	defer w.leave()
+	return w.Writer.Close()
+}
+
+// peakLayer records the most layers being fetched at once
+type peakLayer struct {
+	v1.Layer
+	peak *peak
+}
+
+func (l *peakLayer) Compressed() (io.ReadCloser, error) {
+	leave := l.peak.enter()
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		leave()
+		return nil, err
+	}
+	return &peakReader{ReadCloser: rc, leave: leave}, nil
+}
+
+type peakReader struct {
+	io.ReadCloser
+	leave func()
+}
+
+func (r *peakReader) Close() error {
+	defer r.leave()
+	return r.ReadCloser.Close()
+}
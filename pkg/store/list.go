@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// Record describes a single reference of the store
+type Record struct {
+	Reference string
+	Digest    digest.Digest
+	MediaType string
+
+	// ArtifactType is the manifest's artifactType, falling back to the media type of its config
+	ArtifactType string
+
+	// Size is the total size of the manifest (or index) and everything reachable from it
+	Size int64
+
+	// Platforms are the os/arch[/variant] of an image, or of every manifest of an index
+	Platforms []string
+
+	// Annotations of the manifest, overridden by those on its descriptor in the index
+	Annotations map[string]string
+
+	// Provenance is where the reference came from, if the Layout recorded it WithProvenance
+	Provenance *Provenance
+
+	// Created is when an image was built, or the org.opencontainers.image.created annotation of anything else, and zero
+	// when neither is known
+	Created time.Time
+}
+
+// manifestRecord is everything a Record needs from either a manifest or an index
+type manifestRecord struct {
+	ArtifactType string               `json:"artifactType,omitempty"`
+	Config       ocispec.Descriptor   `json:"config"`
+	Manifests    []ocispec.Descriptor `json:"manifests"`
+	Annotations  map[string]string    `json:"annotations,omitempty"`
+}
+
+// List returns a Record of every reference in the store matching filters, sorted by reference
+func (l *Layout) List(ctx context.Context, filters ...Filter) ([]Record, error) {
+	f := makeFilter(filters...)
+
+	var records []Record
+	err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if ok, err := f.matches(ctx, l, reference, desc); err != nil || !ok {
+			return err
+		}
+
+		r, err := l.record(ctx, reference, desc)
+		if err != nil {
+			return err
+		}
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Reference < records[j].Reference })
+	return records, nil
+}
+
+func (l *Layout) record(ctx context.Context, reference string, desc ocispec.Descriptor) (Record, error) {
+	r := Record{
+		Reference: reference,
+		Digest:    desc.Digest,
+		MediaType: desc.MediaType,
+	}
+
+	seen := make(map[digest.Digest]ocispec.Descriptor)
+	if err := l.descendants(ctx, desc, seen); err != nil {
+		return Record{}, err
+	}
+	for _, d := range seen {
+		r.Size += d.Size
+	}
+
+	var m manifestRecord
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest, consts.DockerManifestSchema2, ocispec.MediaTypeImageIndex, consts.DockerManifestListSchema2:
+		if err := l.fetchJSON(ctx, desc, &m); err != nil {
+			return Record{}, err
+		}
+	}
+
+	r.ArtifactType = m.ArtifactType
+	if r.ArtifactType == "" {
+		r.ArtifactType = m.Config.MediaType
+	}
+
+	r.Annotations = copyAnnotations(m.Annotations)
+	for k, v := range desc.Annotations {
+		if r.Annotations == nil {
+			r.Annotations = make(map[string]string)
+		}
+		r.Annotations[k] = v
+	}
+	if created, err := time.Parse(time.RFC3339, r.Annotations[ocispec.AnnotationCreated]); err == nil {
+		r.Created = created
+	}
+	r.Provenance = provenanceOf(desc.Annotations)
+
+	for _, d := range m.Manifests {
+		if d.Platform != nil {
+			r.Platforms = append(r.Platforms, formatPlatform(*d.Platform))
+		}
+	}
+
+	switch m.Config.MediaType {
+	case ocispec.MediaTypeImageConfig, consts.DockerConfigJSON:
+		var cfg struct {
+			ocispec.Platform
+			Created *time.Time `json:"created,omitempty"`
+		}
+		if err := l.fetchJSON(ctx, m.Config, &cfg); err != nil {
+			return Record{}, err
+		}
+		if cfg.OS != "" {
+			r.Platforms = []string{formatPlatform(cfg.Platform)}
+		}
+		if cfg.Created != nil && !cfg.Created.IsZero() {
+			r.Created = *cfg.Created
+		}
+	}
+	return r, nil
+}
+
+func formatPlatform(p ocispec.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
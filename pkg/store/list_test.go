@@ -0,0 +1,98 @@
+package store_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+func TestLayout_List(t *testing.T) {
+	s := newLayout(t)
+
+	created := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err = mutate.ConfigFile(img, &v1.ConfigFile{OS: "linux", Architecture: "arm64", Created: v1.Time{Time: created}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImage(ctx, img, "image:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddImageIndex(ctx, genIndex(t, "linux/amd64", "linux/arm64"), "index:v1"); err != nil {
+		t.Fatal(err)
+	}
+	annotated := memory.NewMemory([]byte("data"), "random", memory.WithAnnotations(map[string]string{
+		ocispec.AnnotationCreated: created.Format(time.RFC3339),
+		"key":                     "value",
+	}))
+	if _, err := s.AddOCI(ctx, annotated, "memory:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("List() = %d records, want 3", len(records))
+	}
+
+	tests := []struct {
+		reference    string
+		mediaType    string
+		artifactType string
+		platforms    []string
+		created      time.Time
+	}{
+		{
+			reference:    "image:v1",
+			mediaType:    string(types.DockerManifestSchema2),
+			artifactType: string(types.DockerConfigJSON),
+			platforms:    []string{"linux/arm64"},
+			created:      created,
+		},
+		{
+			reference: "index:v1",
+			mediaType: ocispec.MediaTypeImageIndex,
+			platforms: []string{"linux/amd64", "linux/arm64"},
+		},
+		{
+			reference:    "memory:v1",
+			mediaType:    ocispec.MediaTypeImageManifest,
+			artifactType: consts.UnknownManifest,
+			created:      created,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.reference, func(t *testing.T) {
+			r := records[i]
+			if r.Reference != tt.reference || r.MediaType != tt.mediaType || r.ArtifactType != tt.artifactType {
+				t.Errorf("List() = %s %s %s, want %s %s %s", r.Reference, r.MediaType, r.ArtifactType, tt.reference, tt.mediaType, tt.artifactType)
+			}
+			if strings.Join(r.Platforms, ",") != strings.Join(tt.platforms, ",") {
+				t.Errorf("Platforms = %v, want %v", r.Platforms, tt.platforms)
+			}
+			if !r.Created.Equal(tt.created) {
+				t.Errorf("Created = %v, want %v", r.Created, tt.created)
+			}
+			if r.Size == 0 || r.Digest == "" {
+				t.Errorf("List() = size %d, digest %q", r.Size, r.Digest)
+			}
+		})
+	}
+	if got := records[2].Annotations["key"]; got != "value" {
+		t.Errorf("Annotations[key] = %q, want value", got)
+	}
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"github.com/go-logr/logr"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/rancherfederal/ocil/pkg/layer"
+)
+
+// WithLogger logs what the Layout does to log: blobs written and skipped, layer cache hits and copies at V(1), every
+// blob committed at V(2)
+// 	Nothing is logged at V(0), the Layout reports its failures as errors.
+func WithLogger(log logr.Logger) Options {
+	return func(l *Layout) {
+		l.log = log
+	}
+}
+
+// loggedCache logs the hits and misses of a layer.Cache
+type loggedCache struct {
+	layer.Cache
+	log logr.Logger
+}
+
+func (c *loggedCache) Get(h v1.Hash) (v1.Layer, error) {
+	l, err := c.Cache.Get(h)
+	switch {
+	case err == nil:
+		c.log.V(1).Info("layer cache hit", "digest", h.String())
+	case err == layer.ErrLayerNotFound:
+		c.log.V(1).Info("layer cache miss", "digest", h.String())
+	}
+	return l, err
+}
@@ -0,0 +1,58 @@
+package store_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_WithLogger(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	log := funcr.New(func(prefix, args string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, args)
+	}, funcr.Options{Verbosity: 2})
+
+	s := newLayout(t, store.WithLogger(log))
+
+	ref := "hello/world:v1"
+	oci := genArtifact(t, ref)
+	if _, err := s.AddOCI(ctx, oci, ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, oci, "hello/world:v2"); err != nil {
+		t.Fatal(err)
+	}
+	dst := tempLayout(t)
+	if _, err := s.Copy(ctx, ref, dst.OCI, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	logged := strings.Join(lines, "\n")
+	for _, msg := range []string{"wrote blob", "committed blob", "indexing reference", "blob already present, skipping", "copying", "copied"} {
+		if !strings.Contains(logged, `"msg"="`+msg+`"`) {
+			t.Errorf("nothing logged as %q:\n%s", msg, logged)
+		}
+	}
+
+	// nothing above V(0) is logged unless asked for
+	lines = nil
+	quiet, err := store.NewLayout(t.TempDir(), store.WithLogger(funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := quiet.AddOCI(ctx, oci, ref); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 0 {
+		t.Errorf("logged %d lines at V(0), want none", len(lines))
+	}
+}
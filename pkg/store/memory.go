@@ -0,0 +1,14 @@
+package store
+
+import (
+	"github.com/rancherfederal/ocil/pkg/content"
+)
+
+// memoryRoot names the layouts of NewMemory, which have no root of their own
+const memoryRoot = "memory"
+
+// NewMemory returns a Layout kept entirely in memory, so pipelines built on a store can be tested without touching disk
+// 	It supports everything a Layout on disk does but Dedupe, and is gone as soon as it's no longer referenced.
+func NewMemory(opts ...Options) (*Layout, error) {
+	return NewLayout(memoryRoot, append([]Options{WithDriver(content.NewMemoryDriver())}, opts...)...)
+}
@@ -0,0 +1,58 @@
+package store_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestNewMemory(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	s, err := store.NewMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+	// streamed layers are spooled in memory too
+	streamed := artifacts.NewGeneric().AddStream("application/vnd.example.stream.v1", io.NopCloser(strings.NewReader("streamed")), nil)
+	if _, err := s.AddOCI(ctx, streamed, "hello/world:stream"); err != nil {
+		t.Fatal(err)
+	}
+
+	// another memory store is the target of a push
+	dst, err := store.NewMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := s.Copy(ctx, ref, dst.OCI, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, got, err := dst.Resolve(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Digest != desc.Digest {
+		t.Errorf("Resolve() of the pushed %s = %s, want %s", ref, got.Digest, desc.Digest)
+	}
+	rc, err := dst.Fetch(ctx, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	if _, err := os.Stat(filepath.Join(".", "memory")); !os.IsNotExist(err) {
+		t.Errorf("memory store stat error = %v, want nothing written", err)
+	}
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/target"
+)
+
+// Metrics receives measurements of what the Layout does, ie: to export them to prometheus with the metrics package
+// 	Its methods are called concurrently, by whichever operation is being measured.
+type Metrics interface {
+	// BlobWritten is a blob of size bytes written to the store
+	BlobWritten(size int64)
+
+	// BytesCopied are n bytes of blobs read out of the store by a copy
+	BytesCopied(n int64)
+
+	// Collected is a blob of size bytes deleted by GC
+	Collected(size int64)
+
+	// Observe is a single operation that took d, and failed with err unless it's nil
+	Observe(op Operation, d time.Duration, err error)
+}
+
+// WithMetrics reports measurements of every operation on the Layout to m
+func WithMetrics(m Metrics) Options {
+	return func(l *Layout) {
+		l.metrics = m
+	}
+}
+
+// measured wraps op so its duration and outcome are observed
+func (l *Layout) measured(op Handler) Handler {
+	if l.metrics == nil {
+		return op
+	}
+
+	return func(ctx context.Context, req *Request) error {
+		start := time.Now()
+		err := op(ctx, req)
+		l.metrics.Observe(req.Operation, time.Since(start), err)
+		return err
+	}
+}
+
+// countedSource wraps from so bytes fetched from it are counted as copied
+func (l *Layout) countedSource(from target.Target) target.Target {
+	if l.metrics == nil {
+		return from
+	}
+	return &countedTarget{Target: from, m: l.metrics}
+}
+
+type countedTarget struct {
+	target.Target
+	m Metrics
+}
+
+func (t *countedTarget) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	f, err := t.Target.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return remotes.FetcherFunc(func(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+		rc, err := f.Fetch(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		return &countedReader{ReadCloser: rc, m: t.m}, nil
+	}), nil
+}
+
+type countedReader struct {
+	io.ReadCloser
+	m Metrics
+}
+
+func (r *countedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.m.BytesCopied(int64(n))
+	}
+	return n, err
+}
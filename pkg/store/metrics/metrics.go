@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rancherfederal/ocil/pkg/layer"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+// interface guards
+var (
+	_ prometheus.Collector = (*Collector)(nil)
+	_ store.Metrics        = (*Collector)(nil)
+)
+
+// Collector measures a Layout as the ocil_store_* metrics, once given to it with store.WithMetrics
+type Collector struct {
+	blobs     prometheus.Counter
+	written   prometheus.Counter
+	copied    prometheus.Counter
+	collected prometheus.Counter
+	reclaimed prometheus.Counter
+	durations *prometheus.HistogramVec
+
+	cache    layer.StatsReporter
+	hitRatio *prometheus.Desc
+}
+
+type Option func(*Collector)
+
+// WithCache also exports the hit ratio of c, the layer cache the Layout is given with store.WithCache, if it's a
+// layer.StatsReporter
+func WithCache(c layer.Cache) Option {
+	return func(m *Collector) {
+		if stats, ok := c.(layer.StatsReporter); ok {
+			m.cache = stats
+		}
+	}
+}
+
+// NewCollector returns store metrics, labeled with labels to tell Layouts apart
+// 	Nothing is exported until the collector is registered, ie: prometheus.MustRegister(c), for which the same
+// 	Collector is given to the Layout with store.WithMetrics(c).
+func NewCollector(labels prometheus.Labels, opts ...Option) *Collector {
+	counter := func(name, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "ocil", Subsystem: "store", Name: name, Help: help, ConstLabels: labels,
+		})
+	}
+
+	m := &Collector{
+		blobs:     counter("blobs_written_total", "Blobs written to the store."),
+		written:   counter("written_bytes_total", "Bytes of blobs written to the store."),
+		copied:    counter("copied_bytes_total", "Bytes of blobs read out of the store by copies."),
+		collected: counter("gc_collected_blobs_total", "Blobs deleted by garbage collection."),
+		reclaimed: counter("gc_reclaimed_bytes_total", "Bytes of blobs deleted by garbage collection."),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   "ocil",
+			Subsystem:   "store",
+			Name:        "operation_duration_seconds",
+			Help:        "Durations of store operations, by operation and whether they succeeded.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"operation", "result"}),
+		hitRatio: prometheus.NewDesc(prometheus.BuildFQName("ocil", "store", "layer_cache_hit_ratio"),
+			"Fraction of layer cache lookups that were hits.", nil, labels),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *Collector) BlobWritten(size int64) {
+	m.blobs.Inc()
+	m.written.Add(float64(size))
+}
+
+func (m *Collector) BytesCopied(n int64) {
+	m.copied.Add(float64(n))
+}
+
+func (m *Collector) Collected(size int64) {
+	m.collected.Inc()
+	m.reclaimed.Add(float64(size))
+}
+
+func (m *Collector) Observe(op store.Operation, d time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.durations.WithLabelValues(string(op), result).Observe(d.Seconds())
+}
+
+func (m *Collector) Describe(ch chan<- *prometheus.Desc) {
+	m.blobs.Describe(ch)
+	m.written.Describe(ch)
+	m.copied.Describe(ch)
+	m.collected.Describe(ch)
+	m.reclaimed.Describe(ch)
+	m.durations.Describe(ch)
+	if m.cache != nil {
+		ch <- m.hitRatio
+	}
+}
+
+func (m *Collector) Collect(ch chan<- prometheus.Metric) {
+	m.blobs.Collect(ch)
+	m.written.Collect(ch)
+	m.copied.Collect(ch)
+	m.collected.Collect(ch)
+	m.reclaimed.Collect(ch)
+	m.durations.Collect(ch)
+	if m.cache != nil {
+		ch <- prometheus.MustNewConstMetric(m.hitRatio, prometheus.GaugeValue, m.cache.Stats().HitRatio())
+	}
+}
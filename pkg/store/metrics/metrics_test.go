@@ -0,0 +1,90 @@
+package metrics_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/layer"
+	"github.com/rancherfederal/ocil/pkg/store"
+	"github.com/rancherfederal/ocil/pkg/store/metrics"
+)
+
+func TestNewCollector(t *testing.T) {
+	ctx := context.Background()
+
+	m := metrics.NewCollector(prometheus.Labels{"store": "test"}, metrics.WithCache(layer.NewFilesystemCache(t.TempDir())))
+	s, err := store.NewLayout(t.TempDir(), store.WithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a manifest and layer each, and the config they share
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("orphaned"), "random"), "a:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("kept"), "random"), "b:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := store.NewLayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Copy(ctx, "b:v1", dst.OCI, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Remove(ctx, "a:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GC(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `
+# HELP ocil_store_blobs_written_total Blobs written to the store.
+# TYPE ocil_store_blobs_written_total counter
+ocil_store_blobs_written_total{store="test"} 5
+# HELP ocil_store_gc_collected_blobs_total Blobs deleted by garbage collection.
+# TYPE ocil_store_gc_collected_blobs_total counter
+ocil_store_gc_collected_blobs_total{store="test"} 2
+# HELP ocil_store_layer_cache_hit_ratio Fraction of layer cache lookups that were hits.
+# TYPE ocil_store_layer_cache_hit_ratio gauge
+ocil_store_layer_cache_hit_ratio{store="test"} 0
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(want),
+		"ocil_store_blobs_written_total", "ocil_store_gc_collected_blobs_total", "ocil_store_layer_cache_hit_ratio"); err != nil {
+		t.Error(err)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(m); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		switch f.GetName() {
+		case "ocil_store_copied_bytes_total":
+			if v := f.GetMetric()[0].GetCounter().GetValue(); v == 0 {
+				t.Errorf("%s = %v, want more than 0", f.GetName(), v)
+			}
+		case "ocil_store_operation_duration_seconds":
+			for _, metric := range f.GetMetric() {
+				if got := metric.GetHistogram().GetSampleCount(); got == 0 {
+					t.Errorf("%s%v observed nothing", f.GetName(), metric.GetLabel())
+				}
+			}
+			if len(f.GetMetric()) != 3 {
+				t.Errorf("%s has %d series, want add, copy and remove", f.GetName(), len(f.GetMetric()))
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"io"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Operation identifies the store operation a Middleware is wrapping
+type Operation string
+
+const (
+	OperationAdd    Operation = "add"
+	OperationFetch  Operation = "fetch"
+	OperationCopy   Operation = "copy"
+	OperationRemove Operation = "remove"
+	OperationTag    Operation = "tag"
+	OperationUntag  Operation = "untag"
+)
+
+// Request describes a single store operation as it passes through the middleware chain
+// 	Descriptor is populated once the operation has run, where the operation produces one
+type Request struct {
+	Operation  Operation
+	Reference  string
+	Descriptor ocispec.Descriptor
+
+	// admits is what an add brings into the store, for the signature policy to verify before it's written
+	admits *admission
+}
+
+// Handler performs (or continues) a store operation
+type Handler func(ctx context.Context, req *Request) error
+
+// Middleware wraps a Handler, allowing cross-cutting concerns such as auth, metrics, logging and policy to run before
+// and after every store operation, or to reject it entirely by not calling next
+type Middleware func(next Handler) Handler
+
+// WithMiddleware appends mw to the Layouts middleware chain
+// 	Middleware run in the order they are appended, the first being the outermost
+func WithMiddleware(mw ...Middleware) Options {
+	return func(l *Layout) {
+		l.middleware = append(l.middleware, mw...)
+	}
+}
+
+// intercept runs op through the middleware chain
+// 	Operations that would change a read-only layout are rejected before reaching it.
+func (l *Layout) intercept(ctx context.Context, req *Request, op Handler) error {
+	if req.Operation.mutates() {
+		if err := l.writable(string(req.Operation) + " " + req.Reference); err != nil {
+			return err
+		}
+	}
+	if req.Operation == OperationAdd {
+		var done func()
+		ctx, done = l.staging(ctx)
+		defer done()
+	}
+	h := l.measured(l.notified(l.verified(l.tracked(op))))
+	for i := len(l.middleware) - 1; i >= 0; i-- {
+		h = l.middleware[i](h)
+	}
+	return l.traced(h)(ctx, req)
+}
+
+// Fetch returns the content of desc, passing through the middleware chain
+// 	Content failing verification is re-fetched from where it came from with WithRepair.
+func (l *Layout) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := l.intercept(ctx, &Request{Operation: OperationFetch, Descriptor: desc}, func(ctx context.Context, req *Request) error {
+		var err error
+		rc, err = l.OCI.Fetch(ctx, req.Descriptor)
+		if l.repair != nil {
+			rc, err = l.repaired(ctx, req.Descriptor, rc, err)
+		}
+		return err
+	})
+	return rc, err
+}
+
@@ -0,0 +1,55 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Middleware(t *testing.T) {
+	var ops []store.Operation
+	record := func(next store.Handler) store.Handler {
+		return func(ctx context.Context, req *store.Request) error {
+			ops = append(ops, req.Operation)
+			return next(ctx, req)
+		}
+	}
+	errDenied := errors.New("denied")
+	denyRemove := func(next store.Handler) store.Handler {
+		return func(ctx context.Context, req *store.Request) error {
+			if req.Operation == store.OperationRemove {
+				return errDenied
+			}
+			return next(ctx, req)
+		}
+	}
+
+	s := newLayout(t, store.WithMiddleware(record, denyRemove))
+
+	desc, err := s.AddOCI(ctx, memory.NewMemory([]byte("data"), "random"), "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := s.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	if err := s.Remove(ctx, "hello/world:v1"); !errors.Is(err, errDenied) {
+		t.Errorf("Remove() error = %v, want %v", err, errDenied)
+	}
+
+	want := []store.Operation{store.OperationAdd, store.OperationFetch, store.OperationRemove}
+	if len(ops) != len(want) {
+		t.Fatalf("middleware saw operations %v, want %v", ops, want)
+	}
+	for i := range want {
+		if ops[i] != want[i] {
+			t.Errorf("middleware saw operations %v, want %v", ops, want)
+		}
+	}
+}
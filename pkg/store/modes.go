@@ -0,0 +1,32 @@
+package store
+
+import (
+	"io/fs"
+
+	"github.com/rancherfederal/ocil/pkg/content"
+)
+
+// WithFileMode creates the files of the layout (ie: blobs, the index) with mode exactly, rather than 0644 less the
+// umask, as hardened hosts may require
+// 	It only applies to layouts on the local filesystem, not those given WithDriver.
+func WithFileMode(mode fs.FileMode) Options {
+	return func(l *Layout) {
+		l.localOpts = append(l.localOpts, content.WithFileMode(mode))
+	}
+}
+
+// WithDirMode creates the directories of the layout with mode exactly, rather than 0777 less the umask
+// 	Like WithFileMode, it only applies to layouts on the local filesystem.
+func WithDirMode(mode fs.FileMode) Options {
+	return func(l *Layout) {
+		l.localOpts = append(l.localOpts, content.WithDirMode(mode))
+	}
+}
+
+// WithEnforcedModes sets the mode of everything already in the layout as it's opened to those of WithFileMode and
+// WithDirMode, so tightening them applies to existing content too
+func WithEnforcedModes() Options {
+	return func(l *Layout) {
+		l.enforceModes = true
+	}
+}
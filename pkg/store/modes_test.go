@@ -0,0 +1,66 @@
+package store_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestNewLayout_WithFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows only has a read-only attribute")
+	}
+	teardown := setup(t)
+	defer teardown()
+
+	dir := filepath.Join(root, "store")
+	s, err := store.NewLayout(dir, store.WithFileMode(0640), store.WithDirMode(0750))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+	assertModes(t, dir, 0640, 0750)
+
+	// tightening the modes of an existing layout
+	if _, err := store.NewLayout(dir, store.WithFileMode(0600), store.WithDirMode(0700), store.WithEnforcedModes()); err != nil {
+		t.Fatal(err)
+	}
+	assertModes(t, dir, 0600, 0700)
+
+	if _, err := store.NewLayout(dir, store.WithEnforcedModes(), store.WithReadOnly()); !errors.Is(err, store.ErrReadOnly) {
+		t.Errorf("NewLayout() enforcing the modes of a read-only layout error = %v, want ErrReadOnly", err)
+	}
+}
+
+// assertModes checks the mode of every file and directory beneath dir, dir included
+func assertModes(t *testing.T, dir string, file, directory os.FileMode) {
+	t.Helper()
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		want := file
+		if d.IsDir() {
+			want = directory
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s mode = %v, want %v", p, got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// MutateOption is a change Mutate makes to a stored manifest
+type MutateOption func(*mutateOptions)
+
+type mutateOptions struct {
+	annotations       map[string]string
+	removeAnnotations []string
+	labels            map[string]string
+	removeLabels      []string
+	created           *time.Time
+}
+
+// WithAnnotation sets the annotation key of the manifest (or index) to value
+func WithAnnotation(key string, value string) MutateOption {
+	return func(o *mutateOptions) {
+		if o.annotations == nil {
+			o.annotations = make(map[string]string)
+		}
+		o.annotations[key] = value
+	}
+}
+
+// WithoutAnnotations removes the annotations keys of the manifest (or index)
+func WithoutAnnotations(keys ...string) MutateOption {
+	return func(o *mutateOptions) {
+		o.removeAnnotations = append(o.removeAnnotations, keys...)
+	}
+}
+
+// WithLabel sets the config label key of an image to value
+func WithLabel(key string, value string) MutateOption {
+	return func(o *mutateOptions) {
+		if o.labels == nil {
+			o.labels = make(map[string]string)
+		}
+		o.labels[key] = value
+	}
+}
+
+// WithoutLabels removes the config labels keys of an image
+func WithoutLabels(keys ...string) MutateOption {
+	return func(o *mutateOptions) {
+		o.removeLabels = append(o.removeLabels, keys...)
+	}
+}
+
+// WithCreated sets when an image was created in its config, or the org.opencontainers.image.created annotation of
+// anything else
+func WithCreated(t time.Time) MutateOption {
+	return func(o *mutateOptions) {
+		o.created = &t
+	}
+}
+
+func makeMutateOptions(opts ...MutateOption) *mutateOptions {
+	o := &mutateOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Mutate rewrites the manifest (or index) stored under ref with opts, retagging ref to the result
+// 	Fields the changes don't touch are kept as they are, but the rewritten manifest has a digest of its own: the
+// 	previous one stays in the store for any other reference to it (or for GC), and so do its signatures and other
+// 	referrers, which aren't of the rewritten manifest.
+func (l *Layout) Mutate(ctx context.Context, ref string, opts ...MutateOption) (ocispec.Descriptor, error) {
+	req := &Request{Operation: OperationAdd, Reference: ref}
+	err := l.intercept(ctx, req, func(ctx context.Context, req *Request) error {
+		o := makeMutateOptions(opts...)
+
+		desc, err := l.resolve(ctx, req.Reference)
+		if err != nil {
+			return err
+		}
+		raw, err := l.readBlob(ctx, desc)
+		if err != nil {
+			return err
+		}
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return fmt.Errorf("manifest of %s: %w", req.Reference, err)
+		}
+
+		var cfg ocispec.Descriptor
+		if data, ok := m["config"]; ok {
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return fmt.Errorf("manifest of %s: %w", req.Reference, err)
+			}
+		}
+		image := cfg.MediaType == ocispec.MediaTypeImageConfig || cfg.MediaType == consts.DockerConfigJSON
+
+		if o.created != nil && !image {
+			WithAnnotation(ocispec.AnnotationCreated, o.created.UTC().Format(time.RFC3339))(o)
+		}
+		if (o.labels != nil || len(o.removeLabels) > 0) && !image {
+			return fmt.Errorf("reference %s is not an image, it has no labels", req.Reference)
+		}
+
+		annotations := make(map[string]string)
+		if data, ok := m["annotations"]; ok {
+			if err := json.Unmarshal(data, &annotations); err != nil {
+				return fmt.Errorf("annotations of %s: %w", req.Reference, err)
+			}
+		}
+		mutated := mergeAnnotations(annotations, o.annotations, o.removeAnnotations)
+		if len(mutated) == 0 {
+			delete(m, "annotations")
+		} else if m["annotations"], err = json.Marshal(mutated); err != nil {
+			return err
+		}
+
+		if image {
+			if cfg, err = l.mutateConfig(ctx, cfg, o); err != nil {
+				return fmt.Errorf("config of %s: %w", req.Reference, err)
+			}
+			if m["config"], err = json.Marshal(cfg); err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		d, err := l.writeManifestData(ctx, data)
+		if err != nil {
+			return err
+		}
+
+		// the index descriptor carries a copy of the manifests annotations, so it has to change along with them
+		next := desc
+		next.Digest = d
+		next.Size = int64(len(data))
+		next.Annotations = mergeAnnotations(copyAnnotations(desc.Annotations), o.annotations, o.removeAnnotations)
+		next.Annotations[ocispec.AnnotationRefName] = req.Reference
+		req.Descriptor = next
+		if err := l.verify(ctx, req.Reference, admitsDigest(d)); err != nil {
+			return err
+		}
+		return l.addIndex(ctx, next)
+	})
+	return req.Descriptor, err
+}
+
+// mutateConfig writes the image config cfg describes with the labels and created time of o, returning its descriptor
+func (l *Layout) mutateConfig(ctx context.Context, cfg ocispec.Descriptor, o *mutateOptions) (ocispec.Descriptor, error) {
+	if o.labels == nil && len(o.removeLabels) == 0 && o.created == nil {
+		return cfg, nil
+	}
+
+	raw, err := l.readBlob(ctx, cfg)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	var c map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	if o.created != nil {
+		if c["created"], err = json.Marshal(o.created.UTC()); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+
+	if o.labels != nil || len(o.removeLabels) > 0 {
+		var container map[string]json.RawMessage
+		if data, ok := c["config"]; ok && string(data) != "null" {
+			if err := json.Unmarshal(data, &container); err != nil {
+				return ocispec.Descriptor{}, err
+			}
+		}
+		if container == nil {
+			container = make(map[string]json.RawMessage)
+		}
+		labels := make(map[string]string)
+		if data, ok := container["Labels"]; ok && string(data) != "null" {
+			if err := json.Unmarshal(data, &labels); err != nil {
+				return ocispec.Descriptor{}, err
+			}
+		}
+		labels = mergeAnnotations(labels, o.labels, o.removeLabels)
+		if len(labels) == 0 {
+			delete(container, "Labels")
+		} else if container["Labels"], err = json.Marshal(labels); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		if c["config"], err = json.Marshal(container); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := l.writeBlobData(ctx, data); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	mutated := cfg
+	mutated.Digest = digest.FromBytes(data)
+	mutated.Size = int64(len(data))
+	return mutated, nil
+}
+
+// mergeAnnotations sets set in annotations and removes remove from them, allocating annotations if it's nil
+func mergeAnnotations(annotations map[string]string, set map[string]string, remove []string) map[string]string {
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	for k, v := range set {
+		annotations[k] = v
+	}
+	for _, k := range remove {
+		delete(annotations, k)
+	}
+	return annotations
+}
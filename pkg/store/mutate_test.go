@@ -0,0 +1,104 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Mutate(t *testing.T) {
+	s := newLayout(t)
+
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Config(base, v1.Config{Labels: map[string]string{"team": "a", "stale": "yes"}, Env: []string{"KEEP=1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = mutate.Annotations(img, map[string]string{"old": "annotation"}).(v1.Image)
+	before, err := s.AddImage(ctx, img, "images/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Tag(ctx, "images/app:v1", "images/app:pinned"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("data"), "random"), "memory/data:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	desc, err := s.Mutate(ctx, "images/app:v1",
+		store.WithAnnotation("new", "annotation"), store.WithoutAnnotations("old"),
+		store.WithLabel("team", "b"), store.WithoutLabels("stale"),
+		store.WithCreated(created))
+	if err != nil {
+		t.Fatalf("Mutate() error = %v", err)
+	}
+	if desc.Digest == before.Digest {
+		t.Fatalf("Mutate() kept digest %s", desc.Digest)
+	}
+	if desc.Annotations["new"] != "annotation" || desc.Annotations["old"] != "" {
+		t.Errorf("Mutate() descriptor annotations = %v", desc.Annotations)
+	}
+
+	i, err := s.Inspect(ctx, "images/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Descriptor.Digest != desc.Digest {
+		t.Errorf("Mutate() retagged images/app:v1 to %s, want %s", i.Descriptor.Digest, desc.Digest)
+	}
+	if i.Annotations["new"] != "annotation" || i.Annotations["old"] != "" {
+		t.Errorf("Mutate() manifest annotations = %v", i.Annotations)
+	}
+	if labels := i.Image.Config.Labels; len(labels) != 1 || labels["team"] != "b" {
+		t.Errorf("Mutate() labels = %v, want only team=b", labels)
+	}
+	if len(i.Image.Config.Env) != 1 || i.Image.Config.Env[0] != "KEEP=1" {
+		t.Errorf("Mutate() env = %v, want it kept", i.Image.Config.Env)
+	}
+	if !i.Image.Created.Time.Equal(created) {
+		t.Errorf("Mutate() created = %v, want %v", i.Image.Created.Time, created)
+	}
+
+	// the rewritten image is still a valid image, and other references are left as they were
+	mutated, err := s.Image(ctx, "images/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Image(mutated); err != nil {
+		t.Errorf("Mutate() wrote an invalid image: %v", err)
+	}
+	pinned, err := s.Inspect(ctx, "images/app:pinned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinned.Descriptor.Digest != before.Digest {
+		t.Errorf("Mutate() moved images/app:pinned to %s", pinned.Descriptor.Digest)
+	}
+
+	desc, err = s.Mutate(ctx, "memory/data:v1", store.WithCreated(created))
+	if err != nil {
+		t.Fatalf("Mutate() error = %v", err)
+	}
+	if got := desc.Annotations[ocispec.AnnotationCreated]; got != "2020-01-02T03:04:05Z" {
+		t.Errorf("Mutate() created annotation of an artifact = %q", got)
+	}
+	if _, err := s.Mutate(ctx, "memory/data:v1", store.WithLabel("team", "b")); err == nil {
+		t.Errorf("Mutate() labels of an artifact error = nil")
+	}
+	if _, err := s.Mutate(ctx, "images/missing:v1", store.WithAnnotation("k", "v")); err == nil {
+		t.Errorf("Mutate() of a missing reference error = nil")
+	}
+}
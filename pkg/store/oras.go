@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/target"
+	oras "oras.land/oras-go/v2"
+	orascontent "oras.land/oras-go/v2/content"
+)
+
+// orasTarget is a target.Target (the containerd remotes interfaces of oras-go v1) as an oras-go v2 oras.Target, for
+// copies to go through the copy graph of oras-go v2 from and to the targets Copy and CopyAll take
+// 	Blobs are fetched with the Fetcher of ref, and pushed with the Pusher of ref carrying the digest of the root as
+// 	oras-go v1 did, which tags the root as it's pushed by layouts and registries alike, so Tag has nothing left to do.
+// 	Targets report what they already hold when it's pushed, rather than being asked up front, so Exists never skips.
+type orasTarget struct {
+	target target.Target
+	ref    string
+
+	mu      sync.Mutex
+	fetcher remotes.Fetcher
+	pusher  remotes.Pusher
+}
+
+var _ oras.Target = (*orasTarget)(nil)
+
+// newORASTarget is t as an oras.Target, copied from or to ref
+func newORASTarget(t target.Target, ref string) *orasTarget {
+	return &orasTarget{target: t, ref: ref}
+}
+
+func (t *orasTarget) Resolve(ctx context.Context, ref string) (ocispec.Descriptor, error) {
+	_, desc, err := t.target.Resolve(ctx, ref)
+	return desc, err
+}
+
+func (t *orasTarget) Fetch(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	t.mu.Lock()
+	if t.fetcher == nil {
+		fetcher, err := t.target.Fetcher(ctx, t.ref)
+		if err != nil {
+			t.mu.Unlock()
+			return nil, err
+		}
+		t.fetcher = fetcher
+	}
+	fetcher := t.fetcher
+	t.mu.Unlock()
+
+	return fetcher.Fetch(ctx, desc)
+}
+
+func (t *orasTarget) Exists(ctx context.Context, desc ocispec.Descriptor) (bool, error) {
+	return false, nil
+}
+
+// Push writes r as desc through the Pusher of the reference copied to, anything the target already holds being left
+// as it is
+func (t *orasTarget) Push(ctx context.Context, desc ocispec.Descriptor, r io.Reader) error {
+	t.mu.Lock()
+	if t.pusher == nil {
+		pusher, err := t.target.Pusher(ctx, t.ref)
+		if err != nil {
+			t.mu.Unlock()
+			return err
+		}
+		t.pusher = pusher
+	}
+	pusher := t.pusher
+	t.mu.Unlock()
+
+	w, err := pusher.Push(ctx, desc)
+	if errdefs.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return ccontent.Copy(ctx, w, r, desc.Size, desc.Digest)
+}
+
+func (t *orasTarget) Tag(ctx context.Context, desc ocispec.Descriptor, ref string) error {
+	return nil
+}
+
+// orasCopy copies ref from the target.Target from to toRef in to with oras-go v2, toRef being ref if it's empty
+func orasCopy(ctx context.Context, from target.Target, ref string, to target.Target, toRef string) (ocispec.Descriptor, error) {
+	if toRef == "" {
+		toRef = ref
+	}
+	_, root, err := from.Resolve(ctx, ref)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	src := newORASTarget(from, ref)
+	dst := newORASTarget(to, fmt.Sprintf("%s@%s", toRef, root.Digest))
+	return oras.Copy(ctx, src, ref, dst, toRef, oras.CopyOptions{
+		CopyGraphOptions: oras.CopyGraphOptions{FindSuccessors: copySuccessors},
+	})
+}
+
+// copySuccessors are the successors of desc a copy descends into, which unlike those of oras-go v2 leave out the
+// subject of a manifest: attachments are copied after what they're attached to, by copyAttached
+func copySuccessors(ctx context.Context, fetcher orascontent.Fetcher, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageManifest:
+		var m ocispec.Manifest
+		if err := fetchAllJSON(ctx, fetcher, desc, &m); err != nil {
+			return nil, err
+		}
+		return append([]ocispec.Descriptor{m.Config}, m.Layers...), nil
+
+	case ocispec.MediaTypeArtifactManifest:
+		var m ocispec.Artifact
+		if err := fetchAllJSON(ctx, fetcher, desc, &m); err != nil {
+			return nil, err
+		}
+		return m.Blobs, nil
+	}
+	return orascontent.Successors(ctx, fetcher, desc)
+}
+
+// fetchAllJSON decodes the content desc describes into v, verifying it as it's fetched
+func fetchAllJSON(ctx context.Context, fetcher orascontent.Fetcher, desc ocispec.Descriptor, v interface{}) error {
+	data, err := orascontent.FetchAll(ctx, fetcher, desc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
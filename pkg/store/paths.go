@@ -0,0 +1,111 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// reservedNames are the names windows reserves for devices in every directory, whatever their extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// localPath returns the path beneath dir of name, the slash separated name of an entry of an archive
+// 	Names that would resolve anywhere but beneath dir on any platform are rejected, so an archive extracts the same
+// 	everywhere: on windows backslashes are separators too, a colon names a volume (or a stream of a file), trailing
+// 	dots and spaces are dropped and reserved names open a device rather than a file.
+func localPath(dir, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "\\:\x00") {
+		return "", fmt.Errorf("%q is not a valid name", name)
+	}
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%s is outside of the layout", name)
+	}
+	for _, elem := range strings.Split(clean, "/") {
+		if strings.HasSuffix(elem, ".") && elem != "." || strings.HasSuffix(elem, " ") {
+			return "", fmt.Errorf("%q is not a valid name on windows", name)
+		}
+		base := strings.ToUpper(strings.SplitN(elem, ".", 2)[0])
+		if reservedNames[strings.TrimRight(base, " ")] {
+			return "", fmt.Errorf("%q is reserved on windows", name)
+		}
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+// foldedNames detects names that only differ by case, which are the same file on case insensitive filesystems (ie:
+// those of windows and macos)
+type foldedNames map[string]string
+
+// add records name, returning an error if a name differing only by case was recorded already
+func (f foldedNames) add(name string) error {
+	folded := strings.ToLower(path.Clean(name))
+	if other, ok := f[folded]; ok && other != name {
+		return fmt.Errorf("%s and %s collide on case insensitive filesystems", other, name)
+	}
+	f[folded] = name
+	return nil
+}
+
+// maxLinks bounds the symlinks resolved for a single path, as the kernel does, so links to each other fail to resolve
+const maxLinks = 255
+
+// rootedPath returns the path beneath dir of name, every symlink along it resolved as though dir were the root of the
+// filesystem
+// 	Absolute links resolve from dir and .. never climbs out of it, so the path is beneath dir wherever the links of an
+// 	extracted archive point.  What doesn't exist (yet) is taken as it's named.
+func rootedPath(dir, name string) (string, error) {
+	resolved := ""
+	rest := path.Clean("/" + name)
+	links := 0
+	for rest != "" {
+		var elem string
+		elem, rest = splitFirst(rest)
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			resolved = strings.TrimPrefix(path.Dir("/"+resolved), "/")
+			continue
+		}
+
+		next := path.Join(resolved, elem)
+		fi, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(next)))
+		if os.IsNotExist(err) || err == nil && fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if links++; links > maxLinks {
+			return "", fmt.Errorf("%s: too many levels of symbolic links", name)
+		}
+		link, err := os.Readlink(filepath.Join(dir, filepath.FromSlash(next)))
+		if err != nil {
+			return "", err
+		}
+		link = filepath.ToSlash(link)
+		if path.IsAbs(link) {
+			resolved = ""
+		}
+		rest = link + "/" + rest
+	}
+	return filepath.Join(dir, filepath.FromSlash(resolved)), nil
+}
+
+// splitFirst splits the first element off of the slash separated p
+func splitFirst(p string) (string, string) {
+	p = strings.TrimLeft(p, "/")
+	if i := strings.Index(p, "/"); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
@@ -0,0 +1,52 @@
+package store_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestNewLayout_LongPath(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	// well past the MAX_PATH of windows, before the blobs beneath it add their own 80 or so characters
+	long := t.TempDir()
+	for i := 0; i < 6; i++ {
+		long = filepath.Join(long, strings.Repeat(string(rune('a'+i)), 50))
+	}
+	s, err := store.NewLayout(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+	// replacing what's indexed under a long path replaces the index beneath it too
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+	_, desc, err := s.Resolve(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := s.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if _, err := s.GC(ctx); err != nil {
+		t.Fatal(err)
+	}
+	report, err := s.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("Fsck() = %+v, want ok", report)
+	}
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// PreloadArchive is the name of the docker archive of the images Preload writes
+	PreloadArchive = "images.tar"
+
+	// PreloadManifest is the name of the kubernetes manifest Preload writes
+	PreloadManifest = "preload.yaml"
+
+	// preloadDigestAnnotation records the digest of the archive on the pods, rolling them out whenever it changes
+	preloadDigestAnnotation = "ocil.rancherfederal.io/preload-digest"
+
+	// preloadMount is where the containers of the DaemonSet find the archive
+	preloadMount = "/preload"
+)
+
+type PreloadOption func(*preloadOptions)
+
+type preloadOptions struct {
+	name       string
+	namespace  string
+	socket     string
+	hostPath   string
+	url        string
+	pauseImage string
+}
+
+// WithPreloadName names the DaemonSet (and its pods' app label) instead of ocil-preload
+func WithPreloadName(name string) PreloadOption {
+	return func(o *preloadOptions) {
+		o.name = name
+	}
+}
+
+// WithPreloadNamespace creates the DaemonSet in the namespace ns instead of kube-system
+func WithPreloadNamespace(ns string) PreloadOption {
+	return func(o *preloadOptions) {
+		o.namespace = ns
+	}
+}
+
+// WithPreloadSocket imports through the containerd socket at path on the nodes instead of
+// /run/containerd/containerd.sock (ie: /run/k3s/containerd/containerd.sock for k3s and RKE2)
+func WithPreloadSocket(path string) PreloadOption {
+	return func(o *preloadOptions) {
+		o.socket = path
+	}
+}
+
+// WithPreloadHostPath reads the archive from the directory dir of the nodes instead of /var/lib/ocil/preload
+func WithPreloadHostPath(dir string) PreloadOption {
+	return func(o *preloadOptions) {
+		o.hostPath = dir
+	}
+}
+
+// WithPreloadURL downloads the archive from url (ie: of an http server the nodes can reach) rather than reading it from
+// the nodes, so it doesn't have to be copied to each of them
+func WithPreloadURL(url string) PreloadOption {
+	return func(o *preloadOptions) {
+		o.url = url
+	}
+}
+
+// WithPreloadPauseImage runs the pods of the DaemonSet with image once the archive is imported, instead of
+// registry.k8s.io/pause:3.6
+// 	It's best the sandbox image of the nodes, which is the one image they're sure to already hold.
+func WithPreloadPauseImage(image string) PreloadOption {
+	return func(o *preloadOptions) {
+		o.pauseImage = image
+	}
+}
+
+func makePreloadOptions(opts ...PreloadOption) *preloadOptions {
+	o := &preloadOptions{
+		name:       "ocil-preload",
+		namespace:  "kube-system",
+		socket:     "/run/containerd/containerd.sock",
+		hostPath:   "/var/lib/ocil/preload",
+		pauseImage: "registry.k8s.io/pause:3.6",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Preload writes what it takes to preload the images stored under refs onto the nodes of a cluster without a registry
+// into dir, returning the paths it wrote: the docker archive of the images (PreloadArchive), and the DaemonSet
+// importing it into the k8s.io namespace of each node's containerd with ctr (PreloadManifest)
+// 	The DaemonSet runs image, which must provide ctr (and wget, to download the archive with WithPreloadURL) and be
+// 	one the nodes can already run: it's the one image that can't be preloaded this way.  The archive is imported
+// 	from a hostPath unless it's downloaded, so it must be copied to each node first.  Each pod imports the archive
+// 	as it starts, and the pods are rolled out again whenever the archive changes.  When no refs are given every image
+// 	in the store is preloaded.
+func (l *Layout) Preload(ctx context.Context, dir string, image string, refs []string, opts ...PreloadOption) ([]string, error) {
+	o := makePreloadOptions(opts...)
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	archive := filepath.Join(dir, PreloadArchive)
+	f, err := os.Create(archive)
+	if err != nil {
+		return nil, err
+	}
+	digester := digest.Canonical.Digester()
+	if err := l.Export(ctx, io.MultiWriter(f, digester.Hash()), refs...); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	data, err := yaml.Marshal(preloadDaemonSet(image, digester.Digest(), o))
+	if err != nil {
+		return nil, err
+	}
+	manifest := filepath.Join(dir, PreloadManifest)
+	if err := os.WriteFile(manifest, data, 0644); err != nil {
+		return nil, err
+	}
+	return []string{archive, manifest}, nil
+}
+
+// preloadDaemonSet is the DaemonSet importing the archive of digest d with image
+func preloadDaemonSet(image string, d digest.Digest, o *preloadOptions) map[string]interface{} {
+	archive := path.Join(preloadMount, PreloadArchive)
+
+	volumes := []interface{}{
+		map[string]interface{}{
+			"name":     "containerd",
+			"hostPath": map[string]interface{}{"path": o.socket, "type": "Socket"},
+		},
+	}
+	var initContainers []interface{}
+	if o.url != "" {
+		volumes = append(volumes, map[string]interface{}{"name": "preload", "emptyDir": map[string]interface{}{}})
+		initContainers = append(initContainers, map[string]interface{}{
+			"name":         "download",
+			"image":        image,
+			"command":      []string{"wget", "-O", archive, o.url},
+			"volumeMounts": []interface{}{map[string]interface{}{"name": "preload", "mountPath": preloadMount}},
+		})
+	} else {
+		volumes = append(volumes, map[string]interface{}{
+			"name":     "preload",
+			"hostPath": map[string]interface{}{"path": o.hostPath, "type": "Directory"},
+		})
+	}
+	initContainers = append(initContainers, map[string]interface{}{
+		"name":    "import",
+		"image":   image,
+		"command": []string{"ctr", "--address", o.socket, "--namespace", "k8s.io", "images", "import", archive},
+		"volumeMounts": []interface{}{
+			map[string]interface{}{"name": "containerd", "mountPath": o.socket},
+			map[string]interface{}{"name": "preload", "mountPath": preloadMount, "readOnly": o.url == ""},
+		},
+	})
+
+	labels := map[string]string{"app": o.name}
+	return map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "DaemonSet",
+		"metadata": map[string]interface{}{
+			"name":      o.name,
+			"namespace": o.namespace,
+			"labels":    labels,
+		},
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{"matchLabels": labels},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels":      labels,
+					"annotations": map[string]string{preloadDigestAnnotation: d.String()},
+				},
+				"spec": map[string]interface{}{
+					// every node, control plane and tainted ones included
+					"tolerations":    []interface{}{map[string]interface{}{"operator": "Exists"}},
+					"initContainers": initContainers,
+					"containers": []interface{}{
+						map[string]interface{}{"name": "pause", "image": o.pauseImage},
+					},
+					"volumes": volumes,
+				},
+			},
+		},
+	}
+}
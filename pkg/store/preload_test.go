@@ -0,0 +1,145 @@
+package store_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/opencontainers/go-digest"
+	"gopkg.in/yaml.v2"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Preload(t *testing.T) {
+	s := newLayout(t)
+	refs := []string{"hello/world:v1", "hello/other:v1"}
+	for _, ref := range refs {
+		if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		opts      []store.PreloadOption
+		wantInit  []string
+		volume    string
+		namespace string
+	}{
+		{name: "hostpath", wantInit: []string{"import"}, volume: "hostPath", namespace: "kube-system"},
+		{
+			name:      "url",
+			opts:      []store.PreloadOption{store.WithPreloadURL("http://files.example.com/images.tar"), store.WithPreloadNamespace("preload")},
+			wantInit:  []string{"download", "import"},
+			volume:    "emptyDir",
+			namespace: "preload",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(root, "preload-"+tt.name)
+			paths, err := s.Preload(ctx, dir, "registry.example.com/tools/ctr:v1", refs, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			archive, manifest := filepath.Join(dir, store.PreloadArchive), filepath.Join(dir, store.PreloadManifest)
+			if len(paths) != 2 || paths[0] != archive || paths[1] != manifest {
+				t.Fatalf("Preload() = %v, want [%s %s]", paths, archive, manifest)
+			}
+
+			m, err := tarball.LoadManifest(func() (io.ReadCloser, error) {
+				return os.Open(archive)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var tags []string
+			for _, d := range m {
+				tags = append(tags, d.RepoTags...)
+			}
+			sort.Strings(tags)
+			if want := []string{"hello/other:v1", "hello/world:v1"}; !reflect.DeepEqual(tags, want) {
+				t.Errorf("archive tags = %v, want %v", tags, want)
+			}
+
+			data, err := os.ReadFile(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ds struct {
+				Kind     string `yaml:"kind"`
+				Metadata struct {
+					Namespace string `yaml:"namespace"`
+				} `yaml:"metadata"`
+				Spec struct {
+					Template struct {
+						Metadata struct {
+							Annotations map[string]string `yaml:"annotations"`
+						} `yaml:"metadata"`
+						Spec struct {
+							InitContainers []struct {
+								Name    string   `yaml:"name"`
+								Image   string   `yaml:"image"`
+								Command []string `yaml:"command"`
+							} `yaml:"initContainers"`
+							Volumes []map[string]interface{} `yaml:"volumes"`
+						} `yaml:"spec"`
+					} `yaml:"template"`
+				} `yaml:"spec"`
+			}
+			if err := yaml.Unmarshal(data, &ds); err != nil {
+				t.Fatal(err)
+			}
+			if ds.Kind != "DaemonSet" || ds.Metadata.Namespace != tt.namespace {
+				t.Errorf("%s in %s, want a DaemonSet in %s", ds.Kind, ds.Metadata.Namespace, tt.namespace)
+			}
+
+			f, err := os.Open(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			d, err := digest.FromReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ds.Spec.Template.Metadata.Annotations["ocil.rancherfederal.io/preload-digest"]; got != d.String() {
+				t.Errorf("pod digest annotation = %s, want %s", got, d)
+			}
+
+			var names []string
+			for _, c := range ds.Spec.Template.Spec.InitContainers {
+				names = append(names, c.Name)
+				if c.Image != "registry.example.com/tools/ctr:v1" {
+					t.Errorf("init container %s image = %s", c.Name, c.Image)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.wantInit) {
+				t.Errorf("init containers = %v, want %v", names, tt.wantInit)
+			}
+			imp := ds.Spec.Template.Spec.InitContainers[len(names)-1].Command
+			if len(imp) == 0 || imp[0] != "ctr" || imp[len(imp)-1] != "/preload/images.tar" {
+				t.Errorf("import command = %v", imp)
+			}
+
+			found := false
+			for _, v := range ds.Spec.Template.Spec.Volumes {
+				if v["name"] == "preload" {
+					_, found = v[tt.volume]
+				}
+			}
+			if !found {
+				t.Errorf("volumes = %v, want a %s preload volume", ds.Spec.Template.Spec.Volumes, tt.volume)
+			}
+		})
+	}
+
+	if _, err := s.Preload(ctx, filepath.Join(root, "missing"), "ctr", []string{"hello/missing:v1"}); err == nil {
+		t.Errorf("Preload() of a missing reference should fail")
+	}
+}
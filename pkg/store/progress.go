@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"io"
+
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/target"
+)
+
+// ProgressEvent reports bytes transferred for a single blob of a reference being added or copied, or the completion of
+// the reference itself
+// 	Once Complete, Descriptor is the root descriptor of the reference rather than one of its blobs
+type ProgressEvent struct {
+	Operation   Operation
+	Reference   string
+	Descriptor  ocispec.Descriptor
+	Transferred int64
+	Total       int64
+	Complete    bool
+}
+
+// WithProgress reports the progress of every Add, Copy and CopyAll on the Layout to fn
+// 	Blobs are transferred concurrently, but fn is never called concurrently, so it's safe to render directly from it.
+// 	Blobs that are already present at the destination are skipped, and so never reported.
+func WithProgress(fn func(ProgressEvent)) Options {
+	return func(l *Layout) {
+		l.progress = fn
+	}
+}
+
+type progressKey struct{}
+
+// tracked wraps op so the blobs it transfers report progress against req, and req itself is reported once op succeeds
+func (l *Layout) tracked(op Handler) Handler {
+	if l.progress == nil {
+		return op
+	}
+
+	return func(ctx context.Context, req *Request) error {
+		switch req.Operation {
+		case OperationAdd, OperationCopy:
+		default:
+			return op(ctx, req)
+		}
+
+		if err := op(context.WithValue(ctx, progressKey{}, req), req); err != nil {
+			return err
+		}
+
+		l.report(ProgressEvent{
+			Operation:   req.Operation,
+			Reference:   req.Reference,
+			Descriptor:  req.Descriptor,
+			Transferred: req.Descriptor.Size,
+			Total:       req.Descriptor.Size,
+			Complete:    true,
+		})
+		return nil
+	}
+}
+
+func (l *Layout) report(e ProgressEvent) {
+	l.progressMu.Lock()
+	defer l.progressMu.Unlock()
+	l.progress(e)
+}
+
+// progressWriter wraps w so bytes written for desc are reported, if ctx belongs to a tracked operation
+func (l *Layout) progressWriter(ctx context.Context, desc ocispec.Descriptor, w io.Writer) io.Writer {
+	req, ok := ctx.Value(progressKey{}).(*Request)
+	if !ok {
+		return w
+	}
+	return &progressWriter{Writer: w, counter: progressCounter{l: l, req: req, desc: desc}}
+}
+
+// progressSource wraps from so bytes fetched from it are reported, if ctx belongs to a tracked operation
+func (l *Layout) progressSource(ctx context.Context, from target.Target) target.Target {
+	req, ok := ctx.Value(progressKey{}).(*Request)
+	if !ok {
+		return from
+	}
+	return &progressTarget{Target: from, l: l, req: req}
+}
+
+type progressCounter struct {
+	l           *Layout
+	req         *Request
+	desc        ocispec.Descriptor
+	transferred int64
+}
+
+func (c *progressCounter) add(n int) {
+	if n == 0 {
+		return
+	}
+	c.transferred += int64(n)
+	c.l.report(ProgressEvent{
+		Operation:   c.req.Operation,
+		Reference:   c.req.Reference,
+		Descriptor:  c.desc,
+		Transferred: c.transferred,
+		Total:       c.desc.Size,
+	})
+}
+
+type progressWriter struct {
+	io.Writer
+	counter progressCounter
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.counter.add(n)
+	return n, err
+}
+
+type progressReader struct {
+	io.ReadCloser
+	counter progressCounter
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.counter.add(n)
+	return n, err
+}
+
+type progressTarget struct {
+	target.Target
+	l   *Layout
+	req *Request
+}
+
+func (t *progressTarget) Fetcher(ctx context.Context, ref string) (remotes.Fetcher, error) {
+	f, err := t.Target.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return remotes.FetcherFunc(func(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+		rc, err := f.Fetch(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		return &progressReader{ReadCloser: rc, counter: progressCounter{l: t.l, req: t.req, desc: desc}}, nil
+	}), nil
+}
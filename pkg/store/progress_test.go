@@ -0,0 +1,56 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_WithProgress(t *testing.T) {
+	var events []store.ProgressEvent
+	s := newLayout(t, store.WithProgress(func(e store.ProgressEvent) {
+		events = append(events, e)
+	}))
+
+	ref := "hello/world:v1"
+	desc, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := tempLayout(t)
+	if _, err := s.CopyAll(ctx, dst.OCI, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range []store.Operation{store.OperationAdd, store.OperationCopy} {
+		transferred := make(map[digest.Digest]int64)
+		complete := 0
+		for _, e := range events {
+			if e.Operation != op || e.Reference != ref {
+				continue
+			}
+			if e.Complete {
+				complete++
+				if e.Descriptor.Digest != desc.Digest {
+					t.Errorf("%s completed with %s, want %s", op, e.Descriptor.Digest, desc.Digest)
+				}
+				continue
+			}
+			transferred[e.Descriptor.Digest] = e.Transferred
+			if e.Transferred > e.Total {
+				t.Errorf("%s of %s transferred %d of %d bytes", op, e.Descriptor.Digest, e.Transferred, e.Total)
+			}
+		}
+
+		if complete != 1 {
+			t.Errorf("%s reported completion %d times, want 1", op, complete)
+		}
+		// the manifest, config and 3 layers
+		if len(transferred) != 5 {
+			t.Errorf("%s reported progress for %d blobs, want 5", op, len(transferred))
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"runtime/debug"
+	"time"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+const modulePath = "github.com/rancherfederal/ocil"
+
+// Provenance is where a reference of the store came from, as recorded when it was added with WithProvenance
+type Provenance struct {
+	// Source is the url, path or image reference the artifact was fetched from, when it knows
+	Source string `json:"source,omitempty"`
+
+	// Reference is the reference it was added as
+	Reference string `json:"reference"`
+
+	// Fetched is when it was added
+	Fetched time.Time `json:"fetched"`
+
+	// Tool is the ocil version that added it
+	Tool string `json:"tool"`
+}
+
+// WithProvenance records the Provenance of everything added to the Layout as annotations on its index descriptor,
+// which List returns in each Records Provenance
+// 	Artifacts implementing artifacts.Sourced have their source recorded too.
+func WithProvenance() Options {
+	return func(l *Layout) {
+		l.provenance = true
+	}
+}
+
+// provenanceAnnotations returns the annotations recording the provenance of v, added as ref
+func (l *Layout) provenanceAnnotations(v interface{}, ref string) map[string]string {
+	if !l.provenance {
+		return nil
+	}
+
+	annotations := map[string]string{
+		consts.ProvenanceReferenceAnnotation: ref,
+		consts.ProvenanceFetchedAnnotation:   time.Now().UTC().Format(time.RFC3339),
+		consts.ProvenanceToolAnnotation:      toolVersion(),
+	}
+	if s, ok := v.(artifacts.Sourced); ok && s.Source() != "" {
+		annotations[consts.ProvenanceSourceAnnotation] = s.Source()
+	}
+	return annotations
+}
+
+// provenanceOf returns the Provenance recorded in annotations, or nil if none was
+func provenanceOf(annotations map[string]string) *Provenance {
+	ref, ok := annotations[consts.ProvenanceReferenceAnnotation]
+	if !ok {
+		return nil
+	}
+
+	p := &Provenance{
+		Source:    annotations[consts.ProvenanceSourceAnnotation],
+		Reference: ref,
+		Tool:      annotations[consts.ProvenanceToolAnnotation],
+	}
+	if fetched, err := time.Parse(time.RFC3339, annotations[consts.ProvenanceFetchedAnnotation]); err == nil {
+		p.Fetched = fetched
+	}
+	return p
+}
+
+// toolVersion is ocil followed by the version of the module it was built from, when the binary knows it
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "ocil"
+	}
+
+	version := ""
+	if info.Main.Path == modulePath {
+		version = info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			version = dep.Version
+		}
+	}
+	if version == "" || version == "(devel)" {
+		return "ocil"
+	}
+	return "ocil/" + version
+}
@@ -0,0 +1,61 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/file"
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_WithProvenance(t *testing.T) {
+	s := newLayout(t, store.WithProvenance())
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().Add(-time.Second)
+	if _, err := s.AddOCI(ctx, file.NewFile(path), "files/notes:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("data"), "random"), "memory/data:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]string{
+		"files/notes:v1": path,
+		"memory/data:v1": "",
+	}
+	for _, r := range records {
+		p := r.Provenance
+		if p == nil {
+			t.Fatalf("List() record of %s has no provenance", r.Reference)
+		}
+		if p.Reference != r.Reference || p.Source != sources[r.Reference] {
+			t.Errorf("List() provenance of %s = %+v, want source %q", r.Reference, p, sources[r.Reference])
+		}
+		if p.Fetched.Before(before) || p.Tool == "" {
+			t.Errorf("List() provenance of %s = %+v, want a fetch time and tool", r.Reference, p)
+		}
+	}
+
+	// without the option nothing is recorded
+	plain := tempLayout(t)
+	desc, err := plain.AddOCI(ctx, file.NewFile(path), "files/notes:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := desc.Annotations[consts.ProvenanceReferenceAnnotation]; ok {
+		t.Errorf("AddOCI() recorded provenance without WithProvenance: %v", desc.Annotations)
+	}
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"fmt"
+)
+
+// WithReadOnly opens the layout for reading only, ie: one on read-only media (a dvd, a mounted iso, a ro nfs export)
+// 	References can still be resolved, fetched, listed and copied out, but every operation that would change the layout
+// 	fails with an error wrapping ErrReadOnly, and nothing is ever created under its root, not even the oci-layout
+// 	marker of a layout without one.
+func WithReadOnly() Options {
+	return func(l *Layout) {
+		l.readOnly = true
+	}
+}
+
+// ReadOnly reports whether the layout was opened WithReadOnly
+func (l *Layout) ReadOnly() bool {
+	return l.readOnly
+}
+
+// writable returns an error wrapping ErrReadOnly for the operation op of a read-only layout
+func (l *Layout) writable(op string) error {
+	if l.readOnly {
+		return fmt.Errorf("%s: %w", op, ErrReadOnly)
+	}
+	return nil
+}
+
+// mutates reports whether op changes the layout
+func (op Operation) mutates() bool {
+	switch op {
+	case OperationAdd, OperationRemove, OperationTag, OperationUntag:
+		return true
+	}
+	return false
+}
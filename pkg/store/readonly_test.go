@@ -0,0 +1,89 @@
+package store_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestNewLayout_WithReadOnly(t *testing.T) {
+	s := newLayout(t)
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := store.NewLayout(root, store.WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, desc, err := ro.Resolve(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := ro.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	dst := tempLayout(t)
+	if _, err := ro.Copy(ctx, ref, dst.OCI, ""); err != nil {
+		t.Errorf("Copy() out of a read-only layout error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"AddOCI", func() error {
+			_, err := ro.AddOCI(ctx, genArtifact(t, "hello/world:v2"), "hello/world:v2")
+			return err
+		}},
+		{"Tag", func() error {
+			_, err := ro.Tag(ctx, ref, "hello/world:latest")
+			return err
+		}},
+		{"Remove", func() error {
+			return ro.Remove(ctx, ref)
+		}},
+		{"GC", func() error {
+			_, err := ro.GC(ctx)
+			return err
+		}},
+		{"Flush", func() error {
+			return ro.Flush(ctx)
+		}},
+		{"Begin", func() error {
+			_, err := ro.Begin(ctx)
+			return err
+		}},
+		{"Delete", func() error {
+			return ro.OCI.Delete(ctx, desc)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, store.ErrReadOnly) {
+				t.Errorf("%s() error = %v, want ErrReadOnly", tt.name, err)
+			}
+		})
+	}
+	if got := refs(t, s); len(got) != 1 {
+		t.Errorf("stored references = %v, want only %s", got, ref)
+	}
+
+	// nothing is created under the root of a read-only layout
+	empty := t.TempDir()
+	if _, err := store.NewLayout(empty, store.WithReadOnly()); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := os.ReadDir(empty); err != nil || len(entries) != 0 {
+		t.Errorf("read-only layout root entries = %v (%v), want none", entries, err)
+	}
+	if _, err := store.NewLayout(filepath.Join(empty, "missing"), store.WithReadOnly()); err == nil {
+		t.Error("NewLayout() of a missing read-only root error = nil")
+	}
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Referrers returns the manifests in the store that refer to desc as their subject (signatures, attestations, sboms, ...)
+// 	Referrers are found both by their subject and through the "<alg>-<hex>" referrers tag fallback of the OCI
+// 	distribution spec.  The Layout maintains that fallback index for everything it adds with a subject, so copies to
+// 	registries without the referrers API remain discoverable.  Each descriptor carries the annotations and artifact type
+// 	of its manifest, the media type of its config if it has none of its own (see Identify).
+func (l *Layout) Referrers(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	var referrers []ocispec.Descriptor
+	seen := make(map[digest.Digest]bool)
+
+	tag := referrersTag("", desc.Digest)
+	err := l.OCI.Walk(func(reference string, rdesc ocispec.Descriptor) error {
+		if repository(reference)+tag == reference {
+			var idx referrersIndex
+			if err := l.fetchJSON(ctx, rdesc, &idx); err != nil {
+				return err
+			}
+			for _, m := range idx.Manifests {
+				if !seen[m.Digest] {
+					seen[m.Digest] = true
+					referrers = append(referrers, m)
+				}
+			}
+			return nil
+		}
+
+		s, err := l.subject(ctx, rdesc)
+		if err != nil {
+			return err
+		}
+		if s == nil || s.Digest != desc.Digest || seen[rdesc.Digest] {
+			return nil
+		}
+		seen[rdesc.Digest] = true
+
+		entry, err := l.referrerEntry(ctx, rdesc)
+		if err != nil {
+			return err
+		}
+		referrers = append(referrers, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return referrers, nil
+}
+
+// referrersIndex is the index stored under the referrers tag of a subject, listing everything that refers to it
+type referrersIndex struct {
+	specs.Versioned
+	MediaType string               `json:"mediaType"`
+	Manifests []ocispec.Descriptor `json:"manifests"`
+}
+
+// referrersTag is the referrers tag fallback of the subject d in ref's repository
+func referrersTag(ref string, d digest.Digest) string {
+	return fmt.Sprintf("%s:%s-%s", repository(ref), d.Algorithm(), d.Hex())
+}
+
+// addReferrer records desc, stored as ref, in the referrers tag fallback index of subject
+func (l *Layout) addReferrer(ctx context.Context, ref string, subject digest.Digest, desc ocispec.Descriptor) error {
+	entry, err := l.referrerEntry(ctx, desc)
+	if err != nil {
+		return err
+	}
+
+	return l.updateReferrers(ctx, referrersTag(ref, subject), func(entries []ocispec.Descriptor) []ocispec.Descriptor {
+		for i, e := range entries {
+			if e.Digest == entry.Digest {
+				entries[i] = entry
+				return entries
+			}
+		}
+		return append(entries, entry)
+	})
+}
+
+// removeReferrers drops those of refs that have a subject from its referrers tag fallback index
+// 	Indexes that are themselves being removed are left alone
+func (l *Layout) removeReferrers(ctx context.Context, refs []string) error {
+	removing := make(map[string]bool, len(refs))
+	for _, r := range refs {
+		removing[r] = true
+	}
+
+	for _, r := range refs {
+		desc, err := l.resolve(ctx, r)
+		if err != nil {
+			return err
+		}
+		s, err := l.subject(ctx, desc)
+		if err != nil {
+			return err
+		}
+		if s == nil || removing[referrersTag(r, s.Digest)] {
+			continue
+		}
+
+		err = l.updateReferrers(ctx, referrersTag(r, s.Digest), func(entries []ocispec.Descriptor) []ocispec.Descriptor {
+			var kept []ocispec.Descriptor
+			for _, e := range entries {
+				if e.Digest != desc.Digest {
+					kept = append(kept, e)
+				}
+			}
+			return kept
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateReferrers applies fn to the entries of the referrers index stored as tag, and stores the result in its place
+// 	The tag is dropped entirely once nothing refers to its subject
+func (l *Layout) updateReferrers(ctx context.Context, tag string, fn func([]ocispec.Descriptor) []ocispec.Descriptor) error {
+	l.referrersMu.Lock()
+	defer l.referrersMu.Unlock()
+
+	idx := referrersIndex{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+	}
+	// a subject nothing refers to yet has no index to start from, but failing to read one that's there loses its entries
+	desc, err := l.resolve(ctx, tag)
+	switch {
+	case err == nil:
+		if err := l.fetchJSON(ctx, desc, &idx); err != nil {
+			return err
+		}
+	case !errors.Is(err, ErrRefNotFound):
+		return err
+	}
+
+	idx.Manifests = fn(idx.Manifests)
+	if len(idx.Manifests) == 0 {
+		return l.removeIndex(ctx, tag)
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	d, err := l.writeManifestData(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	return l.addIndex(ctx, ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Digest:    d,
+		Size:      int64(len(data)),
+		Annotations: map[string]string{
+			ocispec.AnnotationRefName: tag,
+		},
+	})
+}
+
+// referrerEntry describes the manifest desc as the referrers API would, with its artifact type and annotations
+func (l *Layout) referrerEntry(ctx context.Context, desc ocispec.Descriptor) (ocispec.Descriptor, error) {
+	var m struct {
+		ArtifactType string             `json:"artifactType,omitempty"`
+		Config       ocispec.Descriptor `json:"config"`
+		Annotations  map[string]string  `json:"annotations,omitempty"`
+	}
+	if err := l.fetchJSON(ctx, desc, &m); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	// as the distribution spec has it, the artifactType of a manifest without one is the media type of its config
+	if m.ArtifactType == "" {
+		m.ArtifactType = m.Config.MediaType
+	}
+
+	return ocispec.Descriptor{
+		MediaType:    desc.MediaType,
+		Digest:       desc.Digest,
+		Size:         desc.Size,
+		ArtifactType: m.ArtifactType,
+		Annotations:  m.Annotations,
+	}, nil
+}
+
+// isReferrersTag reports whether ref is the referrers tag fallback of some subject
+func isReferrersTag(ref string) bool {
+	tag := strings.TrimPrefix(ref, repository(ref)+":")
+	if tag == ref {
+		return false
+	}
+	return digest.Digest(strings.Replace(tag, "-", ":", 1)).Validate() == nil
+}
@@ -0,0 +1,78 @@
+package store_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/sbom"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Referrers(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	desc, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"spdx", "other"} {
+		doc, err := sbom.NewSBOM([]byte(fmt.Sprintf(`{"spdxVersion": "SPDX-2.3", "name": "%s"}`, name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the second sbom replaces the first under the same tag, but both remain referrers of the image
+		if _, err := s.AddSBOM(ctx, doc, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	referrers, err := s.Referrers(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 2 {
+		t.Fatalf("Referrers() = %v, want both sboms", referrers)
+	}
+
+	// the referrers tag fallback index lists them for registries without the referrers API
+	fallback := fmt.Sprintf("hello/world:%s-%s", desc.Digest.Algorithm(), desc.Digest.Hex())
+	_, fdesc, err := s.Resolve(ctx, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := s.Fetch(ctx, fdesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var idx struct {
+		Manifests []struct {
+			ArtifactType string `json:"artifactType"`
+		} `json:"manifests"`
+	}
+	if err := json.NewDecoder(rc).Decode(&idx); err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Manifests) != 2 || idx.Manifests[0].ArtifactType != consts.SBOMConfigMediaType {
+		t.Errorf("referrers index = %+v, want both sboms", idx.Manifests)
+	}
+
+	sbomRef := fallback + ".sbom"
+	if err := s.Remove(ctx, sbomRef); err != nil {
+		t.Fatal(err)
+	}
+	if referrers, err := s.Referrers(ctx, desc); err != nil || len(referrers) != 1 {
+		t.Errorf("Referrers() after removing an sbom = %v, %v, want the other one", referrers, err)
+	}
+
+	if err := s.Remove(ctx, ref, store.WithCascade()); err != nil {
+		t.Fatal(err)
+	}
+	if got := refs(t, s); len(got) != 0 {
+		t.Errorf("references after a cascading remove = %v, want none", got)
+	}
+}
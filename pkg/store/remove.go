@@ -0,0 +1,213 @@
+package store
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type RemoveOption func(*removeOptions)
+
+type removeOptions struct {
+	cascade bool
+	prune   bool
+}
+
+// WithCascade removes every artifact attached to the removed reference as well (signatures, sboms, attestations, ...)
+// 	Attachments are found by their manifest's subject, the cosign style "<alg>-<hex>.<suffix>" tag scheme or the
+// 	"<alg>-<hex>" referrers tag fallback.  They're attached to a digest rather than a reference, so they're left in
+// 	place for as long as any other reference to the same digest is.
+func WithCascade() RemoveOption {
+	return func(o *removeOptions) {
+		o.cascade = true
+	}
+}
+
+// WithPrune deletes the blobs of the removed reference that are no longer referenced by anything left in the store
+func WithPrune() RemoveOption {
+	return func(o *removeOptions) {
+		o.prune = true
+	}
+}
+
+// Remove drops ref from the stores index, and optionally the blobs only it referenced
+func (l *Layout) Remove(ctx context.Context, ref string, opts ...RemoveOption) error {
+	return l.intercept(ctx, &Request{Operation: OperationRemove, Reference: ref}, func(ctx context.Context, req *Request) error {
+		desc, err := l.remove(ctx, req.Reference, opts...)
+		req.Descriptor = desc
+		return err
+	})
+}
+
+func (l *Layout) remove(ctx context.Context, ref string, opts ...RemoveOption) (ocispec.Descriptor, error) {
+	o := &removeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	desc, err := l.resolve(ctx, ref)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	refs := []string{ref}
+	if o.cascade {
+		shared, err := l.sharedDigest(ctx, ref, desc.Digest)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		if !shared {
+			attached, err := l.attached(ctx, desc.Digest, map[digest.Digest]bool{})
+			if err != nil {
+				return ocispec.Descriptor{}, err
+			}
+			refs = append(refs, attached...)
+		}
+	}
+
+	// everything the removed references point at is a candidate for pruning, but only once they're out of the index
+	// can we know what is still referenced by something else
+	candidates := make(map[digest.Digest]ocispec.Descriptor)
+	if o.prune {
+		for _, r := range refs {
+			rdesc, err := l.resolve(ctx, r)
+			if err != nil {
+				return ocispec.Descriptor{}, err
+			}
+			if err := l.descendants(ctx, rdesc, candidates); err != nil {
+				return ocispec.Descriptor{}, err
+			}
+		}
+	}
+
+	if err := l.removeReferrers(ctx, refs); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := l.OCI.RemoveIndex(refs...); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	if o.prune {
+		l.gcMu.Lock()
+		defer l.gcMu.Unlock()
+		reachable, err := l.reachable(ctx)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		for d, cdesc := range candidates {
+			if _, ok := reachable[d]; ok {
+				continue
+			}
+			if err := l.deleteBlob(ctx, cdesc); err != nil {
+				return ocispec.Descriptor{}, err
+			}
+		}
+	}
+	return desc, nil
+}
+
+// sharedDigest is whether any reference but ref still resolves to d
+func (l *Layout) sharedDigest(ctx context.Context, ref string, d digest.Digest) (bool, error) {
+	tags, err := l.Tags(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	for _, tag := range tags {
+		if tag != ref {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// deleteBlob deletes a blob along with any sidecar metadata the Layout recorded for it
+func (l *Layout) deleteBlob(ctx context.Context, desc ocispec.Descriptor) error {
+	if err := l.OCI.Delete(ctx, desc); err != nil {
+		return err
+	}
+	if err := l.OCI.Driver().Remove(digestName(desc.Digest)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// attached recursively finds the references of every artifact attached to the manifest identified by d
+func (l *Layout) attached(ctx context.Context, d digest.Digest, seen map[digest.Digest]bool) ([]string, error) {
+	m, err := l.attachments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.attached(d, seen), nil
+}
+
+// attachment is a reference attached to a manifest, along with the digest it's indexed with
+type attachment struct {
+	ref    string
+	digest digest.Digest
+}
+
+// attachmentMap is what's attached to each manifest of the store, by the manifest's digest
+type attachmentMap map[digest.Digest][]attachment
+
+// attachments maps everything attached to a manifest in the store in a single walk of its index
+func (l *Layout) attachments(ctx context.Context) (attachmentMap, error) {
+	m := make(attachmentMap)
+	err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if d, ok := taggedSubject(reference); ok {
+			m[d] = append(m[d], attachment{ref: reference, digest: desc.Digest})
+			return nil
+		}
+
+		s, err := l.subject(ctx, desc)
+		if err != nil {
+			return err
+		}
+		if s != nil {
+			m[s.Digest] = append(m[s.Digest], attachment{ref: reference, digest: desc.Digest})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// attached recursively finds the references of every artifact attached to the manifest identified by d
+func (m attachmentMap) attached(d digest.Digest, seen map[digest.Digest]bool) []string {
+	if seen[d] {
+		return nil
+	}
+	seen[d] = true
+
+	var refs []string
+	for _, a := range m[d] {
+		refs = append(refs, a.ref)
+	}
+	// attachments can have attachments of their own, ie: a signed sbom
+	for _, a := range m[d] {
+		refs = append(refs, m.attached(a.digest, seen)...)
+	}
+	return refs
+}
+
+// taggedSubject returns the digest of the manifest ref is attached to by its tag, either the cosign style
+// "<alg>-<hex>.<suffix>" or the referrers tag fallback "<alg>-<hex>"
+func taggedSubject(ref string) (digest.Digest, bool) {
+	tag := ref[len(repository(ref)):]
+	if !strings.HasPrefix(tag, ":") {
+		return "", false
+	}
+	parts := strings.SplitN(tag[1:], "-", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+	d := digest.NewDigestFromEncoded(digest.Algorithm(parts[0]), strings.SplitN(parts[1], ".", 2)[0])
+	if d.Validate() != nil {
+		return "", false
+	}
+	return d, true
+}
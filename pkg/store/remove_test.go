@@ -0,0 +1,112 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Remove(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	tests := []struct {
+		name     string
+		opts     []store.RemoveOption
+		tags     []string
+		wantRefs int
+	}{
+		{
+			name:     "should leave attachments in place by default",
+			opts:     nil,
+			wantRefs: 2,
+		},
+		{
+			name:     "should remove attachments when cascading",
+			opts:     []store.RemoveOption{store.WithCascade()},
+			wantRefs: 1,
+		},
+		{
+			name:     "should leave attachments of a digest that's still tagged when cascading",
+			opts:     []store.RemoveOption{store.WithCascade()},
+			tags:     []string{"app:latest"},
+			wantRefs: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tempLayout(t)
+
+			desc, err := s.AddOCI(ctx, genArtifact(t, "app:v1"), "app:v1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sigRef := "app:" + desc.Digest.Algorithm().String() + "-" + desc.Digest.Hex() + ".sig"
+			if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("sig"), "random"), sigRef); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("other"), "random"), "other:v1"); err != nil {
+				t.Fatal(err)
+			}
+			for _, tag := range tt.tags {
+				if _, err := s.Tag(ctx, "app:v1", tag); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := s.Remove(ctx, "app:v1", tt.opts...); err != nil {
+				t.Fatal(err)
+			}
+
+			var refs int
+			if err := s.Walk(func(reference string, desc ocispec.Descriptor) error {
+				if reference == "app:v1" {
+					t.Errorf("removed reference %s is still in the index", reference)
+				}
+				refs++
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if refs != tt.wantRefs {
+				t.Errorf("got %d references after Remove(), want %d", refs, tt.wantRefs)
+			}
+		})
+	}
+}
+
+func TestLayout_RemoveWithPrune(t *testing.T) {
+	s := newLayout(t)
+
+	shared := []byte("shared")
+	a := memory.NewMemory(shared, "random", memory.WithConfig(map[string]string{"name": "a"}, consts.MemoryConfigMediaType))
+	b := memory.NewMemory(shared, "random", memory.WithConfig(map[string]string{"name": "b"}, consts.MemoryConfigMediaType))
+	adesc, err := s.AddOCI(ctx, a, "a:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, b, "b:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Remove(ctx, "a:v1", store.WithPrune()); err != nil {
+		t.Fatal(err)
+	}
+
+	blob := func(d digest.Digest) string {
+		return filepath.Join(root, "blobs", d.Algorithm().String(), d.Hex())
+	}
+	if _, err := os.Stat(blob(adesc.Digest)); !os.IsNotExist(err) {
+		t.Errorf("manifest of removed reference was not pruned")
+	}
+	if _, err := os.Stat(blob(digest.FromBytes(shared))); err != nil {
+		t.Errorf("layer still referenced by b:v1 was pruned: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	gname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/target"
+)
+
+// WithRepair re-fetches blobs failing verification on Fetch from the registry an artifact holding them was pulled
+// from, as recorded by WithProvenance, rather than just failing
+// 	Blobs are verified in full before being handed out, so corrupted content is never read part way through.  opts
+// 	authenticate to and reach the registries as they do for copies to a nil target.Target.
+func WithRepair(opts ...CopyOption) Options {
+	return func(l *Layout) {
+		l.repair = makeCopyOptions(opts...)
+	}
+}
+
+// repaired returns rc and err, what fetching desc returned, once desc is verified, repairing it if it's corrupted
+func (l *Layout) repaired(ctx context.Context, desc ocispec.Descriptor, rc io.ReadCloser, err error) (io.ReadCloser, error) {
+	if err == nil {
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		if err == nil {
+			return l.OCI.Fetch(ctx, desc)
+		}
+	}
+	if !errors.Is(err, ErrDigestMismatch) && !errors.Is(err, ErrSizeMismatch) {
+		return nil, err
+	}
+
+	if rerr := l.repairBlob(ctx, desc.Digest); rerr != nil {
+		return nil, fmt.Errorf("%w (repair: %v)", err, rerr)
+	}
+	return l.OCI.Fetch(ctx, desc)
+}
+
+// repairBlob replaces the blob d with a fresh copy from the source of any reference it's reachable from
+func (l *Layout) repairBlob(ctx context.Context, d digest.Digest) error {
+	type candidate struct {
+		source string
+		desc   ocispec.Descriptor
+	}
+
+	var candidates []candidate
+	if err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		p := provenanceOf(desc.Annotations)
+		if p == nil || p.Source == "" {
+			return nil
+		}
+		if _, err := gname.ParseReference(p.Source); err != nil {
+			return nil
+		}
+
+		// a corrupted manifest can't be descended into, but is still found as the root it is
+		seen := make(map[digest.Digest]ocispec.Descriptor)
+		if err := l.descendants(ctx, desc, seen); err != nil && desc.Digest != d {
+			return nil
+		}
+		if found, ok := seen[d]; ok {
+			candidates = append(candidates, candidate{source: p.Source, desc: found})
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no registry source recorded for %s", d)
+	}
+
+	resolver, err := l.repair.remote(l.log)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, c := range candidates {
+		err := l.refetch(ctx, resolver, c.source, c.desc)
+		if err == nil {
+			l.log.Info("repaired blob", "digest", d, "source", c.source)
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", c.source, err))
+	}
+	return fmt.Errorf("refetch %s: %v", d, errs)
+}
+
+// refetch replaces the blob desc with the one fetched from source through from, committed only once it's verified
+func (l *Layout) refetch(ctx context.Context, from target.Target, source string, desc ocispec.Descriptor) error {
+	fetcher, err := from.Fetcher(ctx, source)
+	if err != nil {
+		return err
+	}
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := l.OCI.Delete(ctx, desc); err != nil {
+		return err
+	}
+	w, err := l.OCI.Writer(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if _, err := io.Copy(w, rc); err != nil {
+		return err
+	}
+	return w.Commit(ctx, desc.Size, desc.Digest)
+}
@@ -0,0 +1,112 @@
+package store_test
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/image"
+	"github.com/rancherfederal/ocil/pkg/store"
+	"github.com/rancherfederal/ocil/pkg/transport"
+)
+
+func TestLayout_WithRepair(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := "localhost:" + u.Port() + "/hello/repair:v1"
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(r, img); err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld, err := partial.Descriptor(layers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := ocispec.Descriptor{MediaType: string(ld.MediaType), Digest: digest.Digest(ld.Digest.String()), Size: ld.Size}
+
+	tests := []struct {
+		name    string
+		opts    []store.Options
+		wantErr bool
+	}{
+		{
+			name: "should refetch a corrupted blob from its source",
+			opts: []store.Options{store.WithProvenance(), store.WithRepair(store.WithTransport(transport.WithPlainHTTP()))},
+		},
+		{
+			name:    "should fail without a recorded source",
+			opts:    []store.Options{store.WithRepair(store.WithTransport(transport.WithPlainHTTP()))},
+			wantErr: true,
+		},
+		{
+			name:    "should fail without repair",
+			opts:    []store.Options{store.WithProvenance()},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := store.NewLayout(dir, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			oci, err := image.NewImage(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.AddOCI(ctx, oci, ref); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(dir, "blobs", ld.Digest.Algorithm, ld.Digest.Hex)
+			if err := os.WriteFile(path, make([]byte, ld.Size), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			rc, err := s.Fetch(ctx, desc)
+			if err == nil {
+				var data []byte
+				data, err = io.ReadAll(rc)
+				rc.Close()
+				if err == nil && digest.FromBytes(data) != desc.Digest {
+					t.Errorf("Fetch() = %s, want %s", digest.FromBytes(data), desc.Digest)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/go-logr/logr"
+)
+
+// maxRetryBackoff caps the wait between retries, however many have been attempted
+const maxRetryBackoff = time.Minute
+
+// WithRetry retries copies failing with a transient error (429s, 5xxs, timeouts and dropped connections) up to
+// attempts more times, waiting backoff before the first retry and doubling the wait for every retry after it
+// 	Blobs that reached the destination before the failure are skipped by the retry, so it picks up from the blob that
+// 	failed rather than starting the reference over
+func WithRetry(attempts int, backoff time.Duration) CopyOption {
+	return func(o *copyOptions) {
+		o.retries = attempts
+		o.backoff = backoff
+	}
+}
+
+// retry runs fn until it succeeds, fails with an error that isn't transient, or runs out of retries
+func retry(ctx context.Context, log logr.Logger, o *copyOptions, fn func() error) error {
+	wait := o.backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= o.retries || !isTransient(err) {
+			return err
+		}
+		log.V(1).Info("retrying after transient error", "attempt", attempt+1, "wait", wait, "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+		if wait > maxRetryBackoff {
+			wait = maxRetryBackoff
+		}
+	}
+}
+
+// isTransient reports whether err is worth retrying, ie: the registry is throttling us or briefly unavailable
+func isTransient(err error) bool {
+	var status remoteserrors.ErrUnexpectedStatus
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusTooManyRequests || status.StatusCode >= http.StatusInternalServerError
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
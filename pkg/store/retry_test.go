@@ -0,0 +1,108 @@
+package store_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/remotes"
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/content"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_CopyWithRetry(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name     string
+		status   int
+		failures int
+		wantErr  bool
+	}{
+		{name: "throttled", status: http.StatusTooManyRequests, failures: 2},
+		{name: "unavailable", status: http.StatusServiceUnavailable, failures: 1},
+		{name: "exhausted", status: http.StatusBadGateway, failures: 100, wantErr: true},
+		{name: "not transient", status: http.StatusForbidden, failures: 1, wantErr: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := tempLayout(t)
+			to := &flakyTarget{OCI: dst.OCI, status: tc.status, failures: tc.failures, pushed: make(map[digest.Digest]int64)}
+
+			_, err := s.Copy(ctx, ref, to, "", store.WithRetry(3, time.Millisecond))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Copy() error = %v, wantErr %v", err, tc.wantErr)
+			}
+
+			// transfers cut short by a sibling's failure resume where they left off
+			sizes := blobSizes(t, s.Root)
+			for d, n := range to.pushed {
+				if n > sizes[d] {
+					t.Errorf("blob %s had %d bytes transferred, want at most its %d", d, n, sizes[d])
+				}
+			}
+		})
+	}
+}
+
+// flakyTarget fails the first failures layer pushes with status, and counts the blobs that were pushed
+type flakyTarget struct {
+	*content.OCI
+
+	mu       sync.Mutex
+	status   int
+	failures int
+	pushed   map[digest.Digest]int64
+}
+
+func (f *flakyTarget) Pusher(ctx context.Context, ref string) (remotes.Pusher, error) {
+	p, err := f.OCI.Pusher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return remotes.PusherFunc(func(ctx context.Context, desc ocispec.Descriptor) (ccontent.Writer, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if desc.MediaType == string(types.DockerLayer) && f.failures > 0 {
+			f.failures--
+			return nil, remoteserrors.ErrUnexpectedStatus{Status: http.StatusText(f.status), StatusCode: f.status}
+		}
+
+		w, err := p.Push(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		return &countingWriter{Writer: w, f: f, desc: desc}, nil
+	}), nil
+}
+
+// countingWriter counts the bytes written to a blob across every attempt at pushing it
+type countingWriter struct {
+	ccontent.Writer
+	f    *flakyTarget
+	desc ocispec.Descriptor
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.f.mu.Lock()
+	w.f.pushed[w.desc.Digest] += int64(n)
+	w.f.mu.Unlock()
+	return n, err
+}
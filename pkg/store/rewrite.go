@@ -0,0 +1,153 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ErrInvalidRewriteRule is returned for rewrite rules that can't be applied, ie: without a match
+var ErrInvalidRewriteRule = errors.New("invalid rewrite rule")
+
+// RewriteRule rewrites the references whose repository matches Match
+// 	Match is a repository, or a prefix of repositories ending in "*" (ie: docker.io/*), and "*" alone matches every
+// 	reference.  Replace, Registry, Namespace and TagSuffix are applied in that order, and any that is empty is skipped.
+type RewriteRule struct {
+	// Match is the repository matched, a "*" at its end matching anything beneath it
+	Match string `yaml:"match"`
+
+	// Replace is the repository rewritten to, any "*" in it replaced by what the "*" of Match matched
+	Replace string `yaml:"replace,omitempty"`
+
+	// Registry replaces the registry of the repository, or is prefixed to repositories without one
+	Registry string `yaml:"registry,omitempty"`
+
+	// Namespace is injected between the registry and the path of the repository
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// TagSuffix is appended to the tag of tagged references, references by digest are left as they are
+	TagSuffix string `yaml:"tagSuffix,omitempty"`
+}
+
+// Rewriter rewrites references with the first of its rules that matches them, leaving those none match as they are
+// 	Its Rewrite method is a toMapper for CopyAll, ie: to mirror everything under docker.io to a private registry with
+//
+// 		rules:
+// 		- match: docker.io/*
+// 		  replace: registry.internal/mirror/docker.io/*
+type Rewriter struct {
+	Rules []RewriteRule `yaml:"rules"`
+}
+
+// NewRewriter returns a Rewriter applying rules, once they are checked to be valid
+func NewRewriter(rules ...RewriteRule) (*Rewriter, error) {
+	for i, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return &Rewriter{Rules: rules}, nil
+}
+
+// ParseRewriter parses the rules of a Rewriter from yaml, rejecting unknown fields so typos aren't silently ignored
+func ParseRewriter(data []byte) (*Rewriter, error) {
+	var r Rewriter
+	if err := yaml.UnmarshalStrict(data, &r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRewriteRule, err)
+	}
+	return NewRewriter(r.Rules...)
+}
+
+// LoadRewriter reads the yaml rules of a Rewriter from path
+func LoadRewriter(path string) (*Rewriter, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRewriter(data)
+}
+
+// Rewrite returns ref rewritten by the first rule matching it, or ref itself if none do
+func (rw *Rewriter) Rewrite(ref string) (string, error) {
+	repo := repository(ref)
+	suffix := ref[len(repo):]
+
+	for _, r := range rw.Rules {
+		matched, ok := r.matches(repo)
+		if !ok {
+			continue
+		}
+		return r.apply(repo, matched) + r.tag(suffix), nil
+	}
+	return ref, nil
+}
+
+func (r RewriteRule) validate() error {
+	switch {
+	case r.Match == "":
+		return fmt.Errorf("%w: nothing to match", ErrInvalidRewriteRule)
+	case strings.Contains(strings.TrimSuffix(r.Match, "*"), "*"):
+		return fmt.Errorf("%w: match %s can only end in *", ErrInvalidRewriteRule, r.Match)
+	case strings.Count(r.Replace, "*") > 1:
+		return fmt.Errorf("%w: replace %s has more than one *", ErrInvalidRewriteRule, r.Replace)
+	case strings.Contains(r.Replace, "*") && !strings.HasSuffix(r.Match, "*"):
+		return fmt.Errorf("%w: replace %s has a * that match %s doesn't", ErrInvalidRewriteRule, r.Replace, r.Match)
+	case r.Replace == "" && r.Registry == "" && r.Namespace == "" && r.TagSuffix == "":
+		return fmt.Errorf("%w: %s is matched but not rewritten", ErrInvalidRewriteRule, r.Match)
+	}
+	return nil
+}
+
+// matches reports whether repo is matched, and what the "*" of Match matched
+func (r RewriteRule) matches(repo string) (string, bool) {
+	if !strings.HasSuffix(r.Match, "*") {
+		return "", repo == r.Match
+	}
+	prefix := strings.TrimSuffix(r.Match, "*")
+	if !strings.HasPrefix(repo, prefix) {
+		return "", false
+	}
+	return repo[len(prefix):], true
+}
+
+func (r RewriteRule) apply(repo string, matched string) string {
+	if r.Replace != "" {
+		repo = strings.Replace(r.Replace, "*", matched, 1)
+	}
+
+	host, path := splitRegistry(repo)
+	if r.Registry != "" {
+		host = r.Registry
+	}
+	if r.Namespace != "" {
+		path = strings.Trim(r.Namespace, "/") + "/" + path
+	}
+	if host == "" {
+		return path
+	}
+	return host + "/" + path
+}
+
+// tag appends TagSuffix to the tag of suffix, what of the reference follows its repository
+func (r RewriteRule) tag(suffix string) string {
+	if r.TagSuffix == "" || !strings.HasPrefix(suffix, ":") || strings.Contains(suffix, "@") {
+		return suffix
+	}
+	return suffix + r.TagSuffix
+}
+
+// splitRegistry splits the registry from the path of repo, the registry being empty for repositories without one
+// 	As with docker, the first component is only a registry if it's localhost or has a "." or ":" in it.
+func splitRegistry(repo string) (string, string) {
+	i := strings.Index(repo, "/")
+	if i == -1 {
+		return "", repo
+	}
+	if first := repo[:i]; first == "localhost" || strings.ContainsAny(first, ".:") {
+		return first, repo[i+1:]
+	}
+	return "", repo
+}
@@ -0,0 +1,95 @@
+package store_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestRewriter_Rewrite(t *testing.T) {
+	rw, err := store.ParseRewriter([]byte(`
+rules:
+- match: docker.io/*
+  replace: registry.internal/mirror/docker.io/*
+- match: quay.io/*
+  registry: registry.internal
+  namespace: quay
+- match: localhost:5000/hello/world
+  tagSuffix: -mirrored
+- match: library/*
+  registry: registry.internal
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ref  string
+		want string
+	}{
+		{
+			name: "should map a registry prefix",
+			ref:  "docker.io/library/nginx:1.21",
+			want: "registry.internal/mirror/docker.io/library/nginx:1.21",
+		},
+		{
+			name: "should inject a namespace beneath the new registry",
+			ref:  "quay.io/coreos/etcd:v3.5.0",
+			want: "registry.internal/quay/coreos/etcd:v3.5.0",
+		},
+		{
+			name: "should suffix tags",
+			ref:  "localhost:5000/hello/world:v1",
+			want: "localhost:5000/hello/world:v1-mirrored",
+		},
+		{
+			name: "should leave digests alone",
+			ref:  "localhost:5000/hello/world@sha256:" + strings.Repeat("a", 64),
+			want: "localhost:5000/hello/world@sha256:" + strings.Repeat("a", 64),
+		},
+		{
+			name: "should prefix a registry to references without one",
+			ref:  "library/busybox:latest",
+			want: "registry.internal/library/busybox:latest",
+		},
+		{
+			name: "should leave references no rule matches as they are",
+			ref:  "ghcr.io/hello/world:v1",
+			want: "ghcr.io/hello/world:v1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rw.Rewrite(tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Rewrite(%s) = %s, want %s", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRewriter_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{name: "unknown field", yaml: "rules:\n- match: docker.io/*\n  registy: example.com\n"},
+		{name: "no match", yaml: "rules:\n- registry: example.com\n"},
+		{name: "wildcard in the middle", yaml: "rules:\n- match: docker.io/*/nginx\n  registry: example.com\n"},
+		{name: "wildcard replaced without one matched", yaml: "rules:\n- match: docker.io/nginx\n  replace: example.com/*\n"},
+		{name: "nothing rewritten", yaml: "rules:\n- match: docker.io/*\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.ParseRewriter([]byte(tt.yaml)); !errors.Is(err, store.ErrInvalidRewriteRule) {
+				t.Errorf("ParseRewriter() error = %v, want %v", err, store.ErrInvalidRewriteRule)
+			}
+		})
+	}
+}
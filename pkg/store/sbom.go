@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// AddSBOM attaches the sbom artifact oci (ie: an sbom.SBOM) to the manifest stored as subjectRef
+// 	The sbom is stored with subjectRef's manifest as its subject, under the cosign style "<alg>-<hex>.sbom" tag of it
+// 	in the same repository, so it is found by both subject and tag aware tooling.  Once that tag holds another sbom,
+// 	sboms are stored under "<alg>-<hex>.<sbom>.sbom" instead, <sbom> being the start of the hex of their own digest, so
+// 	attaching several never replaces one with another.
+func (l *Layout) AddSBOM(ctx context.Context, oci artifacts.OCI, subjectRef string) (ocispec.Descriptor, error) {
+	subject, err := l.resolve(ctx, subjectRef)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	gd, err := fromOCIDescriptor(ocispec.Descriptor{
+		MediaType: subject.MediaType,
+		Digest:    subject.Digest,
+		Size:      subject.Size,
+	})
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	ref, err := l.sbomTag(ctx, subjectRef, subject.Digest, oci)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return l.AddOCI(ctx, &referrer{OCI: oci, subject: &gd}, ref)
+}
+
+// sbomTag is the reference the sbom oci is attached to the manifest d in subjectRef's repository under: the cosign tag
+// of d, unless that holds an sbom of other content
+func (l *Layout) sbomTag(ctx context.Context, subjectRef string, d digest.Digest, oci artifacts.OCI) (string, error) {
+	ref := sbomReference(subjectRef, d)
+	desc, err := l.resolve(ctx, ref)
+	if errors.Is(err, ErrRefNotFound) {
+		return ref, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var stored ocispec.Manifest
+	if err := l.fetchJSON(ctx, desc, &stored); err != nil {
+		return "", err
+	}
+	layers, err := oci.Layers()
+	if err != nil {
+		return "", err
+	}
+	same := len(layers) == len(stored.Layers)
+	for i := 0; same && i < len(layers); i++ {
+		h, err := layers[i].Digest()
+		if err != nil {
+			return "", err
+		}
+		same = h.String() == stored.Layers[i].Digest.String()
+	}
+	if same {
+		return ref, nil
+	}
+
+	raw, err := oci.RawManifest()
+	if err != nil {
+		return "", err
+	}
+	own := digest.FromBytes(raw)
+	return fmt.Sprintf("%s:%s-%s.%s.%s", repository(subjectRef), d.Algorithm(), d.Hex(), own.Hex()[:12], consts.CosignSBOMSuffix), nil
+}
+
+// SBOMs returns the references of every sbom attached to ref
+func (l *Layout) SBOMs(ctx context.Context, ref string) ([]string, error) {
+	desc, err := l.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	attached, err := l.attached(ctx, desc.Digest, map[digest.Digest]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	var sboms []string
+	for _, a := range attached {
+		adesc, err := l.resolve(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(a, "."+consts.CosignSBOMSuffix) || l.Identify(ctx, adesc) == consts.SBOMConfigMediaType {
+			sboms = append(sboms, a)
+		}
+	}
+	return sboms, nil
+}
+
+// sbomReference is the reference cosign attaches the sboms of the manifest d in ref's repository under
+func sbomReference(ref string, d digest.Digest) string {
+	return fmt.Sprintf("%s:%s-%s.%s", repository(ref), d.Algorithm(), d.Hex(), consts.CosignSBOMSuffix)
+}
+
+// referrer overrides the subject of an artifact
+type referrer struct {
+	artifacts.OCI
+	subject *gv1.Descriptor
+}
+
+func (r *referrer) Subject() *gv1.Descriptor {
+	return r.subject
+}
+
+// RawManifest marshals the manifest of the wrapped artifact along with the subject it refers to
+func (r *referrer) RawManifest() ([]byte, error) {
+	return artifacts.MarshalManifest(r)
+}
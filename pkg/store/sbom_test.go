@@ -0,0 +1,99 @@
+package store_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/sbom"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_AddSBOM(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	desc, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := sbom.NewSBOM([]byte(`{"spdxVersion": "SPDX-2.3", "name": "hello/world"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddSBOM(ctx, doc, ref); err != nil {
+		t.Fatal(err)
+	}
+
+	sboms, err := s.SBOMs(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbomRef := fmt.Sprintf("hello/world:%s-%s.sbom", desc.Digest.Algorithm(), desc.Digest.Hex())
+	if len(sboms) != 1 || sboms[0] != sbomRef {
+		t.Fatalf("SBOMs() = %v, want [%s]", sboms, sbomRef)
+	}
+
+	_, sdesc, err := s.Resolve(ctx, sbomRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := s.Fetch(ctx, sdesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var m struct {
+		Subject *ocispec.Descriptor `json:"subject"`
+	}
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject == nil || m.Subject.Digest != desc.Digest {
+		t.Errorf("sbom subject = %v, want %s", m.Subject, desc.Digest)
+	}
+
+	dst := tempLayout(t)
+	if _, err := s.Copy(ctx, ref, dst.OCI, "mirror/world:v1", store.WithAttachments()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		strings.TrimSuffix(strings.Replace(sbomRef, "hello/", "mirror/", 1), ".sbom"),
+		strings.Replace(sbomRef, "hello/", "mirror/", 1),
+		"mirror/world:v1",
+	}
+	got := refs(t, dst)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("copied references = %v, want %v", got, want)
+	}
+
+	// another sbom is attached beside the first rather than in its place, and attaching either again changes nothing
+	other, err := sbom.NewSBOM([]byte(`{"bomFormat": "CycloneDX", "specVersion": "1.4"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range []artifacts.OCI{other, doc, other} {
+		if _, err := s.AddSBOM(ctx, doc, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sboms, err = s.SBOMs(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sboms) != 2 || sboms[0] == sboms[1] {
+		t.Fatalf("SBOMs() = %v, want %s and one more", sboms, sbomRef)
+	}
+	for _, r := range sboms {
+		if r != sbomRef && !regexp.MustCompile(`^hello/world:sha256-[0-9a-f]{64}\.[0-9a-f]{12}\.sbom$`).MatchString(r) {
+			t.Errorf("SBOMs() = %v, want %s and a tag of the other sbom's own", sboms, sbomRef)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/scan"
+)
+
+// ScanError is returned when an image is refused entry to the store by its scan threshold
+type ScanError struct {
+	Reference       string
+	Digest          digest.Digest
+	Threshold       scan.Severity
+	Vulnerabilities []scan.Vulnerability
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("%s (%s) refused by scan policy: %d vulnerabilities at or above %s", e.Reference, e.Digest, len(e.Vulnerabilities), e.Threshold)
+}
+
+// WithScanner scans every image added to the Layout with s, storing its report under the "<alg>-<hex>.scan" tag of the
+// stored manifest
+// 	Images of an index are scanned one by one, each with a report of its own.  Artifacts are scanned when their config
+// 	is an image config, anything else isn't scanned.
+func WithScanner(s scan.Scanner) Options {
+	return func(l *Layout) {
+		l.scanner = s
+	}
+}
+
+// WithScanThreshold refuses images with vulnerabilities at least as severe as threshold entry to the store with a
+// *ScanError, instead of only reporting them
+func WithScanThreshold(threshold scan.Severity) Options {
+	return func(l *Layout) {
+		l.scanThreshold = &threshold
+	}
+}
+
+// scan scans img with the Layouts scanner, if it has one, enforcing its threshold
+func (l *Layout) scan(ctx context.Context, img gv1.Image, ref string) (*scan.Report, error) {
+	if l.scanner == nil {
+		return nil, nil
+	}
+
+	r, err := l.scanner.Scan(ctx, img)
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", ref, err)
+	}
+
+	if l.scanThreshold != nil {
+		if found := r.AtLeast(*l.scanThreshold); len(found) > 0 {
+			h, err := img.Digest()
+			if err != nil {
+				return nil, err
+			}
+			return nil, &ScanError{
+				Reference:       ref,
+				Digest:          digest.NewDigestFromHex(h.Algorithm, h.Hex),
+				Threshold:       *l.scanThreshold,
+				Vulnerabilities: found,
+			}
+		}
+	}
+	return r, nil
+}
+
+// scanOCI scans oci if it's an image, as image artifacts are
+func (l *Layout) scanOCI(ctx context.Context, oci artifacts.OCI, ref string) (*scan.Report, error) {
+	if l.scanner == nil {
+		return nil, nil
+	}
+
+	m, err := oci.Manifest()
+	if errors.Is(err, artifacts.ErrNotComputed) {
+		// artifacts with streamed layers can't be known until they've been written, and aren't images anyhow
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch string(m.Config.MediaType) {
+	case ocispec.MediaTypeImageConfig, consts.DockerConfigJSON:
+	default:
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	img, err := partial.CompressedToImage(&ociImage{OCI: oci, raw: raw, manifest: m})
+	if err != nil {
+		return nil, err
+	}
+	return l.scan(ctx, img, ref)
+}
+
+// ociImage is an image artifact as a v1.Image
+type ociImage struct {
+	artifacts.OCI
+	raw      []byte
+	manifest *gv1.Manifest
+}
+
+func (i *ociImage) MediaType() (types.MediaType, error) {
+	return i.manifest.MediaType, nil
+}
+
+func (i *ociImage) RawConfigFile() ([]byte, error) {
+	return i.OCI.RawConfig()
+}
+
+func (i *ociImage) RawManifest() ([]byte, error) {
+	return i.raw, nil
+}
+
+func (i *ociImage) LayerByDigest(h gv1.Hash) (partial.CompressedLayer, error) {
+	layers, err := i.OCI.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for _, lyr := range layers {
+		d, err := lyr.Digest()
+		if err != nil {
+			return nil, err
+		}
+		if d == h {
+			return lyr, nil
+		}
+	}
+	return nil, fmt.Errorf("layer %s: %w", h, ErrBlobNotFound)
+}
+
+// scanIndex scans every image of idx, returning their reports in the order of the index, and nil for anything that
+// isn't an image
+func (l *Layout) scanIndex(ctx context.Context, idx gv1.ImageIndex, ref string) ([]*scan.Report, error) {
+	if l.scanner == nil {
+		return nil, nil
+	}
+
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]*scan.Report, len(im.Manifests))
+	for i, child := range im.Manifests {
+		if !child.MediaType.IsImage() {
+			continue
+		}
+		img, err := idx.Image(child.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if reports[i], err = l.scan(ctx, img, ref); err != nil {
+			return nil, err
+		}
+	}
+	return reports, nil
+}
+
+// scanConfig is the config of stored scan reports, summarizing them
+type scanConfig struct {
+	Scanner         string         `json:"scanner"`
+	Vulnerabilities map[string]int `json:"vulnerabilities"`
+}
+
+// addScanReport stores r attached to the manifest desc, added to the store as ref
+func (l *Layout) addScanReport(ctx context.Context, r *scan.Report, ref string, desc ocispec.Descriptor) error {
+	if r == nil {
+		return nil
+	}
+
+	cfg := scanConfig{Scanner: r.Scanner, Vulnerabilities: make(map[string]int)}
+	for _, v := range r.Vulnerabilities {
+		cfg.Vulnerabilities[v.Severity.String()]++
+	}
+
+	gd, err := fromOCIDescriptor(ocispec.Descriptor{MediaType: desc.MediaType, Digest: desc.Digest, Size: desc.Size})
+	if err != nil {
+		return err
+	}
+
+	report := memory.NewMemory(r.Data, r.MediaType, memory.WithConfig(cfg, consts.ScanReportConfigMediaType))
+	_, err = l.addOCI(ctx, &referrer{OCI: report, subject: &gd}, scanReference(ref, desc.Digest))
+	return err
+}
+
+// addIndexScanReports stores reports, in the order of the index desc added to the store as ref, attached to its
+// manifests
+func (l *Layout) addIndexScanReports(ctx context.Context, reports []*scan.Report, ref string, desc ocispec.Descriptor) error {
+	if len(reports) == 0 {
+		return nil
+	}
+
+	// the stored index is read back, its manifests digests differ from those scanned when they were encrypted
+	var idx ocispec.Index
+	if err := l.fetchJSON(ctx, desc, &idx); err != nil {
+		return err
+	}
+	for i, r := range reports {
+		if i >= len(idx.Manifests) {
+			break
+		}
+		if err := l.addScanReport(ctx, r, ref, idx.Manifests[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanReference is the reference the scan reports of the manifest d in ref's repository are attached under
+func scanReference(ref string, d digest.Digest) string {
+	return fmt.Sprintf("%s:%s-%s.%s", repository(ref), d.Algorithm(), d.Hex(), consts.ScanSuffix)
+}
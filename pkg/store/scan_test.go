@@ -0,0 +1,119 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/scan"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_WithScanner(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	report := &scan.Report{
+		Scanner:   "fake",
+		MediaType: "application/vnd.example.report+json",
+		Data:      []byte(`{"findings": 2}`),
+		Vulnerabilities: []scan.Vulnerability{
+			{ID: "CVE-1", Package: "openssl", Severity: scan.SeverityMedium},
+			{ID: "CVE-2", Package: "zlib", Severity: scan.SeverityHigh},
+		},
+	}
+
+	t.Run("report", func(t *testing.T) {
+		scanner := &fakeScanner{report: report}
+		s := tempLayout(t, store.WithScanner(scanner))
+
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		desc, err := s.AddImage(ctx, img, "image:v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reportRef := fmt.Sprintf("image:%s-%s.scan", desc.Digest.Algorithm(), desc.Digest.Hex())
+		_, rdesc, err := s.Resolve(ctx, reportRef)
+		if err != nil {
+			t.Fatalf("Resolve() of the scan report: %v", err)
+		}
+		if got := s.Identify(ctx, rdesc); got != consts.ScanReportConfigMediaType {
+			t.Errorf("Identify() of the scan report = %s, want %s", got, consts.ScanReportConfigMediaType)
+		}
+
+		// every image of an index gets a report of its own, artifacts that aren't images none
+		if _, err := s.AddImageIndex(ctx, genIndex(t, "linux/amd64", "linux/arm64"), "index:v1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("data"), "random"), "hello/world:v1"); err != nil {
+			t.Fatal(err)
+		}
+		if scanner.scans != 3 {
+			t.Errorf("scanned %d images, want 3", scanner.scans)
+		}
+		reports := 0
+		for _, ref := range refs(t, s) {
+			if strings.HasSuffix(ref, ".scan") {
+				reports++
+			}
+		}
+		if reports != 3 {
+			t.Errorf("stored %d scan reports, want 3", reports)
+		}
+	})
+
+	t.Run("threshold", func(t *testing.T) {
+		for sev, wantErr := range map[scan.Severity]bool{
+			scan.SeverityMedium:   true,
+			scan.SeverityCritical: false,
+		} {
+			s := tempLayout(t, store.WithScanner(&fakeScanner{report: report}), store.WithScanThreshold(sev))
+
+			img, err := random.Image(1024, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = s.AddImage(ctx, img, "image:v1")
+			var serr *store.ScanError
+			if errors.As(err, &serr) != wantErr {
+				t.Fatalf("AddImage() at threshold %s error = %v, wantErr %v", sev, err, wantErr)
+			}
+			if !wantErr {
+				continue
+			}
+			if len(serr.Vulnerabilities) != 2 {
+				t.Errorf("ScanError vulnerabilities = %+v, want 2", serr.Vulnerabilities)
+			}
+			if got := refs(t, s); len(got) != 0 {
+				t.Errorf("refused image was stored: %v", got)
+			}
+		}
+	})
+}
+
+// fakeScanner reports report for every image it scans, counting them
+type fakeScanner struct {
+	report *scan.Report
+
+	mu    sync.Mutex
+	scans int
+}
+
+func (s *fakeScanner) Scan(ctx context.Context, img v1.Image) (*scan.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scans++
+	return s.report, nil
+}
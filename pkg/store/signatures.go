@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/target"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// WithSignatures carries cosign signatures along with everything added to, or copied out of, the Layout
+// 	Added artifacts that can fetch their own signatures (artifacts.Signed) have them stored under the cosign
+// 	"<alg>-<hex>.sig" tag of the stored manifest.  Copies bring every artifact attached to the copied reference along,
+// 	tagged the same in the destination repository.
+func WithSignatures() Options {
+	return func(l *Layout) {
+		l.signatures = true
+	}
+}
+
+// addSignatures stores the signatures of oci, added to the store as ref and desc, if it has any
+func (l *Layout) addSignatures(ctx context.Context, oci artifacts.OCI, ref string, desc ocispec.Descriptor) error {
+	signed, ok := oci.(artifacts.Signed)
+	if !l.signatures || !ok {
+		return nil
+	}
+
+	sig, err := signed.Signatures()
+	if err != nil {
+		return fmt.Errorf("fetch signatures of %s: %w", ref, err)
+	}
+	if sig == nil {
+		return nil
+	}
+
+	_, err = l.addOCI(ctx, sig, signatureReference(ref, desc.Digest))
+	return err
+}
+
+// copyAttached copies everything attached to desc alongside it, into the repository of toRef
+func (l *Layout) copyAttached(ctx context.Context, desc ocispec.Descriptor, to target.Target, toRef string, o *copyOptions) error {
+	if !l.signatures && !o.attachments {
+		return nil
+	}
+
+	m := o.attached
+	if m == nil {
+		var err error
+		if m, err = l.attachments(ctx); err != nil {
+			return err
+		}
+	}
+
+	refs := m.attached(desc.Digest, map[digest.Digest]bool{})
+
+	for _, ref := range refs {
+		dst := ""
+		if toRef != "" {
+			dst = repository(toRef) + strings.TrimPrefix(ref, repository(ref))
+		}
+		if _, err := l.copy(ctx, ref, to, dst, o); err != nil {
+			return fmt.Errorf("copy %s attached to %s: %w", ref, desc.Digest, err)
+		}
+	}
+	return nil
+}
+
+// signatureReference is the reference cosign stores the signatures of the manifest d in ref's repository under
+func signatureReference(ref string, d digest.Digest) string {
+	return fmt.Sprintf("%s:%s-%s.%s", repository(ref), d.Algorithm(), d.Hex(), consts.CosignSignatureSuffix)
+}
+
+// repository strips the tag or digest from ref
+func repository(ref string) string {
+	if i := strings.Index(ref, "@"); i != -1 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i != -1 && !strings.Contains(ref[i:], "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
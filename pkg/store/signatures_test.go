@@ -0,0 +1,39 @@
+package store_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_WithSignatures(t *testing.T) {
+	s := newLayout(t, store.WithSignatures())
+
+	ref := "hello/world:v1"
+	oci := &signedArtifact{OCI: genArtifact(t, ref), sig: genArtifact(t, "sig")}
+	desc, err := s.AddOCI(ctx, oci, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sigRef := fmt.Sprintf("hello/world:%s-%s.sig", desc.Digest.Algorithm(), desc.Digest.Hex())
+	if _, _, err := s.Resolve(ctx, sigRef); err != nil {
+		t.Fatal(err)
+	}
+	if refs := refs(t, s); len(refs) != 2 {
+		t.Fatalf("store references = %v, want the image and its signature", refs)
+	}
+
+	dst := tempLayout(t)
+	if _, err := s.Copy(ctx, ref, dst.OCI, "mirror/world:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{strings.Replace(sigRef, "hello/", "mirror/", 1), "mirror/world:v1"}
+	got := refs(t, dst)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("copied references = %v, want %v", got, want)
+	}
+}
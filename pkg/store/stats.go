@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Stats summarizes what is consuming space in a store
+type Stats struct {
+	// Size and Blobs count everything on disk, reachable or not
+	Size  int64
+	Blobs int
+
+	References int
+
+	// Footprints are the footprint of each reference, sorted by reference
+	Footprints []Footprint
+}
+
+// Footprint is the space a single reference takes up
+type Footprint struct {
+	Reference  string
+	Descriptor ocispec.Descriptor
+
+	// Size is the total size of every blob reachable from the reference, across Blobs blobs
+	Size  int64
+	Blobs int
+
+	// UniqueBytes are only reachable from this reference, and so what removing it would reclaim, SharedBytes are also
+	// reachable from other references
+	UniqueBytes int64
+	SharedBytes int64
+}
+
+// Stats returns the size of the store and the footprint of every reference in it
+func (l *Layout) Stats(ctx context.Context) (*Stats, error) {
+	names, err := l.blobNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{Blobs: len(names)}
+	for _, name := range names {
+		info, err := l.OCI.Driver().Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		stats.Size += info.Size()
+	}
+
+	blobs := make(map[string]map[digest.Digest]ocispec.Descriptor)
+	refcounts := make(map[digest.Digest]int)
+	err = l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		seen := make(map[digest.Digest]ocispec.Descriptor)
+		if err := l.descendants(ctx, desc, seen); err != nil {
+			return err
+		}
+		blobs[reference] = seen
+		stats.Footprints = append(stats.Footprints, Footprint{Reference: reference, Descriptor: desc})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, seen := range blobs {
+		for d := range seen {
+			refcounts[d]++
+		}
+	}
+
+	for i := range stats.Footprints {
+		f := &stats.Footprints[i]
+		for d, desc := range blobs[f.Reference] {
+			f.Size += desc.Size
+			f.Blobs++
+			if refcounts[d] == 1 {
+				f.UniqueBytes += desc.Size
+			} else {
+				f.SharedBytes += desc.Size
+			}
+		}
+	}
+
+	sort.Slice(stats.Footprints, func(i, j int) bool {
+		return stats.Footprints[i].Reference < stats.Footprints[j].Reference
+	})
+	stats.References = len(stats.Footprints)
+	return stats, nil
+}
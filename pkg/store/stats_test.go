@@ -0,0 +1,55 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+)
+
+func TestLayout_Stats(t *testing.T) {
+	s := newLayout(t)
+
+	base := genArtifact(t, "base:v1")
+	for _, ref := range []string{"base:v1", "base:latest"} {
+		if _, err := s.AddOCI(ctx, base, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("unique"), "random"), "unique:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.References != 3 || len(stats.Footprints) != 3 {
+		t.Fatalf("Stats() = %d references, %d footprints, want 3", stats.References, len(stats.Footprints))
+	}
+	// manifest, config and 3 layers of base, manifest, config and layer of unique
+	if stats.Blobs != 8 || stats.Size == 0 {
+		t.Errorf("Stats() = %d blobs of %d bytes, want 8", stats.Blobs, stats.Size)
+	}
+
+	want := []string{"base:latest", "base:v1", "unique:v1"}
+	var total int64
+	for i, f := range stats.Footprints {
+		if f.Reference != want[i] {
+			t.Errorf("Footprints[%d] = %s, want %s", i, f.Reference, want[i])
+		}
+		if f.UniqueBytes+f.SharedBytes != f.Size {
+			t.Errorf("%s: unique %d + shared %d != size %d", f.Reference, f.UniqueBytes, f.SharedBytes, f.Size)
+		}
+		total += f.UniqueBytes
+	}
+
+	if f := stats.Footprints[0]; f.Blobs != 5 || f.UniqueBytes != 0 {
+		t.Errorf("%s = %d blobs, %d unique bytes, want 5 and entirely shared", f.Reference, f.Blobs, f.UniqueBytes)
+	}
+	if f := stats.Footprints[2]; f.Blobs != 3 || f.SharedBytes != 0 {
+		t.Errorf("%s = %d blobs, %d shared bytes, want 3 and entirely unique", f.Reference, f.Blobs, f.SharedBytes)
+	}
+	if shared := stats.Footprints[0].SharedBytes; total+shared != stats.Size {
+		t.Errorf("unique %d + shared %d != store size %d", total, shared, stats.Size)
+	}
+}
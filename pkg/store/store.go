@@ -2,29 +2,85 @@ package store
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
-	"path/filepath"
-
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/errdefs"
+	encconfig "github.com/containers/ocicrypt/config"
+	"github.com/go-logr/logr"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/static"
 	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
-	"oras.land/oras-go/pkg/oras"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
 	"oras.land/oras-go/pkg/target"
 
 	"github.com/rancherfederal/ocil/pkg/artifacts"
 	"github.com/rancherfederal/ocil/pkg/consts"
 	"github.com/rancherfederal/ocil/pkg/content"
+	"github.com/rancherfederal/ocil/pkg/cosign"
 	"github.com/rancherfederal/ocil/pkg/layer"
+	"github.com/rancherfederal/ocil/pkg/scan"
 )
 
 type Layout struct {
 	*content.OCI
 	Root  string
 	cache layer.Cache
+
+	writes     *semaphore.Weighted
+	conns      *semaphore.Weighted
+	bandwidth  *rate.Limiter
+	middleware []Middleware
+
+	descriptorHooks []DescriptorHook
+	annotations     map[string]string
+	provenance      bool
+	readOnly        bool
+	driver          content.Driver
+	localOpts       []content.LocalOption
+	enforceModes    bool
+	repair          *copyOptions
+	secondaryDigest digest.Algorithm
+	digestAlgorithm digest.Algorithm
+
+	progress   func(ProgressEvent)
+	progressMu sync.Mutex
+
+	referrersMu sync.Mutex
+
+	// adds hold gcMu for reading while they write blobs they've yet to index, GC and pruning hold it for writing
+	gcMu  sync.RWMutex
+	txs   map[*Tx]bool
+	txsMu sync.Mutex
+
+	subscribers   []*subscriber
+	subscribersMu sync.Mutex
+
+	signatures bool
+	verifier   cosign.Verifier
+
+	encryption *encconfig.EncryptConfig
+
+	scanner       scan.Scanner
+	scanThreshold *scan.Severity
+
+	log     logr.Logger
+	metrics Metrics
+	tracer  trace.Tracer
 }
 
 type Options func(*Layout)
@@ -35,8 +91,40 @@ func WithCache(c layer.Cache) Options {
 	}
 }
 
+// WithDriver stores the layout with d (ie: content.NewMemoryDriver) rather than on the local filesystem, rootdir then
+// only naming it
+// 	Dedupe needs both stores on the local filesystem, everything else works with any Driver.
+func WithDriver(d content.Driver) Options {
+	return func(l *Layout) {
+		l.driver = d
+	}
+}
+
 func NewLayout(rootdir string, opts ...Options) (*Layout, error) {
-	ociStore, err := content.NewOCI(rootdir)
+	l := &Layout{
+		Root:            rootdir,
+		log:             logr.Discard(),
+		digestAlgorithm: digest.Canonical,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+	if !l.digestAlgorithm.Available() {
+		return nil, fmt.Errorf("digest algorithm %s is unavailable", l.digestAlgorithm)
+	}
+
+	contentOpts := []content.Option{content.WithLogger(l.log)}
+	if l.readOnly {
+		contentOpts = append(contentOpts, content.WithReadOnly())
+	}
+	if l.driver == nil && len(l.localOpts) > 0 {
+		l.driver = content.NewLocalDriver(rootdir, l.localOpts...)
+	}
+	if l.driver != nil {
+		contentOpts = append(contentOpts, content.WithDriver(l.driver))
+	}
+	ociStore, err := content.NewOCI(rootdir, contentOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -44,16 +132,21 @@ func NewLayout(rootdir string, opts ...Options) (*Layout, error) {
 	if err := ociStore.LoadIndex(); err != nil {
 		return nil, err
 	}
-
-	l := &Layout{
-		Root: rootdir,
-		OCI:  ociStore,
+	if l.enforceModes {
+		if err := l.writable("enforce modes"); err != nil {
+			return nil, err
+		}
+		if err := content.EnforceModes(ociStore.Driver()); err != nil {
+			return nil, err
+		}
 	}
 
-	for _, opt := range opts {
-		opt(l)
+	// new stores are always written in the current format
+	if _, err := ociStore.Driver().Stat(consts.OCIImageIndexFile); os.IsNotExist(err) {
+		ociStore.SetIndexAnnotation(consts.StoreVersionAnnotation, strconv.Itoa(StoreVersion))
 	}
 
+	l.OCI = ociStore
 	return l, nil
 }
 
@@ -63,22 +156,70 @@ func NewLayout(rootdir string, opts ...Options) (*Layout, error) {
 //  strict types to define generic content, but provides a processing pipeline suitable for extensibility.  In the
 //  future we'll allow users to define their own content that must adhere either by artifact.OCI or simply an OCI layout.
 func (l *Layout) AddOCI(ctx context.Context, oci artifacts.OCI, ref string) (ocispec.Descriptor, error) {
+	req := &Request{Operation: OperationAdd, Reference: ref, admits: admits(oci, func() (digest.Digest, error) {
+		return artifactDigest(oci)
+	})}
+	err := l.intercept(ctx, req, func(ctx context.Context, req *Request) error {
+		report, err := l.scanOCI(ctx, oci, req.Reference)
+		if err != nil {
+			return err
+		}
+
+		desc, err := l.addOCI(ctx, oci, req.Reference)
+		req.Descriptor = desc
+		if err != nil {
+			return err
+		}
+		if err := l.addScanReport(ctx, report, req.Reference, desc); err != nil {
+			return err
+		}
+		if err := l.addOriginal(ctx, oci, req.Reference, desc); err != nil {
+			return err
+		}
+		return l.addSignatures(ctx, oci, req.Reference, desc)
+	})
+	return req.Descriptor, err
+}
+
+func (l *Layout) addOCI(ctx context.Context, oci artifacts.OCI, ref string) (ocispec.Descriptor, error) {
+	// the cache only wraps artifacts.OCI, so find the subject, artifactType (and the source) first
+	source := oci
+	var subject *v1.Descriptor
+	if r, ok := oci.(artifacts.Referrer); ok {
+		subject = r.Subject()
+	}
+	var artifactType string
+	if t, ok := oci.(artifacts.Typed); ok {
+		artifactType = t.ArtifactType()
+	}
+
 	if l.cache != nil {
-		cached := layer.OCICache(oci, l.cache)
+		cached := layer.OCICache(oci, &loggedCache{Cache: l.cache, log: l.log})
 		oci = cached
 	}
 
-	// Write manifest blob
-	m, err := oci.Manifest()
-	if err != nil {
-		return ocispec.Descriptor{}, err
+	if l.encryption != nil {
+		encrypted, err := encryptOCI(l.encryption, oci)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		oci = encrypted
 	}
 
-	mdata, err := json.Marshal(m)
+	// write blob layers concurrently, first so the manifest of artifacts with streamed layers can be known
+	layers, err := oci.Layers()
 	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
-	if err := l.writeBlobData(mdata); err != nil {
+
+	var g errgroup.Group
+	for _, lyr := range layers {
+		lyr := lyr
+		g.Go(func() error {
+			return l.writeLayer(ctx, lyr)
+		})
+	}
+	if err := g.Wait(); err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
@@ -90,40 +231,57 @@ func (l *Layout) AddOCI(ctx context.Context, oci artifacts.OCI, ref string) (oci
 
 	static.NewLayer(cdata, "")
 
-	if err := l.writeBlobData(cdata); err != nil {
+	if err := l.writeBlobData(ctx, cdata); err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
-	// write blob layers concurrently
-	layers, err := oci.Layers()
+	// Write manifest blob
+	m, err := oci.Manifest()
 	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
-	var g errgroup.Group
-	for _, lyr := range layers {
-		lyr := lyr
-		g.Go(func() error {
-			return l.writeLayer(lyr)
-		})
+	m, err = l.hookManifest(m)
+	if err != nil {
+		return ocispec.Descriptor{}, err
 	}
-	if err := g.Wait(); err != nil {
+
+	mdata, err := marshalManifest(m, artifactType, subject)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if mdata, err = preserveManifest(oci, mdata, artifactType, subject); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	md, err := l.writeManifestData(ctx, mdata)
+	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
 	// Build index
 	idx := ocispec.Descriptor{
-		MediaType: string(m.MediaType),
-		Digest:    digest.FromBytes(mdata),
-		Size:      int64(len(mdata)),
-		Annotations: map[string]string{
-			ocispec.AnnotationRefName: ref,
-		},
-		URLs:     nil,
-		Platform: nil,
+		MediaType:   string(m.MediaType),
+		Digest:      md,
+		Size:        int64(len(mdata)),
+		Annotations: l.indexAnnotations(source, m.Annotations, ref),
+		URLs:        nil,
+		Platform:    nil,
+	}
+
+	if err := l.runDescriptorHooks(&idx); err != nil {
+		return ocispec.Descriptor{}, err
 	}
 
-	return idx, l.OCI.AddIndex(idx)
+	if err := l.addIndex(ctx, idx); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	if subject != nil {
+		if err := l.addReferrer(ctx, ref, digest.Digest(subject.Digest.String()), idx); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+	return idx, nil
 }
 
 // AddOCICollection .
@@ -148,59 +306,221 @@ func (l *Layout) AddOCICollection(ctx context.Context, collection artifacts.OCIC
 // 	This can be a highly destructive operation if the store's directory happens to be inline with other non-store contents
 // 	To reduce the blast radius and likelihood of deleting things we don't own, Flush explicitly deletes oci-layout content only
 func (l *Layout) Flush(ctx context.Context) error {
-	blobs := filepath.Join(l.Root, "blobs")
-	if err := os.RemoveAll(blobs); err != nil {
-		return err
-	}
-
-	index := filepath.Join(l.Root, "index.json")
-	if err := os.RemoveAll(index); err != nil {
+	if err := l.writable("flush"); err != nil {
 		return err
 	}
-
-	layout := filepath.Join(l.Root, "oci-layout")
-	if err := os.RemoveAll(layout); err != nil {
-		return err
+	for _, name := range []string{"blobs", consts.OCIImageIndexFile, ocispec.ImageLayoutFile, digestsDir, content.IngestDir} {
+		if err := l.OCI.Driver().RemoveAll(name); err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
 
 // Copy will copy a given reference to a given target.Target
-// 		This is essentially a wrapper around oras.Copy, but locked to this content store
-func (l *Layout) Copy(ctx context.Context, ref string, to target.Target, toRef string) (ocispec.Descriptor, error) {
-	return oras.Copy(ctx, l.OCI, ref, to, toRef,
-		oras.WithAdditionalCachedMediaTypes(consts.DockerManifestSchema2))
-}
-
-// CopyAll performs bulk copy operations on the stores oci layout to a provided target.Target
-func (l *Layout) CopyAll(ctx context.Context, to target.Target, toMapper func(string) (string, error)) ([]ocispec.Descriptor, error) {
-	var descs []ocispec.Descriptor
-	err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
-		toRef := ""
-		if toMapper != nil {
-			tr, err := toMapper(reference)
+// 		This is essentially a wrapper around oras.Copy of oras-go v2, but locked to this content store.  A nil
+// 		target.Target copies to the registry toRef names, through the resolver given with WithResolver or one
+// 		authenticated with the other auth options (WithDockerConfig, WithKeychain, WithBasicAuth or WithBearerToken)
+// 		and WithTransport.
+func (l *Layout) Copy(ctx context.Context, ref string, to target.Target, toRef string, opts ...CopyOption) (ocispec.Descriptor, error) {
+	req := &Request{Operation: OperationCopy, Reference: ref}
+	err := l.intercept(ctx, req, func(ctx context.Context, req *Request) error {
+		o := makeCopyOptions(opts...)
+
+		dst := toRef
+		if o.pin {
+			pinned, err := l.pinned(ctx, req.Reference, toRef, o)
 			if err != nil {
 				return err
 			}
-			toRef = tr
+			dst = pinned
 		}
 
-		desc, err := l.Copy(ctx, reference, to, toRef)
+		desc, err := l.copy(ctx, req.Reference, to, dst, o)
+		req.Descriptor = desc
 		if err != nil {
 			return err
 		}
+		if err := l.copyAttached(ctx, desc, to, dst, o); err != nil {
+			return err
+		}
+		l.emit(Event{Type: EventCopied, Reference: req.Reference, To: dst, Descriptor: desc})
+		return nil
+	})
+	return req.Descriptor, err
+}
 
-		descs = append(descs, desc)
+func (l *Layout) copy(ctx context.Context, ref string, to target.Target, toRef string, o *copyOptions) (ocispec.Descriptor, error) {
+	from, err := l.source(ctx, ref, o)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	log := l.log.WithValues("reference", ref, "to", toRef)
+	if to == nil {
+		to, err = o.remote(log)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+	if _, layout := to.(*content.OCI); strings.Contains(toRef, "@") && !layout {
+		to = &digestTarget{Target: to}
+	}
+	to = l.connectedTarget(to)
+
+	log.V(1).Info("copying")
+
+	var desc ocispec.Descriptor
+	err = retry(ctx, log, o, func() error {
+		var err error
+		desc, err = orasCopy(ctx, l.countedSource(l.progressSource(ctx, l.throttledSource(from, o))), ref, to, toRef)
+		return err
+	})
+	if err != nil {
+		return desc, err
+	}
+	log.V(1).Info("copied", "digest", desc.Digest)
+	return desc, nil
+}
+
+// CopyAll performs bulk copy operations on the stores oci layout to a provided target.Target
+// 	References are copied concurrently when WithConcurrency is given, and the returned descriptors are in the order the
+// 	references were walked regardless.  The first failed copy cancels any still in flight.  As with Copy, a nil
+// 	target.Target copies to the registries toMapper maps each reference onto.  With WithCheckpoint, references
+// 	copied by a previous, interrupted CopyAll are skipped.  References attached to another one copied (with
+// 	WithAttachments or WithSignatures) are only copied along with it, their descriptor returned as it's indexed.
+func (l *Layout) CopyAll(ctx context.Context, to target.Target, toMapper func(string) (string, error), opts ...CopyOption) ([]ocispec.Descriptor, error) {
+	ctx, span := l.startSpan(ctx, "store.copyAll")
+	defer span.End()
+
+	descs, err := l.copyAll(ctx, to, toMapper, opts...)
+	span.SetAttributes(attribute.Int("ocil.copied", len(descs)))
+	return descs, endSpan(span, err)
+}
+
+func (l *Layout) copyAll(ctx context.Context, to target.Target, toMapper func(string) (string, error), opts ...CopyOption) ([]ocispec.Descriptor, error) {
+	o := makeCopyOptions(opts...)
+	f := makeFilter(o.filters...)
+
+	var refs []string
+	var sources []ocispec.Descriptor
+	err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if ok, err := f.matches(ctx, l, reference, desc); err != nil || !ok {
+			return err
+		}
+		refs = append(refs, reference)
+		sources = append(sources, desc)
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+
+	// what's attached to the references is mapped once, rather than for each of them, and copied along with them only
+	attachedRefs := make(map[string]bool)
+	if l.signatures || o.attachments {
+		m, err := l.attachments(ctx)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[digest.Digest]bool)
+		for _, src := range sources {
+			for _, ref := range m.attached(src.Digest, seen) {
+				attachedRefs[ref] = true
+			}
+		}
+		opts = append(opts[:len(opts):len(opts)], withAttachmentMap(m))
+	}
+
+	var journal *checkpoint
+	if o.checkpoint != "" {
+		if journal, err = openCheckpoint(o.checkpoint); err != nil {
+			return nil, err
+		}
+		defer journal.close()
+	}
+
+	var workers *semaphore.Weighted
+	if o.concurrency > 0 {
+		workers = semaphore.NewWeighted(o.concurrency)
+	}
+
+	descs := make([]ocispec.Descriptor, len(refs))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, reference := range refs {
+		i, reference := i, reference
+		if attachedRefs[reference] {
+			descs[i] = sources[i]
+			continue
+		}
+
+		release, err := acquire(gctx, workers)
+		if err != nil {
+			break
+		}
+		g.Go(func() error {
+			defer release()
+
+			toRef := ""
+			if toMapper != nil {
+				tr, err := toMapper(reference)
+				if err != nil {
+					return err
+				}
+				toRef = tr
+			}
+
+			if journal != nil {
+				if desc, ok := journal.lookup(reference, toRef, sources[i].Digest); ok {
+					descs[i] = desc
+					return nil
+				}
+			}
+
+			desc, err := l.Copy(gctx, reference, to, toRef, opts...)
+			if err != nil {
+				return err
+			}
+
+			descs[i] = desc
+			if journal != nil {
+				return journal.record(checkpointEntry{Reference: reference, To: toRef, Source: sources[i].Digest, Descriptor: desc})
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if journal != nil {
+		if err := journal.remove(); err != nil {
+			return nil, err
+		}
+	}
 	return descs, nil
 }
 
+// WalkByMediaType walks the stores oci layout, only visiting references whose manifest or config media type is one of mediaTypes
+// 	The manifest media type is known from the index, so the manifest is only fetched when a config media type lookup is required
+func (l *Layout) WalkByMediaType(ctx context.Context, mediaTypes []string, fn func(reference string, desc ocispec.Descriptor) error) error {
+	want := make(map[string]bool, len(mediaTypes))
+	for _, mt := range mediaTypes {
+		want[mt] = true
+	}
+
+	return l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if want[desc.MediaType] || want[l.Identify(ctx, desc)] {
+			return fn(reference, desc)
+		}
+		return nil
+	})
+}
+
 // Identify is a helper function that will identify a human-readable content type given a descriptor
+// 	That's the media type of its config, or the artifactType of artifacts whose config is the empty descriptor.
 func (l *Layout) Identify(ctx context.Context, desc ocispec.Descriptor) string {
 	rc, err := l.OCI.Fetch(ctx, desc)
 	if err != nil {
@@ -209,7 +529,8 @@ func (l *Layout) Identify(ctx context.Context, desc ocispec.Descriptor) string {
 	defer rc.Close()
 
 	m := struct {
-		Config struct {
+		ArtifactType string `json:"artifactType,omitempty"`
+		Config       struct {
 			MediaType string `json:"mediaType"`
 		} `json:"config"`
 	}{}
@@ -217,42 +538,144 @@ func (l *Layout) Identify(ctx context.Context, desc ocispec.Descriptor) string {
 		return ""
 	}
 
+	if m.Config.MediaType == consts.OCIEmptyMediaType && m.ArtifactType != "" {
+		return m.ArtifactType
+	}
 	return m.Config.MediaType
 }
 
-func (l *Layout) writeBlobData(data []byte) error {
-	blob := static.NewLayer(data, "") // NOTE: MediaType isn't actually used in the writing
-	return l.writeLayer(blob)
+func (l *Layout) writeBlobData(ctx context.Context, data []byte) error {
+	desc := ocispec.Descriptor{Digest: digest.FromBytes(data), Size: int64(len(data))}
+	return l.writeBlob(ctx, desc, static.NewLayer(data, "").Compressed) // NOTE: MediaType isn't actually used in the writing
+}
+
+// writeManifestData writes a manifest (or index) the store built itself, addressed by the digest algorithm of the
+// Layout rather than the sha256 everything it references is addressed by
+func (l *Layout) writeManifestData(ctx context.Context, data []byte) (digest.Digest, error) {
+	d := l.digestAlgorithm.FromBytes(data)
+	desc := ocispec.Descriptor{Digest: d, Size: int64(len(data))}
+	return d, l.writeBlob(ctx, desc, static.NewLayer(data, "").Compressed)
 }
 
-func (l *Layout) writeLayer(layer v1.Layer) error {
+func (l *Layout) writeLayer(ctx context.Context, layer v1.Layer) error {
 	d, err := layer.Digest()
+	if errors.Is(err, artifacts.ErrNotComputed) {
+		return l.writeStream(ctx, layer)
+	}
 	if err != nil {
 		return err
 	}
 
-	r, err := layer.Compressed()
+	size, err := layer.Size()
 	if err != nil {
 		return err
 	}
 
-	dir := filepath.Join(l.Root, "blobs", d.Algorithm)
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil && !os.IsExist(err) {
+	desc := ocispec.Descriptor{
+		Digest: digest.NewDigestFromHex(d.Algorithm, d.Hex),
+		Size:   size,
+	}
+	return l.writeBlob(ctx, desc, l.connected(ctx, layer.Compressed))
+}
+
+// writeStream writes a layer whose digest and size aren't known until it has been read, spooling it to the ingest
+// directory to find the digest it's committed under
+func (l *Layout) writeStream(ctx context.Context, layer v1.Layer) error {
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
 		return err
 	}
+	name := path.Join(content.IngestDir, "stream-"+hex.EncodeToString(nonce[:]))
 
-	blobPath := filepath.Join(dir, d.Hex)
-	// Skip entirely if something exists, assume layer is present already
-	if _, err := os.Stat(blobPath); err == nil {
-		return nil
+	driver := l.OCI.Driver()
+	f, err := driver.Create(name)
+	if err != nil {
+		return err
+	}
+	defer driver.Remove(name)
+	defer f.Close()
+
+	// the connection is let go of once the layer is spooled, before waiting on a write
+	rc, err := l.connected(ctx, layer.Compressed)()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, &contextReader{ctx: ctx, r: rc})
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	d, err := layer.Digest()
+	if err != nil {
+		return err
+	}
+	size, err := layer.Size()
+	if err != nil {
+		return err
+	}
+
+	desc := ocispec.Descriptor{
+		Digest: digest.NewDigestFromHex(d.Algorithm, d.Hex),
+		Size:   size,
 	}
+	return l.writeBlob(ctx, desc, func() (io.ReadCloser, error) {
+		return driver.Open(name)
+	})
+}
+
+// writeBlob writes the content open returns as the blob desc, unless the store has it already
+func (l *Layout) writeBlob(ctx context.Context, desc ocispec.Descriptor, open func() (io.ReadCloser, error)) error {
+	ctx, span := l.startSpan(ctx, "store.writeBlob",
+		attribute.String("ocil.digest", desc.Digest.String()), attribute.Int64("ocil.size", desc.Size))
+	defer span.End()
+	return endSpan(span, l.writeBlobContent(ctx, desc, open))
+}
 
-	w, err := os.Create(blobPath)
+func (l *Layout) writeBlobContent(ctx context.Context, desc ocispec.Descriptor, open func() (io.ReadCloser, error)) error {
+	release, err := acquire(ctx, l.writes)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	w, err := l.OCI.Writer(ctx, desc)
+	if errdefs.IsAlreadyExists(err) {
+		// Skip entirely if something exists, assume layer is present already
+		l.log.V(1).Info("blob already present, skipping", "digest", desc.Digest)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("ocil.skipped", true))
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 	defer w.Close()
 
-	_, err = io.Copy(w, r)
-	return err
+	// content is cheap to reread, so start over instead of resuming a previous attempt
+	if err := w.Truncate(0); err != nil {
+		return err
+	}
+
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	dst, record, err := l.secondaryDigester(w, desc.Digest)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(l.progressWriter(ctx, desc, dst), l.throttled(ctx, &contextReader{ctx: ctx, r: r}, 0)); err != nil {
+		return err
+	}
+	if err := w.Commit(ctx, desc.Size, desc.Digest); err != nil {
+		return err
+	}
+	l.log.V(2).Info("wrote blob", "digest", desc.Digest, "size", desc.Size, "mediaType", desc.MediaType)
+	if l.metrics != nil {
+		l.metrics.BlobWritten(desc.Size)
+	}
+	return record()
 }
@@ -1,22 +1,31 @@
 package store_test
 
 import (
-	"context"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
+	ccontent "github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/content"
+	"github.com/rancherfederal/ocil/pkg/layer"
 	"github.com/rancherfederal/ocil/pkg/store"
 )
 
-var (
-	ctx  context.Context
-	root string
-)
-
 func TestLayout_AddOCI(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
@@ -62,44 +71,490 @@ func TestLayout_AddOCI(t *testing.T) {
 	}
 }
 
-func setup(t *testing.T) func() error {
-	tmpdir, err := os.MkdirTemp("", "ocil")
+func TestLayout_WalkByMediaType(t *testing.T) {
+	s := newLayout(t)
+
+	if _, err := s.AddOCI(ctx, genArtifact(t, "image:v1"), "image:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, memory.NewMemory([]byte("data"), "random"), "memory:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err := s.WalkByMediaType(ctx, []string{consts.DockerConfigJSON}, func(reference string, desc ocispec.Descriptor) error {
+		got = append(got, reference)
+		return nil
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
-	root = tmpdir
 
-	ctx = context.Background()
+	if len(got) != 1 || got[0] != "image:v1" {
+		t.Errorf("WalkByMediaType() visited %v, want [image:v1]", got)
+	}
+}
 
-	return func() error {
-		os.RemoveAll(tmpdir)
-		return nil
+func TestLayout_Image(t *testing.T) {
+	s := newLayout(t)
+
+	ref := "hello/world:v1"
+	desc, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := s.Image(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != desc.Digest.String() {
+		t.Errorf("Image() digest = %s, want %s", got, desc.Digest)
 	}
 }
 
-type mockArtifact struct {
-	v1.Image
+func TestLayout_ResumableWriter(t *testing.T) {
+	s := newLayout(t)
+
+	data := []byte("some blob content that gets interrupted halfway through")
+	desc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+
+	// simulate an interrupted write
+	w, err := s.Writer(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	half := len(data) / 2
+	if _, err := w.Write(data[:half]); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	if _, err := os.Stat(filepath.Join(root, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Hex())); !os.IsNotExist(err) {
+		t.Fatalf("partial blob should not be visible in the layout")
+	}
+
+	w, err = s.Writer(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	status, err := w.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Offset != int64(half) {
+		t.Fatalf("resumed writer offset = %d, want %d", status.Offset, half)
+	}
+
+	if err := ccontent.Copy(ctx, w, bytes.NewReader(data), desc.Size, desc.Digest); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := s.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("resumed blob = %q, want %q", got, data)
+	}
+
+	if _, err := s.Writer(ctx, desc); !errdefs.IsAlreadyExists(err) {
+		t.Errorf("Writer() on a committed blob error = %v, want already exists", err)
+	}
 }
 
-func (m mockArtifact) MediaType() string {
-	mt, err := m.Image.MediaType()
+func TestLayout_ConcurrentAdd(t *testing.T) {
+	s := newLayout(t)
+
+	const producers = 16
+	var g errgroup.Group
+	for i := 0; i < producers; i++ {
+		ref := fmt.Sprintf("hello/world%d:v1", i)
+		g.Go(func() error {
+			_, err := s.AddOCI(ctx, genArtifact(t, ref), ref)
+			return err
+		})
+		// readers reload the index while it's being updated
+		g.Go(func() error {
+			_, err := s.List(ctx)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := store.NewLayout(root)
 	if err != nil {
-		return ""
+		t.Fatal(err)
+	}
+	if got := refs(t, reopened); len(got) != producers {
+		t.Errorf("stored references = %v, want all %d added concurrently", got, producers)
 	}
-	return string(mt)
 }
 
-func (m mockArtifact) RawConfig() ([]byte, error) {
-	return m.RawConfigFile()
+func TestLayout_ResolveByDigest(t *testing.T) {
+	s := newLayout(t)
+
+	desc, err := s.AddOCI(ctx, genArtifact(t, "app:v1"), "registry.example.com/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name    string
+		ref     string
+		wantErr bool
+	}{
+		{name: "name", ref: "registry.example.com/app:v1"},
+		{name: "repository and digest", ref: "registry.example.com/app@" + desc.Digest.String()},
+		{name: "bare digest", ref: desc.Digest.String()},
+		{name: "other repository", ref: "registry.example.com/other@" + desc.Digest.String(), wantErr: true},
+		{name: "unknown digest", ref: digest.FromString("unknown").String(), wantErr: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, got, err := s.Resolve(ctx, tc.ref)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr && !errors.Is(err, store.ErrRefNotFound) {
+				t.Errorf("Resolve() error = %v, want ErrRefNotFound", err)
+			}
+			if !tc.wantErr && got.Digest != desc.Digest {
+				t.Errorf("Resolve() = %s, want %s", got.Digest, desc.Digest)
+			}
+		})
+	}
 }
 
-func genArtifact(t *testing.T, ref string) artifacts.OCI {
-	img, err := random.Image(1024, 3)
+func TestNewLayout_WithDriver(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	// the root only names a layout stored in memory
+	name := filepath.Join(t.TempDir(), "memory")
+	s, err := store.NewLayout(name, store.WithDriver(content.NewMemoryDriver()))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	return &mockArtifact{
-		img,
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v2"), "hello/world:v2"); err != nil {
+		t.Fatal(err)
 	}
+	_, desc, err := s.Resolve(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := s.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(rc); err != nil {
+		t.Errorf("Fetch() error = %v", err)
+	}
+	rc.Close()
+
+	img, err := s.Image(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := img.Digest(); err != nil {
+		t.Errorf("Image() digest error = %v", err)
+	}
+
+	dst := tempLayout(t)
+	if _, err := s.Copy(ctx, ref, dst.OCI, ""); err != nil {
+		t.Errorf("Copy() out of a memory layout error = %v", err)
+	}
+
+	if err := s.Remove(ctx, "hello/world:v2"); err != nil {
+		t.Fatal(err)
+	}
+	gc, err := s.GC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gc.Deleted) == 0 {
+		t.Error("GC() deleted nothing, want the blobs of hello/world:v2")
+	}
+	report, err := s.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Checked == 0 {
+		t.Errorf("Fsck() = %+v, want every blob checked and ok", report)
+	}
+
+	archive := filepath.Join(t.TempDir(), "store.tar.zst")
+	if err := s.Archive(ctx, archive); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.LoadArchive(ctx, archive, filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refs(t, loaded); len(got) != 1 {
+		t.Errorf("archived references = %v, want only %s", got, ref)
+	}
+
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("memory layout root stat error = %v, want it never created", err)
+	}
+
+	// a layout read through an fs.FS
+	ro, err := store.NewLayout("fs", store.WithDriver(content.NewFSDriver(os.DirFS(loaded.Root))), store.WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, desc, err = ro.Resolve(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err = ro.Fetch(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(rc); err != nil {
+		t.Errorf("Fetch() through an fs.FS error = %v", err)
+	}
+	rc.Close()
+}
+
+func TestLayout_AddOCIArtifactType(t *testing.T) {
+	s := newLayout(t)
+
+	const artifactType = "application/vnd.example.data.v1"
+	img, err := s.AddOCI(ctx, genArtifact(t, "hello/world:v1"), "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := v1.Descriptor{MediaType: types.MediaType(img.MediaType), Size: img.Size, Digest: v1.Hash{Algorithm: img.Digest.Algorithm().String(), Hex: img.Digest.Hex()}}
+	g := artifacts.NewGeneric().WithArtifactType(artifactType).WithSubject(subject)
+	desc, err := s.AddOCI(ctx, g, "hello/world:data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the manifest is stored as the artifact built it, artifactType and all
+	raw, err := g.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := digest.FromBytes(raw); desc.Digest != want {
+		t.Errorf("AddOCI() digest = %s, want %s", desc.Digest, want)
+	}
+
+	if got := s.Identify(ctx, desc); got != artifactType {
+		t.Errorf("Identify() = %q, want %q", got, artifactType)
+	}
+	records, err := s.Find(ctx, store.Query{ArtifactTypes: []string{artifactType}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Reference != "hello/world:data" {
+		t.Errorf("Find() by artifact type = %+v, want only hello/world:data", records)
+	}
+	i, err := s.Inspect(ctx, "hello/world:data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.ArtifactType != artifactType || i.ConfigMediaType != consts.OCIEmptyMediaType || string(i.Config) != "{}" {
+		t.Errorf("Inspect() = %+v, want an empty config of type %s", i, artifactType)
+	}
+
+	referrers, err := s.Referrers(ctx, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != desc.Digest {
+		t.Fatalf("Referrers() = %+v, want the artifact", referrers)
+	}
+	_, fdesc, err := s.Resolve(ctx, fmt.Sprintf("hello/world:%s-%s", img.Digest.Algorithm(), img.Digest.Hex()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := s.Fetch(ctx, fdesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var idx struct {
+		Manifests []struct {
+			ArtifactType string `json:"artifactType"`
+		} `json:"manifests"`
+	}
+	if err := json.NewDecoder(rc).Decode(&idx); err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Manifests) != 1 || idx.Manifests[0].ArtifactType != artifactType {
+		t.Errorf("referrers index = %+v, want the artifactType of the artifact", idx.Manifests)
+	}
+
+	report, err := s.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("Fsck() = %+v, want the empty descriptor stored", report)
+	}
+}
+
+func TestLayout_AddOCIRawManifest(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	annotate := store.WithDescriptorHook(func(d *ocispec.Descriptor) error {
+		if d.Annotations == nil {
+			d.Annotations = make(map[string]string)
+		}
+		d.Annotations["example.com/hooked"] = "true"
+		return nil
+	})
+
+	tests := []struct {
+		name          string
+		opts          []store.Options
+		wantPreserved bool
+	}{
+		{name: "should keep the raw manifest byte for byte", wantPreserved: true},
+		{name: "should remarshal a manifest changed by a hook", opts: []store.Options{annotate}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tempLayout(t, tt.opts...)
+
+			ref := fmt.Sprintf("hello/raw%d:v1", i)
+			oci := genArtifact(t, ref)
+			m, err := oci.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// an unknown field and indentation both change the digest of a remarshaled manifest
+			indented, err := json.MarshalIndent(struct {
+				*v1.Manifest
+				ArtifactType string `json:"artifactType"`
+			}{m, "application/vnd.example"}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			desc, err := s.AddOCI(ctx, &rawArtifact{OCI: oci, raw: indented}, ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if preserved := desc.Digest == digest.FromBytes(indented); preserved != tt.wantPreserved {
+				t.Fatalf("AddOCI() digest preserved = %v, want %v", preserved, tt.wantPreserved)
+			}
+
+			rc, err := s.Fetch(ctx, desc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			got, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if digest.FromBytes(got) != desc.Digest {
+				t.Errorf("Fetch() = %s, want the bytes of %s", digest.FromBytes(got), desc.Digest)
+			}
+		})
+	}
+}
+
+func TestLayout_AddOCIStream(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	tests := []struct {
+		name string
+		opts []store.Options
+	}{
+		{name: "should stream layers into the store"},
+		{name: "should stream layers past the cache", opts: []store.Options{store.WithCache(layer.NewFilesystemCache(t.TempDir()))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tempLayout(t, tt.opts...)
+
+			// a pipe can only be read once, and nothing knows how much will come through it
+			data := bytes.Repeat([]byte("generated "), 1<<16)
+			pr, pw := io.Pipe()
+			go func() {
+				pw.Write(data)
+				pw.Close()
+			}()
+			g := artifacts.NewGeneric().AddStream("application/vnd.example.stream.v1", pr, map[string]string{ocispec.AnnotationTitle: "generated.txt"})
+
+			ref := "hello/stream:v1"
+			desc, err := s.AddOCI(ctx, g, ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var m ocispec.Manifest
+			rc, err := s.Fetch(ctx, desc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = json.NewDecoder(rc).Decode(&m)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Layers) != 1 {
+				t.Fatalf("manifest has %d layers, want 1", len(m.Layers))
+			}
+			if m.Layers[0].Digest != digest.FromBytes(data) || m.Layers[0].Size != int64(len(data)) {
+				t.Errorf("layer descriptor = %s (%d bytes), want %s (%d bytes)", m.Layers[0].Digest, m.Layers[0].Size, digest.FromBytes(data), len(data))
+			}
+			if m.Layers[0].Annotations[ocispec.AnnotationTitle] != "generated.txt" {
+				t.Errorf("layer annotations = %v, want the title given", m.Layers[0].Annotations)
+			}
+
+			rc, err = s.Fetch(ctx, m.Layers[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("stored layer read %d bytes, want the %d streamed", len(got), len(data))
+			}
+		})
+	}
+}
+
+type rawArtifact struct {
+	artifacts.OCI
+	raw []byte
+}
+
+func (r *rawArtifact) RawManifest() ([]byte, error) {
+	return r.raw, nil
 }
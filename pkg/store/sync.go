@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type SyncOption func(*syncOptions)
+
+type syncOptions struct {
+	dryRun  bool
+	filters []Filter
+}
+
+// WithDryRun reports what Sync would transfer without changing anything
+func WithDryRun() SyncOption {
+	return func(o *syncOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithSyncFilter only syncs the references matching every filter
+func WithSyncFilter(filters ...Filter) SyncOption {
+	return func(o *syncOptions) {
+		o.filters = append(o.filters, filters...)
+	}
+}
+
+// SyncReport lists what Sync transferred, or would have with WithDryRun
+type SyncReport struct {
+	// References were added, or now refer to a different manifest than they did
+	References []string
+
+	// Blobs were missing and transferred, Bytes is their total size
+	Blobs []digest.Digest
+	Bytes int64
+}
+
+// Sync brings every reference of from into l, transferring only the blobs l doesn't have yet, so stores can be
+// promoted from one stage to the next (ie: dev to staging to release) for no more than what changed
+// 	References in both stores that refer to different manifests are updated to from's.  Nothing l has that from doesn't
+// 	is ever removed.  Blobs are written before the references to them, so an interrupted sync leaves l as it was,
+// 	give or take blobs GC will collect.  The referrers tag fallback indexes of from aren't synced as is, l's own are
+// 	updated with whatever is synced instead, so they keep listing l's referrers too.
+func (l *Layout) Sync(ctx context.Context, from *Layout, opts ...SyncOption) (*SyncReport, error) {
+	if err := l.writable("sync"); err != nil {
+		return nil, err
+	}
+	o := &syncOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	type pending struct {
+		ref  string
+		desc ocispec.Descriptor
+	}
+	var refs []pending
+	err := from.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if isReferrersTag(reference) {
+			return nil
+		}
+		if current, err := l.resolve(ctx, reference); err == nil && current.Digest == desc.Digest {
+			return nil
+		}
+		refs = append(refs, pending{ref: reference, desc: desc})
+		return nil
+	}, o.filters...)
+	if err != nil {
+		return nil, err
+	}
+	// signatures (and whatever else is tagged after what it's attached to) are indexed after what they're attached to,
+	// for the signature policy to find it
+	sort.Slice(refs, func(i, j int) bool {
+		_, ai := taggedSubject(refs[i].ref)
+		_, aj := taggedSubject(refs[j].ref)
+		if ai != aj {
+			return aj
+		}
+		return refs[i].ref < refs[j].ref
+	})
+
+	have, err := l.blobNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SyncReport{}
+	needed := make(map[digest.Digest]ocispec.Descriptor)
+	for _, p := range refs {
+		report.References = append(report.References, p.ref)
+		if err := from.descendants(ctx, p.desc, needed); err != nil {
+			return nil, err
+		}
+	}
+	blobs := make(map[digest.Digest]bool)
+	for d, desc := range needed {
+		if _, ok := have[d]; !ok {
+			blobs[d] = true
+			report.Bytes += desc.Size
+		}
+	}
+	report.Blobs = sortedDigests(blobs)
+
+	if o.dryRun {
+		return report, nil
+	}
+
+	ctx, done := l.staging(ctx)
+	defer done()
+	for _, d := range report.Blobs {
+		desc := needed[d]
+		err := l.writeBlob(ctx, desc, func() (io.ReadCloser, error) {
+			return from.OCI.Fetch(ctx, desc)
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	for _, p := range refs {
+		req := &Request{Operation: OperationAdd, Reference: p.ref, Descriptor: p.desc, admits: from.admitsStored(ctx, p.ref, p.desc)}
+		err := l.intercept(ctx, req, func(ctx context.Context, req *Request) error {
+			desc := p.desc
+			desc.Annotations = copyAnnotations(p.desc.Annotations)
+			if desc.Annotations == nil {
+				desc.Annotations = make(map[string]string)
+			}
+			desc.Annotations[ocispec.AnnotationRefName] = req.Reference
+			if err := l.OCI.AddIndex(desc); err != nil {
+				return err
+			}
+
+			subject, err := l.subject(ctx, desc)
+			if err != nil || subject == nil {
+				return err
+			}
+			return l.addReferrer(ctx, req.Reference, subject.Digest, desc)
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
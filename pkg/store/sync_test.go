@@ -0,0 +1,104 @@
+package store_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/sbom"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Sync(t *testing.T) {
+	src := newLayout(t)
+	dst := tempLayout(t)
+
+	for _, ref := range []string{"registry.example.com/app:v1", "registry.example.com/app:v2"} {
+		if _, err := src.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := dst.Sync(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.References) != 2 || len(report.Blobs) != 10 {
+		t.Fatalf("Sync() into an empty store = %d references and %d blobs, want 2 and 10", len(report.References), len(report.Blobs))
+	}
+
+	// a new reference, an updated one, an attachment, and one left as is
+	if _, err := src.AddOCI(ctx, genArtifact(t, ""), "registry.example.com/app:v3"); err != nil {
+		t.Fatal(err)
+	}
+	v2, err := src.AddOCI(ctx, genArtifact(t, ""), "registry.example.com/app:v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := sbom.NewSBOM([]byte(`{"spdxVersion": "SPDX-2.3", "name": "app"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.AddSBOM(ctx, doc, "registry.example.com/app:v2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.AddOCI(ctx, genArtifact(t, ""), "registry.example.com/other:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	before := blobSizes(t, dst.Root)
+	dry, err := dst.Sync(ctx, src, store.WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := blobSizes(t, dst.Root); len(after) != len(before) {
+		t.Errorf("dry run wrote %d blobs", len(after)-len(before))
+	}
+
+	report, err = dst.Sync(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(report.References, ",") != strings.Join(dry.References, ",") || report.Bytes != dry.Bytes {
+		t.Errorf("Sync() = %+v, dry run reported %+v", report, dry)
+	}
+
+	sbomRef := fmt.Sprintf("registry.example.com/app:%s-%s.sbom", v2.Digest.Algorithm(), v2.Digest.Hex())
+	// attachments are synced after what they're attached to
+	want := []string{"registry.example.com/app:v2", "registry.example.com/app:v3", sbomRef}
+	if strings.Join(report.References, ",") != strings.Join(want, ",") {
+		t.Errorf("Sync() synced %v, want %v", report.References, want)
+	}
+	for _, d := range report.Blobs {
+		if _, ok := before[d]; ok {
+			t.Errorf("Sync() transferred %s, which was there already", d)
+		}
+	}
+
+	if got, err := dst.Image(ctx, "registry.example.com/other:v1"); err != nil || got == nil {
+		t.Errorf("Sync() lost a reference only the destination had: %v", err)
+	}
+	referrers, err := dst.Referrers(ctx, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 {
+		t.Errorf("Referrers() of the synced subject = %d, want 1", len(referrers))
+	}
+
+	fsck, err := dst.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fsck.OK() {
+		t.Errorf("synced store is unhealthy: %+v", fsck)
+	}
+
+	// nothing left to do
+	report, err = dst.Sync(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.References) != 0 || len(report.Blobs) != 0 {
+		t.Errorf("Sync() of stores in sync = %+v, want nothing", report)
+	}
+}
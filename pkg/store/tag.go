@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Tag adds newRef as another reference to whatever srcRef refers to, replacing anything newRef referred to before
+// 	Every reference is its own entry in the index, carrying a copy of the same descriptor, so removing or untagging
+// 	one leaves the others be.
+func (l *Layout) Tag(ctx context.Context, srcRef string, newRef string) (ocispec.Descriptor, error) {
+	req := &Request{Operation: OperationTag, Reference: newRef}
+	err := l.intercept(ctx, req, func(ctx context.Context, req *Request) error {
+		desc, err := l.resolve(ctx, srcRef)
+		if err != nil {
+			return err
+		}
+		if err := l.verify(ctx, req.Reference, l.admitsStored(ctx, srcRef, desc)); err != nil {
+			return err
+		}
+
+		tagged := desc
+		tagged.Annotations = copyAnnotations(desc.Annotations)
+		if tagged.Annotations == nil {
+			tagged.Annotations = make(map[string]string)
+		}
+		tagged.Annotations[ocispec.AnnotationRefName] = req.Reference
+		if err := l.OCI.AddIndex(tagged); err != nil {
+			return err
+		}
+		req.Descriptor = tagged
+
+		// an attachment tagged into another repository has to be found from there too
+		subject, err := l.subject(ctx, tagged)
+		if err != nil || subject == nil {
+			return err
+		}
+		return l.addReferrer(ctx, req.Reference, subject.Digest, tagged)
+	})
+	return req.Descriptor, err
+}
+
+// Untag drops ref from the index, unlike Remove it never touches blobs: whatever ref referred to stays in place for
+// its other references, or for GC if there are none
+func (l *Layout) Untag(ctx context.Context, ref string) error {
+	return l.intercept(ctx, &Request{Operation: OperationUntag, Reference: ref}, func(ctx context.Context, req *Request) error {
+		desc, err := l.resolve(ctx, req.Reference)
+		if err != nil {
+			return err
+		}
+		req.Descriptor = desc
+
+		if err := l.removeReferrers(ctx, []string{req.Reference}); err != nil {
+			return err
+		}
+		return l.OCI.RemoveIndex(req.Reference)
+	})
+}
+
+// Tags returns every reference to d, sorted
+func (l *Layout) Tags(ctx context.Context, d digest.Digest) ([]string, error) {
+	var refs []string
+	err := l.OCI.Walk(func(reference string, desc ocispec.Descriptor) error {
+		if desc.Digest == d {
+			refs = append(refs, reference)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
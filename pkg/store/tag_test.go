@@ -0,0 +1,63 @@
+package store_test
+
+import (
+	"strings"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Tag(t *testing.T) {
+	s := newLayout(t)
+
+	desc, err := s.AddOCI(ctx, genArtifact(t, "app:v1"), "registry.example.com/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"registry.example.com/app:latest", "mirror.example.com/app:v1"} {
+		tagged, err := s.Tag(ctx, "registry.example.com/app:v1", ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tagged.Digest != desc.Digest || tagged.Annotations[ocispec.AnnotationRefName] != ref {
+			t.Errorf("Tag() = %s %s, want %s %s", tagged.Digest, tagged.Annotations[ocispec.AnnotationRefName], desc.Digest, ref)
+		}
+	}
+	if _, err := s.Tag(ctx, "registry.example.com/missing:v1", "registry.example.com/app:v2"); err == nil {
+		t.Error("Tag() of a missing reference succeeded")
+	}
+
+	// every reference is saved, so a fresh load of the store sees them all
+	reloaded, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := reloaded.Tags(ctx, desc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"mirror.example.com/app:v1", "registry.example.com/app:latest", "registry.example.com/app:v1"}
+	if strings.Join(tags, ",") != strings.Join(want, ",") {
+		t.Errorf("Tags() = %v, want %v", tags, want)
+	}
+
+	if err := reloaded.Untag(ctx, "registry.example.com/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.Untag(ctx, "registry.example.com/app:v1"); err == nil {
+		t.Error("Untag() of a missing reference succeeded")
+	}
+	if _, err := reloaded.Image(ctx, "registry.example.com/app:latest"); err != nil {
+		t.Errorf("Untag() broke another reference to the same manifest: %v", err)
+	}
+
+	report, err := reloaded.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("Untag() left the store unhealthy: %+v", report)
+	}
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name spans of the store are started with
+const tracerName = modulePath + "/pkg/store"
+
+// WithTracerProvider starts the spans of store operations (adds, copies, blob writes and so on) from tp instead of the
+// global otel TracerProvider
+func WithTracerProvider(tp trace.TracerProvider) Options {
+	return func(l *Layout) {
+		l.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// tracing returns the tracer to start spans with, the global one unless the Layout was given one
+func (l *Layout) tracing() trace.Tracer {
+	if l.tracer != nil {
+		return l.tracer
+	}
+	return otel.Tracer(tracerName)
+}
+
+// traced wraps op in a span named for its operation, so everything it does is recorded beneath it
+func (l *Layout) traced(op Handler) Handler {
+	return func(ctx context.Context, req *Request) error {
+		ctx, span := l.startSpan(ctx, "store."+string(req.Operation), attribute.String("ocil.reference", req.Reference))
+		defer span.End()
+
+		err := op(ctx, req)
+		if req.Descriptor.Digest != "" {
+			span.SetAttributes(attribute.String("ocil.digest", req.Descriptor.Digest.String()))
+		}
+		return endSpan(span, err)
+	}
+}
+
+func (l *Layout) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return l.tracing().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err as the outcome of span, returning it
+func endSpan(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
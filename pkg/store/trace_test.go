@@ -0,0 +1,45 @@
+package store_test
+
+import (
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_WithTracerProvider(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	s := newLayout(t, store.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+
+	ref := "hello/world:v1"
+	if _, err := s.AddOCI(ctx, genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+	dst := tempLayout(t)
+	if _, err := s.CopyAll(ctx, dst.OCI, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, span := range sr.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	for _, name := range []string{"store.add", "store.writeBlob", "store.copy", "store.copyAll"} {
+		if len(spans[name]) == 0 {
+			t.Fatalf("no %s span recorded", name)
+		}
+	}
+
+	// blob writes and copies happen beneath the operation that made them
+	add := spans["store.add"][0].SpanContext().SpanID()
+	for _, span := range spans["store.writeBlob"] {
+		if span.Parent().SpanID() != add {
+			t.Errorf("store.writeBlob span parent = %s, want store.add %s", span.Parent().SpanID(), add)
+		}
+	}
+	if got, want := spans["store.copy"][0].Parent().SpanID(), spans["store.copyAll"][0].SpanContext().SpanID(); got != want {
+		t.Errorf("store.copy span parent = %s, want store.copyAll %s", got, want)
+	}
+}
@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+)
+
+// ErrTxDone is returned by the methods of transactions that were already committed or rolled back
+var ErrTxDone = errors.New("transaction already committed or rolled back")
+
+// Tx batches Adds into a single update of the index, so an ingest of several artifacts that fails part way through
+// doesn't leave the index half updated
+// 	Blobs are written as they're added, but nothing references them until Commit indexes everything at once, and
+// 	Rollback leaves them for GC, which keeps what open transactions have staged.  Adds within the transaction see what
+// 	it has staged (ie: a referrer of an artifact added before it), nothing outside it does until it's committed.
+// 	Middleware and subscribers see each Add as it's staged.
+type Tx struct {
+	l   *Layout
+	ctx context.Context
+
+	mu      sync.Mutex
+	staged  map[string]ocispec.Descriptor
+	removed map[string]bool
+	done    bool
+}
+
+type txKey struct{}
+
+// Begin starts a transaction whose Adds run with ctx
+func (l *Layout) Begin(ctx context.Context) (*Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := l.writable("begin"); err != nil {
+		return nil, err
+	}
+	tx := &Tx{
+		l:       l,
+		staged:  make(map[string]ocispec.Descriptor),
+		removed: make(map[string]bool),
+	}
+	tx.ctx = context.WithValue(ctx, txKey{}, tx)
+
+	l.txsMu.Lock()
+	defer l.txsMu.Unlock()
+	if l.txs == nil {
+		l.txs = make(map[*Tx]bool)
+	}
+	l.txs[tx] = true
+	return tx, nil
+}
+
+// AddOCI stages oci as ref, see Layout.AddOCI
+func (tx *Tx) AddOCI(oci artifacts.OCI, ref string) (ocispec.Descriptor, error) {
+	if err := tx.check(); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return tx.l.AddOCI(tx.ctx, oci, ref)
+}
+
+// AddImage stages img as ref, see Layout.AddImage
+func (tx *Tx) AddImage(img gv1.Image, ref string) (ocispec.Descriptor, error) {
+	if err := tx.check(); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return tx.l.AddImage(tx.ctx, img, ref)
+}
+
+// AddImageIndex stages idx as ref, see Layout.AddImageIndex
+func (tx *Tx) AddImageIndex(idx gv1.ImageIndex, ref string) (ocispec.Descriptor, error) {
+	if err := tx.check(); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return tx.l.AddImageIndex(tx.ctx, idx, ref)
+}
+
+// AddSBOM stages the sbom oci attached to subjectRef, which may itself be staged, see Layout.AddSBOM
+func (tx *Tx) AddSBOM(oci artifacts.OCI, subjectRef string) (ocispec.Descriptor, error) {
+	if err := tx.check(); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return tx.l.AddSBOM(tx.ctx, oci, subjectRef)
+}
+
+// AddAttestation stages the attestation oci attached to subjectRef, which may itself be staged, see
+// Layout.AddAttestation
+func (tx *Tx) AddAttestation(oci artifacts.OCI, subjectRef string) (ocispec.Descriptor, error) {
+	if err := tx.check(); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return tx.l.AddAttestation(tx.ctx, oci, subjectRef)
+}
+
+// Commit indexes everything staged by the transaction in a single update of the index
+func (tx *Tx) Commit() error {
+	// GC can't run between the update of the index and the transaction closing, missing what it staged
+	tx.l.gcMu.RLock()
+	defer tx.l.gcMu.RUnlock()
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	defer tx.l.closeTx(tx)
+
+	add := make([]ocispec.Descriptor, 0, len(tx.staged))
+	for _, desc := range tx.staged {
+		add = append(add, desc)
+	}
+	remove := make([]string, 0, len(tx.removed))
+	for ref := range tx.removed {
+		remove = append(remove, ref)
+	}
+	if err := tx.l.OCI.UpdateIndex(add, remove); err != nil {
+		return fmt.Errorf("commit %d references: %w", len(add), err)
+	}
+	tx.l.log.V(1).Info("committed transaction", "added", len(add), "removed", len(remove))
+	return nil
+}
+
+// Rollback discards everything staged by the transaction, it's a no-op once the transaction is committed
+func (tx *Tx) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	tx.staged, tx.removed = nil, nil
+	tx.l.closeTx(tx)
+	return nil
+}
+
+// closeTx forgets tx, GC no longer keeping what it staged
+func (l *Layout) closeTx(tx *Tx) {
+	l.txsMu.Lock()
+	defer l.txsMu.Unlock()
+	delete(l.txs, tx)
+}
+
+// openTxs returns what the transactions still open have staged
+func (l *Layout) openTxs() []ocispec.Descriptor {
+	l.txsMu.Lock()
+	txs := make([]*Tx, 0, len(l.txs))
+	for tx := range l.txs {
+		txs = append(txs, tx)
+	}
+	l.txsMu.Unlock()
+
+	var staged []ocispec.Descriptor
+	for _, tx := range txs {
+		tx.mu.Lock()
+		for _, desc := range tx.staged {
+			staged = append(staged, desc)
+		}
+		tx.mu.Unlock()
+	}
+	return staged
+}
+
+func (tx *Tx) check() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	return nil
+}
+
+// txFrom returns the transaction ctx is running in, if any
+func txFrom(ctx context.Context) *Tx {
+	tx, _ := ctx.Value(txKey{}).(*Tx)
+	return tx
+}
+
+// addIndex indexes desc, or stages it when ctx is running in a transaction
+func (l *Layout) addIndex(ctx context.Context, desc ocispec.Descriptor) error {
+	tx := txFrom(ctx)
+	if tx == nil {
+		return l.OCI.AddIndex(desc)
+	}
+
+	ref, ok := desc.Annotations[ocispec.AnnotationRefName]
+	if !ok {
+		return fmt.Errorf("descriptor must contain a reference from the annotation: %s", ocispec.AnnotationRefName)
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.staged[ref] = desc
+	delete(tx.removed, ref)
+	return nil
+}
+
+// removeIndex removes ref from the index, or stages its removal when ctx is running in a transaction
+func (l *Layout) removeIndex(ctx context.Context, ref string) error {
+	tx := txFrom(ctx)
+	if tx == nil {
+		return l.OCI.RemoveIndex(ref)
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	delete(tx.staged, ref)
+	tx.removed[ref] = true
+	return nil
+}
+
+// staged returns what the transaction of l that ctx is running in has staged as ref, and whether it has staged
+// anything at all
+func (l *Layout) staged(ctx context.Context, ref string) (ocispec.Descriptor, bool, error) {
+	tx := txFrom(ctx)
+	if tx == nil || tx.l != l {
+		return ocispec.Descriptor{}, false, nil
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if desc, ok := tx.staged[ref]; ok {
+		return desc, true, nil
+	}
+	if tx.removed[ref] {
+		return ocispec.Descriptor{}, true, fmt.Errorf("%s: %w", ref, ErrRefNotFound)
+	}
+	return ocispec.Descriptor{}, false, nil
+}
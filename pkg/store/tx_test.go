@@ -0,0 +1,143 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts/memory"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Begin(t *testing.T) {
+	s := newLayout(t)
+
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"hello/world:v1", "hello/world:v2"} {
+		if _, err := tx.AddOCI(genArtifact(t, ref), ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the subject of the sbom is only staged
+	if _, err := tx.AddSBOM(memory.NewMemory([]byte("sbom"), "application/spdx+json"), "hello/world:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := refs(t, s); len(got) != 0 {
+		t.Errorf("stored references before Commit() = %v, want none", got)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both artifacts, the sbom and the referrers index of hello/world:v1
+	if got := refs(t, reopened); len(got) != 4 {
+		t.Errorf("stored references after Commit() = %v, want 4", got)
+	}
+	_, desc, err := reopened.Resolve(ctx, "hello/world:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	referrers, err := reopened.Referrers(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 {
+		t.Errorf("Referrers() = %v, want the sbom staged with its subject", referrers)
+	}
+
+	if err := tx.Commit(); !errors.Is(err, store.ErrTxDone) {
+		t.Errorf("second Commit() error = %v, want ErrTxDone", err)
+	}
+}
+
+func TestTx_Rollback(t *testing.T) {
+	s := newLayout(t)
+
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := "hello/world:v1"
+	if _, err := tx.AddOCI(genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.AddOCI(genArtifact(t, ref), ref); !errors.Is(err, store.ErrTxDone) {
+		t.Errorf("AddOCI() after Rollback() error = %v, want ErrTxDone", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, store.ErrTxDone) {
+		t.Errorf("Commit() after Rollback() error = %v, want ErrTxDone", err)
+	}
+	if got := refs(t, s); len(got) != 0 {
+		t.Errorf("stored references after Rollback() = %v, want none", got)
+	}
+}
+
+func TestTx_GC(t *testing.T) {
+	// GC starts while the add of hello/world:v2 is in flight, before it's written anything
+	var s *store.Layout
+	collected := make(chan error, 1)
+	gcDuringAdd := func(next store.Handler) store.Handler {
+		return func(ctx context.Context, req *store.Request) error {
+			if req.Operation == store.OperationAdd && req.Reference == "hello/world:v2" {
+				go func() {
+					_, err := s.GC(ctx)
+					collected <- err
+				}()
+				time.Sleep(50 * time.Millisecond)
+			}
+			return next(ctx, req)
+		}
+	}
+	s = newLayout(t, store.WithMiddleware(gcDuringAdd))
+
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := "hello/world:v1"
+	if _, err := tx.AddOCI(genArtifact(t, ref), ref); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.GC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Deleted) != 0 {
+		t.Errorf("GC() during the transaction deleted %v, want what it staged kept", report.Deleted)
+	}
+
+	if _, err := tx.AddOCI(genArtifact(t, "hello/world:v2"), "hello/world:v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-collected; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	fsck, err := s.Fsck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fsck.OK() {
+		t.Errorf("store is unhealthy after GC() during the transaction: %+v", fsck)
+	}
+	for _, ref := range []string{"hello/world:v1", "hello/world:v2"} {
+		if _, err := s.Image(ctx, ref); err != nil {
+			t.Errorf("Image(%s) after Commit(): %v", ref, err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	gv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/cosign"
+)
+
+// ErrUnsigned is the reason an artifact without any signatures is refused by the Layouts signature policy
+var ErrUnsigned = errors.New("artifact is not signed")
+
+// PolicyError is returned when an artifact is refused entry to the store by its signature policy
+type PolicyError struct {
+	Reference string
+	Digest    digest.Digest
+	Err       error
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%s (%s) refused by signature policy: %v", e.Reference, e.Digest, e.Err)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// WithVerifier only admits artifacts to the store that carry a cosign signature satisfying v
+// 	Every write to the index is verified: AddOCI, AddImage and AddImageIndex, with the ImportArchive, Sync and registry
+// 	pulls made of them, and Tag, Mutate and CreateIndex.  Signatures are those the artifact brings along, fetched
+// 	itself (artifacts.Signed) or found beside it in the archive or layout it's imported from, or else those the store
+// 	holds under the cosign "<alg>-<hex>.sig" tag of its digest in the same repository.  Artifacts without any are
+// 	refused with a *PolicyError wrapping ErrUnsigned, as is any artifact whose signatures don't verify, so what Mutate
+// 	and CreateIndex write, which nobody has signed yet, is refused too.
+// 	Signatures, sboms and everything else tagged as attached to a digest are only admitted once that digest is in the
+// 	store and verifies with the signatures stored for it, or for a signature, with the signature itself.
+func WithVerifier(v cosign.Verifier) Options {
+	return func(l *Layout) {
+		l.verifier = v
+	}
+}
+
+// admission is what a write brings into the index, by digest, along with the signatures it brings along and what it
+// is read as a signature, either of which is nil if it can't provide them
+type admission struct {
+	digest     func() (digest.Digest, error)
+	signatures func() (cosign.Signatures, error)
+	content    func() (cosign.Signatures, error)
+}
+
+// admits is the admission of v, which has the digest d
+func admits(v interface{}, d func() (digest.Digest, error)) *admission {
+	a := &admission{digest: d}
+	if signed, ok := v.(artifacts.Signed); ok {
+		a.signatures = func() (cosign.Signatures, error) {
+			sig, err := signed.Signatures()
+			if sig == nil || err != nil {
+				return nil, err
+			}
+			return sig, nil
+		}
+	}
+	if sigs, ok := v.(cosign.Signatures); ok {
+		a.content = func() (cosign.Signatures, error) {
+			return sigs, nil
+		}
+	}
+	return a
+}
+
+// admitsDigest is the admission of what's been written to the store with the digest d
+func admitsDigest(d digest.Digest) *admission {
+	return &admission{digest: func() (digest.Digest, error) {
+		return d, nil
+	}}
+}
+
+// admitsStored is the admission of desc, stored in l under ref, as another reference or into another store: the
+// signatures it brings along are those l holds for it in the repository of ref
+func (l *Layout) admitsStored(ctx context.Context, ref string, desc ocispec.Descriptor) *admission {
+	a := admitsDigest(desc.Digest)
+	a.signatures = func() (cosign.Signatures, error) {
+		return l.storedSignatures(ctx, ref, desc.Digest)
+	}
+	a.content = func() (cosign.Signatures, error) {
+		switch desc.MediaType {
+		case ocispec.MediaTypeImageManifest, consts.DockerManifestSchema2:
+			return l.Image(ctx, ref)
+		}
+		return nil, nil
+	}
+	return a
+}
+
+// verified wraps op so the signature policy verifies what a write brings into the index before it writes any of it
+func (l *Layout) verified(op Handler) Handler {
+	if l.verifier == nil {
+		return op
+	}
+
+	return func(ctx context.Context, req *Request) error {
+		if req.admits != nil {
+			if err := l.verify(ctx, req.Reference, req.admits); err != nil {
+				return err
+			}
+		}
+		return op(ctx, req)
+	}
+}
+
+// verify enforces the Layouts signature policy on a, added as ref
+func (l *Layout) verify(ctx context.Context, ref string, a *admission) error {
+	if l.verifier == nil {
+		return nil
+	}
+
+	d, err := a.digest()
+	if err != nil {
+		return err
+	}
+	refuse := func(err error) error {
+		return &PolicyError{Reference: ref, Digest: d, Err: err}
+	}
+
+	if subject, ok := taggedSubject(ref); ok {
+		return l.verifyAttachment(ctx, ref, subject, a, refuse)
+	}
+
+	var sigs cosign.Signatures
+	if a.signatures != nil {
+		if sigs, err = a.signatures(); err != nil {
+			return fmt.Errorf("fetch signatures of %s: %w", ref, err)
+		}
+	}
+	if sigs == nil {
+		if sigs, err = l.storedSignatures(ctx, ref, d); err != nil {
+			return err
+		}
+	}
+	if sigs == nil {
+		return refuse(ErrUnsigned)
+	}
+
+	if err := cosign.Verify(sigs, d, l.verifier); err != nil {
+		return refuse(err)
+	}
+	return nil
+}
+
+// verifyAttachment admits a, attached to subject as ref, if subject is in the store and verifies, with a itself if
+// ref is the signature reference of subject or else the signatures stored for it
+func (l *Layout) verifyAttachment(ctx context.Context, ref string, subject digest.Digest, a *admission, refuse func(error) error) error {
+	held, err := l.holds(ctx, subject)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return refuse(fmt.Errorf("subject %s is not in the store", subject))
+	}
+
+	var sigs cosign.Signatures
+	if ref == signatureReference(ref, subject) {
+		if a.content != nil {
+			if sigs, err = a.content(); err != nil {
+				return err
+			}
+		}
+		if sigs == nil {
+			return refuse(fmt.Errorf("not a signature of %s", subject))
+		}
+	} else {
+		if sigs, err = l.storedSignatures(ctx, ref, subject); err != nil {
+			return err
+		}
+		if sigs == nil {
+			return refuse(fmt.Errorf("subject %s: %w", subject, ErrUnsigned))
+		}
+	}
+
+	if err := cosign.Verify(sigs, subject, l.verifier); err != nil {
+		return refuse(fmt.Errorf("subject %s: %w", subject, err))
+	}
+	return nil
+}
+
+// storedSignatures returns the signatures of d the store holds under its signature reference in the repository of
+// ref, nil if there are none
+func (l *Layout) storedSignatures(ctx context.Context, ref string, d digest.Digest) (cosign.Signatures, error) {
+	sig, err := l.Image(ctx, signatureReference(ref, d))
+	if errors.Is(err, ErrRefNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stored signatures of %s: %w", ref, err)
+	}
+	return sig, nil
+}
+
+// holds is whether d is indexed in the store, or reached by something that is, ie: the manifest of a platform of an
+// index
+func (l *Layout) holds(ctx context.Context, d digest.Digest) (bool, error) {
+	found := false
+	err := l.OCI.Walk(func(_ string, desc ocispec.Descriptor) error {
+		found = found || desc.Digest == d
+		return nil
+	})
+	if err != nil || found {
+		return found, err
+	}
+	for _, desc := range l.openTxs() {
+		if desc.Digest == d {
+			return true, nil
+		}
+	}
+
+	reachable, err := l.reachable(ctx)
+	if err != nil {
+		return false, err
+	}
+	_, found = reachable[d]
+	return found, nil
+}
+
+// artifactDigest is the digest signatures of oci are made over, which for images pulled from a registry is that of the
+// manifest as the registry served it
+func artifactDigest(oci artifacts.OCI) (digest.Digest, error) {
+	if i, ok := oci.(interface{ Digest() (gv1.Hash, error) }); ok {
+		return hashDigest(i.Digest())
+	}
+
+	m, err := oci.Manifest()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(data), nil
+}
+
+// hashDigest converts the go-containerregistry hash h into a digest
+func hashDigest(h gv1.Hash, err error) (digest.Digest, error) {
+	if err != nil {
+		return "", err
+	}
+	return digest.NewDigestFromHex(h.Algorithm, h.Hex), nil
+}
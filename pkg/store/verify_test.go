@@ -0,0 +1,410 @@
+package store_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/artifacts"
+	"github.com/rancherfederal/ocil/pkg/consts"
+	"github.com/rancherfederal/ocil/pkg/cosign"
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_FetchVerified(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	tests := []struct {
+		name    string
+		damage  func(path string, size int64) error
+		unsized bool
+		wantErr error
+	}{
+		{name: "should read an intact blob", damage: func(string, int64) error { return nil }},
+		{
+			name:    "should refuse a truncated blob",
+			damage:  func(path string, size int64) error { return os.Truncate(path, size/2) },
+			wantErr: store.ErrSizeMismatch,
+		},
+		{
+			name:    "should fail reading a corrupted blob",
+			damage:  func(path string, size int64) error { return os.WriteFile(path, make([]byte, size), 0644) },
+			wantErr: store.ErrDigestMismatch,
+		},
+		{
+			name:    "should fail reading a corrupted blob by digest alone",
+			damage:  func(path string, size int64) error { return os.WriteFile(path, make([]byte, size), 0644) },
+			unsized: true,
+			wantErr: store.ErrDigestMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := store.NewLayout(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ref := "hello/world:v1"
+			oci := genArtifact(t, ref)
+			if _, err := s.AddOCI(ctx, oci, ref); err != nil {
+				t.Fatal(err)
+			}
+			m, err := oci.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := m.Layers[0]
+			if err := tt.damage(filepath.Join(dir, "blobs", l.Digest.Algorithm, l.Digest.Hex), l.Size); err != nil {
+				t.Fatal(err)
+			}
+
+			desc := ocispec.Descriptor{MediaType: string(l.MediaType), Digest: digest.Digest(l.Digest.String()), Size: l.Size}
+			if tt.unsized {
+				desc.Size = 0
+			}
+			rc, err := s.Fetch(ctx, desc)
+			if err == nil {
+				_, err = io.ReadAll(rc)
+				rc.Close()
+			}
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("Fetch() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLayout_WithVerifier(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newLayout(t, store.WithVerifier(cosign.NewKeyVerifier(&key.PublicKey)))
+
+	img := genArtifact(t, "hello/world:v1").(*mockArtifact)
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigImg := signature(t, key, d)
+
+	tcs := []struct {
+		name    string
+		oci     artifacts.OCI
+		refused bool
+		wantErr error
+	}{
+		{name: "signed", oci: &signedArtifact{OCI: img, sig: &mockArtifact{sigImg}}},
+		{name: "unsigned", oci: img, refused: true, wantErr: store.ErrUnsigned},
+		{name: "signature of another image", oci: &signedArtifact{OCI: genArtifact(t, "other"), sig: &mockArtifact{sigImg}}, refused: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.AddOCI(ctx, tc.oci, "hello/world:"+strings.ReplaceAll(tc.name, " ", "-"))
+			if !tc.refused {
+				if err != nil {
+					t.Fatalf("AddOCI() error = %v", err)
+				}
+				return
+			}
+
+			var perr *store.PolicyError
+			if !errors.As(err, &perr) {
+				t.Fatalf("AddOCI() error = %v, want a *store.PolicyError", err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("AddOCI() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestLayout_WithVerifierAdds(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := store.WithVerifier(cosign.NewKeyVerifier(&key.PublicKey))
+
+	signed := genPlatformImage(t, "linux", "amd64")
+	idx := genIndex(t, "linux/amd64", "linux/arm64")
+	sigRef := func(repo string, v interface{ Digest() (v1.Hash, error) }) (string, v1.Image) {
+		d, err := v.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("%s:%s-%s.sig", repo, d.Algorithm, d.Hex), signature(t, key, d)
+	}
+
+	refused := func(t *testing.T, err error) {
+		t.Helper()
+		var perr *store.PolicyError
+		if !errors.As(err, &perr) || !errors.Is(err, store.ErrUnsigned) {
+			t.Errorf("error = %v, want a *store.PolicyError wrapping ErrUnsigned", err)
+		}
+	}
+
+	policyRefused := func(t *testing.T, err error) {
+		t.Helper()
+		var perr *store.PolicyError
+		if !errors.As(err, &perr) {
+			t.Errorf("error = %v, want a *store.PolicyError", err)
+		}
+	}
+
+	t.Run("AddImage", func(t *testing.T) {
+		s := tempLayout(t, verifier)
+
+		_, err = s.AddImage(ctx, signed, "hello/world:v1")
+		refused(t, err)
+
+		// signatures are attached to what they sign, which has to be stored first
+		ref, sig := sigRef("hello/world", signed)
+		_, err = s.AddImage(ctx, sig, ref)
+		policyRefused(t, err)
+
+		if _, err := s.AddImage(ctx, signedImage{Image: signed, sig: sig}, "hello/world:v1"); err != nil {
+			t.Fatalf("AddImage() of a signed image: %v", err)
+		}
+		if _, err := s.AddImage(ctx, sig, ref); err != nil {
+			t.Fatalf("AddImage() of the signature of a stored image: %v", err)
+		}
+		// and then found by the digest they sign
+		if _, err := s.AddImage(ctx, signed, "hello/world:v1.0"); err != nil {
+			t.Errorf("AddImage() of an image signed in the store: %v", err)
+		}
+
+		// only signatures in the repository the image is added to count
+		_, err = s.AddImage(ctx, signed, "other/world:v1")
+		refused(t, err)
+		_, err = s.AddImage(ctx, genPlatformImage(t, "linux", "arm64"), "hello/world:v2")
+		refused(t, err)
+	})
+
+	t.Run("AddImageIndex", func(t *testing.T) {
+		s := tempLayout(t, verifier)
+
+		_, err = s.AddImageIndex(ctx, idx, "hello/multi:v1")
+		refused(t, err)
+
+		ref, sig := sigRef("hello/multi", idx)
+		if _, err := s.AddImageIndex(ctx, signedIndex{index: idx, sig: sig}, "hello/multi:v1"); err != nil {
+			t.Errorf("AddImageIndex() of a signed index: %v", err)
+		}
+		if _, err := s.AddImage(ctx, sig, ref); err != nil {
+			t.Errorf("AddImage() of the signature of a stored index: %v", err)
+		}
+	})
+
+	t.Run("attachments", func(t *testing.T) {
+		dir := t.TempDir()
+		unverified, err := store.NewLayout(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unsigned := genPlatformImage(t, "linux", "arm64")
+		if _, err := unverified.AddImage(ctx, unsigned, "hello/world:unsigned"); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := store.NewLayout(dir, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref, sig := sigRef("hello/world", signed)
+		if _, err := s.AddImage(ctx, signedImage{Image: signed, sig: sig}, "hello/world:v1"); err != nil {
+			t.Fatal(err)
+		}
+		sbomRef := strings.TrimSuffix(ref, ".sig") + ".sbom"
+		unsignedRef, _ := sigRef("hello/world", unsigned)
+		missingRef, _ := sigRef("hello/world", genPlatformImage(t, "linux", "s390x"))
+
+		tcs := []struct {
+			name string
+			img  v1.Image
+			ref  string
+			ok   bool
+		}{
+			{name: "signature of a stored image", img: sig, ref: ref, ok: true},
+			{name: "sbom of a signed image", img: unsigned, ref: sbomRef, ok: true},
+			{name: "signature of a stored image, that isn't one", img: unsigned, ref: ref},
+			{name: "signature of another image", img: signature(t, key, v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("0", 64)}), ref: ref},
+			{name: "sbom of an unsigned image", img: unsigned, ref: strings.TrimSuffix(unsignedRef, ".sig") + ".sbom"},
+			{name: "signature of an image that isn't stored", img: unsigned, ref: missingRef},
+		}
+		for _, tc := range tcs {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := s.AddImage(ctx, tc.img, tc.ref)
+				if tc.ok {
+					if err != nil {
+						t.Errorf("AddImage() error = %v", err)
+					}
+					return
+				}
+				policyRefused(t, err)
+			})
+		}
+
+		// what's admitted as an attachment is still unsigned under any other reference
+		_, err = s.Tag(ctx, sbomRef, "hello/world:latest")
+		refused(t, err)
+	})
+
+	t.Run("writes", func(t *testing.T) {
+		dir := t.TempDir()
+		unverified, err := store.NewLayout(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := unverified.AddImage(ctx, genPlatformImage(t, "linux", "arm64"), "hello/world:unsigned"); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := store.NewLayout(dir, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var failed []store.Event
+		s.Subscribe(func(e store.Event) {
+			if e.Type == store.EventVerificationFailed {
+				failed = append(failed, e)
+			}
+		})
+		ref, sig := sigRef("hello/world", signed)
+		v1Desc, err := s.AddImage(ctx, signedImage{Image: signed, sig: sig}, "hello/world:v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.AddImage(ctx, sig, ref); err != nil {
+			t.Fatal(err)
+		}
+
+		// tags are verified with the signatures of where they're tagged from
+		if _, err := s.Tag(ctx, "hello/world:v1", "hello/world:stable"); err != nil {
+			t.Errorf("Tag() of a signed image: %v", err)
+		}
+		if _, err := s.Tag(ctx, "hello/world:v1", "other/world:v1"); err != nil {
+			t.Errorf("Tag() of a signed image into another repository: %v", err)
+		}
+
+		_, err = s.Tag(ctx, "hello/world:unsigned", "hello/world:latest")
+		refused(t, err)
+		_, err = s.Tag(ctx, "hello/world:unsigned", ref)
+		policyRefused(t, err)
+
+		// what Mutate and CreateIndex write isn't signed by anyone
+		_, err = s.Mutate(ctx, "hello/world:v1", store.WithAnnotation("org.example.mutated", "true"))
+		refused(t, err)
+		_, err = s.CreateIndex(ctx, "hello/world:multi", "hello/world:v1")
+		refused(t, err)
+
+		if _, desc, err := s.Resolve(ctx, "hello/world:v1"); err != nil || desc.Digest != v1Desc.Digest {
+			t.Errorf("Resolve() of a refused Mutate = %s, %v, want %s", desc.Digest, err, v1Desc.Digest)
+		}
+		for _, r := range []string{"hello/world:latest", "hello/world:multi"} {
+			if _, _, err := s.Resolve(ctx, r); !errors.Is(err, store.ErrRefNotFound) {
+				t.Errorf("Resolve(%s) of a refused write error = %v, want ErrRefNotFound", r, err)
+			}
+		}
+		if len(failed) != 4 {
+			t.Errorf("Subscribe() got %d verification failures, want 4", len(failed))
+		}
+	})
+
+	t.Run("ImportArchive", func(t *testing.T) {
+		// the signature is indexed after the image it signs, 1.0 sorting first
+		src, err := store.NewLayout(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := src.AddImage(ctx, signed, "hello/world:1.0"); err != nil {
+			t.Fatal(err)
+		}
+		ref, sig := sigRef("hello/world", signed)
+		if _, err := src.AddImage(ctx, sig, ref); err != nil {
+			t.Fatal(err)
+		}
+
+		archive := filepath.Join(t.TempDir(), "signed.tar")
+		tarDir(t, root, archive)
+		dst := tempLayout(t, verifier)
+		if _, err := dst.ImportArchive(ctx, archive); err != nil {
+			t.Fatalf("ImportArchive() of signed images: %v", err)
+		}
+		if got := refs(t, dst); strings.Join(got, ",") != "hello/world:1.0,"+ref {
+			t.Errorf("imported references = %v, want [hello/world:1.0 %s]", got, ref)
+		}
+
+		if _, err := src.AddImage(ctx, genPlatformImage(t, "linux", "arm64"), "hello/world:v2"); err != nil {
+			t.Fatal(err)
+		}
+		archive = filepath.Join(t.TempDir(), "unsigned.tar")
+		tarDir(t, root, archive)
+		dst = tempLayout(t, verifier)
+		_, err = dst.ImportArchive(ctx, archive)
+		refused(t, err)
+	})
+}
+
+// signedImage is an image that brings its signatures along, as if pulled from a registry
+type signedImage struct {
+	v1.Image
+	sig v1.Image
+}
+
+func (s signedImage) Signatures() (artifacts.OCI, error) {
+	return mockArtifact{s.sig}, nil
+}
+
+// signedIndex is an index that brings its signatures along, as if pulled from a registry
+type signedIndex struct {
+	index
+	sig v1.Image
+}
+
+func (s signedIndex) Signatures() (artifacts.OCI, error) {
+	return mockArtifact{s.sig}, nil
+}
+
+// signature returns a cosign signature image of the manifest d, signed with key
+func signature(t *testing.T, key *ecdsa.PrivateKey, d v1.Hash) v1.Image {
+	payload := []byte(fmt.Sprintf(`{"critical":{"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"}}`, d))
+	sum := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, types.MediaType(consts.CosignSimpleSigningMediaType)),
+		Annotations: map[string]string{consts.CosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
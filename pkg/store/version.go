@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/rancherfederal/ocil/pkg/consts"
+)
+
+// StoreVersion is the on-disk format version written by this version of the store
+// 	Any change to the on-disk format must bump this and register the migration that gets existing stores there
+const StoreVersion = 1
+
+// migration upgrades a store from one format version to the next
+type migration struct {
+	description string
+	migrate     func(ctx context.Context, l *Layout) error
+}
+
+// migrations are keyed by the version they upgrade from
+var migrations = map[int]migration{}
+
+func registerMigration(from int, description string, fn func(ctx context.Context, l *Layout) error) {
+	if _, ok := migrations[from]; ok {
+		panic(fmt.Sprintf("migration from store version %d registered twice", from))
+	}
+	migrations[from] = migration{description: description, migrate: fn}
+}
+
+func init() {
+	// stores written before versioning was introduced are already in version 1's format, they just need it recorded
+	registerMigration(0, "record the store format version", func(ctx context.Context, l *Layout) error {
+		return nil
+	})
+}
+
+// Version returns the on-disk format version of the store, stores predating versioning are version 0
+func (l *Layout) Version() (int, error) {
+	v, ok := l.OCI.IndexAnnotations()[consts.StoreVersionAnnotation]
+	if !ok {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid store version %q: %w", v, err)
+	}
+	return version, nil
+}
+
+// Migrate upgrades the store's on-disk format to StoreVersion, one registered migration at a time
+// 	The version is recorded after each step, so an interrupted migration resumes from where it left off
+func (l *Layout) Migrate(ctx context.Context) error {
+	if err := l.writable("migrate"); err != nil {
+		return err
+	}
+	if err := l.OCI.LoadIndex(); err != nil {
+		return err
+	}
+
+	v, err := l.Version()
+	if err != nil {
+		return err
+	}
+	if v > StoreVersion {
+		return fmt.Errorf("store version %d is newer than the supported version %d", v, StoreVersion)
+	}
+
+	for ; v < StoreVersion; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return fmt.Errorf("no migration registered from store version %d", v)
+		}
+		if err := m.migrate(ctx, l); err != nil {
+			return fmt.Errorf("migrate store from version %d (%s): %w", v, m.description, err)
+		}
+
+		l.OCI.SetIndexAnnotation(consts.StoreVersionAnnotation, strconv.Itoa(v+1))
+		if err := l.OCI.SaveIndex(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
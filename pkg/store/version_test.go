@@ -0,0 +1,102 @@
+package store_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/rancherfederal/ocil/pkg/store"
+)
+
+func TestLayout_Migrate(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	// a store written before versioning was introduced
+	if err := os.WriteFile(filepath.Join(root, "index.json"), []byte(`{"schemaVersion":2,"manifests":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Version(); err != nil || v != 0 {
+		t.Fatalf("Version() = %d, %v, want 0", v, err)
+	}
+
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := store.NewLayout(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := reopened.Version(); err != nil || v != store.StoreVersion {
+		t.Errorf("Version() after Migrate() = %d, %v, want %d", v, err, store.StoreVersion)
+	}
+}
+
+func TestNewLayout_ImageLayout(t *testing.T) {
+	tcs := []struct {
+		name    string
+		marker  string
+		wantErr bool
+	}{
+		{name: "new"},
+		{name: "compatible", marker: `{"imageLayoutVersion":"1.1.0"}`},
+		{name: "incompatible", marker: `{"imageLayoutVersion":"2.0.0"}`, wantErr: true},
+		{name: "invalid", marker: `not json`, wantErr: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tc.marker != "" {
+				if err := os.WriteFile(filepath.Join(dir, ocispec.ImageLayoutFile), []byte(tc.marker), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := store.NewLayout(dir)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("NewLayout() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				if !errors.Is(err, store.ErrIncompatibleLayout) {
+					t.Errorf("NewLayout() error = %v, want ErrIncompatibleLayout", err)
+				}
+				return
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, ocispec.ImageLayoutFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var layout ocispec.ImageLayout
+			if err := json.Unmarshal(data, &layout); err != nil {
+				t.Fatal(err)
+			}
+			if layout.Version == "" {
+				t.Errorf("%s has no imageLayoutVersion: %s", ocispec.ImageLayoutFile, data)
+			}
+		})
+	}
+
+	// a flushed store gets its marker back as soon as anything is added to it
+	s := newLayout(t)
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddOCI(ctx, genArtifact(t, "app:v1"), "registry.example.com/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ocispec.ImageLayoutFile)); err != nil {
+		t.Errorf("flushed store has no %s after an add: %v", ocispec.ImageLayoutFile, err)
+	}
+}
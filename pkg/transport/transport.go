@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Options configures how remote registries are reached
+type Options func(*config)
+
+type config struct {
+	insecureSkipVerify bool
+	caFiles            []string
+	plainHTTP          bool
+}
+
+// WithInsecureSkipVerify trusts any certificate a registry presents, ie: self-signed certificates in a lab
+func WithInsecureSkipVerify() Options {
+	return func(c *config) {
+		c.insecureSkipVerify = true
+	}
+}
+
+// WithCAFile trusts the PEM encoded certificates in path, in addition to the systems certificate pool
+func WithCAFile(path string) Options {
+	return func(c *config) {
+		c.caFiles = append(c.caFiles, path)
+	}
+}
+
+// WithPlainHTTP speaks plain http to registries, regardless of the scheme a request was made with
+func WithPlainHTTP() Options {
+	return func(c *config) {
+		c.plainHTTP = true
+	}
+}
+
+// New returns an http.RoundTripper reaching registries as configured by opts
+// 	It plugs into store copies with store.WithTransport, and into remote artifacts with remote.WithTransport.
+func New(opts ...Options) (http.RoundTripper, error) {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.insecureSkipVerify,
+	}
+
+	if len(c.caFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			// not every platform exposes its pool, the given CAs are all we can trust there
+			pool = x509.NewCertPool()
+		}
+
+		for _, path := range c.caFiles {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no certificates found in %s", path)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+
+	if c.plainHTTP {
+		return &plainHTTP{next: t}, nil
+	}
+	return t, nil
+}
+
+// plainHTTP downgrades https requests to http before sending them
+type plainHTTP struct {
+	next http.RoundTripper
+}
+
+func (p *plainHTTP) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		req = req.Clone(req.Context())
+		req.URL.Scheme = "http"
+	}
+	return p.next.RoundTrip(req)
+}
@@ -0,0 +1,66 @@
+package transport_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancherfederal/ocil/pkg/transport"
+)
+
+func TestNew(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	bogus := filepath.Join(t.TempDir(), "bogus.pem")
+	if err := os.WriteFile(bogus, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []transport.Options
+		wantErr bool
+		wantOK  bool
+	}{
+		{
+			name:   "should downgrade https to plain http",
+			opts:   []transport.Options{transport.WithPlainHTTP()},
+			wantOK: true,
+		},
+		{
+			name:   "should speak https by default",
+			wantOK: false,
+		},
+		{
+			name:    "should reject a ca file without certificates",
+			opts:    []transport.Options{transport.WithCAFile(bogus)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt, err := transport.New(tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			client := &http.Client{Transport: rt}
+			resp, err := client.Get(strings.Replace(srv.URL, "http://", "https://", 1))
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err == nil) != tt.wantOK {
+				t.Errorf("GET over https error = %v, want success %v", err, tt.wantOK)
+			}
+		})
+	}
+}